@@ -0,0 +1,191 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/ghodss/yaml"
+	"github.com/namsral/flag"
+)
+
+// AgentConfigFlag is the name of the flag that defines the location
+// of the agent-wide config file. The file is a single YAML (or JSON) document
+// with one top-level section per plugin (the key is the plugin name):
+//
+//	etcdv3:
+//	  endpoints:
+//	    - "172.17.0.1:2379"
+//	http:
+//	  endpoint: "0.0.0.0:9191"
+const AgentConfigFlag = "agent-config"
+
+// AgentConfigDefault is the default value of AgentConfigFlag (no agent-wide config file).
+const AgentConfigDefault = ""
+
+// AgentConfigUsage used as a flag usage (see implementation in declareFlags()).
+const AgentConfigUsage = "Location of the agent-wide configuration file with per-plugin sections; " +
+	"also set via 'AGENT_CONFIG' env variable."
+
+// PrintAgentConfigFlag is the name of the flag that enables printing
+// of the effective agent-wide configuration (see PrintAgentConfig())
+// once the plugins of the agent have been initialized (i.e. their
+// configuration has been read and secret fields are known).
+const PrintAgentConfigFlag = "print-agent-config"
+
+// PrintAgentConfigUsage used as a flag usage (see implementation in declareFlags()).
+const PrintAgentConfigUsage = "Print the effective configuration of all plugins once the agent has started; " +
+	"also set via 'PRINT_AGENT_CONFIG' env variable."
+
+// plugins registered by ForPlugin() (by plugin name)
+var (
+	registeredPlugins = map[string]*pluginConfig{}
+	registryLock      sync.Mutex
+)
+
+// registerPlugin remembers the plugin config to include the plugin's own
+// config file in EffectiveAgentConfig().
+func registerPlugin(pluginCfg *pluginConfig) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+
+	registeredPlugins[pluginCfg.pluginName] = pluginCfg
+}
+
+// copyRegisteredPlugins returns a copy of the registered plugins.
+func copyRegisteredPlugins() map[string]*pluginConfig {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+
+	plugins := make(map[string]*pluginConfig, len(registeredPlugins))
+	for pluginName, pluginCfg := range registeredPlugins {
+		plugins[pluginName] = pluginCfg
+	}
+	return plugins
+}
+
+// AgentConfigFile returns the path to the agent-wide config file
+// (empty string if it is not defined or does not exist).
+func AgentConfigFile() string {
+	flg := flag.CommandLine.Lookup(AgentConfigFlag)
+	if flg == nil {
+		return ""
+	}
+	return lookupConfigFile(flg.Value.String())
+}
+
+// PrintAgentConfigEnabled returns true if PrintAgentConfigFlag is set.
+func PrintAgentConfigEnabled() bool {
+	flg := flag.CommandLine.Lookup(PrintAgentConfigFlag)
+	return flg != nil && flg.Value.String() == "true"
+}
+
+// agentConfigSection parses the section of the agent-wide config file
+// named after the plugin and stores the results in <config>.
+func agentConfigSection(pluginName string, config interface{}) (found bool, err error) {
+	sections, err := readAgentConfig()
+	if err != nil {
+		return false, err
+	}
+	section, found := sections[pluginName]
+	if !found {
+		return false, nil
+	}
+	// JSON is a subset of YAML, the same parser as for config files is used
+	if err = yaml.Unmarshal(section, config); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// readAgentConfig reads the agent-wide config file and splits it into
+// the per-plugin sections (in JSON format).
+func readAgentConfig() (sections map[string]json.RawMessage, err error) {
+	path := AgentConfigFile()
+	if path == "" {
+		return nil, nil
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	jsonDoc, err := yaml.YAMLToJSON(b)
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(jsonDoc, &sections); err != nil {
+		return nil, err
+	}
+	return sections, nil
+}
+
+// EffectiveAgentConfig returns the effective agent-wide configuration,
+// i.e. the sections of the agent-wide config file merged with the config
+// files of individual plugins (registered by ForPlugin()). The plugin's
+// own config file replaces its section from the agent-wide config file.
+// References to secrets are not resolved and the values of secret fields
+// of plugins whose configuration has already been read are redacted
+// (see Redact()).
+func EffectiveAgentConfig() (map[string]interface{}, error) {
+	sections, err := readAgentConfig()
+	if err != nil {
+		return nil, err
+	}
+	doc := make(map[string]interface{})
+	for pluginName, section := range sections {
+		var value interface{}
+		if err := json.Unmarshal(section, &value); err != nil {
+			return nil, err
+		}
+		doc[pluginName] = value
+	}
+
+	for pluginName, pluginCfg := range copyRegisteredPlugins() {
+		if cfgName := pluginCfg.GetConfigName(); cfgName != "" {
+			var value interface{}
+			switch err := parseYamlFile(cfgName, &value); {
+			case err == nil:
+				doc[pluginName] = value
+			case !os.IsNotExist(err): // the file may have been removed since the plugin read it
+				return nil, err
+			}
+		}
+		if cfgType := pluginCfg.configType(); cfgType != nil && doc[pluginName] != nil {
+			doc[pluginName] = redactDoc(doc[pluginName], cfgType)
+		}
+	}
+
+	return doc, nil
+}
+
+// PrintAgentConfig writes the effective agent-wide configuration
+// (see EffectiveAgentConfig()) to <w> in YAML format. The output can be used
+// as the agent-wide config file.
+func PrintAgentConfig(w io.Writer) error {
+	doc, err := EffectiveAgentConfig()
+	if err != nil {
+		return err
+	}
+	b, err := yaml.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
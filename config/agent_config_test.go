@@ -0,0 +1,90 @@
+package config_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ligato/cn-infra/config"
+	"github.com/namsral/flag"
+	. "github.com/onsi/gomega"
+)
+
+type sectionConfig struct {
+	Endpoint string   `json:"endpoint"`
+	Servers  []string `json:"servers"`
+}
+
+const agentConfigDoc = `
+sectionplugin:
+  endpoint: "127.0.0.1:9191"
+  servers:
+    - a
+    - b
+overriddenplugin:
+  endpoint: "from agent config"
+`
+
+// resetFlags replaces the flags registered by ForPlugin() and the agent
+// config state with fresh ones; the returned function restores the flags.
+// Without it the flag defaults of the first run (pointing to its temporary
+// directory) would be used when the tests are run repeatedly (-count).
+func resetFlags() (restore func()) {
+	commandLine := flag.CommandLine
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	config.ResetAgentConfig()
+	return func() {
+		flag.CommandLine = commandLine
+		config.ResetAgentConfig()
+	}
+}
+
+func TestAgentConfig(t *testing.T) {
+	RegisterTestingT(t)
+	defer resetFlags()()
+
+	dir, err := ioutil.TempDir("", "agent-config")
+	Expect(err).ShouldNot(HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	agentCfgFile := filepath.Join(dir, "agent.conf")
+	Expect(ioutil.WriteFile(agentCfgFile, []byte(agentConfigDoc), 0644)).To(Succeed())
+	pluginCfgFile := filepath.Join(dir, "overriddenplugin.conf")
+	Expect(ioutil.WriteFile(pluginCfgFile, []byte(`endpoint: "from plugin config"`), 0644)).To(Succeed())
+
+	flag.String(config.AgentConfigFlag, config.AgentConfigDefault, config.AgentConfigUsage)
+	Expect(flag.Set(config.AgentConfigFlag, agentCfgFile)).To(Succeed())
+
+	// section of the agent config file
+	var cfg sectionConfig
+	found, err := config.ForPlugin("sectionplugin").GetValue(&cfg)
+	Expect(err).ShouldNot(HaveOccurred())
+	Expect(found).Should(BeTrue())
+	Expect(cfg).Should(Equal(sectionConfig{Endpoint: "127.0.0.1:9191", Servers: []string{"a", "b"}}))
+
+	// plugin's own config file wins
+	cfg = sectionConfig{}
+	found, err = config.ForPlugin("overriddenplugin", pluginCfgFile).GetValue(&cfg)
+	Expect(err).ShouldNot(HaveOccurred())
+	Expect(found).Should(BeTrue())
+	Expect(cfg.Endpoint).Should(Equal("from plugin config"))
+
+	// no section
+	found, err = config.ForPlugin("missingplugin").GetValue(&cfg)
+	Expect(err).ShouldNot(HaveOccurred())
+	Expect(found).Should(BeFalse())
+
+	// merged document
+	doc, err := config.EffectiveAgentConfig()
+	Expect(err).ShouldNot(HaveOccurred())
+	Expect(doc).Should(HaveKeyWithValue("overriddenplugin",
+		map[string]interface{}{"endpoint": "from plugin config"}))
+	Expect(doc).Should(HaveKey("sectionplugin"))
+	Expect(doc).ShouldNot(HaveKey("missingplugin"))
+
+	var out bytes.Buffer
+	Expect(config.PrintAgentConfig(&out)).To(Succeed())
+	Expect(out.String()).Should(ContainSubstring("endpoint: from plugin config"))
+}
@@ -0,0 +1,234 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvListSeparator separates items of slices and maps in environment variables
+// (e.g. KAFKA_ADDRS=host1:9092,host2:9092; items of maps are key=value pairs).
+const EnvListSeparator = ","
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// EnvName returns the name of the environment variable for the given
+// (plugin name or field name) parts: the parts are upper-cased,
+// dashes and dots are replaced with underscores, and they are joined with
+// underscores (e.g. "etcd", "dial-timeout" => ETCD_DIAL_TIMEOUT).
+func EnvName(parts ...string) string {
+	replacer := strings.NewReplacer("-", "_", ".", "_")
+	var names []string
+	for _, part := range parts {
+		if part != "" {
+			names = append(names, strings.ToUpper(replacer.Replace(part)))
+		}
+	}
+	return strings.Join(names, "_")
+}
+
+// ApplyEnvOverrides overrides fields of the configuration <cfg> (pointer to a struct)
+// with the values of environment variables. The name of the variable is derived
+// from the <prefix> and the json names of the fields (see EnvName()),
+// e.g. ETCD_DIAL_TIMEOUT for the field tagged `json:"dial-timeout"` and
+// prefix "etcd". Fields of nested structs are named after all enclosing
+// fields (e.g. KAFKA_TLS_ENABLED). Durations are parsed by time.ParseDuration()
+// (a plain number is taken as nanoseconds), items of slices and maps are separated
+// by EnvListSeparator.
+// The function returns true if any field was overridden.
+func ApplyEnvOverrides(prefix string, cfg interface{}) (applied bool, err error) {
+	val := reflect.ValueOf(cfg)
+	if val.Kind() != reflect.Ptr || val.IsNil() {
+		return false, fmt.Errorf("config must be a non-nil pointer, got %T", cfg)
+	}
+	if val.Elem().Kind() != reflect.Struct {
+		return false, nil // only fields of structs can be overridden
+	}
+	return applyEnvToValue(EnvName(prefix), val.Elem())
+}
+
+// applyEnvToValue overrides the value (or its fields) from the environment variable <envName>.
+func applyEnvToValue(envName string, val reflect.Value) (applied bool, err error) {
+	switch {
+	case val.Kind() == reflect.Struct:
+		return applyEnvToStruct(envName, val)
+	case val.Kind() == reflect.Ptr && val.Type().Elem().Kind() == reflect.Struct:
+		// allocate the struct only if any of its fields is overridden
+		elem := reflect.New(val.Type().Elem())
+		if !val.IsNil() {
+			elem.Elem().Set(val.Elem())
+		}
+		if applied, err = applyEnvToStruct(envName, elem.Elem()); applied && err == nil {
+			val.Set(elem)
+		}
+		return applied, err
+	}
+
+	envVal, found := os.LookupEnv(envName)
+	if !found {
+		return false, nil
+	}
+	if err := setFromString(val, envVal); err != nil {
+		return false, fmt.Errorf("invalid value of %s: %v", envName, err)
+	}
+	return true, nil
+}
+
+// applyEnvToStruct overrides the exported fields of the struct.
+func applyEnvToStruct(envName string, val reflect.Value) (applied bool, err error) {
+	typ := val.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.PkgPath != "" {
+			continue // unexported
+		}
+		name, ok := jsonFieldName(field)
+		if !ok {
+			continue
+		}
+		fieldEnvName := EnvName(envName, name)
+		if field.Anonymous && name == "" {
+			// fields of embedded structs are promoted
+			fieldEnvName = envName
+		}
+		fieldApplied, err := applyEnvToValue(fieldEnvName, val.Field(i))
+		if err != nil {
+			return applied, err
+		}
+		applied = applied || fieldApplied
+	}
+	return applied, nil
+}
+
+// jsonFieldName returns the name of the field as used by encoding/json
+// (empty for embedded structs without a tag) and false if the field is ignored.
+func jsonFieldName(field reflect.StructField) (name string, ok bool) {
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", false
+	}
+	name = strings.Split(tag, ",")[0]
+	if name == "" && !(field.Anonymous && indirectType(field.Type).Kind() == reflect.Struct) {
+		name = field.Name
+	}
+	return name, true
+}
+
+// indirectType returns the type the pointer type points to.
+func indirectType(typ reflect.Type) reflect.Type {
+	if typ.Kind() == reflect.Ptr {
+		return typ.Elem()
+	}
+	return typ
+}
+
+// setFromString converts the string into the type of the value and sets it.
+func setFromString(val reflect.Value, str string) error {
+	if val.Type() == durationType {
+		duration, err := time.ParseDuration(str)
+		if err != nil {
+			// plain number of nanoseconds (as in the config files)
+			nanos, numErr := strconv.ParseInt(str, 10, 64)
+			if numErr != nil {
+				return err
+			}
+			duration = time.Duration(nanos)
+		}
+		val.SetInt(int64(duration))
+		return nil
+	}
+
+	switch val.Kind() {
+	case reflect.String:
+		val.SetString(str)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(str)
+		if err != nil {
+			return err
+		}
+		val.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(str, 10, val.Type().Bits())
+		if err != nil {
+			return err
+		}
+		val.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(str, 10, val.Type().Bits())
+		if err != nil {
+			return err
+		}
+		val.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(str, val.Type().Bits())
+		if err != nil {
+			return err
+		}
+		val.SetFloat(f)
+	case reflect.Slice:
+		items := splitList(str)
+		slice := reflect.MakeSlice(val.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := setFromString(slice.Index(i), item); err != nil {
+				return err
+			}
+		}
+		val.Set(slice)
+	case reflect.Map:
+		m := reflect.MakeMap(val.Type())
+		for _, item := range splitList(str) {
+			kv := strings.SplitN(item, "=", 2)
+			if len(kv) != 2 {
+				return fmt.Errorf("invalid map item '%s', expected 'key=value'", item)
+			}
+			key := reflect.New(val.Type().Key()).Elem()
+			if err := setFromString(key, kv[0]); err != nil {
+				return err
+			}
+			value := reflect.New(val.Type().Elem()).Elem()
+			if err := setFromString(value, kv[1]); err != nil {
+				return err
+			}
+			m.SetMapIndex(key, value)
+		}
+		val.Set(m)
+	case reflect.Ptr:
+		elem := reflect.New(val.Type().Elem())
+		if err := setFromString(elem.Elem(), str); err != nil {
+			return err
+		}
+		val.Set(elem)
+	default:
+		return fmt.Errorf("unsupported type %v", val.Type())
+	}
+	return nil
+}
+
+// splitList splits the list of items (empty string is an empty list).
+func splitList(str string) []string {
+	if strings.TrimSpace(str) == "" {
+		return nil
+	}
+	items := strings.Split(str, EnvListSeparator)
+	for i := range items {
+		items[i] = strings.TrimSpace(items[i])
+	}
+	return items
+}
@@ -0,0 +1,112 @@
+package config_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ligato/cn-infra/config"
+	. "github.com/onsi/gomega"
+)
+
+type tlsConfig struct {
+	Enabled bool   `json:"enabled"`
+	CAfile  string `json:"ca-file"`
+}
+
+type envConfig struct {
+	Endpoints   []string          `json:"endpoints"`
+	DialTimeout time.Duration     `json:"dial-timeout"`
+	OpTimeout   time.Duration     `json:"operation-timeout"`
+	Retries     int               `json:"retries"`
+	Insecure    bool              `json:"insecure-transport"`
+	TLS         tlsConfig         `json:"tls"`
+	Auth        *tlsConfig        `json:"auth"`
+	Labels      map[string]string `json:"labels"`
+	Ignored     string            `json:"-"`
+	NoTag       string
+}
+
+func setEnv(vars map[string]string) (unset func()) {
+	for name, value := range vars {
+		os.Setenv(name, value)
+	}
+	return func() {
+		for name := range vars {
+			os.Unsetenv(name)
+		}
+	}
+}
+
+func TestApplyEnvOverrides(t *testing.T) {
+	RegisterTestingT(t)
+
+	defer setEnv(map[string]string{
+		"ENVPLUGIN_ENDPOINTS":          "a:2379, b:2379",
+		"ENVPLUGIN_DIAL_TIMEOUT":       "2s",
+		"ENVPLUGIN_OPERATION_TIMEOUT":  "500",
+		"ENVPLUGIN_RETRIES":            "3",
+		"ENVPLUGIN_INSECURE_TRANSPORT": "true",
+		"ENVPLUGIN_TLS_CA_FILE":        "/ca.pem",
+		"ENVPLUGIN_AUTH_ENABLED":       "true",
+		"ENVPLUGIN_LABELS":             "k1=v1,k2=v2",
+		"ENVPLUGIN_IGNORED":            "x",
+		"ENVPLUGIN_NOTAG":              "y",
+	})()
+
+	cfg := envConfig{Retries: 1, TLS: tlsConfig{Enabled: true}}
+	applied, err := config.ApplyEnvOverrides("envplugin", &cfg)
+	Expect(err).ShouldNot(HaveOccurred())
+	Expect(applied).Should(BeTrue())
+
+	Expect(cfg.Endpoints).Should(Equal([]string{"a:2379", "b:2379"}))
+	Expect(cfg.DialTimeout).Should(Equal(2 * time.Second))
+	Expect(cfg.OpTimeout).Should(Equal(500 * time.Nanosecond))
+	Expect(cfg.Retries).Should(Equal(3))
+	Expect(cfg.Insecure).Should(BeTrue())
+	Expect(cfg.TLS).Should(Equal(tlsConfig{Enabled: true, CAfile: "/ca.pem"}))
+	Expect(cfg.Auth).Should(Equal(&tlsConfig{Enabled: true}))
+	Expect(cfg.Labels).Should(Equal(map[string]string{"k1": "v1", "k2": "v2"}))
+	Expect(cfg.Ignored).Should(BeEmpty())
+	Expect(cfg.NoTag).Should(Equal("y"))
+}
+
+func TestApplyEnvOverridesInvalid(t *testing.T) {
+	RegisterTestingT(t)
+
+	defer setEnv(map[string]string{"ENVPLUGIN_RETRIES": "many"})()
+
+	var cfg envConfig
+	_, err := config.ApplyEnvOverrides("envplugin", &cfg)
+	Expect(err).Should(HaveOccurred())
+	Expect(err.Error()).Should(ContainSubstring("ENVPLUGIN_RETRIES"))
+}
+
+func TestGetValueWithEnvOverrides(t *testing.T) {
+	RegisterTestingT(t)
+
+	defer setEnv(map[string]string{
+		"ENV_ONLY_PLUGIN_ENABLED":      "true",
+		"ENV_ONLY_PLUGIN_DIAL_TIMEOUT": "1m",
+	})()
+
+	// no config file, configuration comes from the environment only
+	var cfg envConfig
+	found, err := config.ForPlugin("env-only-plugin").GetValue(&cfg)
+	Expect(err).ShouldNot(HaveOccurred())
+	Expect(found).Should(BeTrue())
+	Expect(cfg.DialTimeout).Should(Equal(time.Minute))
+}
+
+func TestGetValueEnvOverridesNotEnabled(t *testing.T) {
+	RegisterTestingT(t)
+
+	defer setEnv(map[string]string{"ENV_DISABLED_PLUGIN_DIAL_TIMEOUT": "1m"})()
+
+	// no config file and the plugin is not enabled from the environment
+	cfg := validatedConfig{Name: "preset"}
+	found, err := config.ForPlugin("env-disabled-plugin").GetValue(&cfg)
+	Expect(err).ShouldNot(HaveOccurred())
+	Expect(found).Should(BeFalse())
+	Expect(cfg).Should(Equal(validatedConfig{Name: "preset"}))
+}
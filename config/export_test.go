@@ -0,0 +1,27 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+// ResetAgentConfig forgets the plugins registered by ForPlugin() and their
+// load statuses (used by tests that run more than once in a process).
+func ResetAgentConfig() {
+	registryLock.Lock()
+	registeredPlugins = map[string]*pluginConfig{}
+	registryLock.Unlock()
+
+	loadStatusesLock.Lock()
+	loadStatuses = map[string]LoadStatus{}
+	loadStatusesLock.Unlock()
+}
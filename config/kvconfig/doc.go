@@ -0,0 +1,38 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package kvconfig provides the configuration of plugins stored in
+// a key-value data store (etcd, Redis, Consul) instead of local config files.
+//
+// The configuration of a plugin is a YAML (or JSON) document stored under
+// the key:
+//
+//	servicelabel.GetAgentPrefix() + "config/" + <plugin name>
+//
+// The plugin returns config.PluginConfig for other plugins of the agent:
+//
+//	kvConfig := &kvconfig.Plugin{Deps: kvconfig.Deps{
+//	    ServiceLabel: &flavor.ServiceLabel,
+//	    KvPlugin:     &flavor.ETCD,
+//	}}
+//	flavor.Foo.PluginConfig = kvConfig.ForPlugin("foo")
+//
+// The injected configuration is a core.ProvidedDependency, the agent therefore
+// initializes the plugin after the kvconfig plugin and its data store.
+// The document is read when the plugin calls GetValue(). If the data store
+// is not available (disabled, unreachable) or the key does not exist,
+// the local config file of the plugin is used instead (see config.ForPlugin()).
+// Once read, the key is watched and every change triggers the reload
+// of the configuration of all Reloadable plugins (see core.Agent.Reload()).
+package kvconfig
@@ -0,0 +1,86 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvconfig
+
+import (
+	"errors"
+
+	"github.com/ligato/cn-infra/config"
+	"github.com/ligato/cn-infra/core"
+)
+
+var (
+	// errDataStoreNotAvailable is returned by Plugin.read() if no data store
+	// is injected.
+	errDataStoreNotAvailable = errors.New("data store not available")
+	// errDataStoreNotReady is returned by Plugin.read() if the data store
+	// is disabled or not initialized yet.
+	errDataStoreNotReady = errors.New("data store disabled or not initialized")
+)
+
+// pluginConfig implements config.PluginConfig with the configuration
+// stored in the data store.
+type pluginConfig struct {
+	source     *Plugin
+	pluginName string
+	// fallback config file
+	local config.PluginConfig
+}
+
+// GetValue parses the configuration of the plugin stored in the data store
+// (see config.ParsePluginConfig()). The local config file is used if the data store
+// is not available or the configuration is not stored there.
+// The result is recorded by config.ReportLoadStatus().
+func (p *pluginConfig) GetValue(cfg interface{}) (found bool, err error) {
+	data, found, err := p.source.read(p.pluginName)
+	if err != nil {
+		if err == errDataStoreNotAvailable {
+			p.source.Log.Debugf("Configuration of %s read from local file: %v", p.pluginName, err)
+		} else if err == errDataStoreNotReady {
+			p.source.Log.Warnf("Configuration of %s read from local file: %v", p.pluginName, err)
+		} else {
+			p.source.Log.Warnf("Configuration of %s read from local file, data store unreachable: %v",
+				p.pluginName, err)
+		}
+		return p.local.GetValue(cfg)
+	}
+	if !found {
+		p.source.Log.Debugf("Configuration of %s not found in data store, reading local file", p.pluginName)
+		return p.local.GetValue(cfg)
+	}
+
+	status := config.LoadStatus{PluginName: p.pluginName, Source: config.SourceKV, Key: p.source.Key(p.pluginName)}
+	if err = config.ParsePluginConfig(p.pluginName, data, cfg); err != nil {
+		status.Error = err.Error()
+		config.ReportLoadStatus(status)
+		return false, err
+	}
+	status.Found = true
+	status.Config, _ = config.Redact(cfg)
+	config.ReportLoadStatus(status)
+	return true, nil
+}
+
+// ProvidedBy returns the kvconfig plugin, so that the agent initializes
+// the plugin reading the configuration after the kvconfig plugin
+// (and thus after the data store plugin).
+func (p *pluginConfig) ProvidedBy() core.Plugin {
+	return p.source
+}
+
+// GetConfigName returns the name of the local (fallback) config file.
+func (p *pluginConfig) GetConfigName() string {
+	return p.local.GetConfigName()
+}
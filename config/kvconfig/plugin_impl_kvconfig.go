@@ -0,0 +1,154 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvconfig
+
+import (
+	"sync"
+
+	"github.com/ligato/cn-infra/config"
+	"github.com/ligato/cn-infra/core"
+	"github.com/ligato/cn-infra/db/keyval"
+	"github.com/ligato/cn-infra/flavors/local"
+	"github.com/ligato/cn-infra/servicelabel"
+	"github.com/ligato/cn-infra/utils/safeclose"
+)
+
+// ConfigPrefix is the prefix (relative to the agent prefix) of the keys
+// under which the configuration of plugins is stored.
+const ConfigPrefix = "config/"
+
+// Plugin provides the configuration of other plugins stored in a key-value
+// data store and watches it for changes.
+type Plugin struct {
+	Deps
+
+	access sync.Mutex
+	// close channels of watched keys
+	watched map[string]chan string
+	// used to reload the configuration of plugins after change
+	lifecycle core.LifecycleWatcher
+}
+
+// Deps lists dependencies of the kvconfig plugin.
+type Deps struct {
+	local.PluginLogDeps                        // inject
+	ServiceLabel        servicelabel.ReaderAPI // inject
+	KvPlugin            keyval.KvRawAccess     // inject
+}
+
+// Init does nothing, the configuration is read on demand.
+func (plugin *Plugin) Init() error {
+	return nil
+}
+
+// Close stops watching of the configuration.
+func (plugin *Plugin) Close() error {
+	plugin.access.Lock()
+	defer plugin.access.Unlock()
+
+	var closeChans []interface{}
+	for _, closeChan := range plugin.watched {
+		closeChans = append(closeChans, closeChan)
+	}
+	plugin.watched = nil
+	return safeclose.Close(closeChans...)
+}
+
+// SetLifecycleWatcher stores the agent that is asked to reload
+// the configuration of plugins when it changes in the data store.
+func (plugin *Plugin) SetLifecycleWatcher(watcher core.LifecycleWatcher) {
+	plugin.access.Lock()
+	defer plugin.access.Unlock()
+
+	plugin.lifecycle = watcher
+}
+
+// Key returns the key under which the configuration of the plugin is stored.
+func (plugin *Plugin) Key(pluginName string) string {
+	return plugin.ServiceLabel.GetAgentPrefix() + ConfigPrefix + pluginName
+}
+
+// ForPlugin returns the configuration of the plugin <pluginName> to be injected
+// into the plugin. The options <opts> define the local config file used as
+// a fallback (see config.ForPlugin()).
+func (plugin *Plugin) ForPlugin(pluginName string, opts ...string) config.PluginConfig {
+	return &pluginConfig{
+		source:     plugin,
+		pluginName: pluginName,
+		local:      config.ForPlugin(pluginName, opts...),
+	}
+}
+
+// read loads the configuration document of the plugin from the data store
+// and starts watching it. errDataStoreNotAvailable is returned if there is no
+// data store, errDataStoreNotReady if it is disabled or not initialized yet.
+func (plugin *Plugin) read(pluginName string) (data []byte, found bool, err error) {
+	if plugin.KvPlugin == nil {
+		return nil, false, errDataStoreNotAvailable
+	}
+	db := plugin.KvPlugin.RawAccess()
+	if db == nil {
+		return nil, false, errDataStoreNotReady
+	}
+
+	key := plugin.Key(pluginName)
+	data, found, _, err = db.NewBroker(keyval.Root).GetValue(key)
+	if err != nil {
+		return nil, false, err
+	}
+	plugin.watch(db, key)
+	return data, found, nil
+}
+
+// watch starts watching of the key (if not watched yet).
+func (plugin *Plugin) watch(db keyval.KvBytesPlugin, key string) {
+	plugin.access.Lock()
+	defer plugin.access.Unlock()
+
+	if _, watched := plugin.watched[key]; watched {
+		return
+	}
+	closeChan := make(chan string)
+	err := db.NewWatcher(keyval.Root).Watch(func(resp keyval.BytesWatchResp) {
+		// the watch is prefix-based, ignore keys of other plugins with the same prefix
+		if resp.GetKey() == key {
+			plugin.changed(key, resp.GetRevision())
+		}
+	}, closeChan, key)
+	if err != nil {
+		plugin.Log.Warnf("Unable to watch configuration %s: %v", key, err)
+		return
+	}
+	if plugin.watched == nil {
+		plugin.watched = make(map[string]chan string)
+	}
+	plugin.watched[key] = closeChan
+}
+
+// changed reloads the configuration of the plugins after the change of the key.
+func (plugin *Plugin) changed(key string, rev int64) {
+	plugin.access.Lock()
+	lifecycle := plugin.lifecycle
+	plugin.access.Unlock()
+
+	plugin.Log.Infof("Configuration %s changed (revision %d)", key, rev)
+	if lifecycle == nil {
+		plugin.Log.Warnf("Changed configuration %s not applied, agent not available", key)
+		return
+	}
+	if err := lifecycle.Reload(); err != nil {
+		plugin.Log.Errorf("Failed to apply changed configuration %s: %v", key, err)
+	}
+}
@@ -0,0 +1,271 @@
+package kvconfig_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ligato/cn-infra/config"
+	"github.com/ligato/cn-infra/config/kvconfig"
+	"github.com/ligato/cn-infra/core"
+	"github.com/ligato/cn-infra/datasync"
+	"github.com/ligato/cn-infra/db/keyval"
+	"github.com/ligato/cn-infra/flavors/local"
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+	"github.com/ligato/cn-infra/servicelabel"
+	"github.com/namsral/flag"
+	. "github.com/onsi/gomega"
+)
+
+type testConfig struct {
+	Endpoint string `json:"endpoint"`
+	Retries  int    `json:"retries" default:"3"`
+}
+
+// fakeStore is an in-memory data store of config documents.
+type fakeStore struct {
+	keyval.BytesBroker // only GetValue is implemented
+	sync.Mutex
+	disabled bool
+	err      error
+	docs     map[string][]byte
+	watchers []func(keyval.BytesWatchResp)
+}
+
+func (store *fakeStore) RawAccess() keyval.KvBytesPlugin {
+	if store.disabled {
+		return nil
+	}
+	return store
+}
+
+func (store *fakeStore) NewBroker(prefix string) keyval.BytesBroker {
+	return store
+}
+
+func (store *fakeStore) NewWatcher(prefix string) keyval.BytesWatcher {
+	return store
+}
+
+func (store *fakeStore) GetValue(key string) (data []byte, found bool, revision int64, err error) {
+	store.Lock()
+	defer store.Unlock()
+	data, found = store.docs[key]
+	return data, found, 1, store.err
+}
+
+func (store *fakeStore) Watch(resp func(keyval.BytesWatchResp), closeChan chan string, keys ...string) error {
+	store.Lock()
+	defer store.Unlock()
+	store.watchers = append(store.watchers, resp)
+	return nil
+}
+
+func (store *fakeStore) put(key string, data []byte) {
+	store.Lock()
+	store.docs[key] = data
+	watchers := store.watchers
+	store.Unlock()
+	for _, watcher := range watchers {
+		watcher(&watchResp{key: key, value: data})
+	}
+}
+
+type watchResp struct {
+	key   string
+	value []byte
+}
+
+func (resp *watchResp) GetKey() string                 { return resp.key }
+func (resp *watchResp) GetValue() []byte               { return resp.value }
+func (resp *watchResp) GetPrevValue() []byte           { return nil }
+func (resp *watchResp) GetRevision() int64             { return 2 }
+func (resp *watchResp) GetChangeType() datasync.PutDel { return datasync.Put }
+
+// reloadCounter counts reloads requested from the agent.
+type reloadCounter struct {
+	core.LifecycleWatcher // only Reload is implemented
+	sync.Mutex
+	reloads int
+}
+
+func (counter *reloadCounter) Reload() error {
+	counter.Lock()
+	defer counter.Unlock()
+	counter.reloads++
+	return nil
+}
+
+func (counter *reloadCounter) count() int {
+	counter.Lock()
+	defer counter.Unlock()
+	return counter.reloads
+}
+
+func newPlugin(store *fakeStore) *kvconfig.Plugin {
+	return &kvconfig.Plugin{Deps: kvconfig.Deps{
+		PluginLogDeps: local.PluginLogDeps{Log: logging.ForPlugin("kvconfig", logrus.NewLogRegistry()), PluginName: "kvconfig"},
+		ServiceLabel:  servicelabel.OfDifferentAgent("agent1"),
+		KvPlugin:      store,
+	}}
+}
+
+func TestGetValueFromStore(t *testing.T) {
+	RegisterTestingT(t)
+
+	store := &fakeStore{docs: map[string][]byte{
+		"/vnf-agent/agent1/config/kvplugin": []byte("endpoint: 10.0.0.1:9191\n"),
+	}}
+	plugin := newPlugin(store)
+	Expect(plugin.Key("kvplugin")).Should(Equal("/vnf-agent/agent1/config/kvplugin"))
+
+	var cfg testConfig
+	found, err := plugin.ForPlugin("kvplugin").GetValue(&cfg)
+	Expect(err).ShouldNot(HaveOccurred())
+	Expect(found).Should(BeTrue())
+	Expect(cfg).Should(Equal(testConfig{Endpoint: "10.0.0.1:9191", Retries: 3}))
+
+	status, found := config.GetLoadStatus("kvplugin")
+	Expect(found).Should(BeTrue())
+	Expect(status.Source).Should(Equal(config.SourceKV))
+	Expect(status.Key).Should(Equal("/vnf-agent/agent1/config/kvplugin"))
+	Expect(status.Config).Should(HaveKeyWithValue("endpoint", "10.0.0.1:9191"))
+}
+
+func TestGetValueFallback(t *testing.T) {
+	RegisterTestingT(t)
+
+	dir, err := ioutil.TempDir("", "kvconfig")
+	Expect(err).ShouldNot(HaveOccurred())
+	defer os.RemoveAll(dir)
+	cfgFile := filepath.Join(dir, "fallback.conf")
+	Expect(ioutil.WriteFile(cfgFile, []byte("endpoint: localhost:9191\n"), 0644)).To(Succeed())
+
+	// store disabled
+	store := &fakeStore{disabled: true, docs: map[string][]byte{}}
+	pluginCfg := newPlugin(store).ForPlugin("fallbackplugin", cfgFile)
+	Expect(flag.Set("fallbackplugin"+config.FlagSuffix, cfgFile)).To(Succeed()) // declared by a previous run
+	var cfg testConfig
+	found, err := pluginCfg.GetValue(&cfg)
+	Expect(err).ShouldNot(HaveOccurred())
+	Expect(found).Should(BeTrue())
+	Expect(cfg.Endpoint).Should(Equal("localhost:9191"))
+	Expect(pluginCfg.GetConfigName()).Should(Equal(cfgFile))
+
+	// store unreachable
+	store = &fakeStore{err: errors.New("connection refused"), docs: map[string][]byte{}}
+	cfg = testConfig{}
+	found, err = newPlugin(store).ForPlugin("fallbackplugin", cfgFile).GetValue(&cfg)
+	Expect(err).ShouldNot(HaveOccurred())
+	Expect(found).Should(BeTrue())
+	Expect(cfg.Endpoint).Should(Equal("localhost:9191"))
+
+	// configuration not stored
+	store = &fakeStore{docs: map[string][]byte{}}
+	cfg = testConfig{}
+	found, err = newPlugin(store).ForPlugin("fallbackplugin", cfgFile).GetValue(&cfg)
+	Expect(err).ShouldNot(HaveOccurred())
+	Expect(found).Should(BeTrue())
+	Expect(cfg.Endpoint).Should(Equal("localhost:9191"))
+}
+
+func TestWatchTriggersReload(t *testing.T) {
+	RegisterTestingT(t)
+
+	const key = "/vnf-agent/agent1/config/watchedplugin"
+	store := &fakeStore{docs: map[string][]byte{key: []byte("endpoint: a:1\n")}}
+	plugin := newPlugin(store)
+	counter := &reloadCounter{}
+	plugin.SetLifecycleWatcher(counter)
+	pluginCfg := plugin.ForPlugin("watchedplugin")
+
+	var cfg testConfig
+	_, err := pluginCfg.GetValue(&cfg)
+	Expect(err).ShouldNot(HaveOccurred())
+	// the second read does not start another watch
+	_, err = pluginCfg.GetValue(&cfg)
+	Expect(err).ShouldNot(HaveOccurred())
+	Expect(store.watchers).Should(HaveLen(1))
+
+	store.put(key, []byte("endpoint: b:1\n"))
+	Expect(counter.count()).Should(Equal(1))
+	cfg = testConfig{}
+	_, err = pluginCfg.GetValue(&cfg)
+	Expect(err).ShouldNot(HaveOccurred())
+	Expect(cfg.Endpoint).Should(Equal("b:1"))
+
+	// change of a key with the same prefix is ignored
+	store.put(key+"2", []byte("endpoint: c:1\n"))
+	Expect(counter.count()).Should(Equal(1))
+
+	Expect(plugin.Close()).To(Succeed())
+}
+
+// storePlugin is a data store plugin available once initialized.
+type storePlugin struct {
+	*fakeStore
+	initialized bool
+}
+
+func (store *storePlugin) Init() error {
+	store.initialized = true
+	return nil
+}
+
+func (store *storePlugin) Close() error {
+	return nil
+}
+
+func (store *storePlugin) RawAccess() keyval.KvBytesPlugin {
+	if !store.initialized {
+		return nil
+	}
+	return store.fakeStore.RawAccess()
+}
+
+// consumerPlugin reads its configuration in Init().
+type consumerPlugin struct {
+	Deps struct {
+		config.PluginConfig
+	}
+	cfg testConfig
+}
+
+func (plugin *consumerPlugin) Init() error {
+	_, err := plugin.Deps.GetValue(&plugin.cfg)
+	return err
+}
+
+func (plugin *consumerPlugin) Close() error {
+	return nil
+}
+
+func TestAgentInitOrder(t *testing.T) {
+	RegisterTestingT(t)
+
+	store := &storePlugin{fakeStore: &fakeStore{docs: map[string][]byte{
+		"/vnf-agent/agent1/config/consumer": []byte("endpoint: 10.0.0.1:9191\n"),
+	}}}
+	kvConfig := newPlugin(store.fakeStore)
+	kvConfig.KvPlugin = store
+	consumer := &consumerPlugin{}
+	consumer.Deps.PluginConfig = kvConfig.ForPlugin("consumer")
+
+	// the consumer is listed first, but initialized after the data store
+	agent := core.NewAgentDeprecated(logrus.DefaultLogger(), time.Second,
+		&core.NamedPlugin{PluginName: "consumer", Plugin: consumer},
+		&core.NamedPlugin{PluginName: "kvconfig", Plugin: kvConfig},
+		&core.NamedPlugin{PluginName: "store", Plugin: store})
+	Expect(agent.Start()).To(Succeed())
+	defer agent.Stop()
+
+	Expect(consumer.cfg.Endpoint).Should(Equal("10.0.0.1:9191"))
+	status, found := config.GetLoadStatus("consumer")
+	Expect(found).Should(BeTrue())
+	Expect(status.Source).Should(Equal(config.SourceKV))
+}
@@ -0,0 +1,132 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Source identifies where the configuration of a plugin was loaded from.
+type Source string
+
+const (
+	// SourceFlag is the config file defined by the command-line flag
+	// <plugin>-config.
+	SourceFlag Source = "flag"
+	// SourceEnv is the config file defined by the environment variable
+	// <PLUGIN>_CONFIG.
+	SourceEnv Source = "env"
+	// SourceDefault is the default config file of the plugin.
+	SourceDefault Source = "default"
+	// SourceAgentConfig is the section of the agent-wide config file.
+	SourceAgentConfig Source = "agent-config"
+	// SourceKV is the document stored in a key-value data store.
+	SourceKV Source = "kv"
+	// SourceNone means that no configuration was found (only defaults
+	// and environment overrides, if any, were applied).
+	SourceNone Source = "none"
+)
+
+// LoadStatus describes the last load of the configuration of a plugin.
+type LoadStatus struct {
+	PluginName string `json:"plugin"`
+	Source     Source `json:"source"`
+	// File is the resolved path to the config file.
+	File string `json:"file,omitempty"`
+	// Key is the key of the document in a key-value data store.
+	Key   string `json:"key,omitempty"`
+	Found bool   `json:"found"`
+	// EnvOverrides is true if any field was overridden from the environment.
+	EnvOverrides bool `json:"env-overrides,omitempty"`
+	// Error that occurred while loading the configuration.
+	Error string `json:"error,omitempty"`
+	// Config is the final configuration with secret fields redacted (see Redact()).
+	Config   interface{} `json:"config,omitempty"`
+	LoadedAt time.Time   `json:"loaded-at"`
+}
+
+// statuses of configuration of plugins (by plugin name)
+var (
+	loadStatuses     = map[string]LoadStatus{}
+	loadStatusesLock sync.Mutex
+)
+
+// ReportLoadStatus records the status of the configuration of a plugin.
+// It is called by GetValue() and it is meant to be called by other
+// implementations of PluginConfig (e.g. configuration stored in a data store).
+func ReportLoadStatus(status LoadStatus) {
+	if status.LoadedAt.IsZero() {
+		status.LoadedAt = time.Now()
+	}
+
+	loadStatusesLock.Lock()
+	defer loadStatusesLock.Unlock()
+
+	loadStatuses[status.PluginName] = status
+}
+
+// GetLoadStatus returns the status of the last load of the configuration
+// of the plugin.
+func GetLoadStatus(pluginName string) (status LoadStatus, found bool) {
+	loadStatusesLock.Lock()
+	defer loadStatusesLock.Unlock()
+
+	status, found = loadStatuses[pluginName]
+	return status, found
+}
+
+// LoadStatuses returns the statuses of configuration of all plugins
+// (sorted by plugin name).
+func LoadStatuses() []LoadStatus {
+	loadStatusesLock.Lock()
+	defer loadStatusesLock.Unlock()
+
+	statuses := make([]LoadStatus, 0, len(loadStatuses))
+	for _, status := range loadStatuses {
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].PluginName < statuses[j].PluginName
+	})
+	return statuses
+}
+
+// configFileSource determines whether the flag <flgName> with the name of
+// the config file was set on the command line, from the environment
+// or the default value is used.
+func configFileSource(flgName string) Source {
+	for _, arg := range os.Args[1:] {
+		if arg == "--" {
+			break
+		}
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		name := strings.TrimLeft(arg, "-")
+		if name == flgName || strings.HasPrefix(name, flgName+"=") {
+			return SourceFlag
+		}
+	}
+	// the same name as used by flag.ParseEnv()
+	envName := strings.Replace(strings.ToUpper(flgName), "-", "_", -1)
+	if _, set := os.LookupEnv(envName); set {
+		return SourceEnv
+	}
+	return SourceDefault
+}
@@ -0,0 +1,60 @@
+package config_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ligato/cn-infra/config"
+	. "github.com/onsi/gomega"
+)
+
+func TestLoadStatus(t *testing.T) {
+	RegisterTestingT(t)
+	defer resetFlags()()
+
+	dir, err := ioutil.TempDir("", "load-status")
+	Expect(err).ShouldNot(HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	cfgFile := filepath.Join(dir, "statusplugin.conf")
+	Expect(ioutil.WriteFile(cfgFile, []byte("user: admin\npassword: secret\n"), 0644)).To(Succeed())
+
+	// loaded from the default config file
+	var cfg secretConfig
+	_, err = config.ForPlugin("statusplugin", cfgFile).GetValue(&cfg)
+	Expect(err).ShouldNot(HaveOccurred())
+
+	status, found := config.GetLoadStatus("statusplugin")
+	Expect(found).Should(BeTrue())
+	Expect(status.Source).Should(Equal(config.SourceDefault))
+	Expect(status.File).Should(Equal(cfgFile))
+	Expect(status.Found).Should(BeTrue())
+	Expect(status.Error).Should(BeEmpty())
+	Expect(status.Config).Should(HaveKeyWithValue("user", "admin"))
+	Expect(status.Config).Should(HaveKeyWithValue("password", config.RedactedValue))
+	Expect(status.LoadedAt.IsZero()).Should(BeFalse())
+
+	// parse error is recorded
+	Expect(ioutil.WriteFile(cfgFile, []byte("user: [admin"), 0644)).To(Succeed())
+	_, err = config.ForPlugin("statusplugin", cfgFile).GetValue(&cfg)
+	Expect(err).Should(HaveOccurred())
+	status, _ = config.GetLoadStatus("statusplugin")
+	Expect(status.Error).Should(Equal(err.Error()))
+	Expect(status.Config).Should(BeNil())
+
+	// configuration not found
+	_, err = config.ForPlugin("missingplugin").GetValue(&cfg)
+	Expect(err).ShouldNot(HaveOccurred())
+	status, _ = config.GetLoadStatus("missingplugin")
+	Expect(status.Source).Should(Equal(config.SourceNone))
+	Expect(status.Found).Should(BeFalse())
+
+	var names []string
+	for _, status := range config.LoadStatuses() {
+		names = append(names, status.PluginName)
+	}
+	Expect(names).Should(ContainElement("statusplugin"))
+	Expect(names).Should(ContainElement("missingplugin"))
+}
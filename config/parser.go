@@ -24,11 +24,21 @@ import (
 // ParseConfigFromYamlFile parses a configuration from a file in YAML
 // format. The file's location is specified by the <path> parameter and the
 // resulting config is stored into the structure referenced by the <cfg>
-// parameter.
+// parameter. References to secrets in string values are resolved
+// (see ResolveSecretRefs()).
 // If the file doesn't exist or cannot be read, the returned error will
 // be of type os.PathError. An untyped error is returned in case the file
 // doesn't contain a valid YAML configuration.
 func ParseConfigFromYamlFile(path string, cfg interface{}) error {
+	if err := parseYamlFile(path, cfg); err != nil {
+		return err
+	}
+	return ResolveSecretRefs(cfg)
+}
+
+// parseYamlFile parses a configuration from a file in YAML format
+// (references to secrets are left unresolved).
+func parseYamlFile(path string, cfg interface{}) error {
 	b, err := ioutil.ReadFile(path)
 	if err != nil {
 		return err
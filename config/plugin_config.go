@@ -1,11 +1,15 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"path"
+	"reflect"
+	"strconv"
 	"strings"
 	"sync"
 
+	"github.com/ghodss/yaml"
 	"github.com/ligato/cn-infra/logging/logrus"
 	"github.com/namsral/flag"
 )
@@ -16,6 +20,11 @@ const FlagSuffix = "-config"
 // EnvSuffix is added to plugin name while loading plugins configuration from ENV variable.
 const EnvSuffix = "_CONFIG"
 
+// EnvEnabledSuffix is added to plugin name to get the name of the ENV variable
+// that enables configuration of the plugin from the environment only
+// (e.g. ETCD_ENABLED=true), i.e. without any config file.
+const EnvEnabledSuffix = "_ENABLED"
+
 // DirFlag as flag name (see implementation in declareFlags())
 // is used to define default directory where config files reside.
 // This flag name is derived from the name of the plugin.
@@ -70,29 +79,138 @@ func ForPlugin(pluginName string, opts ...string) PluginConfig {
 		flag.String(flgName, flagDefault, flagUsage)
 	}
 
-	return &pluginConfig{pluginName: pluginName}
+	pluginCfg := &pluginConfig{pluginName: pluginName}
+	registerPlugin(pluginCfg)
+	return pluginCfg
 }
 
 type pluginConfig struct {
 	pluginName string
 	access     sync.Mutex
 	cfg        string
+	// type of the configuration passed to GetValue() (see ConfigReference())
+	cfgType reflect.Type
 }
 
 // GetValue binds the configuration to config method argument.
+// The plugin's own config file takes precedence, the section of the agent-wide
+// config file (see AgentConfigFlag) named after the plugin is used otherwise.
+// Fields of the parsed configuration are then overridden by environment
+// variables prefixed with the plugin name (see ApplyEnvOverrides()).
+// The configuration is found only if it was loaded from a file, or if there is
+// no file but the plugin is enabled by the environment variable named after
+// the plugin with EnvEnabledSuffix (e.g. ETCD_ENABLED=true); environment
+// variables alone therefore never enable a plugin that has no configuration.
+// Empty fields are set to their default values (see SetDefaults()) before
+// parsing, references to secrets are resolved (see ResolveSecretRefs())
+// and the found configuration is validated (see Validate()).
+// The configuration is parsed into a copy of <config>, which is left untouched
+// if the configuration is not found or is invalid.
 func (p *pluginConfig) GetValue(config interface{}) (found bool, err error) {
+	p.access.Lock()
+	p.cfgType = reflect.TypeOf(config)
+	p.access.Unlock()
+
+	status := LoadStatus{PluginName: p.pluginName}
+	found, err = p.getValue(config, &status)
+	status.Found = found
+	if err != nil {
+		status.Error = err.Error()
+	} else if found {
+		status.Config, _ = Redact(config)
+		logrus.DefaultLogger().Debugf("Configuration of %s: %v", p.pluginName, status.Config)
+	}
+	ReportLoadStatus(status)
+	return found, err
+}
+
+// getValue implements GetValue() and records the source of the configuration in <status>.
+func (p *pluginConfig) getValue(config interface{}, status *LoadStatus) (found bool, err error) {
+	target := reflect.ValueOf(config)
+	if target.Kind() != reflect.Ptr || target.IsNil() {
+		return false, fmt.Errorf("config must be a non-nil pointer, got %T", config)
+	}
+	copied := reflect.New(target.Elem().Type())
+	copied.Elem().Set(target.Elem())
+	cfg := copied.Interface()
+
+	if err = SetDefaults(cfg); err != nil {
+		return false, err
+	}
+
+	status.Source = SourceNone
 	cfgName := p.GetConfigName()
 	if cfgName == "" {
+		found, err = agentConfigSection(p.pluginName, cfg)
+		if found {
+			status.Source, status.File = SourceAgentConfig, AgentConfigFile()
+		}
+	} else {
+		status.Source, status.File = configFileSource(p.pluginName+FlagSuffix), cfgName
+		err = parseYamlFile(cfgName, cfg)
+		found = err == nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if !found && !EnabledByEnv(p.pluginName) {
 		return false, nil
 	}
-	err = ParseConfigFromYamlFile(cfgName, config) //TODO switch to Viper (possible to have one huge config file)
+
+	overridden, err := ApplyEnvOverrides(p.pluginName, cfg)
 	if err != nil {
 		return false, err
 	}
+	status.EnvOverrides = overridden
 
+	if err = ResolveSecretRefs(cfg); err != nil {
+		return false, err
+	}
+	if err = Validate(cfg); err != nil {
+		return false, err
+	}
+	target.Elem().Set(copied.Elem())
 	return true, nil
 }
 
+// EnabledByEnv returns true if the configuration of the plugin can be taken
+// from the environment only, i.e. the variable named after the plugin
+// with EnvEnabledSuffix is set to true.
+func EnabledByEnv(pluginName string) bool {
+	enabled, err := strconv.ParseBool(os.Getenv(EnvName(pluginName) + EnvEnabledSuffix))
+	return err == nil && enabled
+}
+
+// ParsePluginConfig parses the configuration of the plugin <pluginName> from
+// <data> in YAML format (e.g. a document loaded from a data store) the same way
+// as GetValue() parses the config files: empty fields are set to their
+// defaults, overridden by environment variables, references to secrets
+// are resolved and the result is validated.
+func ParsePluginConfig(pluginName string, data []byte, config interface{}) error {
+	if err := SetDefaults(config); err != nil {
+		return err
+	}
+	if err := yaml.Unmarshal(data, config); err != nil {
+		return err
+	}
+	if _, err := ApplyEnvOverrides(pluginName, config); err != nil {
+		return err
+	}
+	if err := ResolveSecretRefs(config); err != nil {
+		return err
+	}
+	return Validate(config)
+}
+
+// configType returns the type of the configuration of the plugin
+// (nil if GetValue() has not been called yet).
+func (p *pluginConfig) configType() reflect.Type {
+	p.access.Lock()
+	defer p.access.Unlock()
+
+	return p.cfgType
+}
+
 // GetConfigName looks up flag value and uses it to:
 // 1. Find config in flag value location.
 // 2. Alternatively, it tries to find it in config dir
@@ -111,23 +229,30 @@ func (p *pluginConfig) getConfigName() string {
 	flgName := p.pluginName + FlagSuffix
 	flg := flag.CommandLine.Lookup(flgName)
 	if flg != nil {
-		flgVal := flg.Value.String()
+		return lookupConfigFile(flg.Value.String())
+	}
 
-		if flgVal != "" {
-			// if exist value from flag
-			if _, err := os.Stat(flgVal); !os.IsNotExist(err) {
-				return flgVal
-			}
-			cfgDir, err := Dir()
-			if err != nil {
-				logrus.DefaultLogger().Error(err)
-				return ""
-			}
-			// if exist flag value in config dir
-			flgValInConfigDir := path.Join(cfgDir, flgVal)
-			if _, err := os.Stat(flgValInConfigDir); !os.IsNotExist(err) {
-				return flgValInConfigDir
-			}
+	return ""
+}
+
+// lookupConfigFile returns the path to the config file with the given name,
+// which is either the name itself or a file in the config dir.
+// Empty string is returned if the file does not exist.
+func lookupConfigFile(flgVal string) string {
+	if flgVal != "" {
+		// if exist value from flag
+		if _, err := os.Stat(flgVal); !os.IsNotExist(err) {
+			return flgVal
+		}
+		cfgDir, err := Dir()
+		if err != nil {
+			logrus.DefaultLogger().Error(err)
+			return ""
+		}
+		// if exist flag value in config dir
+		flgValInConfigDir := path.Join(cfgDir, flgVal)
+		if _, err := os.Stat(flgValInConfigDir); !os.IsNotExist(err) {
+			return flgValInConfigDir
 		}
 	}
 
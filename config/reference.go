@@ -0,0 +1,136 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/namsral/flag"
+)
+
+// PrintConfigReferenceFlag is the name of the flag that enables printing
+// of the reference of plugins' configuration (see PrintConfigReference())
+// once the agent has started.
+const PrintConfigReferenceFlag = "print-config-reference"
+
+// PrintConfigReferenceUsage used as a flag usage (see implementation in declareFlags()).
+const PrintConfigReferenceUsage = "Print the reference of configuration fields of all plugins once the agent has started; " +
+	"also set via 'PRINT_CONFIG_REFERENCE' env variable."
+
+// FieldInfo describes a single field of a configuration.
+type FieldInfo struct {
+	// Path to the field composed of json names of the fields.
+	Path string
+	// Type of the field.
+	Type string
+	// Default value of the field (DefaultTag).
+	Default string
+	// Validation rules of the field (ValidateTag).
+	Validate string
+	// Env is the name of the environment variable overriding the field
+	// (empty for fields that cannot be overridden, e.g. items of slices).
+	Env string
+}
+
+// Describe returns descriptions of all fields of the configuration <cfg>
+// (struct or pointer to struct). Names of the environment variables are
+// derived from the <prefix> (plugin name).
+func Describe(prefix string, cfg interface{}) []FieldInfo {
+	typ := reflect.TypeOf(cfg)
+	if typ == nil {
+		return nil
+	}
+	return describeType("", EnvName(prefix), indirectType(typ), nil)
+}
+
+// describeType appends descriptions of the fields of the struct type.
+func describeType(path, envName string, typ reflect.Type, fields []FieldInfo) []FieldInfo {
+	if typ.Kind() != reflect.Struct {
+		return fields
+	}
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		name, ok := jsonFieldName(field)
+		if field.PkgPath != "" || !ok {
+			continue
+		}
+		fieldPath := joinPath(path, name)
+		fieldEnv := ""
+		if envName != "" {
+			fieldEnv = EnvName(envName, name)
+		}
+
+		fieldType := indirectType(field.Type)
+		switch {
+		case fieldType.Kind() == reflect.Struct && fieldType != durationType:
+			fields = describeType(fieldPath, fieldEnv, fieldType, fields)
+		case fieldType.Kind() == reflect.Slice && indirectType(fieldType.Elem()).Kind() == reflect.Struct:
+			fields = describeType(fieldPath+"[]", "", indirectType(fieldType.Elem()), fields)
+		default:
+			fields = append(fields, FieldInfo{
+				Path:     fieldPath,
+				Type:     field.Type.String(),
+				Default:  field.Tag.Get(DefaultTag),
+				Validate: field.Tag.Get(ValidateTag),
+				Env:      fieldEnv,
+			})
+		}
+	}
+	return fields
+}
+
+// ConfigReference returns descriptions of the configuration fields of all
+// plugins registered by ForPlugin() whose configuration has already been read
+// (the type of the configuration is known once GetValue() is called).
+func ConfigReference() map[string][]FieldInfo {
+	reference := make(map[string][]FieldInfo)
+	for pluginName, pluginCfg := range copyRegisteredPlugins() {
+		if cfgType := pluginCfg.configType(); cfgType != nil {
+			reference[pluginName] = describeType("", EnvName(pluginName), indirectType(cfgType), nil)
+		}
+	}
+	return reference
+}
+
+// PrintConfigReference writes ConfigReference() to <w> as a table.
+func PrintConfigReference(w io.Writer) error {
+	reference := ConfigReference()
+	var pluginNames []string
+	for pluginName := range reference {
+		pluginNames = append(pluginNames, pluginName)
+	}
+	sort.Strings(pluginNames)
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, pluginName := range pluginNames {
+		fmt.Fprintf(tw, "%s:\n", pluginName)
+		fmt.Fprintln(tw, "  FIELD\tTYPE\tDEFAULT\tVALIDATE\tENV")
+		for _, field := range reference[pluginName] {
+			fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\t%s\n", field.Path, field.Type, field.Default, field.Validate, field.Env)
+		}
+		fmt.Fprintln(tw)
+	}
+	return tw.Flush()
+}
+
+// PrintConfigReferenceEnabled returns true if PrintConfigReferenceFlag is set.
+func PrintConfigReferenceEnabled() bool {
+	flg := flag.CommandLine.Lookup(PrintConfigReferenceFlag)
+	return flg != nil && flg.Value.String() == "true"
+}
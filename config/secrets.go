@@ -0,0 +1,224 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+const (
+	// SecretTag marks config fields with sensitive values (`secret:"true"`).
+	// Values of such fields are redacted whenever the configuration
+	// is logged or printed (see Redact()).
+	SecretTag = "secret"
+
+	// RedactedValue replaces values of secret fields.
+	RedactedValue = "*****"
+)
+
+// secretRefRegexp matches references to secrets: ${env:NAME} and ${file:/path}.
+var secretRefRegexp = regexp.MustCompile(`\$\{(env|file):([^}]+)\}`)
+
+// ResolveSecretRefs replaces references to secrets in all string values
+// of the configuration <cfg> (pointer to a struct, slice, map, ...):
+//   - ${env:NAME} is replaced with the value of the environment variable NAME,
+//   - ${file:/run/secrets/x} is replaced with the content of the file
+//     (without the trailing newline).
+//
+// References can be a part of a value (e.g. "admin:${env:ADMIN_PASSWORD}").
+// An error is returned if the variable is not set or the file cannot be read.
+func ResolveSecretRefs(cfg interface{}) error {
+	val := reflect.ValueOf(cfg)
+	if val.Kind() != reflect.Ptr || val.IsNil() {
+		return fmt.Errorf("config must be a non-nil pointer, got %T", cfg)
+	}
+	return resolveSecretRefs("", val.Elem())
+}
+
+// resolveSecretRefs resolves references in the (settable) value recursively.
+func resolveSecretRefs(path string, val reflect.Value) error {
+	switch val.Kind() {
+	case reflect.String:
+		resolved, err := resolveString(val.String())
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		val.SetString(resolved)
+	case reflect.Ptr:
+		if !val.IsNil() {
+			return resolveSecretRefs(path, val.Elem())
+		}
+	case reflect.Interface:
+		if !val.IsNil() {
+			// values stored in interfaces are not settable, resolve a copy
+			elem := reflect.New(val.Elem().Type()).Elem()
+			elem.Set(val.Elem())
+			if err := resolveSecretRefs(path, elem); err != nil {
+				return err
+			}
+			val.Set(elem)
+		}
+	case reflect.Struct:
+		typ := val.Type()
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			name, ok := jsonFieldName(field)
+			if field.PkgPath != "" || !ok {
+				continue
+			}
+			if err := resolveSecretRefs(joinPath(path, name), val.Field(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < val.Len(); i++ {
+			if err := resolveSecretRefs(fmt.Sprintf("%s[%d]", path, i), val.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		for _, key := range val.MapKeys() {
+			// map items are not settable, resolve a copy
+			item := reflect.New(val.Type().Elem()).Elem()
+			item.Set(val.MapIndex(key))
+			if err := resolveSecretRefs(joinPath(path, fmt.Sprint(key.Interface())), item); err != nil {
+				return err
+			}
+			val.SetMapIndex(key, item)
+		}
+	}
+	return nil
+}
+
+// resolveString replaces all references to secrets in the string.
+func resolveString(str string) (string, error) {
+	var err error
+	resolved := secretRefRegexp.ReplaceAllStringFunc(str, func(ref string) string {
+		match := secretRefRegexp.FindStringSubmatch(ref)
+		switch match[1] {
+		case "env":
+			value, found := os.LookupEnv(match[2])
+			if !found && err == nil {
+				err = fmt.Errorf("environment variable %s referenced by secret is not set", match[2])
+			}
+			return value
+		default: // file
+			content, readErr := ioutil.ReadFile(match[2])
+			if readErr != nil && err == nil {
+				err = fmt.Errorf("failed to read secret: %v", readErr)
+			}
+			return strings.TrimRight(string(content), "\r\n")
+		}
+	})
+	return resolved, err
+}
+
+// Redact returns a copy of the configuration <cfg> (in the form of generic
+// maps and slices as if decoded from JSON) with values of the fields tagged
+// with SecretTag replaced by RedactedValue. It is meant for logging and
+// printing of the configuration.
+func Redact(cfg interface{}) (interface{}, error) {
+	b, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var doc interface{}
+	if err = json.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+	if cfg == nil {
+		return doc, nil
+	}
+	return redactDoc(doc, reflect.TypeOf(cfg)), nil
+}
+
+// redactDoc redacts the values of secret fields in the generic document <doc>
+// decoded from the configuration of type <typ>.
+func redactDoc(doc interface{}, typ reflect.Type) interface{} {
+	typ = indirectType(typ)
+	switch typ.Kind() {
+	case reflect.Struct:
+		fields, ok := doc.(map[string]interface{})
+		if !ok {
+			return doc
+		}
+		redactFields(fields, typ)
+	case reflect.Slice, reflect.Array:
+		if items, ok := doc.([]interface{}); ok {
+			for i := range items {
+				items[i] = redactDoc(items[i], typ.Elem())
+			}
+		}
+	case reflect.Map:
+		if items, ok := doc.(map[string]interface{}); ok {
+			for key := range items {
+				items[key] = redactDoc(items[key], typ.Elem())
+			}
+		}
+	}
+	return doc
+}
+
+// redactFields redacts the secret fields of the struct type <typ> found in <fields>.
+func redactFields(fields map[string]interface{}, typ reflect.Type) {
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		name, ok := jsonFieldName(field)
+		if field.PkgPath != "" || !ok {
+			continue
+		}
+		if name == "" {
+			// fields of embedded structs are promoted
+			redactFields(fields, indirectType(field.Type))
+			continue
+		}
+		for key, value := range fields {
+			// encoding/json matches the names case-insensitively
+			if !strings.EqualFold(key, name) {
+				continue
+			}
+			if field.Tag.Get(SecretTag) == "true" {
+				fields[key] = redactValue(value)
+			} else {
+				fields[key] = redactDoc(value, field.Type)
+			}
+		}
+	}
+}
+
+// redactValue replaces the value (or all items of a list or a map) with RedactedValue.
+func redactValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		for i := range value {
+			value[i] = redactValue(value[i])
+		}
+		return value
+	case map[string]interface{}:
+		for key := range value {
+			value[key] = redactValue(value[key])
+		}
+		return value
+	}
+	return RedactedValue
+}
@@ -0,0 +1,111 @@
+package config_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ligato/cn-infra/config"
+	. "github.com/onsi/gomega"
+)
+
+type Credentials struct {
+	User     string `json:"user"`
+	Password string `json:"password" secret:"true"`
+}
+
+type secretConfig struct {
+	Credentials
+	Endpoint  string            `json:"endpoint"`
+	BasicAuth []string          `json:"basic-auth" secret:"true"`
+	Backends  []Credentials     `json:"backends"`
+	Labels    map[string]string `json:"labels"`
+}
+
+func TestResolveSecretRefs(t *testing.T) {
+	RegisterTestingT(t)
+
+	dir, err := ioutil.TempDir("", "secrets")
+	Expect(err).ShouldNot(HaveOccurred())
+	defer os.RemoveAll(dir)
+	secretFile := filepath.Join(dir, "password")
+	Expect(ioutil.WriteFile(secretFile, []byte("from-file\n"), 0600)).To(Succeed())
+	defer setEnv(map[string]string{"SECRET_PASSWORD": "from-env"})()
+
+	cfg := secretConfig{
+		Credentials: Credentials{User: "admin", Password: "${env:SECRET_PASSWORD}"},
+		Endpoint:    "localhost:9191",
+		BasicAuth:   []string{"admin:${file:" + secretFile + "}"},
+		Backends:    []Credentials{{Password: "${env:SECRET_PASSWORD}${env:SECRET_PASSWORD}"}},
+		Labels:      map[string]string{"token": "${env:SECRET_PASSWORD}"},
+	}
+	Expect(config.ResolveSecretRefs(&cfg)).To(Succeed())
+	Expect(cfg.Password).Should(Equal("from-env"))
+	Expect(cfg.BasicAuth).Should(Equal([]string{"admin:from-file"}))
+	Expect(cfg.Backends[0].Password).Should(Equal("from-envfrom-env"))
+	Expect(cfg.Labels["token"]).Should(Equal("from-env"))
+
+	// generic documents are resolved as well
+	var doc interface{} = map[string]interface{}{"list": []interface{}{"${env:SECRET_PASSWORD}"}}
+	Expect(config.ResolveSecretRefs(&doc)).To(Succeed())
+	Expect(doc).Should(Equal(map[string]interface{}{"list": []interface{}{"from-env"}}))
+
+	cfg = secretConfig{Backends: []Credentials{{Password: "${env:SECRET_UNDEFINED}"}}}
+	err = config.ResolveSecretRefs(&cfg)
+	Expect(err).Should(HaveOccurred())
+	Expect(err.Error()).Should(ContainSubstring("backends[0].password"))
+	Expect(err.Error()).Should(ContainSubstring("SECRET_UNDEFINED"))
+
+	cfg = secretConfig{Endpoint: "${file:" + filepath.Join(dir, "missing") + "}"}
+	Expect(config.ResolveSecretRefs(&cfg)).ShouldNot(Succeed())
+}
+
+func TestRedact(t *testing.T) {
+	RegisterTestingT(t)
+
+	cfg := secretConfig{
+		Credentials: Credentials{User: "admin", Password: "pass"},
+		BasicAuth:   []string{"a:b", "c:d"},
+		Backends:    []Credentials{{User: "user", Password: "pass"}},
+	}
+	redacted, err := config.Redact(&cfg)
+	Expect(err).ShouldNot(HaveOccurred())
+	Expect(redacted).Should(Equal(map[string]interface{}{
+		"user":       "admin",
+		"password":   config.RedactedValue,
+		"endpoint":   "",
+		"basic-auth": []interface{}{config.RedactedValue, config.RedactedValue},
+		"backends":   []interface{}{map[string]interface{}{"user": "user", "password": config.RedactedValue}},
+		"labels":     nil,
+	}))
+	// the configuration itself is not changed
+	Expect(cfg.Password).Should(Equal("pass"))
+}
+
+func TestGetValueWithSecrets(t *testing.T) {
+	RegisterTestingT(t)
+	defer resetFlags()()
+
+	dir, err := ioutil.TempDir("", "secrets")
+	Expect(err).ShouldNot(HaveOccurred())
+	defer os.RemoveAll(dir)
+	defer setEnv(map[string]string{"SECRET_PASSWORD": "from-env"})()
+
+	cfgFile := filepath.Join(dir, "secretplugin.conf")
+	Expect(ioutil.WriteFile(cfgFile, []byte("user: admin\npassword: ${env:SECRET_PASSWORD}\n"), 0644)).To(Succeed())
+
+	var cfg secretConfig
+	found, err := config.ForPlugin("secretplugin", cfgFile).GetValue(&cfg)
+	Expect(err).ShouldNot(HaveOccurred())
+	Expect(found).Should(BeTrue())
+	Expect(cfg.Password).Should(Equal("from-env"))
+
+	// printed configuration contains neither the secret nor the reference
+	var out bytes.Buffer
+	Expect(config.PrintAgentConfig(&out)).To(Succeed())
+	Expect(out.String()).Should(ContainSubstring("secretplugin:"))
+	Expect(out.String()).Should(ContainSubstring("password: '" + config.RedactedValue + "'"))
+	Expect(out.String()).ShouldNot(ContainSubstring("from-env"))
+}
@@ -0,0 +1,343 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultTag is the struct tag with the default value of a config field
+	// (in the same format as used for environment variables, see ApplyEnvOverrides()).
+	DefaultTag = "default"
+
+	// ValidateTag is the struct tag with comma-separated validation rules
+	// of a config field (e.g. `validate:"required,min=1,hostport"`):
+	//  - required: the value must not be empty (zero)
+	//  - min=N, max=N: minimal/maximal value of a number or duration (e.g. min=1s),
+	//    minimal/maximal length of a string, slice or map
+	//  - hostport: "host:port" address (applied to every item of a slice)
+	//  - oneof=A B C: one of the space-separated values
+	// Rules other than required are not checked for empty values.
+	ValidateTag = "validate"
+)
+
+// FieldError describes a config field that failed validation.
+type FieldError struct {
+	// Path to the field composed of json names of the fields (e.g. tls.ca-file, endpoints[1]).
+	Path string
+	// Rule that failed.
+	Rule string
+	// Message describes the failure.
+	Message string
+}
+
+// Error returns the path to the field with the description of the failure.
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Message)
+}
+
+// ValidationErrors aggregates all failures found by Validate().
+type ValidationErrors []*FieldError
+
+// Error lists all failures.
+func (errs ValidationErrors) Error() string {
+	var msgs []string
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+	return "invalid configuration: " + strings.Join(msgs, "; ")
+}
+
+// SetDefaults sets fields of the configuration <cfg> (pointer to a struct)
+// that have zero value to the default value defined by DefaultTag.
+// It is applied before the configuration is parsed (see PluginConfig.GetValue()),
+// therefore values defined in the config file take precedence.
+func SetDefaults(cfg interface{}) error {
+	val := reflect.ValueOf(cfg)
+	if val.Kind() != reflect.Ptr || val.IsNil() {
+		return fmt.Errorf("config must be a non-nil pointer, got %T", cfg)
+	}
+	return setDefaults("", val.Elem())
+}
+
+// setDefaults sets defaults of the fields of the struct (recursively).
+func setDefaults(path string, val reflect.Value) error {
+	if val.Kind() == reflect.Ptr && !val.IsNil() {
+		val = val.Elem()
+	}
+	if val.Kind() != reflect.Struct {
+		return nil
+	}
+
+	typ := val.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		name, ok := jsonFieldName(field)
+		if field.PkgPath != "" || !ok {
+			continue
+		}
+		fieldPath := joinPath(path, name)
+		fieldVal := val.Field(i)
+
+		if def, found := field.Tag.Lookup(DefaultTag); found && isZero(fieldVal) {
+			if err := setFromString(fieldVal, def); err != nil {
+				return fmt.Errorf("invalid default value of %s: %v", fieldPath, err)
+			}
+		}
+		if err := setDefaults(fieldPath, fieldVal); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate checks the configuration <cfg> (pointer to a struct) against
+// the rules defined by ValidateTag. All failures are returned as ValidationErrors.
+func Validate(cfg interface{}) error {
+	val := reflect.ValueOf(cfg)
+	for val.Kind() == reflect.Ptr {
+		if val.IsNil() {
+			return nil
+		}
+		val = val.Elem()
+	}
+	var errs ValidationErrors
+	if err := validateStruct("", val, &errs); err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// validateStruct validates the fields of the struct (recursively).
+// The returned error signals an invalid rule (not an invalid value).
+func validateStruct(path string, val reflect.Value, errs *ValidationErrors) error {
+	if val.Kind() != reflect.Struct {
+		return nil
+	}
+	typ := val.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		name, ok := jsonFieldName(field)
+		if field.PkgPath != "" || !ok {
+			continue
+		}
+		fieldPath := joinPath(path, name)
+		fieldVal := val.Field(i)
+
+		if rules := field.Tag.Get(ValidateTag); rules != "" {
+			if err := validateField(fieldPath, fieldVal, rules, errs); err != nil {
+				return err
+			}
+		}
+		if err := validateNested(fieldPath, fieldVal, errs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateNested validates structs referenced from the field.
+func validateNested(path string, val reflect.Value, errs *ValidationErrors) error {
+	switch val.Kind() {
+	case reflect.Ptr:
+		if !val.IsNil() {
+			return validateNested(path, val.Elem(), errs)
+		}
+	case reflect.Struct:
+		return validateStruct(path, val, errs)
+	case reflect.Slice, reflect.Array:
+		if indirectType(val.Type().Elem()).Kind() != reflect.Struct {
+			return nil
+		}
+		for i := 0; i < val.Len(); i++ {
+			if err := validateNested(fmt.Sprintf("%s[%d]", path, i), val.Index(i), errs); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validateField checks the value of the field against the rules.
+func validateField(path string, val reflect.Value, rules string, errs *ValidationErrors) error {
+	ruleList := strings.Split(rules, ",")
+	if isZero(val) {
+		for _, rule := range ruleList {
+			if strings.TrimSpace(rule) == "required" {
+				*errs = append(*errs, &FieldError{Path: path, Rule: "required", Message: "value is required"})
+			}
+		}
+		return nil
+	}
+
+	for _, rule := range ruleList {
+		rule = strings.TrimSpace(rule)
+		ruleName, arg := rule, ""
+		if idx := strings.Index(rule, "="); idx >= 0 {
+			ruleName, arg = rule[:idx], rule[idx+1:]
+		}
+
+		var msg string
+		var err error
+		switch ruleName {
+		case "required", "":
+		case "min", "max":
+			msg, err = checkLimit(val, ruleName, arg)
+		case "hostport":
+			msg = checkHostPort(val)
+		case "oneof":
+			msg = checkOneOf(val, arg)
+		default:
+			err = fmt.Errorf("unknown validation rule %q", rule)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		if msg != "" {
+			*errs = append(*errs, &FieldError{Path: path, Rule: ruleName, Message: msg})
+		}
+	}
+	return nil
+}
+
+// checkLimit checks min/max rule.
+func checkLimit(val reflect.Value, rule, arg string) (msg string, err error) {
+	var actual, limit float64
+	switch {
+	case val.Type() == durationType:
+		d, err := time.ParseDuration(arg)
+		if err != nil {
+			return "", fmt.Errorf("invalid %s rule: %v", rule, err)
+		}
+		actual, limit = float64(val.Int()), float64(d)
+	default:
+		limit, err = strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return "", fmt.Errorf("invalid %s rule: %v", rule, err)
+		}
+		switch val.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			actual = float64(val.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			actual = float64(val.Uint())
+		case reflect.Float32, reflect.Float64:
+			actual = val.Float()
+		case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+			actual = float64(val.Len())
+			if rule == "min" && actual < limit {
+				return fmt.Sprintf("length must be at least %s", arg), nil
+			}
+			if rule == "max" && actual > limit {
+				return fmt.Sprintf("length must be at most %s", arg), nil
+			}
+			return "", nil
+		default:
+			return "", fmt.Errorf("%s rule not applicable to %v", rule, val.Type())
+		}
+	}
+	if rule == "min" && actual < limit {
+		return fmt.Sprintf("value must be at least %s", arg), nil
+	}
+	if rule == "max" && actual > limit {
+		return fmt.Sprintf("value must be at most %s", arg), nil
+	}
+	return "", nil
+}
+
+// checkHostPort checks that the value (or every item of a slice) is a host:port address.
+func checkHostPort(val reflect.Value) string {
+	if val.Kind() == reflect.Slice || val.Kind() == reflect.Array {
+		for i := 0; i < val.Len(); i++ {
+			if msg := checkHostPort(val.Index(i)); msg != "" {
+				return fmt.Sprintf("item %d: %s", i, msg)
+			}
+		}
+		return ""
+	}
+	if val.Kind() != reflect.String {
+		return fmt.Sprintf("host:port expected, got %v", val.Type())
+	}
+	_, port, err := net.SplitHostPort(val.String())
+	if err != nil {
+		return fmt.Sprintf("invalid host:port address %q", val.String())
+	}
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return fmt.Sprintf("invalid port in address %q", val.String())
+	}
+	return ""
+}
+
+// checkOneOf checks that the value is one of the space-separated options.
+func checkOneOf(val reflect.Value, options string) string {
+	str := fmt.Sprint(val.Interface())
+	for _, option := range strings.Fields(options) {
+		if str == option {
+			return ""
+		}
+	}
+	return fmt.Sprintf("value %q must be one of: %s", str, options)
+}
+
+// isZero returns true for zero values and empty slices and maps.
+func isZero(val reflect.Value) bool {
+	switch val.Kind() {
+	case reflect.Slice, reflect.Map, reflect.String:
+		return val.Len() == 0
+	case reflect.Bool:
+		return !val.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return val.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return val.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return val.Float() == 0
+	case reflect.Complex64, reflect.Complex128:
+		return val.Complex() == 0
+	case reflect.Ptr, reflect.Interface, reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		return val.IsNil()
+	case reflect.Array:
+		for i := 0; i < val.Len(); i++ {
+			if !isZero(val.Index(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Struct:
+		for i := 0; i < val.NumField(); i++ {
+			if !isZero(val.Field(i)) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// joinPath appends the field name to the path (embedded structs have empty name).
+func joinPath(path, name string) string {
+	if path == "" || name == "" {
+		return path + name
+	}
+	return path + "." + name
+}
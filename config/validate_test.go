@@ -0,0 +1,111 @@
+package config_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ligato/cn-infra/config"
+	. "github.com/onsi/gomega"
+)
+
+type serverConfig struct {
+	Address string `json:"address" validate:"required,hostport"`
+	Weight  int    `json:"weight" default:"1" validate:"min=1,max=10"`
+}
+
+type validatedConfig struct {
+	Endpoints   []string       `json:"endpoints" validate:"required,hostport"`
+	DialTimeout time.Duration  `json:"dial-timeout" default:"1s" validate:"min=100ms"`
+	Level       string         `json:"level" default:"info" validate:"oneof=debug info error"`
+	Insecure    bool           `json:"insecure" default:"true"`
+	Name        string         `json:"name" validate:"min=3"`
+	Servers     []serverConfig `json:"servers"`
+}
+
+func TestSetDefaults(t *testing.T) {
+	RegisterTestingT(t)
+
+	cfg := validatedConfig{Level: "debug"}
+	Expect(config.SetDefaults(&cfg)).To(Succeed())
+	Expect(cfg.DialTimeout).Should(Equal(time.Second))
+	Expect(cfg.Level).Should(Equal("debug"))
+	Expect(cfg.Insecure).Should(BeTrue())
+}
+
+func TestValidate(t *testing.T) {
+	RegisterTestingT(t)
+
+	cfg := validatedConfig{
+		Endpoints:   []string{"127.0.0.1:2379"},
+		DialTimeout: time.Second,
+		Level:       "info",
+		Servers:     []serverConfig{{Address: "[::1]:80", Weight: 5}},
+	}
+	Expect(config.Validate(&cfg)).To(Succeed())
+
+	cfg = validatedConfig{
+		DialTimeout: time.Millisecond,
+		Level:       "trace",
+		Name:        "ab",
+		Servers:     []serverConfig{{Address: "localhost", Weight: 11}},
+	}
+	err := config.Validate(&cfg)
+	Expect(err).Should(HaveOccurred())
+
+	errs, ok := err.(config.ValidationErrors)
+	Expect(ok).Should(BeTrue())
+	var paths []string
+	for _, fieldErr := range errs {
+		paths = append(paths, fieldErr.Path+" "+fieldErr.Rule)
+	}
+	Expect(paths).Should(Equal([]string{
+		"endpoints required",
+		"dial-timeout min",
+		"level oneof",
+		"name min",
+		"servers[0].address hostport",
+		"servers[0].weight max",
+	}))
+}
+
+func TestGetValueValidates(t *testing.T) {
+	RegisterTestingT(t)
+	defer resetFlags()()
+
+	dir, err := ioutil.TempDir("", "validate")
+	Expect(err).ShouldNot(HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	cfgFile := filepath.Join(dir, "validated.conf")
+	Expect(ioutil.WriteFile(cfgFile, []byte("endpoints: [\"no-port\"]\nlevel: error\n"), 0644)).To(Succeed())
+
+	pluginCfg := config.ForPlugin("validatedplugin", cfgFile)
+	var cfg validatedConfig
+	_, err = pluginCfg.GetValue(&cfg)
+	Expect(err).Should(HaveOccurred())
+	Expect(err.Error()).Should(ContainSubstring("endpoints: item 0"))
+
+	Expect(ioutil.WriteFile(cfgFile, []byte("endpoints: [\"host:1\"]\nlevel: error\n"), 0644)).To(Succeed())
+	cfg = validatedConfig{}
+	found, err := pluginCfg.GetValue(&cfg)
+	Expect(err).ShouldNot(HaveOccurred())
+	Expect(found).Should(BeTrue())
+	Expect(cfg.DialTimeout).Should(Equal(time.Second)) // default
+	Expect(cfg.Level).Should(Equal("error"))           // config file wins
+
+	// reference of the configuration
+	fields := config.ConfigReference()["validatedplugin"]
+	Expect(fields).Should(ContainElement(config.FieldInfo{Path: "dial-timeout", Type: "time.Duration",
+		Default: "1s", Validate: "min=100ms", Env: "VALIDATEDPLUGIN_DIAL_TIMEOUT"}))
+	Expect(fields).Should(ContainElement(config.FieldInfo{Path: "servers[].weight", Type: "int",
+		Default: "1", Validate: "min=1,max=10"}))
+
+	var out bytes.Buffer
+	Expect(config.PrintConfigReference(&out)).To(Succeed())
+	Expect(out.String()).Should(ContainSubstring("validatedplugin:"))
+	Expect(out.String()).Should(ContainSubstring("VALIDATEDPLUGIN_ENDPOINTS"))
+}
@@ -15,13 +15,18 @@
 package core
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"os"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/namsral/flag"
 
+	"github.com/ligato/cn-infra/config"
 	"github.com/ligato/cn-infra/logging"
 	"github.com/ligato/cn-infra/logging/logrus"
 )
@@ -29,17 +34,38 @@ import (
 var (
 	// DefaultMaxStartupTime defines maximal duration of start for agent.
 	DefaultMaxStartupTime = 15 * time.Second
+
+	// DefaultCloseTimeout defines maximal duration of Close() of a single plugin.
+	DefaultCloseTimeout = 10 * time.Second
 )
 
 // Agent implements startup & shutdown procedures.
 type Agent struct {
 	// plugin list
 	plugins []*NamedPlugin
+	// dependencies between the plugins (built when the plugins are sorted)
+	graph *dependencyGraph
 	logging.Logger
-	// The field is set before initialization of every plugin with its name.
-	currentlyProcessing string
+	// Plugins that are currently being initialized (by name).
+	currentlyProcessing map[string]struct{}
+	// Plugins whose Init()/AfterInit() was abandoned after a timeout, mapped
+	// to channels closed once the abandoned handler finally returns.
+	abandoned      map[PluginName]<-chan struct{}
+	processingLock sync.Mutex
+	// Independent plugins are initialized concurrently if enabled.
+	parallelInit bool
+	// Per-plugin time limits for Init() and AfterInit().
+	pluginTimeouts       map[PluginName]time.Duration
+	defaultPluginTimeout time.Duration
+	// Time limit for Close() of a single plugin.
+	closeTimeout time.Duration
+	// Context passed to plugins during startup, cancelled on timeout or interrupt.
+	startupCtx    context.Context
+	cancelStartup context.CancelFunc
 	// agent's stopwatch
 	timer Timer
+	// lifecycle states of the plugins and watchers of their transitions
+	lifecycle lifecycle
 }
 
 // Timer holds all startup times.
@@ -53,6 +79,9 @@ type Timer struct {
 	// durations
 	init      time.Duration
 	afterInit time.Duration
+	// per-plugin startup details
+	plugins map[Phase]map[PluginName]*PluginStartup
+	access  sync.Mutex
 }
 
 // NewAgent returns a new instance of the Agent with plugins. Use options if needed:
@@ -63,6 +92,11 @@ type Timer struct {
 // to initialize inside the specified time limit.
 // <WithPlugins() option> is a variable list of plugins to load. ListPluginsInFlavor() helper
 // method can be used to obtain the list from a given flavor.
+// <WithParallelInit() option> enables concurrent initialization of plugins
+// that do not depend on each other.
+// <WithPluginTimeout() option> puts a time limit on Init() and AfterInit()
+// of individual plugins.
+// <WithCloseTimeout() option> puts a time limit on Close() of individual plugins.
 //
 // Example 1 (existing flavor - or use alias rpc.NewAgent()):
 //
@@ -77,6 +111,7 @@ type Timer struct {
 //    })
 func NewAgent(flavor Flavor, opts ...Option) *Agent {
 	maxStartup := DefaultMaxStartupTime
+	closeTimeout := DefaultCloseTimeout
 
 	var flavors []Flavor
 	if fs, ok := flavor.(flavorAggregator); ok {
@@ -88,6 +123,9 @@ func NewAgent(flavor Flavor, opts ...Option) *Agent {
 	flavor.Inject()
 
 	var agentCoreLogger logging.Logger
+	var parallelInit bool
+	var defaultPluginTimeout time.Duration
+	pluginTimeouts := make(map[PluginName]time.Duration)
 	plugins := flavor.Plugins()
 
 	for _, opt := range opts {
@@ -101,6 +139,18 @@ func NewAgent(flavor Flavor, opts ...Option) *Agent {
 			}
 		case *WithLoggerOpt:
 			agentCoreLogger = opt.(*WithLoggerOpt).Logger
+		case *WithParallelInitOpt:
+			parallelInit = true
+		case *WithPluginTimeoutOpt:
+			timeoutOpt := opt.(*WithPluginTimeoutOpt)
+			if len(timeoutOpt.Plugins) == 0 {
+				defaultPluginTimeout = timeoutOpt.Timeout
+			}
+			for _, pluginName := range timeoutOpt.Plugins {
+				pluginTimeouts[pluginName] = timeoutOpt.Timeout
+			}
+		case *WithCloseTimeoutOpt:
+			closeTimeout = opt.(*WithCloseTimeoutOpt).Timeout
 		}
 	}
 
@@ -115,9 +165,17 @@ func NewAgent(flavor Flavor, opts ...Option) *Agent {
 		agentCoreLogger = logrus.DefaultLogger()
 	}
 
+	startupCtx, cancelStartup := context.WithCancel(context.Background())
+
 	return &Agent{
-		plugins: plugins,
-		Logger:  agentCoreLogger,
+		plugins:              plugins,
+		Logger:               agentCoreLogger,
+		parallelInit:         parallelInit,
+		pluginTimeouts:       pluginTimeouts,
+		defaultPluginTimeout: defaultPluginTimeout,
+		closeTimeout:         closeTimeout,
+		startupCtx:           startupCtx,
+		cancelStartup:        cancelStartup,
 		timer: Timer{
 			MaxStartupTime: maxStartup,
 		},
@@ -134,9 +192,14 @@ func NewAgent(flavor Flavor, opts ...Option) *Agent {
 // <plugins> is a variable that holds a list of plugins to load. ListPluginsInFlavor() helper
 // method can be used to obtain the list from a given flavor.
 func NewAgentDeprecated(logger logging.Logger, maxStartup time.Duration, plugins ...*NamedPlugin) *Agent {
+	startupCtx, cancelStartup := context.WithCancel(context.Background())
+
 	return &Agent{
-		plugins: plugins,
-		Logger:  logger,
+		plugins:       plugins,
+		Logger:        logger,
+		closeTimeout:  DefaultCloseTimeout,
+		startupCtx:    startupCtx,
+		cancelStartup: cancelStartup,
 		timer: Timer{
 			MaxStartupTime: maxStartup,
 		},
@@ -149,6 +212,7 @@ type logRegistryGetter interface {
 }
 
 // Start starts/initializes all selected plugins.
+// The plugins are first ordered by their dependencies (see sortPlugins()).
 // The first iteration tries to run Init() method on every plugin from the list.
 // If any of the plugins fails to initialize (Init() returns non-nil error),
 // the initialization is cancelled by calling Close() method for already initialized
@@ -160,6 +224,18 @@ type logRegistryGetter interface {
 // called on every plugin.
 // The startup/initialization must take no longer than maxStartup time limit,
 // otherwise ErrPluginsInitTimeout error is returned.
+// If the agent was created with WithParallelInit() option, plugins whose
+// dependencies are already (after-)initialized are processed concurrently
+// in both iterations.
+// Init() and AfterInit() of a single plugin can be further limited in time
+// by WithPluginTimeout() option or by the plugin itself (WithInitTimeout).
+// Details of the startup of every plugin are available via StartupReport().
+// Plugins implementing InitContext/PostInitContext interfaces are initialized
+// with a context that is cancelled when the time limit of the plugin or of the
+// whole startup expires, or when the startup is interrupted
+// (see EventLoopWithInterrupt()). Once the context is cancelled, no other plugin
+// is started and the already initialized plugins are closed before Start() returns
+// (even if the last of them completes its startup after the cancellation).
 func (agent *Agent) Start() error {
 	agent.WithFields(logging.Fields{"CommitHash": CommitHash, "BuildDate": BuildDate}).
 		Infof("Starting agent %v", BuildVersion)
@@ -169,7 +245,13 @@ func (agent *Agent) Start() error {
 	}
 
 	doneChannel := make(chan struct{})
-	errChannel := make(chan error)
+	errChannel := make(chan error, 1)
+
+	if err := agent.sortPlugins(); err != nil {
+		agent.Error(err)
+		return err
+	}
+	agent.initLifecycle()
 
 	agent.timer.agentStart = time.Now()
 
@@ -192,6 +274,16 @@ func (agent *Agent) Start() error {
 	case <-doneChannel:
 		agent.Infof("Agent started successfully, took %v (Init: %v, AfterInit: %v)",
 			agent.timer.init+agent.timer.afterInit, agent.timer.init, agent.timer.afterInit)
+		if config.PrintAgentConfigEnabled() {
+			if err := config.PrintAgentConfig(os.Stdout); err != nil {
+				agent.Warnf("Printing of agent config failed: %v", err)
+			}
+		}
+		if config.PrintConfigReferenceEnabled() {
+			if err := config.PrintConfigReference(os.Stdout); err != nil {
+				agent.Warnf("Printing of config reference failed: %v", err)
+			}
+		}
 		return nil
 
 	case err := <-errChannel:
@@ -199,14 +291,48 @@ func (agent *Agent) Start() error {
 		agent.Debugf("Agent AfterInit took %v", agent.timer.afterInit)
 		return err
 
+	case <-agent.startupCtx.Done():
+		agent.Warn("Agent startup cancelled")
+		if agent.waitForStartup(doneChannel, errChannel) {
+			agent.stopCompletedStartup()
+		}
+		return errors.New("agent startup cancelled")
+
 	case <-time.After(agent.timer.MaxStartupTime):
-		if agent.timer.init == 0 {
+		if initTook := agent.timer.phaseDuration(InitPhase); initTook == 0 {
 			agent.Infof("Agent Init took > %v", agent.timer.MaxStartupTime)
 		} else {
-			agent.Infof("Agent Init took %v", agent.timer.init)
+			agent.Infof("Agent Init took %v", initTook)
 			agent.Infof("Agent AfterInit took > %v", agent.timer.MaxStartupTime)
 		}
-		return fmt.Errorf("plugin %s not completed before timeout", agent.currentlyProcessing)
+		err := fmt.Errorf("plugin %s not completed before timeout", agent.processing())
+		agent.cancelStartup()
+		if agent.waitForStartup(doneChannel, errChannel) {
+			agent.stopCompletedStartup()
+		}
+		return err
+	}
+}
+
+// waitForStartup waits until the startup go routine finishes (which includes
+// closing of the initialized plugins after the startup was cancelled).
+// It returns true if the startup completed anyway, i.e. all the plugins were
+// initialized before the cancellation could stop it.
+func (agent *Agent) waitForStartup(doneChannel chan struct{}, errChannel chan error) (completed bool) {
+	select {
+	case <-doneChannel:
+		return true
+	case <-errChannel:
+		return false
+	}
+}
+
+// stopCompletedStartup closes all plugins of the startup that completed even
+// though it was cancelled or timed out, so that none of them is left open.
+func (agent *Agent) stopCompletedStartup() {
+	agent.Warn("Agent startup completed after it was cancelled, stopping plugins")
+	if err := agent.Stop(); err != nil {
+		agent.Errorf("Agent stop error '%+v'", err)
 	}
 }
 
@@ -214,7 +340,10 @@ func (agent *Agent) Start() error {
 // interrupts the Agent from the EventLoopWithInterrupt().
 //
 // This implementation tries to call Close() method on every plugin on the list
-// in the reverse order. It continues even if some error occurred.
+// in the reverse order (i.e. in the reverse order of dependencies). It continues
+// even if some error occurred. The plugin is given at most the close timeout
+// (see WithCloseTimeout()) to finish; plugins implementing the CloseContext
+// interface get a context which is cancelled once the timeout expires.
 func (agent *Agent) Stop() error {
 	agent.Info("Stopping agent...")
 
@@ -224,7 +353,7 @@ func (agent *Agent) Stop() error {
 
 		agent.Debugf("Closing plugin: %s", p)
 
-		if err := p.Plugin.Close(); err != nil {
+		if err := agent.closePlugin(p); err != nil {
 			agent.Warnf("plugin %s: Close failed: %v", p, err)
 			errMsgs = append(errMsgs, fmt.Sprintf("%s: %v", p, err))
 		}
@@ -241,41 +370,21 @@ func (agent *Agent) Stop() error {
 
 // initPlugins calls Init() on all plugins in the list.
 func (agent *Agent) initPlugins() error {
-	// Flag indicates that some of the plugins failed to initialize
-	var initPluginCounter int
-	var wasError error
-
 	agent.timer.initStart = time.Now()
-	for index, plugin := range agent.plugins {
-		initPluginCounter = index
-
-		// Set currently initialized plugin name.
-		agent.currentlyProcessing = plugin.String()
-
-		// Skip all other plugins if some of them failed.
-		if wasError != nil {
-			agent.Warnf("plugin %s: Init skipped due to previous error", plugin)
-			continue
-		}
-
-		pluginStartTime := time.Now()
-		if err := plugin.Init(); err != nil {
-			wasError = fmt.Errorf("plugin %s: Init failed: %v", plugin, err)
-			agent.WithField("took", time.Since(pluginStartTime)).Error(wasError)
-		} else {
-			agent.WithField("took", time.Since(pluginStartTime)).Infof("plugin %s: Init ok", plugin)
-		}
-	}
-	agent.timer.init = time.Since(agent.timer.initStart)
+	called, wasError := agent.runPhase(InitPhase, agent.initPlugin)
+	agent.timer.setPhaseDuration(InitPhase, time.Since(agent.timer.initStart))
 
 	if wasError != nil {
 		//Stop the plugins that are initialized
-		for i := initPluginCounter; i >= 0; i-- {
+		for i := len(agent.plugins) - 1; i >= 0; i-- {
+			if !called[i] {
+				continue
+			}
 			p := agent.plugins[i]
 
 			agent.Debugf("Closing plugin: %s", p)
 
-			if err := p.Close(); err != nil {
+			if err := agent.closePlugin(p); err != nil {
 				wasError = err
 			}
 		}
@@ -288,39 +397,375 @@ func (agent *Agent) initPlugins() error {
 // handleAfterInit calls the AfterInit handlers on plugins that can only
 // finish their initialization after all other plugins have been initialized.
 func (agent *Agent) handleAfterInit() error {
-	// Flag indicates that some of the plugins failed to after-initialize
-	var wasError error
-
 	agent.timer.afterInitStart = time.Now()
-	for _, plugin := range agent.plugins {
-		// Set currently after-initialized plugin name.
-		agent.currentlyProcessing = plugin.String()
+	_, wasError := agent.runPhase(AfterInitPhase, agent.afterInitPlugin)
+	agent.timer.setPhaseDuration(AfterInitPhase, time.Since(agent.timer.afterInitStart))
+
+	if wasError != nil {
+		agent.Stop()
+		return wasError
+	}
+
+	return nil
+}
+
+// initPlugin calls InitWithContext() or Init() on a single plugin.
+func (agent *Agent) initPlugin(ctx context.Context, plugin *NamedPlugin) error {
+	if ctxPlugin, ok := plugin.Plugin.(InitContext); ok {
+		return ctxPlugin.InitWithContext(ctx)
+	}
+	return plugin.Init()
+}
+
+// afterInitPlugin calls AfterInitWithContext() or AfterInit() on a single
+// plugin if it implements any of them.
+func (agent *Agent) afterInitPlugin(ctx context.Context, plugin *NamedPlugin) error {
+	// Check if plugin implements AfterInit().
+	if ctxPlugin, ok := plugin.Plugin.(PostInitContext); ok {
+		return ctxPlugin.AfterInitWithContext(ctx)
+	}
+	if postPlugin, ok := plugin.Plugin.(PostInit); ok {
+		return postPlugin.AfterInit()
+	}
+	agent.Debugf("plugin %s: no AfterInit implement", plugin)
+	return nil
+}
+
+// runPhase calls <handler> on every plugin either sequentially (in the order
+// of the plugin list) or, if the parallel initialization is enabled,
+// concurrently for plugins whose dependencies have been already processed.
+// If the handler fails for some plugin or the startup is cancelled,
+// the remaining plugins are skipped.
+// The function returns flags marking plugins for which the handler was called
+// and the first error encountered.
+func (agent *Agent) runPhase(phase Phase, handler pluginHandler) (called []bool, wasError error) {
+	called = make([]bool, len(agent.plugins))
+	if agent.parallelInit {
+		wasError = agent.runParallel(phase, handler, called)
+	} else {
+		for index, plugin := range agent.plugins {
+			// Skip all other plugins if some of them failed.
+			if wasError != nil {
+				break
+			}
+			if wasError = agent.startupCtx.Err(); wasError != nil {
+				break
+			}
+			called[index] = true
+			wasError = agent.callPlugin(phase, plugin, handler)
+		}
+	}
 
-		// Skip all other plugins if some of them failed.
+	for index, plugin := range agent.plugins {
+		if !called[index] {
+			agent.Warnf("plugin %s: %s skipped due to previous error", plugin, phase)
+			agent.timer.recordPlugin(phase, &PluginStartup{PluginName: plugin.PluginName, Skipped: true})
+		}
+	}
+
+	return called, wasError
+}
+
+// runParallel calls <handler> concurrently on all plugins. Every plugin
+// is processed only after the handler has successfully returned for all
+// the plugins it depends on. Once the handler fails, no other plugin
+// is started and the function waits for the running ones to finish.
+func (agent *Agent) runParallel(phase Phase, handler pluginHandler, called []bool) (wasError error) {
+	graph := agent.dependencies()
+	remaining := make([]int, len(agent.plugins))
+	dependents := map[int][]int{}
+	for i := range agent.plugins {
+		remaining[i] = len(graph.deps[i])
+		for _, dep := range graph.deps[i] {
+			dependents[dep] = append(dependents[dep], i)
+		}
+	}
+
+	type result struct {
+		index int
+		err   error
+	}
+	results := make(chan result)
+	running := 0
+	start := func(index int) {
+		if err := agent.startupCtx.Err(); err != nil {
+			if wasError == nil {
+				wasError = err
+			}
+			return
+		}
+		called[index] = true
+		running++
+		go func() {
+			results <- result{index, agent.callPlugin(phase, agent.plugins[index], handler)}
+		}()
+	}
+
+	for i := range agent.plugins {
+		if remaining[i] == 0 {
+			start(i)
+		}
+	}
+	for running > 0 {
+		res := <-results
+		running--
+		if res.err != nil && wasError == nil {
+			wasError = res.err
+		}
 		if wasError != nil {
-			agent.Warnf("plugin %s: AfterInit skipped due to previous error", plugin)
 			continue
 		}
-
-		// Check if plugin implements AfterInit().
-		if postPlugin, ok := plugin.Plugin.(PostInit); ok {
-			pluginStartTime := time.Now()
-			if err := postPlugin.AfterInit(); err != nil {
-				wasError = fmt.Errorf("plugin %s: AfterInit failed: %v", plugin, err)
-				agent.WithField("took", time.Since(pluginStartTime)).Error(wasError)
-			} else {
-				agent.WithField("took", time.Since(pluginStartTime)).Infof("plugin %s: AfterInit ok", plugin)
+		for _, dependent := range dependents[res.index] {
+			remaining[dependent]--
+			if remaining[dependent] == 0 {
+				start(dependent)
 			}
-		} else {
-			agent.Debugf("plugin %s: no AfterInit implement", plugin)
 		}
 	}
-	agent.timer.afterInit = time.Since(agent.timer.afterInitStart)
 
-	if wasError != nil {
-		agent.Stop()
-		return wasError
+	return wasError
+}
+
+// pluginHandler calls a lifecycle method of a plugin.
+type pluginHandler func(ctx context.Context, plugin *NamedPlugin) error
+
+// callPlugin calls <handler> on a single plugin as a part of the agent startup
+// and records the result into the startup report.
+func (agent *Agent) callPlugin(phase Phase, plugin *NamedPlugin, handler pluginHandler) (err error) {
+	agent.startProcessing(plugin)
+	defer agent.stopProcessing(plugin)
+
+	agent.timer.recordPlugin(phase, &PluginStartup{PluginName: plugin.PluginName, InProgress: true, start: time.Now()})
+	took, timedOut, err := agent.invokePlugin(agent.startupCtx, phase, plugin, handler)
+	agent.timer.recordPlugin(phase, &PluginStartup{PluginName: plugin.PluginName, Duration: took, Err: err, TimedOut: timedOut})
+
+	return err
+}
+
+// invokePlugin calls <handler> on a single plugin, logs the result and updates
+// the lifecycle state of the plugin. If a time limit is defined for the plugin,
+// the handler is abandoned after the limit expires (and its context is cancelled)
+// and an error is returned. The same applies if <ctx> is cancelled. The plugin
+// is not closed until its abandoned handler returns (see closePlugin()).
+func (agent *Agent) invokePlugin(ctx context.Context, phase Phase, plugin *NamedPlugin, handler pluginHandler) (
+	took time.Duration, timedOut bool, err error) {
+
+	agent.setState(plugin.PluginName, Initializing, nil)
+
+	pluginStartTime := time.Now()
+	timeout := agent.pluginTimeout(plugin)
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	returned, err := callWithContext(ctx, func(ctx context.Context) error { return handler(ctx, plugin) })
+	took = time.Since(pluginStartTime)
+	if ctx.Err() != nil && err == ctx.Err() {
+		agent.setAbandoned(plugin, returned)
+	}
+
+	timedOut = err != nil && ctx.Err() == context.DeadlineExceeded
+	if timedOut {
+		err = fmt.Errorf("plugin %s: %s not completed within %v", plugin, phase, timeout)
+		agent.WithField("took", took).Error(err)
+	} else if err != nil {
+		err = fmt.Errorf("plugin %s: %s failed: %v", plugin, phase, err)
+		agent.WithField("took", took).Error(err)
+	} else {
+		agent.WithField("took", took).Infof("plugin %s: %s ok", plugin, phase)
+	}
+
+	if err != nil {
+		agent.setState(plugin.PluginName, Failed, err)
+	} else if phase == AfterInitPhase {
+		agent.setState(plugin.PluginName, Ready, nil)
+	}
+	return took, timedOut, err
+}
+
+// closePlugin calls Close() (or CloseWithContext()) on a single plugin and waits
+// at most the close timeout for it to return.
+// If Init()/AfterInit() of the plugin was abandoned, it is given the close
+// timeout to return; Close() is skipped if it is still running afterwards,
+// so that the plugin is never closed while being initialized.
+func (agent *Agent) closePlugin(plugin *NamedPlugin) error {
+	if !agent.waitForAbandoned(plugin) {
+		agent.Warnf("plugin %s: abandoned startup handler still running, Close skipped", plugin)
+		return nil
+	}
+
+	agent.setState(plugin.PluginName, Closing, nil)
+
+	ctx := context.Background()
+	if agent.closeTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, agent.closeTimeout)
+		defer cancel()
+	}
+
+	_, err := callWithContext(ctx, func(ctx context.Context) error {
+		if ctxPlugin, ok := plugin.Plugin.(CloseContext); ok {
+			return ctxPlugin.CloseWithContext(ctx)
+		}
+		return plugin.Close()
+	})
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("Close not completed within %v", agent.closeTimeout)
+	}
+
+	if err != nil {
+		agent.setState(plugin.PluginName, Failed, err)
+	} else {
+		agent.setState(plugin.PluginName, Closed, nil)
+	}
+	return err
+}
+
+// pluginTimeout returns the time limit for a single startup phase of the plugin.
+// The limit set by WithPluginTimeout() option for the plugin takes precedence
+// over the limit declared by the plugin (WithInitTimeout), which takes precedence
+// over the default limit set by WithPluginTimeout() option for all plugins.
+// Zero means no limit.
+func (agent *Agent) pluginTimeout(plugin *NamedPlugin) time.Duration {
+	if timeout, ok := agent.pluginTimeouts[plugin.PluginName]; ok {
+		return timeout
+	}
+	if withTimeout, ok := plugin.Plugin.(WithInitTimeout); ok {
+		if timeout := withTimeout.InitTimeout(); timeout > 0 {
+			return timeout
+		}
+	}
+	return agent.defaultPluginTimeout
+}
+
+// callWithContext calls <handler> and waits until it returns or until
+// the context is done (then the context error is returned).
+// The returned channel is closed once the handler returns, which may happen
+// only after this function returned.
+func callWithContext(ctx context.Context, handler func(ctx context.Context) error) (
+	returned <-chan struct{}, err error) {
+
+	errCh := make(chan error, 1)
+	returnedCh := make(chan struct{})
+	go func() {
+		err := handler(ctx)
+		close(returnedCh)
+		errCh <- err
+	}()
+
+	select {
+	case err := <-errCh:
+		return returnedCh, err
+	case <-ctx.Done():
+		return returnedCh, ctx.Err()
+	}
+}
+
+// setAbandoned records that the startup handler of the plugin was abandoned
+// (it has not returned before <returned> is closed).
+func (agent *Agent) setAbandoned(plugin *NamedPlugin, returned <-chan struct{}) {
+	agent.processingLock.Lock()
+	defer agent.processingLock.Unlock()
+
+	select {
+	case <-returned:
+		return
+	default:
+	}
+	agent.Warnf("plugin %s: startup handler abandoned while still running", plugin)
+	if agent.abandoned == nil {
+		agent.abandoned = make(map[PluginName]<-chan struct{})
+	}
+	agent.abandoned[plugin.PluginName] = returned
+}
+
+// waitForAbandoned waits at most the close timeout for the abandoned startup
+// handler of the plugin (if there is any) to return. It returns false
+// if the handler is still running.
+func (agent *Agent) waitForAbandoned(plugin *NamedPlugin) (returned bool) {
+	agent.processingLock.Lock()
+	returnedCh, found := agent.abandoned[plugin.PluginName]
+	agent.processingLock.Unlock()
+	if !found {
+		return true
+	}
+
+	var timeout <-chan time.Time
+	if agent.closeTimeout > 0 {
+		timeout = time.After(agent.closeTimeout)
+	}
+	select {
+	case <-returnedCh:
+	case <-timeout:
+		return false
+	}
+
+	agent.processingLock.Lock()
+	delete(agent.abandoned, plugin.PluginName)
+	agent.processingLock.Unlock()
+	return true
+}
+
+// startProcessing marks the plugin as currently being processed.
+func (agent *Agent) startProcessing(plugin *NamedPlugin) {
+	agent.processingLock.Lock()
+	defer agent.processingLock.Unlock()
+
+	if agent.currentlyProcessing == nil {
+		agent.currentlyProcessing = make(map[string]struct{})
+	}
+	agent.currentlyProcessing[plugin.String()] = struct{}{}
+}
+
+// stopProcessing removes the plugin from the set of currently processed plugins.
+func (agent *Agent) stopProcessing(plugin *NamedPlugin) {
+	agent.processingLock.Lock()
+	defer agent.processingLock.Unlock()
+
+	delete(agent.currentlyProcessing, plugin.String())
+}
+
+// processing returns comma-separated names of the plugins that are currently
+// being processed.
+func (agent *Agent) processing() string {
+	agent.processingLock.Lock()
+	defer agent.processingLock.Unlock()
+
+	var names []string
+	for name := range agent.currentlyProcessing {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// dependencies returns the dependency graph of the (sorted) plugins.
+func (agent *Agent) dependencies() *dependencyGraph {
+	if agent.graph == nil {
+		agent.graph = newDependencyGraph(agent.plugins)
+	}
+	return agent.graph
+}
+
+// sortPlugins orders the plugins of the agent topologically by the dependencies
+// injected into their Deps fields, so that every plugin is initialized after
+// all plugins it depends on (and closed before them). Plugins that do not
+// depend on each other keep the order in which they were listed in the flavor.
+// Error is returned if the dependencies form a cycle.
+func (agent *Agent) sortPlugins() error {
+	graph := newDependencyGraph(agent.plugins)
+	sorted, err := graph.sort()
+	if err != nil {
+		return err
+	}
+	for i, plugin := range agent.plugins {
+		if deps := graph.dependencies(i); len(deps) > 0 {
+			agent.Debugf("plugin %s depends on %v", plugin, deps)
+		}
 	}
+	agent.plugins = sorted
+	agent.graph = newDependencyGraph(sorted)
 
 	return nil
 }
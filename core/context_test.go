@@ -0,0 +1,180 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ligato/cn-infra/logging"
+	"github.com/onsi/gomega"
+)
+
+func TestInitWithContextTimeout(t *testing.T) {
+	gomega.RegisterTestingT(t)
+
+	plugin := NewContextPlugin()
+	agent := NewAgent(Inject(), WithTimeout(5*time.Second),
+		WithPluginTimeout(50*time.Millisecond),
+		WithPlugin("Context", plugin))
+
+	err := agent.Start()
+	gomega.Expect(err).NotTo(gomega.BeNil())
+	gomega.Eventually(plugin.initCancelled).Should(gomega.BeClosed())
+	gomega.Eventually(plugin.closed).Should(gomega.BeClosed())
+}
+
+func TestStartupTimeoutCancelsContext(t *testing.T) {
+	gomega.RegisterTestingT(t)
+
+	first := &TestPlugin{}
+	plugin := NewContextPlugin()
+	agent := NewAgent(Inject(), WithTimeout(50*time.Millisecond),
+		WithPlugin("First", first),
+		WithPlugin("Context", plugin))
+
+	err := agent.Start()
+	gomega.Expect(err).NotTo(gomega.BeNil())
+	gomega.Eventually(plugin.initCancelled).Should(gomega.BeClosed())
+	// initialized plugins are closed before Start returns
+	gomega.Expect(first.Closed()).To(gomega.BeTrue())
+}
+
+func TestEventLoopCancelStartup(t *testing.T) {
+	gomega.RegisterTestingT(t)
+
+	plugin := NewContextPlugin()
+	agent := NewAgent(Inject(), WithTimeout(5*time.Second), WithPlugin("Context", plugin))
+
+	closeCh := make(chan struct{})
+	errCh := make(chan error)
+	go func() {
+		errCh <- EventLoopWithInterrupt(agent, closeCh)
+	}()
+
+	<-plugin.initStarted
+	close(closeCh)
+
+	select {
+	case err := <-errCh:
+		gomega.Expect(err).NotTo(gomega.BeNil())
+	case <-time.After(time.Second):
+		t.FailNow()
+	}
+	gomega.Eventually(plugin.initCancelled).Should(gomega.BeClosed())
+}
+
+func TestCancelStartupCompletedAnyway(t *testing.T) {
+	gomega.RegisterTestingT(t)
+
+	first := &TestPlugin{}
+	last := &TestPlugin{}
+	agent := NewAgent(Inject(), WithTimeout(5*time.Second),
+		WithPlugin("First", first),
+		WithPlugin("Last", last))
+	// cancel the startup once the last AfterInit has returned, but before
+	// the startup is completed
+	agent.Logger = &cancellingLogger{Logger: agent.Logger, cancel: agent.cancelStartup,
+		when: last.AfterInitialized}
+
+	err := agent.Start()
+	gomega.Expect(err).NotTo(gomega.BeNil())
+	gomega.Expect(last.AfterInitialized()).To(gomega.BeTrue())
+	gomega.Expect(last.Closed()).To(gomega.BeTrue())
+	gomega.Expect(first.Closed()).To(gomega.BeTrue())
+}
+
+func TestCloseWithContextTimeout(t *testing.T) {
+	gomega.RegisterTestingT(t)
+
+	plugin := NewContextPlugin()
+	plugin.blockClose = true
+	other := &TestPlugin{}
+	agent := NewAgent(Inject(), WithCloseTimeout(50*time.Millisecond),
+		WithPlugin("Other", other), WithPlugin("Context", plugin))
+
+	close(plugin.release)
+	gomega.Expect(agent.Start()).To(gomega.BeNil())
+
+	err := agent.Stop()
+	gomega.Expect(err).NotTo(gomega.BeNil())
+	gomega.Eventually(plugin.closeCancelled).Should(gomega.BeClosed())
+	gomega.Expect(other.Closed()).To(gomega.BeTrue())
+}
+
+// ContextPlugin blocks in InitWithContext until released or cancelled.
+type ContextPlugin struct {
+	blockClose bool
+
+	release        chan struct{}
+	initStarted    chan struct{}
+	initCancelled  chan struct{}
+	closeCancelled chan struct{}
+	closed         chan struct{}
+}
+
+func NewContextPlugin() *ContextPlugin {
+	return &ContextPlugin{
+		release:        make(chan struct{}),
+		initStarted:    make(chan struct{}),
+		initCancelled:  make(chan struct{}),
+		closeCancelled: make(chan struct{}),
+		closed:         make(chan struct{}),
+	}
+}
+
+func (p *ContextPlugin) Init() error {
+	panic("InitWithContext is expected to be called")
+}
+
+func (p *ContextPlugin) InitWithContext(ctx context.Context) error {
+	close(p.initStarted)
+	select {
+	case <-p.release:
+		return nil
+	case <-ctx.Done():
+		close(p.initCancelled)
+		return ctx.Err()
+	}
+}
+
+func (p *ContextPlugin) Close() error {
+	panic("CloseWithContext is expected to be called")
+}
+
+func (p *ContextPlugin) CloseWithContext(ctx context.Context) error {
+	if p.blockClose {
+		<-ctx.Done()
+		close(p.closeCancelled)
+	}
+	close(p.closed)
+	return nil
+}
+
+// cancellingLogger calls <cancel> when the agent logs the result of a plugin
+// handler and the <when> condition is true.
+type cancellingLogger struct {
+	logging.Logger
+	cancel context.CancelFunc
+	when   func() bool
+}
+
+func (l *cancellingLogger) WithField(key string, value interface{}) logging.LogWithLevel {
+	if key == "took" && l.when() {
+		l.cancel()
+	}
+	return l.Logger.WithField(key, value)
+}
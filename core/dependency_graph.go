@@ -0,0 +1,249 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+const (
+	// InjectTag is the struct tag that can be used on a field of plugin's Deps
+	// to adjust how the field is treated while building the dependency graph.
+	InjectTag = "inject"
+
+	// InjectIgnore (`inject:"-"`) excludes the field from the dependency graph.
+	InjectIgnore = "-"
+
+	// InjectReverse (`inject:"reverse"`) reverses the direction of the dependency.
+	// It is meant for orchestrating plugins (e.g. resync) that are injected
+	// into the plugins they orchestrate: the injected plugin is initialized
+	// (and after-initialized) after the plugin that holds the reference.
+	InjectReverse = "reverse"
+)
+
+// depsFieldSuffix is a suffix of the plugin struct fields that group injected
+// dependencies (e.g. Deps, ForkDeps).
+const depsFieldSuffix = "Deps"
+
+// dependencyGraph holds dependencies between plugins of the agent.
+type dependencyGraph struct {
+	plugins []*NamedPlugin
+	// deps maps index of a plugin to indexes of the plugins it depends on
+	deps map[int][]int
+}
+
+// newDependencyGraph inspects the Deps fields of the given plugins and builds
+// the graph of dependencies between them. Only references to plugins
+// that are part of the list are taken into account.
+func newDependencyGraph(plugins []*NamedPlugin) *dependencyGraph {
+	graph := &dependencyGraph{plugins: plugins, deps: map[int][]int{}}
+
+	index := map[Plugin]int{}
+	for i, plugin := range plugins {
+		if isComparable(plugin.Plugin) {
+			index[plugin.Plugin] = i
+		}
+	}
+
+	for i, plugin := range plugins {
+		inspectPluginDeps(plugin.Plugin, func(dep Plugin, reverse bool) {
+			j, found := index[dep]
+			if !found || i == j {
+				return
+			}
+			if reverse {
+				graph.addDependency(j, i)
+			} else {
+				graph.addDependency(i, j)
+			}
+		})
+	}
+
+	return graph
+}
+
+// addDependency records that plugin <from> depends on plugin <to>.
+func (graph *dependencyGraph) addDependency(from, to int) {
+	for _, dep := range graph.deps[from] {
+		if dep == to {
+			return
+		}
+	}
+	graph.deps[from] = append(graph.deps[from], to)
+}
+
+// dependencies returns names of the plugins that the given plugin depends on.
+func (graph *dependencyGraph) dependencies(plugin int) []*NamedPlugin {
+	var ret []*NamedPlugin
+	for _, dep := range graph.deps[plugin] {
+		ret = append(ret, graph.plugins[dep])
+	}
+	return ret
+}
+
+// sort returns the plugins ordered so that every plugin follows all its
+// dependencies. Plugins without mutual dependencies preserve their original
+// order. If the graph contains a cycle, an error describing the cycle is returned.
+func (graph *dependencyGraph) sort() ([]*NamedPlugin, error) {
+	remaining := make([]int, len(graph.plugins))
+	for i := range graph.plugins {
+		remaining[i] = len(graph.deps[i])
+	}
+	dependents := map[int][]int{}
+	for i := range graph.plugins {
+		for _, dep := range graph.deps[i] {
+			dependents[dep] = append(dependents[dep], i)
+		}
+	}
+
+	sorted := make([]*NamedPlugin, 0, len(graph.plugins))
+	done := make([]bool, len(graph.plugins))
+	for len(sorted) < len(graph.plugins) {
+		// pick the first plugin (in the original order) with all dependencies resolved
+		next := -1
+		for i := range graph.plugins {
+			if !done[i] && remaining[i] == 0 {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			return nil, graph.cycleError(done)
+		}
+		done[next] = true
+		sorted = append(sorted, graph.plugins[next])
+		for _, dependent := range dependents[next] {
+			remaining[dependent]--
+		}
+	}
+
+	return sorted, nil
+}
+
+// cycleError finds a cycle among the plugins that could not be sorted
+// and returns a readable error describing it.
+func (graph *dependencyGraph) cycleError(done []bool) error {
+	const (
+		unvisited = iota
+		inProgress
+		visited
+	)
+	state := make([]int, len(graph.plugins))
+	var path []int
+	var cycle []int
+
+	var visit func(i int) bool
+	visit = func(i int) bool {
+		state[i] = inProgress
+		path = append(path, i)
+		for _, dep := range graph.deps[i] {
+			if done[dep] {
+				continue
+			}
+			if state[dep] == inProgress {
+				for k, p := range path {
+					if p == dep {
+						cycle = append(append(cycle, path[k:]...), dep)
+						break
+					}
+				}
+				return true
+			}
+			if state[dep] == unvisited && visit(dep) {
+				return true
+			}
+		}
+		path = path[:len(path)-1]
+		state[i] = visited
+		return false
+	}
+
+	for i := range graph.plugins {
+		if !done[i] && state[i] == unvisited && visit(i) {
+			break
+		}
+	}
+
+	var names []string
+	for _, i := range cycle {
+		names = append(names, graph.plugins[i].String())
+	}
+	return fmt.Errorf("plugin dependency cycle detected: %s", strings.Join(names, " -> "))
+}
+
+// inspectPluginDeps calls <visit> for every plugin referenced from the fields
+// of the plugin struct whose names end with "Deps" (nested structs included).
+func inspectPluginDeps(plugin Plugin, visit func(dep Plugin, reverse bool)) {
+	val := reflect.ValueOf(plugin)
+	for val.Kind() == reflect.Ptr || val.Kind() == reflect.Interface {
+		if val.IsNil() {
+			return
+		}
+		val = val.Elem()
+	}
+	if val.Kind() != reflect.Struct {
+		return
+	}
+
+	typ := val.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.PkgPath != "" || !strings.HasSuffix(field.Name, depsFieldSuffix) {
+			continue
+		}
+		inspectDepsValue(val.Field(i), field.Tag.Get(InjectTag), visit)
+	}
+}
+
+// inspectDepsValue recursively walks through structs nested in the Deps
+// and reports every pointer or interface field that refers to a plugin
+// (or to a ProvidedDependency, in which case the providing plugin is reported).
+func inspectDepsValue(val reflect.Value, tag string, visit func(dep Plugin, reverse bool)) {
+	if tag == InjectIgnore {
+		return
+	}
+
+	switch val.Kind() {
+	case reflect.Struct:
+		typ := val.Type()
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			if field.PkgPath != "" {
+				continue // unexported
+			}
+			inspectDepsValue(val.Field(i), field.Tag.Get(InjectTag), visit)
+		}
+	case reflect.Ptr, reflect.Interface:
+		if val.IsNil() || !val.CanInterface() {
+			return
+		}
+		if dep, ok := val.Interface().(Plugin); ok {
+			if isComparable(dep) {
+				visit(dep, tag == InjectReverse)
+			}
+		} else if provided, ok := val.Interface().(ProvidedDependency); ok {
+			if dep := provided.ProvidedBy(); isComparable(dep) {
+				visit(dep, tag == InjectReverse)
+			}
+		}
+	}
+}
+
+// isComparable checks if the plugin can be used as a map key.
+func isComparable(plugin Plugin) bool {
+	return plugin != nil && reflect.TypeOf(plugin).Comparable()
+}
@@ -0,0 +1,311 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ligato/cn-infra/logging/logrus"
+	"github.com/onsi/gomega"
+)
+
+func TestSortPluginsWithoutDeps(t *testing.T) {
+	gomega.RegisterTestingT(t)
+
+	plugins := []*NamedPlugin{{"First", &TestPlugin{}},
+		{"Second", &TestPlugin{}},
+		{"Third", &TestPlugin{}}}
+
+	sorted, err := newDependencyGraph(plugins).sort()
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(pluginNames(sorted)).To(gomega.Equal([]string{"First", "Second", "Third"}))
+}
+
+func TestSortPluginsByDeps(t *testing.T) {
+	gomega.RegisterTestingT(t)
+
+	db := &DepsPlugin{}
+	dbSync := &DepsPlugin{}
+	app := &DepsPlugin{}
+	other := &DepsPlugin{}
+	dbSync.Deps.DB = db
+	app.Deps.Nested.Sync = dbSync
+	app.Deps.Plugin = db
+
+	plugins := []*NamedPlugin{{"App", app},
+		{"Other", other},
+		{"Sync", dbSync},
+		{"DB", db}}
+
+	sorted, err := newDependencyGraph(plugins).sort()
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(pluginNames(sorted)).To(gomega.Equal([]string{"Other", "DB", "Sync", "App"}))
+}
+
+// providedConfig is a dependency provided by a plugin.
+type providedConfig struct {
+	provider Plugin
+}
+
+func (cfg *providedConfig) ProvidedBy() Plugin {
+	return cfg.provider
+}
+
+func TestSortPluginsProvidedDependency(t *testing.T) {
+	gomega.RegisterTestingT(t)
+
+	db := &DepsPlugin{}
+	configurator := &DepsPlugin{}
+	app := &DepsPlugin{}
+	configurator.Deps.DB = db
+	app.Deps.Config = &providedConfig{provider: configurator}
+
+	plugins := []*NamedPlugin{{"App", app},
+		{"Configurator", configurator},
+		{"DB", db}}
+
+	sorted, err := newDependencyGraph(plugins).sort()
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(pluginNames(sorted)).To(gomega.Equal([]string{"DB", "Configurator", "App"}))
+}
+
+func TestSortPluginsInjectTags(t *testing.T) {
+	gomega.RegisterTestingT(t)
+
+	orch := &DepsPlugin{}
+	db := &DepsPlugin{}
+	ignored := &DepsPlugin{}
+	db.Deps.Orchestrator = orch
+	db.Deps.Ignored = ignored
+
+	plugins := []*NamedPlugin{{"Orchestrator", orch},
+		{"Ignored", ignored},
+		{"DB", db}}
+
+	sorted, err := newDependencyGraph(plugins).sort()
+	gomega.Expect(err).To(gomega.BeNil())
+	gomega.Expect(pluginNames(sorted)).To(gomega.Equal([]string{"Ignored", "DB", "Orchestrator"}))
+}
+
+func TestSortPluginsCycle(t *testing.T) {
+	gomega.RegisterTestingT(t)
+
+	first := &DepsPlugin{}
+	second := &DepsPlugin{}
+	third := &DepsPlugin{}
+	first.Deps.DB = second
+	second.Deps.DB = third
+	third.Deps.DB = first
+
+	plugins := []*NamedPlugin{{"Independent", &TestPlugin{}},
+		{"First", first},
+		{"Second", second},
+		{"Third", third}}
+
+	_, err := newDependencyGraph(plugins).sort()
+	gomega.Expect(err).NotTo(gomega.BeNil())
+	gomega.Expect(err.Error()).To(gomega.Equal(
+		"plugin dependency cycle detected: First -> Second -> Third -> First"))
+
+	agent := NewAgentDeprecated(logrus.DefaultLogger(), 100*time.Millisecond, plugins...)
+	err = agent.Start()
+	gomega.Expect(err).NotTo(gomega.BeNil())
+	gomega.Expect(first.initOrder).To(gomega.BeZero())
+}
+
+func TestAgentDependencyOrder(t *testing.T) {
+	gomega.RegisterTestingT(t)
+
+	var order lifecycleOrder
+	db := &DepsPlugin{order: &order}
+	app := &DepsPlugin{order: &order}
+	app.Deps.DB = db
+
+	agent := NewAgentDeprecated(logrus.DefaultLogger(), 100*time.Millisecond,
+		&NamedPlugin{"App", app}, &NamedPlugin{"DB", db})
+	gomega.Expect(agent.Start()).To(gomega.BeNil())
+	gomega.Expect(db.initOrder).To(gomega.BeNumerically("<", app.initOrder))
+
+	gomega.Expect(agent.Stop()).To(gomega.BeNil())
+	gomega.Expect(app.closeOrder).To(gomega.BeNumerically("<", db.closeOrder))
+}
+
+func pluginNames(plugins []*NamedPlugin) (names []string) {
+	for _, plugin := range plugins {
+		names = append(names, plugin.String())
+	}
+	return names
+}
+
+type lifecycleOrder struct {
+	sync.Mutex
+	counter int
+}
+
+func (o *lifecycleOrder) next() int {
+	if o == nil {
+		return 0
+	}
+	o.Lock()
+	defer o.Unlock()
+	o.counter++
+	return o.counter
+}
+
+type DepsPlugin struct {
+	Deps struct {
+		DB     Plugin
+		Plugin *DepsPlugin
+		Nested struct {
+			Sync *DepsPlugin
+		}
+		Orchestrator Plugin `inject:"reverse"`
+		Ignored      Plugin `inject:"-"`
+		Config       interface{}
+	}
+
+	order       *lifecycleOrder
+	initOrder   int
+	closeOrder  int
+	restartable bool
+	initErr     error
+}
+
+func (p *DepsPlugin) Init() error {
+	p.initOrder = p.order.next()
+	return p.initErr
+}
+
+func (p *DepsPlugin) CanRestart() bool {
+	return p.restartable
+}
+
+func (p *DepsPlugin) Close() error {
+	p.closeOrder = p.order.next()
+	return nil
+}
+
+func TestParallelInit(t *testing.T) {
+	gomega.RegisterTestingT(t)
+
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+	first := &BlockingPlugin{started: started, release: release}
+	second := &BlockingPlugin{started: started, release: release}
+	dependent := &BlockingPlugin{}
+	dependent.Deps.First = first
+	dependent.Deps.Second = second
+
+	agent := NewAgent(Inject(), WithParallelInit(), WithTimeout(time.Second),
+		WithPlugin("Dependent", dependent), WithPlugin("First", first), WithPlugin("Second", second))
+
+	errCh := make(chan error)
+	go func() {
+		errCh <- agent.Start()
+	}()
+
+	// both independent plugins are initialized at the same time
+	for i := 0; i < 2; i++ {
+		select {
+		case <-started:
+		case <-time.After(500 * time.Millisecond):
+			t.Fatal("independent plugins were not initialized concurrently")
+		}
+	}
+	gomega.Expect(dependent.Initialized()).To(gomega.BeFalse())
+	close(release)
+
+	gomega.Expect(<-errCh).To(gomega.BeNil())
+	gomega.Expect(dependent.Initialized()).To(gomega.BeTrue())
+	gomega.Expect(agent.timer.plugins[InitPhase]).To(gomega.HaveKey(PluginName("First")))
+	gomega.Expect(agent.timer.plugins[InitPhase]).To(gomega.HaveKey(PluginName("Dependent")))
+	gomega.Expect(agent.Stop()).To(gomega.BeNil())
+}
+
+func TestParallelInitFailed(t *testing.T) {
+	gomega.RegisterTestingT(t)
+
+	failing := &BlockingPlugin{failInit: true}
+	independent := &BlockingPlugin{}
+	dependent := &BlockingPlugin{}
+	dependent.Deps.First = failing
+
+	agent := NewAgent(Inject(), WithParallelInit(), WithTimeout(time.Second),
+		WithPlugin("Failing", failing), WithPlugin("Independent", independent), WithPlugin("Dependent", dependent))
+
+	err := agent.Start()
+	gomega.Expect(err).NotTo(gomega.BeNil())
+
+	gomega.Expect(failing.Closed()).To(gomega.BeTrue())
+	gomega.Expect(independent.Initialized()).To(gomega.BeTrue())
+	gomega.Expect(independent.Closed()).To(gomega.BeTrue())
+	// skipped plugin is neither initialized nor closed
+	gomega.Expect(dependent.Initialized()).To(gomega.BeFalse())
+	gomega.Expect(dependent.Closed()).To(gomega.BeFalse())
+}
+
+type BlockingPlugin struct {
+	Deps struct {
+		First  Plugin
+		Second Plugin
+	}
+
+	failInit bool
+	started  chan struct{}
+	release  chan struct{}
+
+	sync.Mutex
+	initCalled  bool
+	closeCalled bool
+}
+
+func (p *BlockingPlugin) Init() error {
+	if p.started != nil {
+		p.started <- struct{}{}
+	}
+	if p.release != nil {
+		<-p.release
+	}
+
+	p.Lock()
+	defer p.Unlock()
+	p.initCalled = true
+	if p.failInit {
+		return fmt.Errorf("Init failed")
+	}
+	return nil
+}
+
+func (p *BlockingPlugin) Close() error {
+	p.Lock()
+	defer p.Unlock()
+	p.closeCalled = true
+	return nil
+}
+
+func (p *BlockingPlugin) Initialized() bool {
+	p.Lock()
+	defer p.Unlock()
+	return p.initCalled
+}
+
+func (p *BlockingPlugin) Closed() bool {
+	p.Lock()
+	defer p.Unlock()
+	return p.closeCalled
+}
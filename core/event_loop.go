@@ -22,21 +22,59 @@ import (
 
 // EventLoopWithInterrupt starts an instance of the agent created with NewAgent().
 // Agent is stopped when <closeChan> is closed, a user interrupt (SIGINT), or a
-// terminate signal (SIGTERM) is received.
+// terminate signal (SIGTERM) is received. If any of these happens while the agent
+// is still starting, the startup is cancelled (see Agent.Start()).
+// A hangup signal (SIGHUP) received after the startup triggers reload
+// of the configuration of the plugins (see Agent.Reload()).
 func EventLoopWithInterrupt(agent *Agent, closeChan chan struct{}) error {
-	err := agent.Start()
-	if err != nil {
-		agent.Error("Error loading core: ", err)
-		return err
-	}
-
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt)
 	signal.Notify(sigChan, syscall.SIGTERM)
+	defer signal.Stop(sigChan)
+
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
+	defer signal.Stop(hupChan)
+
+	startChan := make(chan error, 1)
+	go func() {
+		startChan <- agent.Start()
+	}()
+
+	var (
+		err           error
+		stopRequested bool // the startup was interrupted (it may have completed anyway)
+	)
 	select {
+	case err = <-startChan:
 	case <-sigChan:
-		agent.Println("Interrupt received, returning.")
+		agent.Println("Interrupt received during startup, cancelling.")
+		agent.cancelStartup()
+		err = <-startChan
+		stopRequested = true
 	case <-closeChan:
+		agent.cancelStartup()
+		err = <-startChan
+		stopRequested = true
+	}
+	if err != nil {
+		agent.Error("Error loading core: ", err)
+		return err
+	}
+
+	for !stopRequested {
+		select {
+		case <-hupChan:
+			agent.Println("Hangup received, reloading configuration.")
+			if err := agent.Reload(); err != nil {
+				agent.Errorf("Reload of configuration failed: %v", err)
+			}
+			continue
+		case <-sigChan:
+			agent.Println("Interrupt received, returning.")
+		case <-closeChan:
+		}
+		break
 	}
 
 	err = agent.Stop()
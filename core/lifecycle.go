@@ -0,0 +1,286 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// LifecycleState describes the state of a plugin in its lifecycle.
+type LifecycleState string
+
+const (
+	// Created is the state of a plugin before its initialization.
+	Created LifecycleState = "created"
+	// Initializing is the state of a plugin during Init() and AfterInit().
+	Initializing LifecycleState = "initializing"
+	// Ready is the state of a plugin after successful AfterInit().
+	Ready LifecycleState = "ready"
+	// Failed is the state of a plugin whose Init(), AfterInit() or Close() failed.
+	Failed LifecycleState = "failed"
+	// Closing is the state of a plugin during Close().
+	Closing LifecycleState = "closing"
+	// Closed is the state of a plugin after Close().
+	Closed LifecycleState = "closed"
+)
+
+// lifecycleTransitions lists allowed transitions between the lifecycle states.
+var lifecycleTransitions = map[LifecycleState][]LifecycleState{
+	Created:      {Initializing, Closing},
+	Initializing: {Ready, Failed, Closing},
+	Ready:        {Closing},
+	Failed:       {Initializing, Closing},
+	Closing:      {Closed, Failed},
+	Closed:       {Initializing, Closing},
+}
+
+// LifecycleEvent describes a transition of a plugin between two lifecycle states.
+type LifecycleEvent struct {
+	PluginName PluginName
+	From       LifecycleState
+	To         LifecycleState
+	// Err is set for transitions to the Failed state.
+	Err  error
+	Time time.Time
+}
+
+// LifecycleWatcher allows to inspect and control the lifecycle of the plugins
+// of an agent. It is implemented by Agent.
+type LifecycleWatcher interface {
+	// PluginState returns the current lifecycle state of the plugin.
+	PluginState(pluginName PluginName) LifecycleState
+
+	// PluginStates returns the current lifecycle states of all plugins.
+	PluginStates() map[PluginName]LifecycleState
+
+	// WatchLifecycle registers a channel that receives every lifecycle transition
+	// of every plugin. The events are not delivered if the channel is full
+	// (buffered channel is recommended). The returned function unregisters the channel.
+	WatchLifecycle(events chan LifecycleEvent) (unregister func())
+
+	// RestartPlugin closes and re-initializes the plugin together with all
+	// plugins that (transitively) depend on it (all of them must be Restartable).
+	RestartPlugin(pluginName PluginName) error
+
+	// Reload re-reads the configuration of all Reloadable plugins and applies
+	// the changes (see Agent.Reload()).
+	Reload() error
+}
+
+// lifecycle holds lifecycle states of plugins and registered watchers.
+type lifecycle struct {
+	access   sync.Mutex
+	states   map[PluginName]LifecycleState
+	watchers map[int]chan LifecycleEvent
+	lastID   int
+
+	// serializes restarts of plugins and reloads of their configuration
+	restartLock sync.Mutex
+}
+
+// initLifecycle sets all plugins to the Created state and passes the agent
+// to the plugins that observe the lifecycle.
+func (agent *Agent) initLifecycle() {
+	agent.lifecycle.access.Lock()
+	agent.lifecycle.states = make(map[PluginName]LifecycleState)
+	for _, plugin := range agent.plugins {
+		agent.lifecycle.states[plugin.PluginName] = Created
+	}
+	agent.lifecycle.access.Unlock()
+
+	for _, plugin := range agent.plugins {
+		if aware, ok := plugin.Plugin.(LifecycleAware); ok {
+			aware.SetLifecycleWatcher(agent)
+		}
+	}
+}
+
+// setState changes the lifecycle state of the plugin and notifies the watchers.
+func (agent *Agent) setState(pluginName PluginName, state LifecycleState, err error) {
+	agent.lifecycle.access.Lock()
+	defer agent.lifecycle.access.Unlock()
+
+	if agent.lifecycle.states == nil {
+		agent.lifecycle.states = make(map[PluginName]LifecycleState)
+	}
+	from, found := agent.lifecycle.states[pluginName]
+	if !found {
+		from = Created
+	}
+	if from == state {
+		return
+	}
+	if !isAllowedTransition(from, state) {
+		agent.Warnf("plugin %s: unexpected lifecycle transition %s -> %s", pluginName, from, state)
+	}
+	agent.lifecycle.states[pluginName] = state
+
+	event := LifecycleEvent{PluginName: pluginName, From: from, To: state, Err: err, Time: time.Now()}
+	for _, watcher := range agent.lifecycle.watchers {
+		select {
+		case watcher <- event:
+		default:
+			agent.Warnf("plugin %s: lifecycle event %s -> %s dropped (watcher channel full)",
+				pluginName, from, state)
+		}
+	}
+}
+
+// isAllowedTransition checks the transition against lifecycleTransitions.
+func isAllowedTransition(from, to LifecycleState) bool {
+	for _, allowed := range lifecycleTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// PluginState returns the current lifecycle state of the plugin
+// (empty string if the agent does not contain the plugin).
+func (agent *Agent) PluginState(pluginName PluginName) LifecycleState {
+	agent.lifecycle.access.Lock()
+	defer agent.lifecycle.access.Unlock()
+
+	return agent.lifecycle.states[pluginName]
+}
+
+// PluginStates returns the current lifecycle states of all plugins.
+func (agent *Agent) PluginStates() map[PluginName]LifecycleState {
+	agent.lifecycle.access.Lock()
+	defer agent.lifecycle.access.Unlock()
+
+	states := make(map[PluginName]LifecycleState, len(agent.lifecycle.states))
+	for pluginName, state := range agent.lifecycle.states {
+		states[pluginName] = state
+	}
+	return states
+}
+
+// WatchLifecycle registers a channel that receives every lifecycle transition
+// of every plugin. The events are not delivered if the channel is full
+// (buffered channel is recommended). The returned function unregisters the channel.
+func (agent *Agent) WatchLifecycle(events chan LifecycleEvent) (unregister func()) {
+	agent.lifecycle.access.Lock()
+	defer agent.lifecycle.access.Unlock()
+
+	if agent.lifecycle.watchers == nil {
+		agent.lifecycle.watchers = make(map[int]chan LifecycleEvent)
+	}
+	agent.lifecycle.lastID++
+	id := agent.lifecycle.lastID
+	agent.lifecycle.watchers[id] = events
+
+	return func() {
+		agent.lifecycle.access.Lock()
+		defer agent.lifecycle.access.Unlock()
+
+		delete(agent.lifecycle.watchers, id)
+	}
+}
+
+// RestartPlugin closes and re-initializes (Init() followed by AfterInit())
+// the plugin together with all plugins that (transitively) depend on it.
+// The dependent plugins are closed before the plugin and initialized after it.
+// The plugin can be restarted only after the agent has started and only
+// if the plugin and all its dependents implement Restartable.
+// If re-initialization of any plugin fails, the remaining plugins are not
+// initialized, the already initialized ones are closed again (all affected
+// plugins end up Closed and can be restarted later) and the error is returned.
+func (agent *Agent) RestartPlugin(pluginName PluginName) error {
+	agent.lifecycle.restartLock.Lock()
+	defer agent.lifecycle.restartLock.Unlock()
+
+	index := -1
+	for i, plugin := range agent.plugins {
+		if plugin.PluginName == pluginName {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return fmt.Errorf("plugin %s not found", pluginName)
+	}
+	switch state := agent.PluginState(pluginName); state {
+	case Ready, Failed, Closed:
+	default:
+		return fmt.Errorf("plugin %s cannot be restarted in state %s", pluginName, state)
+	}
+
+	affected := agent.dependents(index)
+	for _, plugin := range affected {
+		if restartable, ok := plugin.Plugin.(Restartable); !ok || !restartable.CanRestart() {
+			return fmt.Errorf("plugin %s cannot be restarted: plugin %s is not restartable", pluginName, plugin)
+		}
+	}
+	agent.Infof("Restarting plugin %s (affected plugins: %v)", pluginName, affected)
+
+	agent.closePlugins(affected)
+	initialized := 0
+	for _, handler := range []struct {
+		phase   Phase
+		handler pluginHandler
+	}{{InitPhase, agent.initPlugin}, {AfterInitPhase, agent.afterInitPlugin}} {
+		for i, plugin := range affected {
+			if handler.phase == InitPhase {
+				initialized = i + 1
+			}
+			if _, _, err := agent.invokePlugin(context.Background(), handler.phase, plugin, handler.handler); err != nil {
+				// do not leave plugins initialized only partially
+				agent.closePlugins(affected[:initialized])
+				return err
+			}
+		}
+	}
+
+	agent.Infof("Plugin %s restarted", pluginName)
+	return nil
+}
+
+// closePlugins closes the plugins in the reverse order.
+func (agent *Agent) closePlugins(plugins []*NamedPlugin) {
+	for i := len(plugins) - 1; i >= 0; i-- {
+		if err := agent.closePlugin(plugins[i]); err != nil {
+			agent.Warnf("plugin %s: Close failed: %v", plugins[i], err)
+		}
+	}
+}
+
+// dependents returns the plugin at the given index together with all plugins
+// that (transitively) depend on it, in the order of initialization.
+func (agent *Agent) dependents(index int) []*NamedPlugin {
+	graph := agent.dependencies()
+	affected := map[int]bool{index: true}
+	// plugins are sorted, therefore dependents always follow their dependencies
+	for i := index + 1; i < len(agent.plugins); i++ {
+		for _, dep := range graph.deps[i] {
+			if affected[dep] {
+				affected[i] = true
+				break
+			}
+		}
+	}
+
+	var ret []*NamedPlugin
+	for i, plugin := range agent.plugins {
+		if affected[i] {
+			ret = append(ret, plugin)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,168 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ligato/cn-infra/logging/logrus"
+	"github.com/onsi/gomega"
+)
+
+func TestLifecycleStates(t *testing.T) {
+	gomega.RegisterTestingT(t)
+
+	agent := NewAgentDeprecated(logrus.DefaultLogger(), time.Second,
+		&NamedPlugin{"First", &TestPlugin{}},
+		&NamedPlugin{"Second", NewTestPlugin(false, true, false)},
+		&NamedPlugin{"Third", &TestPlugin{}})
+
+	events := make(chan LifecycleEvent, 100)
+	unregister := agent.WatchLifecycle(events)
+	defer unregister()
+
+	gomega.Expect(agent.Start()).NotTo(gomega.BeNil())
+	gomega.Expect(agent.PluginStates()).To(gomega.Equal(map[PluginName]LifecycleState{
+		"First":  Closed,
+		"Second": Closed,
+		"Third":  Closed,
+	}))
+
+	var second []LifecycleState
+	for len(events) > 0 {
+		event := <-events
+		if event.PluginName == "Second" {
+			second = append(second, event.To)
+			if event.To == Failed {
+				gomega.Expect(event.Err).NotTo(gomega.BeNil())
+			}
+		}
+	}
+	gomega.Expect(second).To(gomega.Equal([]LifecycleState{Initializing, Failed, Closing, Closed}))
+}
+
+func TestRestartPlugin(t *testing.T) {
+	gomega.RegisterTestingT(t)
+
+	var order lifecycleOrder
+	db := &DepsPlugin{order: &order, restartable: true}
+	app := &DepsPlugin{order: &order, restartable: true}
+	other := &DepsPlugin{order: &order}
+	app.Deps.DB = db
+
+	agent := NewAgentDeprecated(logrus.DefaultLogger(), time.Second,
+		&NamedPlugin{"App", app}, &NamedPlugin{"DB", db}, &NamedPlugin{"Other", other})
+
+	gomega.Expect(agent.RestartPlugin("DB")).NotTo(gomega.BeNil())
+	gomega.Expect(agent.Start()).To(gomega.BeNil())
+	gomega.Expect(agent.PluginState("DB")).To(gomega.Equal(Ready))
+
+	events := make(chan LifecycleEvent, 100)
+	agent.WatchLifecycle(events)
+
+	gomega.Expect(agent.RestartPlugin("Unknown")).NotTo(gomega.BeNil())
+	gomega.Expect(agent.RestartPlugin("DB")).To(gomega.BeNil())
+
+	// dependent plugin is closed first and initialized last
+	gomega.Expect(app.closeOrder).To(gomega.BeNumerically("<", db.closeOrder))
+	gomega.Expect(db.initOrder).To(gomega.BeNumerically("<", app.initOrder))
+	gomega.Expect(other.closeOrder).To(gomega.BeZero())
+
+	gomega.Expect(agent.PluginStates()).To(gomega.Equal(map[PluginName]LifecycleState{
+		"App":   Ready,
+		"DB":    Ready,
+		"Other": Ready,
+	}))
+	gomega.Expect(events).To(gomega.HaveLen(8))
+
+	// plugins not implementing Restartable are not restarted
+	gomega.Expect(agent.RestartPlugin("Other")).NotTo(gomega.BeNil())
+	gomega.Expect(other.closeOrder).To(gomega.BeZero())
+	gomega.Expect(agent.PluginState("Other")).To(gomega.Equal(Ready))
+}
+
+func TestRestartNotRestartableDependent(t *testing.T) {
+	gomega.RegisterTestingT(t)
+
+	var order lifecycleOrder
+	db := &DepsPlugin{order: &order, restartable: true}
+	app := &DepsPlugin{order: &order, restartable: true}
+	legacy := &DepsPlugin{order: &order}
+	app.Deps.DB = db
+	legacy.Deps.Plugin = app
+
+	agent := NewAgentDeprecated(logrus.DefaultLogger(), time.Second,
+		&NamedPlugin{"Legacy", legacy}, &NamedPlugin{"App", app}, &NamedPlugin{"DB", db})
+	gomega.Expect(agent.Start()).To(gomega.BeNil())
+
+	// the transitive dependent cannot be restarted, nothing is closed
+	gomega.Expect(agent.RestartPlugin("DB")).NotTo(gomega.BeNil())
+	gomega.Expect(db.closeOrder).To(gomega.BeZero())
+	gomega.Expect(app.closeOrder).To(gomega.BeZero())
+	gomega.Expect(legacy.closeOrder).To(gomega.BeZero())
+
+	// neither the plugin itself
+	gomega.Expect(agent.RestartPlugin("Legacy")).NotTo(gomega.BeNil())
+
+	// once all dependents are restartable, the plugin is restarted with them
+	legacy.restartable = true
+	gomega.Expect(agent.RestartPlugin("App")).To(gomega.BeNil())
+	gomega.Expect(legacy.closeOrder).To(gomega.BeNumerically("<", app.closeOrder))
+	gomega.Expect(app.initOrder).To(gomega.BeNumerically("<", legacy.initOrder))
+	gomega.Expect(db.closeOrder).To(gomega.BeZero())
+	gomega.Expect(agent.PluginStates()).To(gomega.Equal(map[PluginName]LifecycleState{
+		"Legacy": Ready,
+		"App":    Ready,
+		"DB":     Ready,
+	}))
+}
+
+func TestRestartInitFailure(t *testing.T) {
+	gomega.RegisterTestingT(t)
+
+	var order lifecycleOrder
+	db := &DepsPlugin{order: &order, restartable: true}
+	app := &DepsPlugin{order: &order, restartable: true}
+	other := &DepsPlugin{order: &order, restartable: true}
+	app.Deps.DB = db
+	other.Deps.DB = db
+
+	agent := NewAgentDeprecated(logrus.DefaultLogger(), time.Second,
+		&NamedPlugin{"App", app}, &NamedPlugin{"DB", db}, &NamedPlugin{"Other", other})
+	gomega.Expect(agent.Start()).To(gomega.BeNil())
+
+	// Init of the first dependent fails - the re-initialized DB is closed
+	// again and the other dependent is not initialized
+	app.initErr = errors.New("init failed")
+	gomega.Expect(agent.RestartPlugin("DB")).NotTo(gomega.BeNil())
+	gomega.Expect(db.closeOrder).To(gomega.BeNumerically(">", app.initOrder))
+	gomega.Expect(other.initOrder).To(gomega.BeNumerically("<", other.closeOrder))
+	gomega.Expect(agent.PluginStates()).To(gomega.Equal(map[PluginName]LifecycleState{
+		"App":   Closed,
+		"DB":    Closed,
+		"Other": Closed,
+	}))
+
+	// all affected plugins are initialized once the failure is gone
+	app.initErr = nil
+	gomega.Expect(agent.RestartPlugin("DB")).To(gomega.BeNil())
+	gomega.Expect(agent.PluginStates()).To(gomega.Equal(map[PluginName]LifecycleState{
+		"App":   Ready,
+		"DB":    Ready,
+		"Other": Ready,
+	}))
+}
@@ -52,12 +52,59 @@ func WithLogger(logger logging.Logger) *WithLoggerOpt {
 // OptionMarkerCore is just for marking implementation that implements this interface.
 func (marker *WithLoggerOpt) OptionMarkerCore() {}
 
+// WithParallelInitOpt enables concurrent initialization of independent plugins.
+type WithParallelInitOpt struct{}
+
+// WithParallelInit creates an option for NewAgent() that enables concurrent
+// Init() and AfterInit() of plugins. A plugin is started as soon as all plugins
+// it depends on (see Agent.Start()) have been successfully processed.
+func WithParallelInit() *WithParallelInitOpt {
+	return &WithParallelInitOpt{}
+}
+
+// OptionMarkerCore is just for marking implementation that implements this interface.
+func (marker *WithParallelInitOpt) OptionMarkerCore() {}
+
+// WithPluginTimeoutOpt defines the maximum duration of Init() and AfterInit() of plugins.
+type WithPluginTimeoutOpt struct {
+	Timeout time.Duration
+	Plugins []PluginName
+}
+
+// WithPluginTimeout creates an option for NewAgent() that limits the duration
+// of Init() and of AfterInit() (each of them separately) of the listed plugins,
+// or of all plugins if none is listed. The limit set for a particular plugin
+// overrides the limit declared by the plugin itself (see WithInitTimeout interface).
+func WithPluginTimeout(timeout time.Duration, plugins ...PluginName) *WithPluginTimeoutOpt {
+	return &WithPluginTimeoutOpt{Timeout: timeout, Plugins: plugins}
+}
+
+// OptionMarkerCore is just for marking implementation that implements this interface.
+func (marker *WithPluginTimeoutOpt) OptionMarkerCore() {}
+
+// WithCloseTimeoutOpt defines the maximum duration of Close() of a single plugin.
+type WithCloseTimeoutOpt struct {
+	Timeout time.Duration
+}
+
+// WithCloseTimeout creates an option for NewAgent() that limits the duration
+// of Close() of every plugin (DefaultCloseTimeout is used otherwise).
+// Zero means no limit.
+func WithCloseTimeout(timeout time.Duration) *WithCloseTimeoutOpt {
+	return &WithCloseTimeoutOpt{Timeout: timeout}
+}
+
+// OptionMarkerCore is just for marking implementation that implements this interface.
+func (marker *WithCloseTimeoutOpt) OptionMarkerCore() {}
+
 // WithPluginsOpt is used in NewAgent()
 type WithPluginsOpt interface {
 	Option
 
 	// return list named plugins with injected dependencies
+	// the plugins are ordered by their dependencies (injected in Deps),
 	// the order in list impacts the order of Init(), AfterInit(), Close() sequence
+	// only for the plugins that do not depend on each other
 	Plugins(...Flavor) []*NamedPlugin
 }
 
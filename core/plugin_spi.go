@@ -14,6 +14,11 @@
 
 package core
 
+import (
+	"context"
+	"time"
+)
+
 // Plugin interface defines plugin's basic life-cycle methods.
 type Plugin interface {
 	// Init is called in the agent`s startup phase.
@@ -27,3 +32,86 @@ type PostInit interface {
 	// AfterInit is called once Init() of all plugins have returned without error.
 	AfterInit() error
 }
+
+// WithInitTimeout interface defines an optional method for plugins that need
+// to limit the duration of their initialization.
+type WithInitTimeout interface {
+	// InitTimeout returns the maximum duration of Init() and of AfterInit()
+	// (each of them separately). Zero means no limit.
+	InitTimeout() time.Duration
+}
+
+// InitContext interface defines an optional method that is preferred by the agent
+// over Init() if implemented by the plugin.
+type InitContext interface {
+	// InitWithContext is called in the agent`s startup phase. The context
+	// is cancelled if the startup times out or is interrupted.
+	InitWithContext(ctx context.Context) error
+}
+
+// PostInitContext interface defines an optional method that is preferred by the agent
+// over AfterInit() if implemented by the plugin.
+type PostInitContext interface {
+	// AfterInitWithContext is called once Init() of all plugins have returned
+	// without error. The context is cancelled if the startup times out or
+	// is interrupted.
+	AfterInitWithContext(ctx context.Context) error
+}
+
+// CloseContext interface defines an optional method that is preferred by the agent
+// over Close() if implemented by the plugin.
+type CloseContext interface {
+	// CloseWithContext is called in the agent`s cleanup phase. The context
+	// is cancelled once the time limit for closing of the plugin expires.
+	CloseWithContext(ctx context.Context) error
+}
+
+// ProvidedDependency interface defines an optional method for injected
+// dependencies that are not plugins themselves but are provided by a plugin
+// (e.g. configuration read from a data store). The plugin holding such
+// dependency in its Deps is initialized after the providing plugin.
+type ProvidedDependency interface {
+	// ProvidedBy returns the plugin that provides the dependency.
+	ProvidedBy() Plugin
+}
+
+// LifecycleAware interface defines an optional method for plugins that need to
+// observe (or control) the lifecycle of other plugins of the agent.
+type LifecycleAware interface {
+	// SetLifecycleWatcher is called by the agent before Init() of any plugin.
+	SetLifecycleWatcher(watcher LifecycleWatcher)
+}
+
+// Restartable interface defines an optional method for plugins that can be
+// closed and initialized again at runtime (see Agent.RestartPlugin()).
+// Plugins not implementing the interface are not restarted, as their Init()
+// is not expected to be called more than once.
+type Restartable interface {
+	// CanRestart returns true if Init() of the closed plugin can be called again.
+	CanRestart() bool
+}
+
+// Reloadable interface defines optional methods for plugins that are able
+// to apply a changed configuration without restart (see Agent.Reload()).
+type Reloadable interface {
+	// CurrentConfig returns a pointer to (a copy of) the configuration currently
+	// applied by the plugin. The agent uses it to determine the type of the
+	// configuration and to roll the plugin back if another plugin rejects
+	// the new configuration.
+	CurrentConfig() interface{}
+
+	// Reload applies the new configuration (a pointer of the same type as
+	// returned by CurrentConfig()). If an error is returned, the plugin
+	// is expected to keep the current configuration.
+	Reload(newCfg interface{}) error
+}
+
+// ReloadDefaults interface defines an optional method for Reloadable plugins
+// whose configuration is read on top of defaults (e.g. set by the flavor
+// or by command line flags) rather than into an empty configuration.
+type ReloadDefaults interface {
+	// DefaultConfig returns a pointer to a new configuration (of the same type
+	// as returned by CurrentConfig()) with the defaults applied the same way
+	// as in Init(). The agent reads the reloaded configuration into it.
+	DefaultConfig() interface{}
+}
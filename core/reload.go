@@ -0,0 +1,195 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/ligato/cn-infra/config"
+)
+
+// pluginConfigName is the name of the (usually embedded) field of plugin's Deps
+// through which the configuration of the plugin is injected.
+const pluginConfigName = "PluginConfig"
+
+// configChange holds the configuration of a plugin before and after reload.
+type configChange struct {
+	plugin     *NamedPlugin
+	reloadable Reloadable
+	oldCfg     interface{}
+	newCfg     interface{}
+}
+
+// Reload re-reads the configuration of every Reloadable plugin (through the
+// config.PluginConfig injected into the plugin) and passes the changed
+// configuration to the plugin. Plugins are reloaded in the order of
+// initialization. Only plugins that are ready (successfully initialized)
+// are reloaded.
+//
+// If the configuration of any plugin cannot be read, no plugin is reloaded.
+// If a plugin rejects the new configuration, the plugins reloaded before it
+// are rolled back to their previous configuration (in reverse order)
+// and the error is returned.
+func (agent *Agent) Reload() error {
+	agent.lifecycle.restartLock.Lock()
+	defer agent.lifecycle.restartLock.Unlock()
+
+	agent.Info("Reloading configuration of plugins")
+
+	// read all configurations first
+	var changes []*configChange
+	for _, plugin := range agent.plugins {
+		reloadable, ok := plugin.Plugin.(Reloadable)
+		if !ok {
+			continue
+		}
+		if state := agent.PluginState(plugin.PluginName); state != Ready {
+			agent.Debugf("plugin %s: not reloaded in state %s", plugin.PluginName, state)
+			continue
+		}
+		change, err := readConfigChange(plugin, reloadable)
+		if err != nil {
+			return fmt.Errorf("plugin %s: failed to read configuration: %v", plugin.PluginName, err)
+		}
+		if change == nil {
+			agent.Debugf("plugin %s: configuration not changed", plugin.PluginName)
+			continue
+		}
+		changes = append(changes, change)
+	}
+
+	// apply them
+	for i, change := range changes {
+		if err := change.reloadable.Reload(change.newCfg); err != nil {
+			agent.Errorf("plugin %s: configuration rejected: %v", change.plugin.PluginName, err)
+			agent.rollbackReload(changes[:i])
+			return fmt.Errorf("plugin %s rejected configuration: %v", change.plugin.PluginName, err)
+		}
+		agent.Infof("plugin %s: configuration reloaded", change.plugin.PluginName)
+	}
+
+	return nil
+}
+
+// rollbackReload restores the previous configuration of the reloaded plugins.
+func (agent *Agent) rollbackReload(changes []*configChange) {
+	for i := len(changes) - 1; i >= 0; i-- {
+		change := changes[i]
+		if err := change.reloadable.Reload(change.oldCfg); err != nil {
+			agent.Errorf("plugin %s: rollback of configuration failed: %v", change.plugin.PluginName, err)
+		} else {
+			agent.Infof("plugin %s: configuration rolled back", change.plugin.PluginName)
+		}
+	}
+}
+
+// readConfigChange reads the configuration of the plugin into a new instance
+// of the type returned by CurrentConfig() (or into the defaults of the plugin
+// if it implements ReloadDefaults). It returns nil if the plugin has
+// no configuration or if the configuration has not changed.
+func readConfigChange(plugin *NamedPlugin, reloadable Reloadable) (*configChange, error) {
+	pluginCfg := injectedPluginConfig(plugin.Plugin)
+	if pluginCfg == nil {
+		return nil, nil
+	}
+	oldCfg := reloadable.CurrentConfig()
+	cfgType := reflect.TypeOf(oldCfg)
+	if cfgType == nil || cfgType.Kind() != reflect.Ptr {
+		return nil, fmt.Errorf("current configuration is not a pointer (%T)", oldCfg)
+	}
+
+	newCfg := reflect.New(cfgType.Elem()).Interface()
+	if defaults, ok := plugin.Plugin.(ReloadDefaults); ok {
+		newCfg = defaults.DefaultConfig()
+		if reflect.TypeOf(newCfg) != cfgType {
+			return nil, fmt.Errorf("default configuration %T differs from current configuration %T", newCfg, oldCfg)
+		}
+	}
+	found, err := pluginCfg.GetValue(newCfg)
+	if err != nil {
+		return nil, err
+	}
+	if !found || reflect.DeepEqual(oldCfg, newCfg) {
+		return nil, nil
+	}
+
+	return &configChange{plugin: plugin, reloadable: reloadable, oldCfg: oldCfg, newCfg: newCfg}, nil
+}
+
+// injectedPluginConfig returns config.PluginConfig injected into the plugin
+// (typically embedded in plugin's Deps), nil if there is none.
+func injectedPluginConfig(plugin Plugin) config.PluginConfig {
+	val := reflect.ValueOf(plugin)
+	for val.Kind() == reflect.Ptr || val.Kind() == reflect.Interface {
+		if val.IsNil() {
+			return nil
+		}
+		val = val.Elem()
+	}
+	if val.Kind() != reflect.Struct {
+		return nil
+	}
+
+	if pluginCfg := pluginConfigField(val); pluginCfg != nil {
+		return pluginCfg
+	}
+	// look also into the Deps fields that are not embedded
+	typ := val.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.PkgPath != "" || field.Anonymous || !strings.HasSuffix(field.Name, depsFieldSuffix) ||
+			field.Type.Kind() != reflect.Struct {
+			continue
+		}
+		if pluginCfg := pluginConfigField(val.Field(i)); pluginCfg != nil {
+			return pluginCfg
+		}
+	}
+	return nil
+}
+
+// pluginConfigField returns the value of the (possibly promoted)
+// PluginConfig field of the struct.
+func pluginConfigField(val reflect.Value) config.PluginConfig {
+	field, found := val.Type().FieldByName(pluginConfigName)
+	if !found {
+		return nil
+	}
+	fieldVal, err := fieldByIndex(val, field.Index)
+	if err != nil || !fieldVal.CanInterface() {
+		return nil
+	}
+	if pluginCfg, ok := fieldVal.Interface().(config.PluginConfig); ok && pluginCfg != nil {
+		return pluginCfg
+	}
+	return nil
+}
+
+// fieldByIndex returns the nested field of the struct (see reflect.Value.FieldByIndex()).
+// An error is returned if an embedded struct pointer on the way is nil.
+func fieldByIndex(val reflect.Value, index []int) (reflect.Value, error) {
+	for i, fieldIdx := range index {
+		if i > 0 && val.Kind() == reflect.Ptr {
+			if val.IsNil() {
+				return reflect.Value{}, fmt.Errorf("nil pointer to embedded struct %v", val.Type().Elem())
+			}
+			val = val.Elem()
+		}
+		val = val.Field(fieldIdx)
+	}
+	return val, nil
+}
@@ -0,0 +1,215 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ligato/cn-infra/config"
+	"github.com/ligato/cn-infra/logging/logrus"
+	"github.com/onsi/gomega"
+)
+
+func TestReload(t *testing.T) {
+	gomega.RegisterTestingT(t)
+
+	changed := NewReloadablePlugin("old")
+	unchanged := NewReloadablePlugin("same")
+	noConfig := NewReloadablePlugin("old")
+	noConfig.Deps.PluginConfig = nil
+
+	agent := NewAgentDeprecated(logrus.DefaultLogger(), 100*time.Millisecond,
+		&NamedPlugin{"Changed", changed}, &NamedPlugin{"Unchanged", unchanged}, &NamedPlugin{"NoConfig", noConfig})
+	gomega.Expect(agent.Start()).To(gomega.BeNil())
+
+	changed.source.Value = "new"
+	gomega.Expect(agent.Reload()).To(gomega.BeNil())
+	gomega.Expect(changed.cfg.Value).To(gomega.Equal("new"))
+	gomega.Expect(changed.reloads).To(gomega.Equal(1))
+	gomega.Expect(unchanged.reloads).To(gomega.BeZero())
+	gomega.Expect(noConfig.reloads).To(gomega.BeZero())
+
+	gomega.Expect(agent.Stop()).To(gomega.BeNil())
+}
+
+func TestReloadRollback(t *testing.T) {
+	gomega.RegisterTestingT(t)
+
+	first := NewReloadablePlugin("old")
+	rejecting := NewReloadablePlugin("old")
+	rejecting.reject = true
+	last := NewReloadablePlugin("old")
+
+	agent := NewAgentDeprecated(logrus.DefaultLogger(), 100*time.Millisecond,
+		&NamedPlugin{"First", first}, &NamedPlugin{"Rejecting", rejecting}, &NamedPlugin{"Last", last})
+	gomega.Expect(agent.Start()).To(gomega.BeNil())
+
+	first.source.Value = "new"
+	rejecting.source.Value = "new"
+	last.source.Value = "new"
+	err := agent.Reload()
+	gomega.Expect(err).NotTo(gomega.BeNil())
+	gomega.Expect(err.Error()).To(gomega.ContainSubstring("Rejecting"))
+
+	// first plugin was reloaded and rolled back, the last one was not touched
+	gomega.Expect(first.reloads).To(gomega.Equal(2))
+	gomega.Expect(first.cfg.Value).To(gomega.Equal("old"))
+	gomega.Expect(rejecting.cfg.Value).To(gomega.Equal("old"))
+	gomega.Expect(last.reloads).To(gomega.BeZero())
+
+	gomega.Expect(agent.Stop()).To(gomega.BeNil())
+}
+
+func TestReloadConfigError(t *testing.T) {
+	gomega.RegisterTestingT(t)
+
+	first := NewReloadablePlugin("old")
+	broken := NewReloadablePlugin("old")
+
+	agent := NewAgentDeprecated(logrus.DefaultLogger(), 100*time.Millisecond,
+		&NamedPlugin{"First", first}, &NamedPlugin{"Broken", broken})
+	gomega.Expect(agent.Start()).To(gomega.BeNil())
+
+	first.source.Value = "new"
+	broken.source.err = fmt.Errorf("invalid config")
+	gomega.Expect(agent.Reload()).NotTo(gomega.BeNil())
+
+	// no plugin is reloaded if any configuration cannot be read
+	gomega.Expect(first.reloads).To(gomega.BeZero())
+
+	gomega.Expect(agent.Stop()).To(gomega.BeNil())
+}
+
+func TestReloadBeforeStart(t *testing.T) {
+	gomega.RegisterTestingT(t)
+
+	plugin := NewReloadablePlugin("old")
+	agent := NewAgentDeprecated(logrus.DefaultLogger(), 100*time.Millisecond, &NamedPlugin{"Plugin", plugin})
+
+	plugin.source.Value = "new"
+	gomega.Expect(agent.Reload()).To(gomega.BeNil())
+	gomega.Expect(plugin.reloads).To(gomega.BeZero())
+}
+
+func TestReloadDefaults(t *testing.T) {
+	gomega.RegisterTestingT(t)
+
+	plugin := &DefaultingPlugin{ReloadablePlugin: NewReloadablePlugin("old")}
+	plugin.Deps.PluginConfig = plugin.source
+	plugin.cfg.Default = "default"
+	agent := NewAgentDeprecated(logrus.DefaultLogger(), 100*time.Millisecond, &NamedPlugin{"Plugin", plugin})
+	gomega.Expect(agent.Start()).To(gomega.BeNil())
+
+	plugin.source.Value = "new"
+	gomega.Expect(agent.Reload()).To(gomega.BeNil())
+	gomega.Expect(plugin.cfg).To(gomega.Equal(ReloadableConfig{Value: "new", Default: "default"}))
+
+	gomega.Expect(agent.Stop()).To(gomega.BeNil())
+}
+
+func TestInjectedPluginConfig(t *testing.T) {
+	gomega.RegisterTestingT(t)
+
+	plugin := NewReloadablePlugin("old")
+	gomega.Expect(injectedPluginConfig(plugin)).To(gomega.Equal(plugin.source))
+
+	// nil embedded pointer on the way to the field
+	type pluginDeps struct {
+		config.PluginConfig
+	}
+	gomega.Expect(injectedPluginConfig(&struct {
+		*pluginDeps
+		Plugin
+	}{})).To(gomega.BeNil())
+}
+
+type ReloadableConfig struct {
+	Value   string
+	Default string
+}
+
+type TestPluginConfig struct {
+	ReloadableConfig
+	err error
+}
+
+func (c *TestPluginConfig) GetValue(data interface{}) (found bool, err error) {
+	if c.err != nil {
+		return false, c.err
+	}
+	data.(*ReloadableConfig).Value = c.Value
+	return true, nil
+}
+
+func (c *TestPluginConfig) GetConfigName() string {
+	return "test.conf"
+}
+
+type ReloadablePlugin struct {
+	Deps struct {
+		config.PluginConfig
+	}
+
+	source  *TestPluginConfig
+	cfg     ReloadableConfig
+	reject  bool
+	reloads int
+}
+
+func NewReloadablePlugin(value string) *ReloadablePlugin {
+	p := &ReloadablePlugin{source: &TestPluginConfig{ReloadableConfig: ReloadableConfig{Value: value}}}
+	p.Deps.PluginConfig = p.source
+	return p
+}
+
+func (p *ReloadablePlugin) Init() error {
+	if p.Deps.PluginConfig != nil {
+		_, err := p.Deps.GetValue(&p.cfg)
+		return err
+	}
+	return nil
+}
+
+func (p *ReloadablePlugin) Close() error {
+	return nil
+}
+
+func (p *ReloadablePlugin) CurrentConfig() interface{} {
+	cfgCopy := p.cfg
+	return &cfgCopy
+}
+
+func (p *ReloadablePlugin) Reload(newCfg interface{}) error {
+	if p.reject {
+		return fmt.Errorf("configuration rejected")
+	}
+	p.reloads++
+	p.cfg = *newCfg.(*ReloadableConfig)
+	return nil
+}
+
+// DefaultingPlugin reads the reloaded configuration into its defaults.
+type DefaultingPlugin struct {
+	Deps struct {
+		config.PluginConfig
+	}
+	*ReloadablePlugin
+}
+
+func (p *DefaultingPlugin) DefaultConfig() interface{} {
+	return &ReloadableConfig{Default: "default"}
+}
@@ -0,0 +1,132 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"time"
+)
+
+// Phase identifies a phase of the agent startup.
+type Phase string
+
+const (
+	// InitPhase is the phase when Init() is called on plugins.
+	InitPhase Phase = "Init"
+	// AfterInitPhase is the phase when AfterInit() is called on plugins.
+	AfterInitPhase Phase = "AfterInit"
+)
+
+// PluginStartup describes a single startup phase of a plugin.
+type PluginStartup struct {
+	PluginName PluginName
+	Phase      Phase
+	// Duration of the phase (so far if the phase is still in progress).
+	Duration time.Duration
+	// Err is set if the phase failed.
+	Err error
+	// TimedOut is set if the phase was not completed within the plugin's time limit.
+	TimedOut bool
+	// Skipped is set if the phase was not started due to a failure of another plugin.
+	Skipped bool
+	// InProgress is set if the phase has not finished yet.
+	InProgress bool
+
+	start time.Time
+}
+
+// StartupReport summarizes the startup of the agent.
+type StartupReport struct {
+	// MaxStartupTime is the time limit for the startup of all plugins.
+	MaxStartupTime time.Duration
+	// Init is the total duration of the Init phase.
+	Init time.Duration
+	// AfterInit is the total duration of the AfterInit phase.
+	AfterInit time.Duration
+	// Plugins lists phases of the startup of individual plugins that were
+	// reached, in the order of the phases and the order of the plugins.
+	Plugins []PluginStartup
+}
+
+// StartupReport returns the startup details of the agent and of all its plugins.
+// It can be called during the startup as well (e.g. after Start() returned
+// due to timeout) to find out which plugins are still being initialized.
+func (agent *Agent) StartupReport() *StartupReport {
+	timer := &agent.timer
+	timer.access.Lock()
+	defer timer.access.Unlock()
+
+	report := &StartupReport{
+		MaxStartupTime: timer.MaxStartupTime,
+		Init:           timer.init,
+		AfterInit:      timer.afterInit,
+	}
+	for _, phase := range []Phase{InitPhase, AfterInitPhase} {
+		for _, plugin := range agent.plugins {
+			startup, found := timer.plugins[phase][plugin.PluginName]
+			if !found {
+				continue
+			}
+			entry := *startup
+			entry.Phase = phase
+			if entry.InProgress {
+				entry.Duration = time.Since(entry.start)
+			}
+			report.Plugins = append(report.Plugins, entry)
+		}
+	}
+
+	return report
+}
+
+// recordPlugin stores startup details of a single plugin.
+func (timer *Timer) recordPlugin(phase Phase, startup *PluginStartup) {
+	timer.access.Lock()
+	defer timer.access.Unlock()
+
+	if timer.plugins == nil {
+		timer.plugins = make(map[Phase]map[PluginName]*PluginStartup)
+	}
+	if timer.plugins[phase] == nil {
+		timer.plugins[phase] = make(map[PluginName]*PluginStartup)
+	}
+	timer.plugins[phase][startup.PluginName] = startup
+}
+
+// setPhaseDuration stores the total duration of a startup phase.
+func (timer *Timer) setPhaseDuration(phase Phase, took time.Duration) {
+	timer.access.Lock()
+	defer timer.access.Unlock()
+
+	switch phase {
+	case InitPhase:
+		timer.init = took
+	case AfterInitPhase:
+		timer.afterInit = took
+	}
+}
+
+// phaseDuration returns the total duration of a startup phase.
+func (timer *Timer) phaseDuration(phase Phase) time.Duration {
+	timer.access.Lock()
+	defer timer.access.Unlock()
+
+	switch phase {
+	case InitPhase:
+		return timer.init
+	case AfterInitPhase:
+		return timer.afterInit
+	}
+	return 0
+}
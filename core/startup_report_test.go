@@ -0,0 +1,130 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/onsi/gomega"
+)
+
+func TestStartupReport(t *testing.T) {
+	gomega.RegisterTestingT(t)
+
+	agent := NewAgent(Inject(), WithTimeout(time.Second),
+		WithPlugin("First", &TestPlugin{}),
+		WithPlugin("Second", NewTestPlugin(false, true, false)),
+		WithPlugin("Third", &TestPlugin{}))
+
+	err := agent.Start()
+	gomega.Expect(err).NotTo(gomega.BeNil())
+
+	report := agent.StartupReport()
+	gomega.Expect(report.MaxStartupTime).To(gomega.Equal(time.Second))
+	gomega.Expect(report.Plugins).To(gomega.HaveLen(6))
+
+	for _, startup := range report.Plugins[:3] {
+		gomega.Expect(startup.Phase).To(gomega.Equal(InitPhase))
+		gomega.Expect(startup.Err).To(gomega.BeNil())
+		gomega.Expect(startup.Skipped).To(gomega.BeFalse())
+		gomega.Expect(startup.InProgress).To(gomega.BeFalse())
+	}
+	gomega.Expect(report.Plugins[3].Phase).To(gomega.Equal(AfterInitPhase))
+	gomega.Expect(report.Plugins[3].Err).To(gomega.BeNil())
+	gomega.Expect(report.Plugins[4].PluginName).To(gomega.BeEquivalentTo("Second"))
+	gomega.Expect(report.Plugins[4].Err).NotTo(gomega.BeNil())
+	gomega.Expect(report.Plugins[5].PluginName).To(gomega.BeEquivalentTo("Third"))
+	gomega.Expect(report.Plugins[5].Skipped).To(gomega.BeTrue())
+}
+
+func TestPluginTimeout(t *testing.T) {
+	gomega.RegisterTestingT(t)
+
+	slow := &SlowPlugin{delay: time.Second}
+	agent := NewAgent(Inject(), WithTimeout(5*time.Second),
+		WithPluginTimeout(50*time.Millisecond, "Slow"),
+		WithCloseTimeout(50*time.Millisecond),
+		WithPlugin("Slow", slow))
+
+	start := time.Now()
+	err := agent.Start()
+	gomega.Expect(err).NotTo(gomega.BeNil())
+	gomega.Expect(time.Since(start)).To(gomega.BeNumerically("<", time.Second))
+
+	report := agent.StartupReport()
+	gomega.Expect(report.Plugins).To(gomega.HaveLen(1))
+	gomega.Expect(report.Plugins[0].TimedOut).To(gomega.BeTrue())
+	gomega.Expect(report.Plugins[0].Err).NotTo(gomega.BeNil())
+}
+
+func TestPluginTimeoutPrecedence(t *testing.T) {
+	gomega.RegisterTestingT(t)
+
+	plugin := &NamedPlugin{"Slow", &SlowPlugin{timeout: 2 * time.Second}}
+	other := &NamedPlugin{"Other", &TestPlugin{}}
+
+	agent := NewAgent(Inject(), WithPluginTimeout(time.Second))
+	gomega.Expect(agent.pluginTimeout(plugin)).To(gomega.Equal(2 * time.Second))
+	gomega.Expect(agent.pluginTimeout(other)).To(gomega.Equal(time.Second))
+
+	agent = NewAgent(Inject(), WithPluginTimeout(3*time.Second, "Slow"))
+	gomega.Expect(agent.pluginTimeout(plugin)).To(gomega.Equal(3 * time.Second))
+	gomega.Expect(agent.pluginTimeout(other)).To(gomega.BeZero())
+}
+
+func TestAbandonedInitNotClosed(t *testing.T) {
+	gomega.RegisterTestingT(t)
+
+	blocking := &BlockingPlugin{release: make(chan struct{})}
+	agent := NewAgent(Inject(), WithTimeout(5*time.Second),
+		WithPluginTimeout(50*time.Millisecond, "Blocking"),
+		WithCloseTimeout(50*time.Millisecond),
+		WithPlugin("Blocking", blocking))
+
+	err := agent.Start()
+	gomega.Expect(err).NotTo(gomega.BeNil())
+	// Init is still running, the plugin must not be closed
+	gomega.Expect(blocking.Closed()).To(gomega.BeFalse())
+	gomega.Expect(agent.Stop()).To(gomega.BeNil())
+	gomega.Expect(blocking.Closed()).To(gomega.BeFalse())
+
+	// once Init returns, the plugin can be closed
+	close(blocking.release)
+	gomega.Eventually(func() bool {
+		agent.Stop()
+		return blocking.Closed()
+	}).Should(gomega.BeTrue())
+	gomega.Expect(blocking.Initialized()).To(gomega.BeTrue())
+}
+
+// SlowPlugin takes <delay> to initialize.
+type SlowPlugin struct {
+	delay   time.Duration
+	timeout time.Duration
+}
+
+func (p *SlowPlugin) Init() error {
+	time.Sleep(p.delay)
+	return nil
+}
+
+func (p *SlowPlugin) Close() error {
+	return nil
+}
+
+func (p *SlowPlugin) InitTimeout() time.Duration {
+	return p.timeout
+}
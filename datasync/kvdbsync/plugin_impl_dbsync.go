@@ -62,7 +62,7 @@ func (plugin /*intentionally without pointer receiver*/ Plugin) OfDifferentAgent
 // logically separated from other plugin fields.
 type Deps struct {
 	local.PluginInfraDeps                      // inject
-	ResyncOrch            resync.Subscriber    // inject
+	ResyncOrch            resync.Subscriber    `inject:"reverse"` // inject (registered in AfterInit)
 	KvPlugin              keyval.KvProtoPlugin // inject
 }
 
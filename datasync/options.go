@@ -58,6 +58,33 @@ func WithPrefix() *WithPrefixOpt {
 	return &WithPrefixOpt{}
 }
 
+// WithExpectedRevisionOpt applies Put or Delete operation only if the item
+// was last modified in the given revision (optimistic concurrency).
+// Revision 0 requires the item to not exist.
+type WithExpectedRevisionOpt struct {
+	PutOptionMarker
+	DelOptionMarker
+	Revision int64
+}
+
+// WithExpectedRevision creates a new instance of WithExpectedRevisionOpt.
+// If the item was modified in the meantime, the operation fails with
+// keyval.ErrRevisionMismatch.
+func WithExpectedRevision(rev int64) *WithExpectedRevisionOpt {
+	return &WithExpectedRevisionOpt{Revision: rev}
+}
+
+// WithCreateOnlyOpt applies Put operation only if the item does not exist yet.
+type WithCreateOnlyOpt struct {
+	PutOptionMarker
+}
+
+// WithCreateOnly creates a new instance of WithCreateOnlyOpt.
+// If the item already exists, Put fails with keyval.ErrRevisionMismatch.
+func WithCreateOnly() *WithCreateOnlyOpt {
+	return &WithCreateOnlyOpt{}
+}
+
 // PutOptionMarker is meant for anonymous composition in With*Opt structs.
 type PutOptionMarker struct{}
 
@@ -0,0 +1,741 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bolt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	boltdb "github.com/boltdb/bolt"
+	"github.com/ligato/cn-infra/datasync"
+	"github.com/ligato/cn-infra/db/keyval"
+	"github.com/ligato/cn-infra/db/keyval/internal/kvstore"
+	"github.com/ligato/cn-infra/logging"
+)
+
+var (
+	// kvBucket stores the key-value items.
+	kvBucket = []byte("kv")
+	// metaBucket stores the global revision of the data store
+	// and the revision of the newest change dropped from the history.
+	metaBucket   = []byte("meta")
+	revisionKey  = []byte("revision")
+	compactedKey = []byte("compacted")
+	// historyBucket stores the most recent changes ordered by a sequence number.
+	historyBucket = []byte("history")
+)
+
+// recordHeaderLen is the length of the create revision, the modification
+// revision and the expiration time that precede the value in the record.
+const recordHeaderLen = 24
+
+// ErrClosed is returned by the operations of a closed data store.
+var ErrClosed = errors.New("bolt data store is closed")
+
+// BytesConnectionBolt is an embedded persistent key-value data store.
+// It provides API to read/edit and watch values.
+type BytesConnectionBolt struct {
+	logging.Logger
+	db *boltdb.DB
+
+	// serializes the changes so that the watches receive them in order
+	access      sync.Mutex
+	closed      bool
+	watches     *kvstore.Watches
+	expirations map[string]*time.Timer
+	// number of the most recent changes kept in the history
+	historySize int
+}
+
+// BytesBrokerWatcherBolt uses BytesConnectionBolt to access the data store.
+// BytesBrokerWatcherBolt allows defining a keyPrefix that is prepended
+// to all keys in its methods in order to shorten keys used in arguments.
+type BytesBrokerWatcherBolt struct {
+	db     *BytesConnectionBolt
+	prefix string
+}
+
+// record is a value stored under a key together with its revisions.
+type record struct {
+	createRev int64
+	modRev    int64
+	// unix time in nanoseconds when the record put with TTL expires (0 = never)
+	expires int64
+	value   []byte
+}
+
+// bytesKeyValIterator is an iterator returned by ListValues call.
+type bytesKeyValIterator struct {
+	index int
+	kvs   []*bytesKeyVal
+}
+
+// bytesKeyIterator is an iterator returned by ListKeys call.
+type bytesKeyIterator struct {
+	index int
+	kvs   []*bytesKeyVal
+}
+
+// bytesKeyVal represents a single key-value pair.
+type bytesKeyVal struct {
+	key       string
+	value     []byte
+	prevValue []byte
+	revision  int64
+}
+
+// NewBytesConnectionBolt opens (or creates) the data store in the file
+// defined by the configuration. Opening fails if the file stays locked
+// by another process for longer than Config.LockTimeout.
+func NewBytesConnectionBolt(cfg *Config, log logging.Logger) (*BytesConnectionBolt, error) {
+	fileMode := cfg.FileMode
+	if fileMode == 0 {
+		fileMode = 0660
+	}
+	db, err := boltdb.Open(cfg.DbPath, fileMode, &boltdb.Options{Timeout: cfg.LockTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %v", cfg.DbPath, err)
+	}
+	db.NoSync = cfg.NoSync
+	historySize := cfg.HistorySize
+	if historySize == 0 {
+		historySize = DefaultHistorySize
+	}
+
+	conn := &BytesConnectionBolt{
+		Logger:      log,
+		db:          db,
+		watches:     kvstore.NewWatches(log),
+		expirations: make(map[string]*time.Timer),
+		historySize: historySize,
+	}
+	var expiring map[string]*record
+	err = db.Update(func(tx *boltdb.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(metaBucket); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucketIfNotExists(historyBucket); err != nil {
+			return err
+		}
+		bucket, err := tx.CreateBucketIfNotExists(kvBucket)
+		if err != nil {
+			return err
+		}
+		// the records put with TTL before the restart expire as well
+		expiring = make(map[string]*record)
+		return bucket.ForEach(func(key, data []byte) error {
+			rec, err := unmarshalRecord(data)
+			if err != nil {
+				return fmt.Errorf("invalid record of %s: %v", key, err)
+			}
+			if rec.expires != 0 {
+				expiring[string(key)] = rec
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	for key, rec := range expiring {
+		conn.scheduleExpiration(key, rec)
+	}
+	return conn, nil
+}
+
+// Close stops all watches and closes the file of the data store.
+func (db *BytesConnectionBolt) Close() error {
+	db.access.Lock()
+	defer db.access.Unlock()
+
+	if db.closed {
+		return nil
+	}
+	db.closed = true
+	for key, timer := range db.expirations {
+		timer.Stop()
+		delete(db.expirations, key)
+	}
+	db.watches.Close()
+	return db.db.Close()
+}
+
+// NewBroker creates a new instance of a proxy that provides access
+// to the data store. <prefix> will be prepended to the key argument in all
+// calls from the created BytesBrokerWatcherBolt. To avoid using a prefix,
+// pass keyval.Root constant as an argument.
+func (db *BytesConnectionBolt) NewBroker(prefix string) keyval.BytesBroker {
+	return &BytesBrokerWatcherBolt{db: db, prefix: prefix}
+}
+
+// NewWatcher creates a new instance of a proxy that provides access
+// to the data store. <prefix> will be prepended to the key argument in all
+// calls on created BytesBrokerWatcherBolt and removed from the keys
+// of the watch events. To avoid using a prefix, pass keyval.Root constant
+// as an argument.
+func (db *BytesConnectionBolt) NewWatcher(prefix string) keyval.BytesWatcher {
+	return &BytesBrokerWatcherBolt{db: db, prefix: prefix}
+}
+
+// Put writes the provided key-value item into the data store.
+// If datasync.WithTTL() option is used, the item is removed once the TTL
+// expires (also if the agent is restarted in the meantime).
+// If datasync.WithExpectedRevision() or datasync.WithCreateOnly() option is used
+// and the item was modified in the meantime, keyval.ErrRevisionMismatch is returned.
+func (db *BytesConnectionBolt) Put(key string, data []byte, opts ...datasync.PutOption) error {
+	return db.put(key, data, opts...)
+}
+
+// Delete removes data identified by the <key> (or all keys with the prefix
+// <key> if datasync.WithPrefix() option is used).
+// If datasync.WithExpectedRevision() option is used and the item under
+// the <key> was modified in the meantime, keyval.ErrRevisionMismatch is returned.
+func (db *BytesConnectionBolt) Delete(key string, opts ...datasync.DelOption) (existed bool, err error) {
+	return db.delete(key, opts...)
+}
+
+// GetValue retrieves one key-value item from the data store. The item
+// is identified by the provided <key>.
+func (db *BytesConnectionBolt) GetValue(key string) (data []byte, found bool, revision int64, err error) {
+	rec, err := db.getRecord(key)
+	if err != nil || rec == nil {
+		return nil, false, 0, err
+	}
+	return rec.value, true, rec.modRev, nil
+}
+
+// GetRevisions returns the revision that created the item stored under
+// the <key> and the revision of its last modification.
+func (db *BytesConnectionBolt) GetRevisions(key string) (createRev int64, modRev int64, found bool, err error) {
+	rec, err := db.getRecord(key)
+	if err != nil || rec == nil {
+		return 0, 0, false, err
+	}
+	return rec.createRev, rec.modRev, true, nil
+}
+
+// ListValues returns an iterator that enables traversing values stored under
+// the provided <key> (prefix) in the lexical order of the keys.
+// The items selected by the list options are read in a single read-only
+// transaction (i.e. consistently).
+func (db *BytesConnectionBolt) ListValues(key string, opts ...keyval.ListOption) (keyval.BytesKeyValIterator, error) {
+	kvs, err := db.list(keyval.Root, key, prefixEnd(key), keyval.ParseListOptions(opts...))
+	if err != nil {
+		return nil, err
+	}
+	return &bytesKeyValIterator{kvs: kvs}, nil
+}
+
+// ListKeys returns an iterator that allows traversing all keys from data
+// store that share the given <prefix>.
+func (db *BytesConnectionBolt) ListKeys(prefix string, opts ...keyval.ListOption) (keyval.BytesKeyIterator, error) {
+	kvs, err := db.list(keyval.Root, prefix, prefixEnd(prefix), keyval.ParseListOptions(append(opts, keyval.WithKeysOnly())...))
+	if err != nil {
+		return nil, err
+	}
+	return &bytesKeyIterator{kvs: kvs}, nil
+}
+
+// ListValuesRange returns an iterator that enables traversing values stored
+// under the keys from the range [fromPrefix, toPrefix). Empty <toPrefix>
+// means no upper bound.
+func (db *BytesConnectionBolt) ListValuesRange(fromPrefix string, toPrefix string) (keyval.BytesKeyValIterator, error) {
+	kvs, err := db.list(keyval.Root, fromPrefix, toPrefix, keyval.ParseListOptions())
+	if err != nil {
+		return nil, err
+	}
+	return &bytesKeyValIterator{kvs: kvs}, nil
+}
+
+// NewTxn creates a new transaction. All operations of the transaction
+// are applied atomically with a single revision.
+func (db *BytesConnectionBolt) NewTxn() keyval.BytesTxn {
+	return kvstore.NewTxn(db.txnUpdate, keyval.Root)
+}
+
+// NewCondTxn creates a new conditional transaction. The conditions are
+// evaluated and the selected operations applied atomically with a single
+// revision.
+func (db *BytesConnectionBolt) NewCondTxn() keyval.BytesCondTxn {
+	return kvstore.NewCondTxn(db.txnUpdate, keyval.Root)
+}
+
+// Watch starts subscription for changes associated with the selected keys
+// (prefixes). Watch events will be delivered to <resp> callback
+// (in the order of the changes, from a separate goroutine).
+// Watching of a key ends once the key is sent to (or once the) <closeChan> is closed.
+func (db *BytesConnectionBolt) Watch(resp func(keyval.BytesWatchResp), closeChan chan string, keys ...string) error {
+	return db.watch(keyval.Root, resp, closeChan, keys...)
+}
+
+// GetRevision returns the current revision of the data store.
+func (db *BytesConnectionBolt) GetRevision() (revision int64, err error) {
+	err = db.db.View(func(tx *boltdb.Tx) error {
+		revision = readRevision(tx)
+		return nil
+	})
+	return revision, translateErr(err)
+}
+
+// Put calls 'Put' function of the underlying BytesConnectionBolt.
+// KeyPrefix defined in constructor is prepended to the key argument.
+func (pdb *BytesBrokerWatcherBolt) Put(key string, data []byte, opts ...datasync.PutOption) error {
+	return pdb.db.put(pdb.prefix+key, data, opts...)
+}
+
+// NewTxn creates a new transaction.
+// KeyPrefix defined in constructor will be prepended to all key arguments
+// in the transaction.
+func (pdb *BytesBrokerWatcherBolt) NewTxn() keyval.BytesTxn {
+	return kvstore.NewTxn(pdb.db.txnUpdate, pdb.prefix)
+}
+
+// NewCondTxn creates a new conditional transaction.
+// KeyPrefix defined in constructor will be prepended to the keys of all
+// conditions and operations in the transaction.
+func (pdb *BytesBrokerWatcherBolt) NewCondTxn() keyval.BytesCondTxn {
+	return kvstore.NewCondTxn(pdb.db.txnUpdate, pdb.prefix)
+}
+
+// GetValue calls 'GetValue' function of the underlying BytesConnectionBolt.
+// KeyPrefix defined in constructor is prepended to the key argument.
+func (pdb *BytesBrokerWatcherBolt) GetValue(key string) (data []byte, found bool, revision int64, err error) {
+	return pdb.db.GetValue(pdb.prefix + key)
+}
+
+// ListValues calls 'ListValues' function of the underlying BytesConnectionBolt.
+// KeyPrefix defined in constructor is prepended to the key argument.
+// The prefix is removed from the keys of the returned values.
+func (pdb *BytesBrokerWatcherBolt) ListValues(key string, opts ...keyval.ListOption) (keyval.BytesKeyValIterator, error) {
+	kvs, err := pdb.db.list(pdb.prefix, pdb.prefix+key, prefixEnd(pdb.prefix+key), keyval.ParseListOptions(opts...))
+	if err != nil {
+		return nil, err
+	}
+	return &bytesKeyValIterator{kvs: kvs}, nil
+}
+
+// ListKeys calls 'ListKeys' function of the underlying BytesConnectionBolt.
+// KeyPrefix defined in constructor is prepended to the argument.
+// The prefix is removed from the returned keys.
+func (pdb *BytesBrokerWatcherBolt) ListKeys(prefix string, opts ...keyval.ListOption) (keyval.BytesKeyIterator, error) {
+	kvs, err := pdb.db.list(pdb.prefix, pdb.prefix+prefix, prefixEnd(pdb.prefix+prefix),
+		keyval.ParseListOptions(append(opts, keyval.WithKeysOnly())...))
+	if err != nil {
+		return nil, err
+	}
+	return &bytesKeyIterator{kvs: kvs}, nil
+}
+
+// ListValuesRange calls 'ListValuesRange' function of the underlying
+// BytesConnectionBolt. KeyPrefix defined in constructor is prepended to both
+// bounds of the range.
+func (pdb *BytesBrokerWatcherBolt) ListValuesRange(fromPrefix string, toPrefix string) (keyval.BytesKeyValIterator, error) {
+	to := prefixEnd(pdb.prefix)
+	if toPrefix != "" {
+		to = pdb.prefix + toPrefix
+	}
+	kvs, err := pdb.db.list(pdb.prefix, pdb.prefix+fromPrefix, to, keyval.ParseListOptions())
+	if err != nil {
+		return nil, err
+	}
+	return &bytesKeyValIterator{kvs: kvs}, nil
+}
+
+// Delete calls 'Delete' function of the underlying BytesConnectionBolt.
+// KeyPrefix defined in constructor is prepended to the key argument.
+func (pdb *BytesBrokerWatcherBolt) Delete(key string, opts ...datasync.DelOption) (existed bool, err error) {
+	return pdb.db.delete(pdb.prefix+key, opts...)
+}
+
+// Watch starts subscription for changes associated with the selected <keys>.
+// KeyPrefix defined in constructor is prepended to all <keys> in the argument
+// list. The prefix is removed from the keys returned in watch events.
+func (pdb *BytesBrokerWatcherBolt) Watch(resp func(keyval.BytesWatchResp), closeChan chan string, keys ...string) error {
+	return pdb.db.watch(pdb.prefix, resp, closeChan, keys...)
+}
+
+func (db *BytesConnectionBolt) put(key string, data []byte, opts ...datasync.PutOption) error {
+	var ttl time.Duration
+	for _, opt := range opts {
+		if withTTL, ok := opt.(*datasync.WithTTLOpt); ok && withTTL.TTL > 0 {
+			ttl = withTTL.TTL
+		}
+	}
+	expectedRev, expected := keyval.PutExpectedRevision(opts...)
+	_, err := db.update(func(store *bucketStore, rev int64) ([]*kvstore.Change, error) {
+		if expected {
+			if err := checkRevision(store.bucket, key, expectedRev); err != nil {
+				return nil, err
+			}
+		}
+		ch, err := store.put(key, data, ttl, rev)
+		if err != nil {
+			return nil, err
+		}
+		return []*kvstore.Change{ch}, nil
+	})
+	return err
+}
+
+func (db *BytesConnectionBolt) delete(key string, opts ...datasync.DelOption) (existed bool, err error) {
+	withPrefix := false
+	for _, opt := range opts {
+		if _, ok := opt.(*datasync.WithPrefixOpt); ok {
+			withPrefix = true
+		}
+	}
+	expectedRev, expected := keyval.DelExpectedRevision(opts...)
+	changes, err := db.update(func(store *bucketStore, rev int64) ([]*kvstore.Change, error) {
+		if expected {
+			if err := checkRevision(store.bucket, key, expectedRev); err != nil {
+				return nil, err
+			}
+		}
+		if !withPrefix {
+			ch, err := store.Delete(key, rev)
+			if err != nil || ch == nil {
+				return nil, err
+			}
+			return []*kvstore.Change{ch}, nil
+		}
+		var keys []string
+		cursor := store.bucket.Cursor()
+		for k, _ := cursor.Seek([]byte(key)); k != nil && bytes.HasPrefix(k, []byte(key)); k, _ = cursor.Next() {
+			keys = append(keys, string(k))
+		}
+		var changes []*kvstore.Change
+		for _, k := range keys {
+			ch, err := store.Delete(k, rev)
+			if err != nil {
+				return nil, err
+			}
+			changes = append(changes, ch)
+		}
+		return changes, nil
+	})
+	return len(changes) > 0, err
+}
+
+// update applies the changes made by <apply> in a single bolt transaction
+// with a new revision. The revision is incremented, the changes are recorded
+// in the history and the watches are notified only if there is any change.
+func (db *BytesConnectionBolt) update(apply func(store *bucketStore, rev int64) ([]*kvstore.Change, error)) (changes []*kvstore.Change, err error) {
+	db.access.Lock()
+	defer db.access.Unlock()
+
+	if db.closed {
+		return nil, ErrClosed
+	}
+	store := &bucketStore{}
+	err = db.db.Update(func(tx *boltdb.Tx) error {
+		rev := readRevision(tx) + 1
+		store.bucket = tx.Bucket(kvBucket)
+		changes, err = apply(store, rev)
+		if err != nil || len(changes) == 0 {
+			return err
+		}
+		if err := writeRevision(tx, rev); err != nil {
+			return err
+		}
+		return appendHistory(tx, changes, db.historySize)
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, ch := range changes {
+		if timer, scheduled := db.expirations[ch.Key]; scheduled {
+			timer.Stop()
+			delete(db.expirations, ch.Key)
+		}
+		if rec, expiring := store.expiring[ch.Key]; expiring && ch.Op == datasync.Put {
+			db.scheduleExpiration(ch.Key, rec)
+		}
+	}
+	db.notify(changes...)
+	return changes, nil
+}
+
+// scheduleExpiration removes the record once it expires.
+func (db *BytesConnectionBolt) scheduleExpiration(key string, rec *record) {
+	modRev := rec.modRev
+	db.expirations[key] = time.AfterFunc(time.Until(time.Unix(0, rec.expires)), func() {
+		db.expire(key, modRev)
+	})
+}
+
+// expire removes the record put with TTL unless it was changed since.
+func (db *BytesConnectionBolt) expire(key string, modRev int64) {
+	_, err := db.update(func(store *bucketStore, rev int64) ([]*kvstore.Change, error) {
+		data := store.bucket.Get([]byte(key))
+		if data == nil {
+			return nil, nil
+		}
+		rec, err := unmarshalRecord(data)
+		if err != nil || rec.modRev != modRev {
+			return nil, err
+		}
+		db.Debugf("Key %s expired", key)
+		ch, err := store.Delete(key, rev)
+		if err != nil {
+			return nil, err
+		}
+		return []*kvstore.Change{ch}, nil
+	})
+	if err != nil && err != ErrClosed {
+		db.Warnf("Failed to remove expired key %s: %v", key, err)
+	}
+}
+
+func (db *BytesConnectionBolt) getRecord(key string) (rec *record, err error) {
+	err = db.db.View(func(tx *boltdb.Tx) error {
+		data := tx.Bucket(kvBucket).Get([]byte(key))
+		if data == nil {
+			return nil
+		}
+		rec, err = unmarshalRecord(data)
+		return err
+	})
+	return rec, translateErr(err)
+}
+
+// list returns the items with keys from the range [from, to) selected
+// by the list options with <trimPrefix> removed from the keys.
+// Empty <to> means no upper bound.
+func (db *BytesConnectionBolt) list(trimPrefix, from, to string, opts keyval.ListOptions) (kvs []*bytesKeyVal, err error) {
+	err = db.db.View(func(tx *boltdb.Tx) error {
+		cursor := tx.Bucket(kvBucket).Cursor()
+		start := opts.RangeStart(trimPrefix, from)
+		for k, data := cursor.Seek([]byte(start)); k != nil && (to == "" || string(k) < to); k, data = cursor.Next() {
+			if opts.Limit > 0 && len(kvs) == opts.Limit {
+				break
+			}
+			rec, err := unmarshalRecord(data)
+			if err != nil {
+				return fmt.Errorf("invalid record of %s: %v", k, err)
+			}
+			kv := &bytesKeyVal{
+				key:      strings.TrimPrefix(string(k), trimPrefix),
+				revision: rec.modRev,
+			}
+			if !opts.KeysOnly {
+				kv.value = rec.value
+			}
+			kvs = append(kvs, kv)
+		}
+		return nil
+	})
+	return kvs, translateErr(err)
+}
+
+// checkRevision returns keyval.ErrRevisionMismatch if the record
+// was not last modified in the <expected> revision.
+func checkRevision(bucket *boltdb.Bucket, key string, expected int64) error {
+	data := bucket.Get([]byte(key))
+	if data == nil {
+		return keyval.CheckRevision(key, expected, false, 0)
+	}
+	rec, err := unmarshalRecord(data)
+	if err != nil {
+		return err
+	}
+	return keyval.CheckRevision(key, expected, true, rec.modRev)
+}
+
+// bucketStore provides the records of the data store within a bolt
+// transaction (implements kvstore.Store for the transactions).
+type bucketStore struct {
+	bucket *boltdb.Bucket
+	// records put with TTL by the transaction
+	expiring map[string]*record
+}
+
+// Get returns the value of the record and the revision of its last modification.
+func (store *bucketStore) Get(key string) (value []byte, found bool, modRev int64, err error) {
+	data := store.bucket.Get([]byte(key))
+	if data == nil {
+		return nil, false, 0, nil
+	}
+	rec, err := unmarshalRecord(data)
+	if err != nil {
+		return nil, false, 0, err
+	}
+	return rec.value, true, rec.modRev, nil
+}
+
+// Put stores the value with the given revision and returns the change.
+func (store *bucketStore) Put(key string, value []byte, rev int64) (*kvstore.Change, error) {
+	return store.put(key, value, 0, rev)
+}
+
+// put stores the value (removed once the <ttl> expires, if set) with the given
+// revision and returns the change.
+func (store *bucketStore) put(key string, data []byte, ttl time.Duration, rev int64) (*kvstore.Change, error) {
+	rec := &record{createRev: rev, modRev: rev, value: data}
+	ch := &kvstore.Change{Op: datasync.Put, Key: key, Value: append([]byte(nil), data...), Rev: rev}
+	if prevData := store.bucket.Get([]byte(key)); prevData != nil {
+		prev, err := unmarshalRecord(prevData)
+		if err != nil {
+			return nil, err
+		}
+		rec.createRev = prev.createRev
+		ch.PrevValue, ch.PrevRev = prev.value, prev.modRev
+	}
+	if ttl > 0 {
+		rec.expires = time.Now().Add(ttl).UnixNano()
+		if store.expiring == nil {
+			store.expiring = make(map[string]*record)
+		}
+		store.expiring[key] = rec
+	} else {
+		delete(store.expiring, key)
+	}
+	return ch, store.bucket.Put([]byte(key), rec.marshal())
+}
+
+// Delete removes the record and returns the change
+// (nil if the record does not exist).
+func (store *bucketStore) Delete(key string, rev int64) (*kvstore.Change, error) {
+	prevData := store.bucket.Get([]byte(key))
+	if prevData == nil {
+		return nil, nil
+	}
+	prev, err := unmarshalRecord(prevData)
+	if err != nil {
+		return nil, err
+	}
+	delete(store.expiring, key)
+	ch := &kvstore.Change{Op: datasync.Delete, Key: key, PrevValue: prev.value, PrevRev: prev.modRev, Rev: rev}
+	return ch, store.bucket.Delete([]byte(key))
+}
+
+func readRevision(tx *boltdb.Tx) int64 {
+	return readMeta(tx, revisionKey)
+}
+
+func writeRevision(tx *boltdb.Tx, rev int64) error {
+	return writeMeta(tx, revisionKey, rev)
+}
+
+// readMeta reads the number stored under the <key> in the metaBucket.
+func readMeta(tx *boltdb.Tx, key []byte) int64 {
+	data := tx.Bucket(metaBucket).Get(key)
+	if len(data) != 8 {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint64(data))
+}
+
+// writeMeta stores the number under the <key> in the metaBucket.
+func writeMeta(tx *boltdb.Tx, key []byte, value int64) error {
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint64(data, uint64(value))
+	return tx.Bucket(metaBucket).Put(key, data)
+}
+
+// translateErr replaces the error of a closed bolt database with ErrClosed.
+func translateErr(err error) error {
+	if err == boltdb.ErrDatabaseNotOpen {
+		return ErrClosed
+	}
+	return err
+}
+
+// marshal encodes the record as the revisions and the expiration time
+// (big endian) followed by the value.
+func (rec *record) marshal() []byte {
+	data := make([]byte, recordHeaderLen+len(rec.value))
+	binary.BigEndian.PutUint64(data[0:], uint64(rec.createRev))
+	binary.BigEndian.PutUint64(data[8:], uint64(rec.modRev))
+	binary.BigEndian.PutUint64(data[16:], uint64(rec.expires))
+	copy(data[recordHeaderLen:], rec.value)
+	return data
+}
+
+// unmarshalRecord decodes the record, the value is copied (data returned
+// by bolt are valid only during the transaction).
+func unmarshalRecord(data []byte) (*record, error) {
+	if len(data) < recordHeaderLen {
+		return nil, fmt.Errorf("record too short (%d bytes)", len(data))
+	}
+	return &record{
+		createRev: int64(binary.BigEndian.Uint64(data[0:])),
+		modRev:    int64(binary.BigEndian.Uint64(data[8:])),
+		expires:   int64(binary.BigEndian.Uint64(data[16:])),
+		value:     append([]byte(nil), data[recordHeaderLen:]...),
+	}, nil
+}
+
+// prefixEnd returns the smallest key greater than all keys with the given
+// prefix (empty string if there is no such key).
+func prefixEnd(prefix string) string {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return string(end[:i+1])
+		}
+	}
+	return ""
+}
+
+// GetNext returns the following item from the result set.
+// When there are no more items to get, <stop> is returned as *true* and <val>
+// is simply *nil*.
+func (ctx *bytesKeyValIterator) GetNext() (val keyval.BytesKeyVal, stop bool) {
+	if ctx.index >= len(ctx.kvs) {
+		return nil, true
+	}
+	val = ctx.kvs[ctx.index]
+	ctx.index++
+	return val, false
+}
+
+// GetNext returns the following key (+ revision) from the result set.
+// When there are no more keys to get, <stop> is returned as *true*
+// and <key> and <rev> are default values.
+func (ctx *bytesKeyIterator) GetNext() (key string, rev int64, stop bool) {
+	if ctx.index >= len(ctx.kvs) {
+		return "", 0, true
+	}
+	kv := ctx.kvs[ctx.index]
+	ctx.index++
+	return kv.key, kv.revision, false
+}
+
+// GetValue returns the value of the pair.
+func (kv *bytesKeyVal) GetValue() []byte {
+	return kv.value
+}
+
+// GetPrevValue returns the previous value of the pair.
+func (kv *bytesKeyVal) GetPrevValue() []byte {
+	return kv.prevValue
+}
+
+// GetKey returns the key of the pair.
+func (kv *bytesKeyVal) GetKey() string {
+	return kv.key
+}
+
+// GetRevision returns the revision associated with the pair.
+func (kv *bytesKeyVal) GetRevision() int64 {
+	return kv.revision
+}
@@ -0,0 +1,253 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bolt
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ligato/cn-infra/config"
+	"github.com/ligato/cn-infra/core"
+	"github.com/ligato/cn-infra/datasync"
+	"github.com/ligato/cn-infra/db/keyval"
+	"github.com/ligato/cn-infra/health/statuscheck/model/status"
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+	"github.com/namsral/flag"
+	"github.com/onsi/gomega"
+)
+
+// openTestDb opens the data store in a new temporary directory.
+func openTestDb() (db *BytesConnectionBolt, cfg *Config, cleanup func()) {
+	dir, err := ioutil.TempDir("", "bolt")
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	cfg = &Config{DbPath: filepath.Join(dir, "bolt.db"), LockTimeout: time.Second}
+	db, err = NewBytesConnectionBolt(cfg, logrus.DefaultLogger())
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	return db, cfg, func() {
+		db.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func listKeys(it keyval.BytesKeyValIterator) (keys []string) {
+	for {
+		kv, stop := it.GetNext()
+		if stop {
+			return keys
+		}
+		keys = append(keys, kv.GetKey())
+	}
+}
+
+func TestPersistence(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	db, cfg, cleanup := openTestDb()
+	defer cleanup()
+
+	gomega.Expect(db.Put("/a/1", []byte("1"))).To(gomega.Succeed())                           // rev 1
+	gomega.Expect(db.Put("/a/1", []byte("2"))).To(gomega.Succeed())                           // rev 2
+	gomega.Expect(db.NewTxn().Put("/a/2", []byte("1")).Put("/a/3", []byte("1")).Commit()).To( // rev 3
+		gomega.Succeed())
+	gomega.Expect(db.Put("/a/expiring", []byte("1"), datasync.WithTTL(200*time.Millisecond))).To(gomega.Succeed()) // rev 4
+	_, err := db.Delete("/a/3")                                                                                    // rev 5
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	gomega.Expect(db.Close()).To(gomega.Succeed())
+	_, _, _, err = db.GetValue("/a/1")
+	gomega.Expect(err).Should(gomega.Equal(ErrClosed))
+
+	db, err = NewBytesConnectionBolt(cfg, logrus.DefaultLogger())
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	defer db.Close()
+
+	// the values and the revisions are restored
+	data, found, rev, err := db.GetValue("/a/1")
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	gomega.Expect(found).Should(gomega.BeTrue())
+	gomega.Expect(string(data)).Should(gomega.Equal("2"))
+	gomega.Expect(rev).Should(gomega.BeEquivalentTo(2))
+	createRev, modRev, found, err := db.GetRevisions("/a/1")
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	gomega.Expect(found).Should(gomega.BeTrue())
+	gomega.Expect(createRev).Should(gomega.BeEquivalentTo(1))
+	gomega.Expect(modRev).Should(gomega.BeEquivalentTo(2))
+	it, err := db.ListValues("/a/")
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	gomega.Expect(listKeys(it)).Should(gomega.Equal([]string{"/a/1", "/a/2", "/a/expiring"}))
+	revision, _ := db.GetRevision()
+	gomega.Expect(revision).Should(gomega.BeEquivalentTo(5))
+
+	// the revision continues from the persisted one
+	gomega.Expect(db.Put("/a/2", []byte("2"), datasync.WithExpectedRevision(3))).To(gomega.Succeed())
+	revision, _ = db.GetRevision()
+	gomega.Expect(revision).Should(gomega.BeEquivalentTo(6))
+
+	// the TTL is respected after the restart
+	gomega.Eventually(func() bool {
+		_, found, _, _ := db.GetValue("/a/expiring")
+		return found
+	}).Should(gomega.BeFalse())
+	revision, _ = db.GetRevision()
+	gomega.Expect(revision).Should(gomega.BeEquivalentTo(7))
+}
+
+func TestExpiredWhileClosed(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	db, cfg, cleanup := openTestDb()
+	defer cleanup()
+
+	gomega.Expect(db.Put("/a/expiring", []byte("1"), datasync.WithTTL(10*time.Millisecond))).To(gomega.Succeed())
+	gomega.Expect(db.Close()).To(gomega.Succeed())
+	time.Sleep(50 * time.Millisecond)
+
+	db, err := NewBytesConnectionBolt(cfg, logrus.DefaultLogger())
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	defer db.Close()
+	gomega.Eventually(func() bool {
+		_, found, _, _ := db.GetValue("/a/expiring")
+		return found
+	}).Should(gomega.BeFalse())
+}
+
+func TestLocked(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	db, cfg, cleanup := openTestDb()
+	defer cleanup()
+
+	// the file is locked while the data store is open
+	lockedCfg := *cfg
+	lockedCfg.LockTimeout = 10 * time.Millisecond
+	_, err := NewBytesConnectionBolt(&lockedCfg, logrus.DefaultLogger())
+	gomega.Expect(err).Should(gomega.HaveOccurred())
+
+	// the second connection waits for the lock up to the timeout
+	lockedCfg.LockTimeout = 5 * time.Second
+	opened := make(chan *BytesConnectionBolt)
+	go func() {
+		db, err := NewBytesConnectionBolt(&lockedCfg, logrus.DefaultLogger())
+		if err != nil {
+			close(opened)
+			return
+		}
+		opened <- db
+	}()
+	gomega.Consistently(opened, 100*time.Millisecond).ShouldNot(gomega.Receive())
+	gomega.Expect(db.Put("a", []byte("1"))).To(gomega.Succeed())
+	gomega.Expect(db.Close()).To(gomega.Succeed())
+
+	var db2 *BytesConnectionBolt
+	gomega.Eventually(opened).Should(gomega.Receive(&db2))
+	gomega.Expect(db2).ShouldNot(gomega.BeNil())
+	defer db2.Close()
+	data, found, _, err := db2.GetValue("a")
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	gomega.Expect(found).Should(gomega.BeTrue())
+	gomega.Expect(string(data)).Should(gomega.Equal("1"))
+}
+
+func TestPersistedHistory(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	db, cfg, cleanup := openTestDb()
+	defer cleanup()
+
+	gomega.Expect(db.Put("/h/a", []byte("1"))).To(gomega.Succeed()) // rev 1
+	gomega.Expect(db.Put("/h/b", []byte("1"))).To(gomega.Succeed()) // rev 2
+	gomega.Expect(db.Put("/h/a", []byte("2"))).To(gomega.Succeed()) // rev 3
+	_, err := db.Delete("/h/b")                                     // rev 4
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	data, found, rev, err := db.GetValueAtRevision("/h/a", 2)
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	gomega.Expect(found).Should(gomega.BeTrue())
+	gomega.Expect(string(data)).Should(gomega.Equal("1"))
+	gomega.Expect(rev).Should(gomega.BeEquivalentTo(1))
+
+	it, err := db.ListValuesAtRevision("/h/", 3)
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	gomega.Expect(listKeys(it)).Should(gomega.Equal([]string{"/h/a", "/h/b"}))
+
+	// the history is persisted, the broker trims its prefix
+	gomega.Expect(db.Close()).To(gomega.Succeed())
+	cfg.HistorySize = 2
+	db, err = NewBytesConnectionBolt(cfg, logrus.DefaultLogger())
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	defer db.Close()
+
+	changes, err := db.NewBroker("/h/").(*BytesBrokerWatcherBolt).KeyHistory("b", 2)
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	gomega.Expect(changes).Should(gomega.HaveLen(2))
+	gomega.Expect(changes[0].GetKey()).Should(gomega.Equal("b"))
+	gomega.Expect(changes[0].GetChangeType()).Should(gomega.Equal(datasync.Put))
+	gomega.Expect(string(changes[0].GetValue())).Should(gomega.Equal("1"))
+	gomega.Expect(changes[1].GetChangeType()).Should(gomega.Equal(datasync.Delete))
+	gomega.Expect(string(changes[1].GetPrevValue())).Should(gomega.Equal("1"))
+	gomega.Expect(changes[1].GetRevision()).Should(gomega.BeEquivalentTo(4))
+
+	// the oldest changes are dropped with the next change
+	gomega.Expect(db.Put("/h/c", []byte("1"))).To(gomega.Succeed()) // rev 5
+	_, _, _, err = db.GetValueAtRevision("/h/a", 2)
+	gomega.Expect(err).Should(gomega.Equal(keyval.ErrCompacted))
+	_, err = db.KeyHistory("/h/b", 2)
+	gomega.Expect(err).Should(gomega.Equal(keyval.ErrCompacted))
+	_, found, _, err = db.GetValueAtRevision("/h/b", 3)
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	gomega.Expect(found).Should(gomega.BeTrue())
+}
+
+func TestPlugin(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	dir, err := ioutil.TempDir("", "bolt")
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	defer os.RemoveAll(dir)
+	cfgFile := filepath.Join(dir, "bolt.conf")
+	gomega.Expect(ioutil.WriteFile(cfgFile, []byte("db-path: "+filepath.Join(dir, "bolt.db")+"\n"), 0644)).To(gomega.Succeed())
+
+	// the flag with the location of the configuration is registered only once per plugin name
+	newPlugin := func(pluginName, cfgFile string) *Plugin {
+		plugin := &Plugin{}
+		plugin.Log = logging.ForPlugin(pluginName, logrus.NewLogRegistry())
+		plugin.PluginName = core.PluginName(pluginName)
+		plugin.PluginConfig = config.ForPlugin(pluginName, cfgFile)
+		flag.Set(pluginName+config.FlagSuffix, cfgFile) // declared by a previous run
+		return plugin
+	}
+
+	// disabled without configuration
+	plugin := newPlugin("bolt-missing", filepath.Join(dir, "missing.conf"))
+	gomega.Expect(plugin.Init()).To(gomega.Succeed())
+	gomega.Expect(plugin.Disabled()).Should(gomega.BeTrue())
+	gomega.Expect(plugin.RawAccess()).Should(gomega.BeNil())
+	gomega.Expect(plugin.Close()).To(gomega.Succeed())
+
+	plugin = newPlugin("bolt", cfgFile)
+	gomega.Expect(plugin.Init()).To(gomega.Succeed())
+	gomega.Expect(plugin.Disabled()).Should(gomega.BeFalse())
+	broker := plugin.NewBroker("/agent/")
+	gomega.Expect(broker.Put("status/etcd", &status.PluginStatus{State: status.OperationalState_OK})).To(gomega.Succeed())
+	gomega.Expect(plugin.Close()).To(gomega.Succeed())
+
+	// the data survive the restart of the plugin
+	plugin = newPlugin("bolt", cfgFile)
+	gomega.Expect(plugin.Init()).To(gomega.Succeed())
+	defer plugin.Close()
+	value := &status.PluginStatus{}
+	found, _, err := plugin.NewBroker("/agent/").GetValue("status/etcd", value)
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	gomega.Expect(found).Should(gomega.BeTrue())
+	gomega.Expect(value.State).Should(gomega.Equal(status.OperationalState_OK))
+}
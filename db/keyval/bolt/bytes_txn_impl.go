@@ -0,0 +1,28 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bolt
+
+import (
+	"github.com/ligato/cn-infra/db/keyval/internal/kvstore"
+)
+
+// txnUpdate applies the transaction in a single bolt transaction
+// with a new revision (see kvstore.UpdateFunc).
+func (db *BytesConnectionBolt) txnUpdate(apply func(store kvstore.Store, rev int64) ([]*kvstore.Change, error)) error {
+	_, err := db.update(func(store *bucketStore, rev int64) ([]*kvstore.Change, error) {
+		return apply(store, rev)
+	})
+	return err
+}
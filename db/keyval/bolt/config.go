@@ -0,0 +1,37 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bolt
+
+import (
+	"os"
+	"time"
+)
+
+// Config represents configuration of the bolt plugin.
+type Config struct {
+	// Path to the file of the data store (created if it does not exist).
+	DbPath string `json:"db-path" validate:"required"`
+	// Permissions of the file of the data store (0660 by default).
+	FileMode os.FileMode `json:"file-mode"`
+	// Maximum amount of time to wait for the lock of the file
+	// (the file is locked by the first process that opens it).
+	LockTimeout time.Duration `json:"lock-timeout" default:"1s" validate:"min=0s"`
+	// Disables fsync after each commit (faster, but the recent changes
+	// may be lost in case of a crash of the operating system).
+	NoSync bool `json:"no-sync"`
+	// Number of the most recent changes kept for keyval.HistoryReader
+	// (DefaultHistorySize if not set, negative value disables the history).
+	HistorySize int `json:"history-size"`
+}
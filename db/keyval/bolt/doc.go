@@ -0,0 +1,35 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package bolt implements the key-value Data Broker client API with
+// an embedded persistent data store (file-backed B+tree of boltdb).
+// See cn-infra/db/keyval for the definition of the key-value Data Broker
+// client API.
+//
+// The data store is meant for agents running on a single box where running
+// etcd is overkill, but the data must survive the restart of the agent.
+// The data store keeps the global revision of the data store and per-key
+// create and modification revisions (persisted together with the values),
+// supports watch (with previous values), transactions, TTL and listing
+// of values by a prefix or by a range of keys.
+//
+// The entity that provides access to the data store is called BytesConnectionBolt:
+//
+//	db, err := bolt.NewBytesConnectionBolt(&bolt.Config{DbPath: "/var/lib/agent/data.db"}, logger)
+//	broker := db.NewBroker("/vnf-agent/")
+//	broker.Put("config/x", []byte("value"))
+//
+// The data store can be used as a plugin of an agent (see Plugin),
+// the proto-modelled data are serialized to JSON as with the etcd plugin.
+package bolt
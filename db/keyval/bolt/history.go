@@ -0,0 +1,313 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bolt
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	boltdb "github.com/boltdb/bolt"
+	"github.com/ligato/cn-infra/datasync"
+	"github.com/ligato/cn-infra/db/keyval"
+	"github.com/ligato/cn-infra/db/keyval/internal/kvstore"
+)
+
+// DefaultHistorySize is the default number of the most recent changes kept
+// in the data store for keyval.HistoryReader (see Config.HistorySize).
+const DefaultHistorySize = 1000
+
+// changeHeaderLen is the length of the operation, the revisions
+// and the length of the key that precede the key in the history entry.
+const changeHeaderLen = 21
+
+// GetValueAtRevision retrieves the item stored under the <key> at the revision
+// <rev> (zero or negative <rev> means the current revision).
+// keyval.ErrCompacted is returned if the revision is older than the history
+// kept in the data store.
+func (db *BytesConnectionBolt) GetValueAtRevision(key string, rev int64) (data []byte, found bool, revision int64, err error) {
+	return db.getValueAtRevision(key, rev)
+}
+
+// ListValuesAtRevision returns an iterator that enables traversing values
+// stored under the provided <prefix> at the revision <rev> in the lexical
+// order of the keys.
+func (db *BytesConnectionBolt) ListValuesAtRevision(prefix string, rev int64, opts ...keyval.ListOption) (keyval.BytesKeyValIterator, error) {
+	kvs, err := db.listAtRevision(keyval.Root, prefix, prefixEnd(prefix), rev, keyval.ParseListOptions(opts...))
+	if err != nil {
+		return nil, err
+	}
+	return &bytesKeyValIterator{kvs: kvs}, nil
+}
+
+// KeyHistory returns the changes of the item stored under the <key> made
+// in the revision <fromRev> or later (from the oldest to the newest).
+// keyval.ErrCompacted is returned if some of the changes were already dropped
+// from the history.
+func (db *BytesConnectionBolt) KeyHistory(key string, fromRev int64) ([]keyval.BytesWatchResp, error) {
+	return db.keyHistory(keyval.Root, key, fromRev)
+}
+
+// GetValueAtRevision calls 'GetValueAtRevision' function of the underlying
+// BytesConnectionBolt. KeyPrefix defined in constructor is prepended
+// to the key argument.
+func (pdb *BytesBrokerWatcherBolt) GetValueAtRevision(key string, rev int64) (data []byte, found bool, revision int64, err error) {
+	return pdb.db.getValueAtRevision(pdb.prefix+key, rev)
+}
+
+// ListValuesAtRevision calls 'ListValuesAtRevision' function of the underlying
+// BytesConnectionBolt. KeyPrefix defined in constructor is prepended to the
+// argument. The prefix is removed from the keys of the returned values.
+func (pdb *BytesBrokerWatcherBolt) ListValuesAtRevision(prefix string, rev int64, opts ...keyval.ListOption) (keyval.BytesKeyValIterator, error) {
+	kvs, err := pdb.db.listAtRevision(pdb.prefix, pdb.prefix+prefix, prefixEnd(pdb.prefix+prefix), rev, keyval.ParseListOptions(opts...))
+	if err != nil {
+		return nil, err
+	}
+	return &bytesKeyValIterator{kvs: kvs}, nil
+}
+
+// KeyHistory calls 'KeyHistory' function of the underlying BytesConnectionBolt.
+// KeyPrefix defined in constructor is prepended to the key argument
+// and removed from the keys of the returned changes.
+func (pdb *BytesBrokerWatcherBolt) KeyHistory(key string, fromRev int64) ([]keyval.BytesWatchResp, error) {
+	return pdb.db.keyHistory(pdb.prefix, pdb.prefix+key, fromRev)
+}
+
+func (db *BytesConnectionBolt) getValueAtRevision(key string, rev int64) (data []byte, found bool, revision int64, err error) {
+	err = db.db.View(func(tx *boltdb.Tx) error {
+		rev, err := historyRevision(tx, rev)
+		if err != nil {
+			return err
+		}
+		if recData := tx.Bucket(kvBucket).Get([]byte(key)); recData != nil {
+			rec, err := unmarshalRecord(recData)
+			if err != nil {
+				return fmt.Errorf("invalid record of %s: %v", key, err)
+			}
+			data, found, revision = rec.value, true, rec.modRev
+		}
+		return revertHistory(tx, rev, func(ch *kvstore.Change) {
+			if ch.Key == key {
+				data, found, revision = ch.PrevValue, ch.PrevRev != 0, ch.PrevRev
+			}
+		})
+	})
+	if err != nil {
+		return nil, false, 0, translateErr(err)
+	}
+	return data, found, revision, nil
+}
+
+// listAtRevision returns the items with keys from the range [from, to)
+// as they were at the revision <rev>, selected by the list options
+// with <trimPrefix> removed from the keys.
+func (db *BytesConnectionBolt) listAtRevision(trimPrefix, from, to string, rev int64, opts keyval.ListOptions) (kvs []*bytesKeyVal, err error) {
+	err = db.db.View(func(tx *boltdb.Tx) error {
+		rev, err := historyRevision(tx, rev)
+		if err != nil {
+			return err
+		}
+		items := make(map[string]*bytesKeyVal)
+		cursor := tx.Bucket(kvBucket).Cursor()
+		for k, data := cursor.Seek([]byte(from)); k != nil && (to == "" || string(k) < to); k, data = cursor.Next() {
+			rec, err := unmarshalRecord(data)
+			if err != nil {
+				return fmt.Errorf("invalid record of %s: %v", k, err)
+			}
+			items[string(k)] = &bytesKeyVal{key: string(k), value: rec.value, revision: rec.modRev}
+		}
+		err = revertHistory(tx, rev, func(ch *kvstore.Change) {
+			if ch.Key < from || (to != "" && ch.Key >= to) {
+				return
+			}
+			if ch.PrevRev == 0 {
+				delete(items, ch.Key)
+			} else {
+				items[ch.Key] = &bytesKeyVal{key: ch.Key, value: ch.PrevValue, revision: ch.PrevRev}
+			}
+		})
+		if err != nil {
+			return err
+		}
+		var keys []string
+		for key := range items {
+			keys = append(keys, key)
+		}
+		for _, key := range opts.SelectKeys(keys, trimPrefix) {
+			kv := items[key]
+			kv.key = strings.TrimPrefix(key, trimPrefix)
+			if opts.KeysOnly {
+				kv.value = nil
+			}
+			kvs = append(kvs, kv)
+		}
+		return nil
+	})
+	return kvs, translateErr(err)
+}
+
+func (db *BytesConnectionBolt) keyHistory(trimPrefix, key string, fromRev int64) (changes []keyval.BytesWatchResp, err error) {
+	err = db.db.View(func(tx *boltdb.Tx) error {
+		if compacted := readMeta(tx, compactedKey); compacted > 0 && fromRev <= compacted {
+			return keyval.ErrCompacted
+		}
+		cursor := tx.Bucket(historyBucket).Cursor()
+		for k, data := cursor.First(); k != nil; k, data = cursor.Next() {
+			ch, err := unmarshalChange(data)
+			if err != nil {
+				return err
+			}
+			if ch.Key == key && ch.Rev >= fromRev {
+				changes = append(changes, ch.WatchResp(trimPrefix))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, translateErr(err)
+	}
+	return changes, nil
+}
+
+// historyRevision validates the revision requested from the history
+// (zero or negative revision is replaced with the current revision).
+func historyRevision(tx *boltdb.Tx, rev int64) (int64, error) {
+	current := readRevision(tx)
+	if rev <= 0 {
+		return current, nil
+	}
+	if rev > current {
+		return 0, fmt.Errorf("revision %d is newer than the current revision %d", rev, current)
+	}
+	if rev < readMeta(tx, compactedKey) {
+		return 0, keyval.ErrCompacted
+	}
+	return rev, nil
+}
+
+// revertHistory calls <revert> for the changes made after the revision <rev>
+// from the newest to the oldest.
+func revertHistory(tx *boltdb.Tx, rev int64, revert func(ch *kvstore.Change)) error {
+	cursor := tx.Bucket(historyBucket).Cursor()
+	for k, data := cursor.Last(); k != nil; k, data = cursor.Prev() {
+		ch, err := unmarshalChange(data)
+		if err != nil {
+			return err
+		}
+		if ch.Rev <= rev {
+			break
+		}
+		revert(ch)
+	}
+	return nil
+}
+
+// appendHistory records the changes in the history and drops the oldest
+// changes above the <size> limit.
+func appendHistory(tx *boltdb.Tx, changes []*kvstore.Change, size int) error {
+	bucket := tx.Bucket(historyBucket)
+	for _, ch := range changes {
+		seq, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		key := make([]byte, 8)
+		binary.BigEndian.PutUint64(key, seq)
+		if err := bucket.Put(key, marshalChange(ch)); err != nil {
+			return err
+		}
+	}
+
+	if size < 0 {
+		size = 0
+	}
+	cursor := bucket.Cursor()
+	k, data := cursor.First()
+	if k == nil {
+		return nil
+	}
+	// the sequence numbers are contiguous, the oldest entries are dropped first
+	drop := int64(bucket.Sequence()-binary.BigEndian.Uint64(k)+1) - int64(size)
+	var dropped [][]byte
+	var compacted int64
+	for ; k != nil && int64(len(dropped)) < drop; k, data = cursor.Next() {
+		ch, err := unmarshalChange(data)
+		if err != nil {
+			return err
+		}
+		dropped = append(dropped, append([]byte(nil), k...))
+		compacted = ch.Rev
+	}
+	for _, k := range dropped {
+		if err := bucket.Delete(k); err != nil {
+			return err
+		}
+	}
+	if len(dropped) == 0 {
+		return nil
+	}
+	return writeMeta(tx, compactedKey, compacted)
+}
+
+// marshalChange encodes the change as the operation (0 = put, 1 = delete), the revisions and the length
+// of the key (big endian) followed by the key, the length of the value,
+// the value and the previous value.
+func marshalChange(ch *kvstore.Change) []byte {
+	data := make([]byte, changeHeaderLen, changeHeaderLen+len(ch.Key)+4+len(ch.Value)+len(ch.PrevValue))
+	if ch.Op == datasync.Delete {
+		data[0] = 1
+	}
+	binary.BigEndian.PutUint64(data[1:], uint64(ch.Rev))
+	binary.BigEndian.PutUint64(data[9:], uint64(ch.PrevRev))
+	binary.BigEndian.PutUint32(data[17:], uint32(len(ch.Key)))
+	data = append(data, ch.Key...)
+	valueLen := make([]byte, 4)
+	binary.BigEndian.PutUint32(valueLen, uint32(len(ch.Value)))
+	data = append(data, valueLen...)
+	data = append(data, ch.Value...)
+	return append(data, ch.PrevValue...)
+}
+
+// unmarshalChange decodes the change, the values are copied (data returned
+// by bolt are valid only during the transaction).
+func unmarshalChange(data []byte) (*kvstore.Change, error) {
+	if len(data) < changeHeaderLen {
+		return nil, fmt.Errorf("history entry too short (%d bytes)", len(data))
+	}
+	ch := &kvstore.Change{
+		Op:      datasync.Put,
+		Rev:     int64(binary.BigEndian.Uint64(data[1:])),
+		PrevRev: int64(binary.BigEndian.Uint64(data[9:])),
+	}
+	if data[0] == 1 {
+		ch.Op = datasync.Delete
+	}
+	keyEnd := changeHeaderLen + int(binary.BigEndian.Uint32(data[17:]))
+	if len(data) < keyEnd+4 {
+		return nil, fmt.Errorf("invalid history entry of revision %d", ch.Rev)
+	}
+	ch.Key = string(data[changeHeaderLen:keyEnd])
+	valueEnd := keyEnd + 4 + int(binary.BigEndian.Uint32(data[keyEnd:]))
+	if len(data) < valueEnd {
+		return nil, fmt.Errorf("invalid history entry of revision %d", ch.Rev)
+	}
+	if ch.Op == datasync.Put {
+		ch.Value = append([]byte(nil), data[keyEnd+4:valueEnd]...)
+	}
+	if valueEnd < len(data) {
+		ch.PrevValue = append([]byte(nil), data[valueEnd:]...)
+	}
+	return ch, nil
+}
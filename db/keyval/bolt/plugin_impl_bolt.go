@@ -0,0 +1,117 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bolt
+
+import (
+	"github.com/ligato/cn-infra/core"
+	"github.com/ligato/cn-infra/db/keyval"
+	"github.com/ligato/cn-infra/db/keyval/kvproto"
+	"github.com/ligato/cn-infra/flavors/local"
+	"github.com/ligato/cn-infra/health/statuscheck"
+	"github.com/ligato/cn-infra/utils/safeclose"
+)
+
+// Plugin implements the embedded persistent data store as a plugin.
+type Plugin struct {
+	Deps
+	// Plugin is disabled if there is no config file available
+	disabled bool
+	// bolt data store encapsulation
+	connection *BytesConnectionBolt
+	// Read/Write proto modelled data
+	protoWrapper *kvproto.ProtoWrapper
+}
+
+// Deps lists dependencies of the bolt plugin.
+// If injected, bolt plugin will use StatusCheck to signal the state
+// of the data store.
+type Deps struct {
+	local.PluginInfraDeps
+}
+
+// Init reads the configuration of the plugin and opens the data store.
+// The plugin is disabled if the configuration is not found.
+func (plugin *Plugin) Init() error {
+	cfg, err := plugin.getConfig()
+	if err != nil || plugin.disabled {
+		return err
+	}
+	plugin.connection, err = NewBytesConnectionBolt(cfg, plugin.Log)
+	if err != nil {
+		plugin.Log.Errorf("Err: %v", err)
+		return err
+	}
+	plugin.protoWrapper = kvproto.NewProtoWrapperWithSerializer(plugin.connection, &keyval.SerializerJSON{})
+
+	// Register for providing status reports (polling mode).
+	if plugin.StatusCheck != nil {
+		plugin.StatusCheck.Register(core.PluginName(plugin.PluginName), func() (statuscheck.PluginState, error) {
+			if _, err := plugin.connection.GetRevision(); err != nil {
+				return statuscheck.Error, err
+			}
+			return statuscheck.OK, nil
+		})
+	} else {
+		plugin.Log.Warnf("Unable to start status check for bolt")
+	}
+	return nil
+}
+
+// Close stops all watches and closes the data store.
+func (plugin *Plugin) Close() error {
+	if plugin.connection == nil {
+		return nil
+	}
+	return safeclose.Close(plugin.connection)
+}
+
+// NewBroker creates new instance of prefixed broker that provides API with arguments of type proto.Message.
+func (plugin *Plugin) NewBroker(keyPrefix string) keyval.ProtoBroker {
+	return plugin.protoWrapper.NewBroker(keyPrefix)
+}
+
+// NewWatcher creates new instance of prefixed broker that provides API with arguments of type proto.Message.
+func (plugin *Plugin) NewWatcher(keyPrefix string) keyval.ProtoWatcher {
+	return plugin.protoWrapper.NewWatcher(keyPrefix)
+}
+
+// RawAccess returns access to the data stored in the form of bytes
+// (nil if the plugin is disabled).
+func (plugin *Plugin) RawAccess() keyval.KvBytesPlugin {
+	if plugin.connection == nil {
+		return nil
+	}
+	return plugin.connection
+}
+
+// Disabled returns *true* if the plugin is not in use due to missing
+// configuration.
+func (plugin *Plugin) Disabled() (disabled bool) {
+	return plugin.disabled
+}
+
+func (plugin *Plugin) getConfig() (*Config, error) {
+	var cfg Config
+	found, err := plugin.PluginConfig.GetValue(&cfg)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		plugin.Log.Info("Bolt config not found, skip loading this plugin")
+		plugin.disabled = true
+		return nil, nil
+	}
+	return &cfg, nil
+}
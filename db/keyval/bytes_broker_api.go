@@ -26,11 +26,15 @@ type BytesBroker interface {
 	// GetValue retrieves one item under the provided key.
 	GetValue(key string) (data []byte, found bool, revision int64, err error)
 	// ListValues returns an iterator that enables to traverse all items stored
-	// under the provided <key>.
-	ListValues(key string) (BytesKeyValIterator, error)
+	// under the provided <key>. The items are listed by a single request
+	// unless WithPageSize is given (then they are fetched in pages on demand),
+	// the listing can be adjusted using ListOptions.
+	ListValues(key string, opts ...ListOption) (BytesKeyValIterator, error)
 	// ListKeys returns an iterator that allows to traverse all keys from data
-	// store that share the given <prefix>.
-	ListKeys(prefix string) (BytesKeyIterator, error)
+	// store that share the given <prefix>. The keys are listed by a single
+	// request unless WithPageSize is given (then they are fetched in pages
+	// on demand), the listing can be adjusted using ListOptions.
+	ListKeys(prefix string, opts ...ListOption) (BytesKeyIterator, error)
 	// Delete removes data stored under the <key>.
 	Delete(key string, opts ...datasync.DelOption) (existed bool, err error)
 }
@@ -29,3 +29,51 @@ type BytesTxn interface {
 	// of them and an error is returned.
 	Commit() error
 }
+
+// BytesCondTxn is a conditional transaction. The operations added by Then()
+// are applied only if all the conditions added by If() hold, otherwise
+// the operations added by Else() are applied. The evaluation of the conditions
+// and the selected operations are applied atomically (see the documentation
+// of a particular data store for exceptions).
+type BytesCondTxn interface {
+	// If adds conditions (see RevEquals(), Missing(), ValueEquals())
+	// into the transaction.
+	If(conditions ...TxnCondition) BytesCondTxn
+	// Then adds operations (see OpPut(), OpDelete()) applied if all
+	// the conditions hold.
+	Then(ops ...TxnOp) BytesCondTxn
+	// Else adds operations (see OpPut(), OpDelete()) applied if any
+	// of the conditions does not hold.
+	Else(ops ...TxnOp) BytesCondTxn
+	// Commit evaluates the conditions and applies the selected operations.
+	// <succeeded> is true if all the conditions held (i.e. the Then operations
+	// were applied).
+	Commit() (succeeded bool, err error)
+}
+
+// BytesCondTxnBroker is implemented by the brokers of the data stores that
+// support conditional transactions.
+type BytesCondTxnBroker interface {
+	// NewCondTxn creates a conditional transaction.
+	NewCondTxn() BytesCondTxn
+}
+
+// TxnOp is an operation of a conditional transaction.
+type TxnOp struct {
+	// Key of the item that is written or removed.
+	Key string
+	// Value written under the key (if not Delete).
+	Value []byte
+	// Delete is true if the item is removed.
+	Delete bool
+}
+
+// OpPut returns an operation that writes <value> under the <key>.
+func OpPut(key string, value []byte) TxnOp {
+	return TxnOp{Key: key, Value: value}
+}
+
+// OpDelete returns an operation that removes the item under the <key>.
+func OpDelete(key string) TxnOp {
+	return TxnOp{Key: key, Delete: true}
+}
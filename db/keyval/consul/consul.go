@@ -19,7 +19,9 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 
 	"github.com/ligato/cn-infra/datasync"
 	"github.com/ligato/cn-infra/db/keyval"
@@ -44,6 +46,12 @@ func transformKey(key string) string {
 // Client serves as a client for Consul KV storage and implements keyval.CoreBrokerWatcher interface.
 type Client struct {
 	client *api.Client
+
+	// sessions renewed by KeepAlive()
+	access      sync.Mutex
+	renewals    map[keyval.LeaseID]chan struct{}
+	closeCtx    context.Context
+	cancelClose context.CancelFunc
 }
 
 // NewClient creates new client for Consul using given address.
@@ -59,16 +67,42 @@ func NewClient(cfg *api.Config) (store *Client, err error) {
 	}
 	consulLogger.Infof("consul peers: %v", peers)
 
+	closeCtx, cancelClose := context.WithCancel(context.Background())
 	return &Client{
-		client: c,
+		client:      c,
+		renewals:    make(map[keyval.LeaseID]chan struct{}),
+		closeCtx:    closeCtx,
+		cancelClose: cancelClose,
 	}, nil
 
 }
 
 // Put stores given data for the key.
+// With datasync.WithExpectedRevision() or datasync.WithCreateOnly() option
+// the data are stored by check-and-set of the ModifyIndex, keyval.ErrRevisionMismatch
+// is returned if the key was modified in the meantime. With keyval.WithLease()
+// option the key is acquired by the session (see GrantLease()). With
+// datasync.WithTTL() option the key is acquired by a new session that
+// is not renewed (see putWithTTL()).
 func (c *Client) Put(key string, data []byte, opts ...datasync.PutOption) error {
 	consulLogger.Debugf("put: %q\n", key)
 	p := &api.KVPair{Key: transformKey(key), Value: data}
+	if id, found := keyval.PutLease(opts...); found {
+		return c.putWithSession(key, p, id, opts...)
+	}
+	if ttl, found := putTTL(opts...); found {
+		return c.putWithTTL(key, p, ttl, opts...)
+	}
+	if rev, expected := keyval.PutExpectedRevision(opts...); expected {
+		p.ModifyIndex = uint64(rev)
+		ok, _, err := c.client.KV().CAS(p, nil)
+		if err != nil {
+			return err
+		} else if !ok {
+			return c.revisionMismatch(key, rev)
+		}
+		return nil
+	}
 	_, err := c.client.KV().Put(p, nil)
 	if err != nil {
 		return err
@@ -84,6 +118,13 @@ func (c *Client) NewTxn() keyval.BytesTxn {
 	}
 }
 
+// NewCondTxn creates new conditional transaction.
+func (c *Client) NewCondTxn() keyval.BytesCondTxn {
+	return &condTxn{
+		kv: c.client.KV(),
+	}
+}
+
 // GetValue returns data for the given key.
 func (c *Client) GetValue(key string) (data []byte, found bool, revision int64, err error) {
 	consulLogger.Debugf("get value: %q\n", key)
@@ -98,28 +139,64 @@ func (c *Client) GetValue(key string) (data []byte, found bool, revision int64,
 }
 
 // ListValues returns interator with key-value pairs for given key prefix.
-func (c *Client) ListValues(key string) (keyval.BytesKeyValIterator, error) {
-	pairs, _, err := c.client.KV().List(transformKey(key), nil)
+// The items are listed by a single request, unless keyval.WithLimit() or
+// keyval.WithPageSize() is used (then the keys are listed at once and
+// the values are fetched in pages on demand).
+func (c *Client) ListValues(key string, opts ...keyval.ListOption) (keyval.BytesKeyValIterator, error) {
+	list, err := listPrefix(c.client.KV(), transformKey(key), "", keyval.ParseListOptions(opts...))
 	if err != nil {
 		return nil, err
 	}
 
-	return &bytesKeyValIterator{len: len(pairs), pairs: pairs}, nil
+	return &bytesKeyValIterator{list: list}, nil
+}
+
+// ListValuesRange returns an iterator that enables traversing values stored
+// under the keys from the range [fromPrefix, toPrefix). Empty <toPrefix>
+// means no upper bound.
+func (c *Client) ListValuesRange(fromPrefix string, toPrefix string) (keyval.BytesKeyValIterator, error) {
+	from, to := transformKey(fromPrefix), transformKey(toPrefix)
+	list, err := listRange(c.client.KV(), commonPrefix(from, to), from, to, "", keyval.ParseListOptions())
+	if err != nil {
+		return nil, err
+	}
+
+	return &bytesKeyValIterator{list: list}, nil
 }
 
 // ListKeys returns interator with keys for given key prefix.
-func (c *Client) ListKeys(prefix string) (keyval.BytesKeyIterator, error) {
-	keys, _, err := c.client.KV().Keys(transformKey(prefix), "", nil)
+func (c *Client) ListKeys(prefix string, opts ...keyval.ListOption) (keyval.BytesKeyIterator, error) {
+	list, err := listPrefix(c.client.KV(), transformKey(prefix), "", keyval.ParseListOptions(append(opts, keyval.WithKeysOnly())...))
 	if err != nil {
 		return nil, err
 	}
 
-	return &bytesKeyIterator{len: len(keys), keys: keys}, nil
+	return &bytesKeyIterator{list: list}, nil
 }
 
 // Delete deletes given key.
+// With datasync.WithExpectedRevision() option the key is deleted by check-and-set
+// of the ModifyIndex, keyval.ErrRevisionMismatch is returned if the key was
+// modified in the meantime.
 func (c *Client) Delete(key string, opts ...datasync.DelOption) (existed bool, err error) {
 	consulLogger.Debugf("delete: %q\n", key)
+	if rev, expected := keyval.DelExpectedRevision(opts...); expected {
+		if rev == 0 {
+			// nothing to delete if the key does not exist
+			_, found, current, err := c.GetValue(key)
+			if err != nil {
+				return false, err
+			}
+			return false, keyval.CheckRevision(key, rev, found, current)
+		}
+		ok, _, err := c.client.KV().DeleteCAS(&api.KVPair{Key: transformKey(key), ModifyIndex: uint64(rev)}, nil)
+		if err != nil {
+			return false, err
+		} else if !ok {
+			return false, c.revisionMismatch(key, rev)
+		}
+		return true, nil
+	}
 	if _, err := c.client.KV().Delete(transformKey(key), nil); err != nil {
 		return false, err
 	}
@@ -127,6 +204,25 @@ func (c *Client) Delete(key string, opts ...datasync.DelOption) (existed bool, e
 	return true, nil
 }
 
+// revisionMismatch returns keyval.ErrRevisionMismatch with the current
+// ModifyIndex of the key after a failed check-and-set.
+func (c *Client) revisionMismatch(key string, expected int64) error {
+	_, _, current, err := c.GetValue(key)
+	if err != nil {
+		return err
+	}
+	return &keyval.ErrRevisionMismatch{Key: key, Expected: expected, Current: current}
+}
+
+// revisionCheck returns the transaction operation checking that the key
+// was last modified with the index <rev> (0 = the key does not exist).
+func revisionCheck(key string, rev int64) *api.KVTxnOp {
+	if rev == 0 {
+		return &api.KVTxnOp{Verb: api.KVCheckNotExists, Key: key}
+	}
+	return &api.KVTxnOp{Verb: api.KVCheckIndex, Key: key, Index: uint64(rev)}
+}
+
 // Watch watches given list of key prefixes.
 func (c *Client) Watch(resp func(keyval.BytesWatchResp), closeChan chan string, keys ...string) error {
 	consulLogger.Debug("Watch:", keys)
@@ -201,10 +297,10 @@ func (c *Client) watch(resp func(watchResp keyval.BytesWatchResp), closeCh chan
 						}
 					} else {
 						r = &watchResp{
-							typ:   datasync.Delete,
-							key:   key,
-							value: ev.Value,
-							rev:   ev.Revision,
+							typ:       datasync.Delete,
+							key:       key,
+							prevValue: ev.PrevValue,
+							rev:       ev.Revision,
 						}
 					}
 					resp(r)
@@ -284,50 +380,80 @@ func (c *Client) watchPrefix(ctx context.Context, prefix string) <-chan watchRes
 				consulLogger.Debugf(" + key: %q create: %v modify: %v", pair.Key, pair.CreateIndex, pair.ModifyIndex)
 			}
 
-			var evs []*watchEvent
+			evs := diffPairs(oldPairsMap, newPairs, newIndex)
 
-			// Search for all created and modified KV
-			for _, pair := range newPairs {
-				if pair.ModifyIndex > oldIndex {
-					var prevVal []byte
-					if oldPair, ok := oldPairsMap[pair.Key]; ok {
-						prevVal = oldPair.Value
-					}
-					evs = append(evs, &watchEvent{
-						Type:      datasync.Put,
-						Key:       pair.Key,
-						Value:     pair.Value,
-						PrevValue: prevVal,
-						Revision:  int64(pair.ModifyIndex),
-					})
-				}
-				delete(oldPairsMap, pair.Key)
-			}
-			// Search for all deleted KV
-			for _, pair := range oldPairsMap {
-				evs = append(evs, &watchEvent{
-					Type:      datasync.Delete,
-					Key:       pair.Key,
-					PrevValue: pair.Value,
-					Revision:  int64(pair.ModifyIndex),
-				})
+			// Prepare latest KV pairs and last index for next round.
+			// The index going backwards (e.g. after a restore of the data
+			// store) is reset, the blocking query would otherwise wait until
+			// the data store reaches the old index.
+			if newIndex < oldIndex {
+				oldIndex = 0
+			} else {
+				oldIndex = newIndex
 			}
-
-			// Prepare latest KV pairs and last index for next round
-			oldIndex = newIndex
 			oldPairsMap = make(map[string]*api.KVPair)
 			for _, pair := range newPairs {
 				oldPairsMap[pair.Key] = pair
 			}
 
+			if len(evs) == 0 {
+				continue
+			}
 			ch <- watchResponse{Events: evs}
 		}
 	}()
 	return ch
 }
 
-// Close returns nil.
+// diffPairs compares the pairs of the previous listing (by key) with the new
+// listing of the prefix returned with the index <lastIndex>. Pairs with
+// a different ModifyIndex are reported as put (with the previous value),
+// missing pairs as deleted with the revision <lastIndex> (the index of the
+// deletion is not known otherwise). Intermediate changes of a key between
+// two listings are not reported. The events are sorted by revisions.
+func diffPairs(oldPairs map[string]*api.KVPair, newPairs api.KVPairs, lastIndex uint64) []*watchEvent {
+	var evs []*watchEvent
+	listed := make(map[string]struct{}, len(newPairs))
+	for _, pair := range newPairs {
+		listed[pair.Key] = struct{}{}
+		oldPair, found := oldPairs[pair.Key]
+		if found && oldPair.ModifyIndex == pair.ModifyIndex {
+			continue
+		}
+		var prevVal []byte
+		if found {
+			prevVal = oldPair.Value
+		}
+		evs = append(evs, &watchEvent{
+			Type:      datasync.Put,
+			Key:       pair.Key,
+			Value:     pair.Value,
+			PrevValue: prevVal,
+			Revision:  int64(pair.ModifyIndex),
+		})
+	}
+	for key, pair := range oldPairs {
+		if _, found := listed[key]; !found {
+			evs = append(evs, &watchEvent{
+				Type:      datasync.Delete,
+				Key:       key,
+				PrevValue: pair.Value,
+				Revision:  int64(lastIndex),
+			})
+		}
+	}
+	sort.Slice(evs, func(i, j int) bool {
+		if evs[i].Revision != evs[j].Revision {
+			return evs[i].Revision < evs[j].Revision
+		}
+		return evs[i].Key < evs[j].Key
+	})
+	return evs
+}
+
+// Close stops renewal of the sessions kept alive by KeepAlive().
 func (c *Client) Close() error {
+	c.cancelClose()
 	return nil
 }
 
@@ -382,6 +508,16 @@ func (pdb *BrokerWatcher) NewTxn() keyval.BytesTxn {
 	return pdb.Client.NewTxn()
 }
 
+// NewCondTxn creates a new conditional transaction.
+// KeyPrefix defined in constructor will be prepended to the keys of all
+// conditions and operations in the transaction.
+func (pdb *BrokerWatcher) NewCondTxn() keyval.BytesCondTxn {
+	return &condTxn{
+		kv:        pdb.client.KV(),
+		prefixKey: pdb.prefixKey,
+	}
+}
+
 // GetValue calls 'GetValue' function of the underlying BytesConnectionEtcd.
 // KeyPrefix defined in constructor is prepended to the key argument.
 func (pdb *BrokerWatcher) GetValue(key string) (data []byte, found bool, revision int64, err error) {
@@ -391,24 +527,43 @@ func (pdb *BrokerWatcher) GetValue(key string) (data []byte, found bool, revisio
 // ListValues calls 'ListValues' function of the underlying BytesConnectionEtcd.
 // KeyPrefix defined in constructor is prepended to the key argument.
 // The prefix is removed from the keys of the returned values.
-func (pdb *BrokerWatcher) ListValues(key string) (keyval.BytesKeyValIterator, error) {
-	pairs, _, err := pdb.client.KV().List(pdb.prefixKey(transformKey(key)), nil)
+func (pdb *BrokerWatcher) ListValues(key string, opts ...keyval.ListOption) (keyval.BytesKeyValIterator, error) {
+	list, err := listPrefix(pdb.client.KV(), pdb.prefixKey(transformKey(key)), pdb.prefix, keyval.ParseListOptions(opts...))
+	if err != nil {
+		return nil, err
+	}
+
+	return &bytesKeyValIterator{list: list, prefix: pdb.prefix}, nil
+}
+
+// ListValuesRange calls 'ListValuesRange' function of the underlying Client.
+// KeyPrefix defined in constructor is prepended to both bounds of the range,
+// the range is limited to the keys with the prefix. The prefix is removed
+// from the keys of the returned values.
+func (pdb *BrokerWatcher) ListValuesRange(fromPrefix string, toPrefix string) (keyval.BytesKeyValIterator, error) {
+	prefix := transformKey(pdb.prefix)
+	to := ""
+	if toPrefix != "" {
+		to = prefix + toPrefix
+	}
+	list, err := listRange(pdb.client.KV(), prefix, prefix+fromPrefix, to, pdb.prefix, keyval.ParseListOptions())
 	if err != nil {
 		return nil, err
 	}
 
-	return &bytesKeyValIterator{len: len(pairs), pairs: pairs, prefix: pdb.prefix}, nil
+	return &bytesKeyValIterator{list: list, prefix: pdb.prefix}, nil
 }
 
 // ListKeys calls 'ListKeys' function of the underlying BytesConnectionEtcd.
 // KeyPrefix defined in constructor is prepended to the argument.
-func (pdb *BrokerWatcher) ListKeys(prefix string) (keyval.BytesKeyIterator, error) {
-	keys, qm, err := pdb.client.KV().Keys(pdb.prefixKey(transformKey(prefix)), "", nil)
+func (pdb *BrokerWatcher) ListKeys(prefix string, opts ...keyval.ListOption) (keyval.BytesKeyIterator, error) {
+	list, err := listPrefix(pdb.client.KV(), pdb.prefixKey(transformKey(prefix)), pdb.prefix,
+		keyval.ParseListOptions(append(opts, keyval.WithKeysOnly())...))
 	if err != nil {
 		return nil, err
 	}
 
-	return &bytesKeyIterator{len: len(keys), keys: keys, prefix: pdb.prefix, lastIndex: qm.LastIndex}, nil
+	return &bytesKeyIterator{list: list, prefix: pdb.prefix}, nil
 }
 
 // Delete calls 'Delete' function of the underlying BytesConnectionEtcd.
@@ -435,74 +590,60 @@ func (pdb *BrokerWatcher) Watch(resp func(keyval.BytesWatchResp), closeChan chan
 
 // bytesKeyIterator is an iterator returned by ListKeys call.
 type bytesKeyIterator struct {
-	index     int
-	len       int
-	keys      []string
-	prefix    string
-	lastIndex uint64
+	list   *pagedList
+	prefix string
 }
 
 // GetNext returns the following key (+ revision) from the result set.
 // When there are no more keys to get, <stop> is returned as *true*
 // and <key> and <rev> are default values.
 func (it *bytesKeyIterator) GetNext() (key string, rev int64, stop bool) {
-	if it.index >= it.len {
+	pair := it.list.nextPair()
+	if pair == nil {
 		return "", 0, true
 	}
 
-	key = string(it.keys[it.index])
+	key = pair.Key
 	if it.prefix != "" {
 		key = strings.TrimPrefix(key, it.prefix)
 	}
-	rev = int64(it.lastIndex)
-	it.index++
-
-	return key, rev, false
+	return key, int64(pair.ModifyIndex), false
 }
 
-// Close does nothing since db cursors are not needed.
-// The method is required by the code since it implements Iterator API.
+// Close returns the error that stopped fetching of the pages (if any).
 func (it *bytesKeyIterator) Close() error {
-	return nil
+	return it.list.err
 }
 
 // bytesKeyValIterator is an iterator returned by ListValues call.
 type bytesKeyValIterator struct {
-	index  int
-	len    int
-	pairs  api.KVPairs
-	prefix string
+	list      *pagedList
+	prefix    string
+	prevValue []byte
 }
 
 // GetNext returns the following item from the result set.
 // When there are no more items to get, <stop> is returned as *true* and <val>
 // is simply *nil*.
 func (it *bytesKeyValIterator) GetNext() (val keyval.BytesKeyVal, stop bool) {
-	if it.index >= it.len {
+	pair := it.list.nextPair()
+	if pair == nil {
 		return nil, true
 	}
 
-	key := string(it.pairs[it.index].Key)
+	key := pair.Key
 	if it.prefix != "" {
 		key = strings.TrimPrefix(key, it.prefix)
 	}
-	data := it.pairs[it.index].Value
-	rev := int64(it.pairs[it.index].ModifyIndex)
-
-	var prevValue []byte
-	if len(it.pairs) > 0 && it.index > 0 {
-		prevValue = it.pairs[it.index-1].Value
-	}
+	prevValue := it.prevValue
+	it.prevValue = pair.Value
 
-	it.index++
-
-	return &bytesKeyVal{key, data, prevValue, rev}, false
+	return &bytesKeyVal{key, pair.Value, prevValue, int64(pair.ModifyIndex)}, false
 }
 
-// Close does nothing since db cursors are not needed.
-// The method is required by the code since it implements Iterator API.
+// Close returns the error that stopped fetching of the pages (if any).
 func (it *bytesKeyValIterator) Close() error {
-	return nil
+	return it.list.err
 }
 
 // bytesKeyVal represents a single key-value pair.
@@ -15,12 +15,16 @@
 package consul
 
 import (
+	"context"
+	"fmt"
+	"io"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/hashicorp/consul/api"
 	"github.com/hashicorp/consul/testutil"
+	"github.com/ligato/cn-infra/datasync"
 	"github.com/ligato/cn-infra/db/keyval"
 	"github.com/ligato/cn-infra/logging"
 	"github.com/ligato/cn-infra/logging/logrus"
@@ -96,6 +100,130 @@ func TestDelete(t *testing.T) {
 	Expect(ctx.testSrv.ListKV(t, "")).To(BeEmpty())
 }
 
+func TestCondTxn(t *testing.T) {
+	ctx := setupTest(t)
+	defer ctx.teardownTest()
+
+	ctx.testSrv.SetKV(t, "key", []byte("val"))
+	_, _, rev, err := ctx.client.GetValue("key")
+	Expect(err).ToNot(HaveOccurred())
+
+	succeeded, err := ctx.client.NewCondTxn().
+		If(keyval.RevEquals("key", rev), keyval.ValueEquals("key", []byte("val")), keyval.Missing("other")).
+		Then(keyval.OpPut("key", []byte("new"))).
+		Commit()
+	Expect(err).ToNot(HaveOccurred())
+	Expect(succeeded).To(BeTrue())
+	Expect(ctx.testSrv.GetKVString(t, "key")).To(Equal("new"))
+
+	// the revision has changed since
+	succeeded, err = ctx.client.NewCondTxn().
+		If(keyval.RevEquals("key", rev)).
+		Then(keyval.OpPut("key", []byte("then"))).
+		Else(keyval.OpPut("conflict", []byte("else"))).
+		Commit()
+	Expect(err).ToNot(HaveOccurred())
+	Expect(succeeded).To(BeFalse())
+	Expect(ctx.testSrv.GetKVString(t, "key")).To(Equal("new"))
+	Expect(ctx.testSrv.GetKVString(t, "conflict")).To(Equal("else"))
+}
+
+func TestPutExpectedRevision(t *testing.T) {
+	ctx := setupTest(t)
+	defer ctx.teardownTest()
+
+	err := ctx.client.Put("key", []byte("val"), datasync.WithCreateOnly())
+	Expect(err).ToNot(HaveOccurred())
+	_, _, rev, err := ctx.client.GetValue("key")
+	Expect(err).ToNot(HaveOccurred())
+
+	err = ctx.client.Put("key", []byte("other"), datasync.WithCreateOnly())
+	Expect(err).To(BeAssignableToTypeOf(&keyval.ErrRevisionMismatch{}))
+	Expect(err.(*keyval.ErrRevisionMismatch).Current).To(Equal(rev))
+
+	err = ctx.client.Put("key", []byte("new"), datasync.WithExpectedRevision(rev))
+	Expect(err).ToNot(HaveOccurred())
+	Expect(ctx.testSrv.GetKVString(t, "key")).To(Equal("new"))
+
+	existed, err := ctx.client.Delete("key", datasync.WithExpectedRevision(rev))
+	Expect(err).To(BeAssignableToTypeOf(&keyval.ErrRevisionMismatch{}))
+	Expect(existed).To(BeFalse())
+}
+
+func TestLease(t *testing.T) {
+	ctx := setupTest(t)
+	defer ctx.teardownTest()
+
+	// TTL shorter than the minimal TTL of Consul sessions is rounded up
+	id, err := ctx.client.GrantLease(time.Second)
+	Expect(err).ToNot(HaveOccurred())
+	entry, _, err := ctx.client.client.Session().Info(string(id), nil)
+	Expect(err).ToNot(HaveOccurred())
+	Expect(entry.TTL).To(Equal(minSessionTTL.String()))
+	Expect(ctx.client.KeepAlive(id)).To(Succeed())
+
+	err = ctx.client.Put("status", []byte("ok"), keyval.WithLease(id))
+	Expect(err).ToNot(HaveOccurred())
+	Expect(ctx.testSrv.GetKVString(t, "status")).To(Equal("ok"))
+
+	Expect(ctx.client.Revoke(id)).To(Succeed())
+	_, found, _, err := ctx.client.GetValue("status")
+	Expect(err).ToNot(HaveOccurred())
+	Expect(found).To(BeFalse())
+}
+
+func TestPutWithTTL(t *testing.T) {
+	ctx := setupTest(t)
+	defer ctx.teardownTest()
+
+	err := ctx.client.Put("temp", []byte("val1"), datasync.WithTTL(time.Second))
+	Expect(err).ToNot(HaveOccurred())
+	pair, _, err := ctx.client.client.KV().Get("temp", nil)
+	Expect(err).ToNot(HaveOccurred())
+	Expect(pair.Session).ToNot(BeEmpty())
+	entry, _, err := ctx.client.client.Session().Info(pair.Session, nil)
+	Expect(err).ToNot(HaveOccurred())
+	Expect(entry.TTL).To(Equal(minSessionTTL.String()))
+
+	// the key is re-bound to the session of the next put
+	err = ctx.client.Put("temp", []byte("val2"), datasync.WithTTL(time.Second))
+	Expect(err).ToNot(HaveOccurred())
+	newPair, _, err := ctx.client.client.KV().Get("temp", nil)
+	Expect(err).ToNot(HaveOccurred())
+	Expect(newPair.Session).ToNot(Equal(pair.Session))
+	Expect(newPair.Value).To(Equal([]byte("val2")))
+
+	err = ctx.client.Put("temp", []byte("val3"), datasync.WithTTL(time.Second), datasync.WithExpectedRevision(int64(pair.ModifyIndex)))
+	Expect(err).To(BeAssignableToTypeOf(&keyval.ErrRevisionMismatch{}))
+
+	// the key is removed with the session
+	_, err = ctx.client.client.Session().Destroy(newPair.Session, nil)
+	Expect(err).ToNot(HaveOccurred())
+	_, found, _, err := ctx.client.GetValue("temp")
+	Expect(err).ToNot(HaveOccurred())
+	Expect(found).To(BeFalse())
+}
+
+func TestMutex(t *testing.T) {
+	ctx := setupTest(t)
+	defer ctx.teardownTest()
+
+	mutex, err := ctx.client.NewMutex("lock", 3*time.Second)
+	Expect(err).ToNot(HaveOccurred())
+	Expect(mutex.Lock(context.Background())).To(Succeed())
+	Expect(mutex.FencingToken()).To(BeNumerically(">", 0))
+
+	e, err := ctx.client.NewElection("leader", 3*time.Second)
+	Expect(err).ToNot(HaveOccurred())
+	Expect(e.Campaign(context.Background(), "agent1")).To(Succeed())
+	Expect(e.IsLeader()).To(BeTrue())
+	Expect(e.Resign(context.Background())).To(Succeed())
+	Expect(e.IsLeader()).To(BeFalse())
+
+	Expect(mutex.Unlock()).To(Succeed())
+	Expect(mutex.Close()).To(Succeed())
+}
+
 func TestListKeys(t *testing.T) {
 	ctx := setupTest(t)
 	defer ctx.teardownTest()
@@ -176,6 +304,57 @@ func TestListValues(t *testing.T) {
 	}
 }
 
+func TestListPages(t *testing.T) {
+	ctx := setupTest(t)
+	defer ctx.teardownTest()
+
+	kvs := map[string][]byte{}
+	for i := 0; i < maxTxnOps+10; i++ {
+		kvs[fmt.Sprintf("key/%03d", i)] = []byte{byte(i)}
+	}
+	ctx.testSrv.PopulateKV(t, kvs)
+
+	kvi, err := ctx.client.ListValues("key", keyval.WithStartAfter("key/004"), keyval.WithPageSize(100))
+	Expect(err).ToNot(HaveOccurred())
+	var keys []string
+	for {
+		kv, all := kvi.GetNext()
+		if all {
+			break
+		}
+		Expect(kv.GetValue()).To(Equal(kvs[kv.GetKey()]))
+		keys = append(keys, kv.GetKey())
+	}
+	Expect(kvi.(io.Closer).Close()).To(Succeed())
+	Expect(keys).To(HaveLen(maxTxnOps + 5))
+	Expect(keys[0]).To(Equal("key/005"))
+
+	// without the page size the items are listed by a single request
+	kvi, err = ctx.client.NewBroker("key/").ListValues("", keyval.WithStartAfter(fmt.Sprintf("%03d", maxTxnOps)))
+	Expect(err).ToNot(HaveOccurred())
+	keys = nil
+	for {
+		kv, all := kvi.GetNext()
+		if all {
+			break
+		}
+		Expect(kv.GetValue()).To(Equal(kvs["key/"+kv.GetKey()]))
+		keys = append(keys, kv.GetKey())
+	}
+	Expect(keys).To(HaveLen(9))
+	Expect(keys[0]).To(Equal(fmt.Sprintf("%03d", maxTxnOps+1)))
+
+	ki, err := ctx.client.NewBroker("key/").ListKeys("", keyval.WithLimit(2))
+	Expect(err).ToNot(HaveOccurred())
+	key, _, all := ki.GetNext()
+	Expect(all).To(BeFalse())
+	Expect(key).To(Equal("000"))
+	key, _, _ = ki.GetNext()
+	Expect(key).To(Equal("001"))
+	_, _, all = ki.GetNext()
+	Expect(all).To(BeTrue())
+}
+
 func TestListValuesPrefixed(t *testing.T) {
 	ctx := setupTest(t)
 	defer ctx.teardownTest()
@@ -205,6 +384,69 @@ func TestListValuesPrefixed(t *testing.T) {
 	}
 }
 
+func TestListValuesRange(t *testing.T) {
+	ctx := setupTest(t)
+	defer ctx.teardownTest()
+
+	ctx.testSrv.PopulateKV(t, map[string][]byte{
+		"myprefix/a/1": []byte("val1"),
+		"myprefix/a/2": []byte("val2"),
+		"myprefix/b/1": []byte("val3"),
+		"other/a":      []byte("val4"),
+	})
+
+	listKeys := func(kvi keyval.BytesKeyValIterator) (keys []string) {
+		for {
+			kv, all := kvi.GetNext()
+			if all {
+				return keys
+			}
+			Expect(kv.GetRevision()).To(BeNumerically(">", 0))
+			keys = append(keys, kv.GetKey())
+		}
+	}
+
+	kvi, err := ctx.client.ListValuesRange("/myprefix/a/2", "/myprefix/c")
+	Expect(err).ToNot(HaveOccurred())
+	Expect(listKeys(kvi)).To(Equal([]string{"myprefix/a/2", "myprefix/b/1"}))
+
+	kvi, err = ctx.client.ListValuesRange("myprefix/b", "")
+	Expect(err).ToNot(HaveOccurred())
+	Expect(listKeys(kvi)).To(Equal([]string{"myprefix/b/1", "other/a"}))
+
+	kvi, err = ctx.client.NewBroker("myprefix/").(*BrokerWatcher).ListValuesRange("a/2", "")
+	Expect(err).ToNot(HaveOccurred())
+	Expect(listKeys(kvi)).To(Equal([]string{"a/2", "b/1"}))
+
+	// revisions of the keys are listed without values
+	ki, err := ctx.client.ListKeys("myprefix/a/2")
+	Expect(err).ToNot(HaveOccurred())
+	_, rev, _ := ki.GetNext()
+	_, _, expected, err := ctx.client.GetValue("myprefix/a/2")
+	Expect(err).ToNot(HaveOccurred())
+	Expect(rev).To(Equal(expected))
+}
+
+func TestWatchChanges(t *testing.T) {
+	RegisterTestingT(t)
+
+	oldPairs := map[string]*api.KVPair{
+		"a": {Key: "a", Value: []byte("a1"), ModifyIndex: 5},
+		"b": {Key: "b", Value: []byte("b1"), ModifyIndex: 6},
+		"c": {Key: "c", Value: []byte("c1"), ModifyIndex: 7},
+	}
+	newPairs := api.KVPairs{
+		{Key: "a", Value: []byte("a1"), ModifyIndex: 5},
+		{Key: "b", Value: []byte("b2"), ModifyIndex: 9},
+		{Key: "d", Value: []byte("d1"), ModifyIndex: 8},
+	}
+	Expect(diffPairs(oldPairs, newPairs, 10)).To(Equal([]*watchEvent{
+		{Type: datasync.Put, Key: "d", Value: []byte("d1"), Revision: 8},
+		{Type: datasync.Put, Key: "b", Value: []byte("b2"), PrevValue: []byte("b1"), Revision: 9},
+		{Type: datasync.Delete, Key: "c", PrevValue: []byte("c1"), Revision: 10},
+	}))
+}
+
 func TestWatch(t *testing.T) {
 	ctx := setupTest(t)
 	defer ctx.teardownTest()
@@ -0,0 +1,243 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consul
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/ligato/cn-infra/db/keyval/election"
+)
+
+const (
+	// observeRetryMin is the delay of the first retry of a failed query
+	// observing the election, the delay is doubled up to observeRetryMax.
+	observeRetryMin = 100 * time.Millisecond
+	observeRetryMax = 10 * time.Second
+)
+
+// consulMutex implements election.Mutex using a Consul lock. The ModifyIndex
+// of the lock key after the acquisition is used as the fencing token.
+type consulMutex struct {
+	client *api.Client
+	lock   *api.Lock
+	key    string
+
+	access sync.Mutex
+	lostCh <-chan struct{}
+	token  int64
+}
+
+// consulElection implements election.Election using a Consul lock
+// that carries the value of the leader.
+type consulElection struct {
+	client *api.Client
+	key    string
+	ttl    time.Duration
+
+	access sync.Mutex
+	lock   *api.Lock
+	lostCh <-chan struct{}
+}
+
+// NewMutex creates a new distributed lock. Every acquisition of the lock
+// creates a new Consul session with the given <ttl> (rounded to the range
+// accepted by Consul as in GrantLease()).
+func (c *Client) NewMutex(key string, ttl time.Duration) (election.Mutex, error) {
+	lock, err := c.client.LockOpts(&api.LockOptions{Key: transformKey(key), SessionTTL: sessionTTL(ttl)})
+	if err != nil {
+		return nil, err
+	}
+	return &consulMutex{client: c.client, lock: lock, key: transformKey(key)}, nil
+}
+
+// NewElection creates a new participant of the leader election. Every campaign
+// creates a new Consul session with the given <ttl> (rounded to the range
+// accepted by Consul as in GrantLease()).
+func (c *Client) NewElection(key string, ttl time.Duration) (election.Election, error) {
+	return &consulElection{client: c.client, key: transformKey(key), ttl: ttl}, nil
+}
+
+// Lock blocks until the lock is acquired or the <ctx> is done.
+func (m *consulMutex) Lock(ctx context.Context) error {
+	lostCh, err := m.lock.Lock(ctx.Done())
+	if err != nil {
+		return err
+	} else if lostCh == nil {
+		return ctx.Err()
+	}
+	pair, _, err := m.client.KV().Get(m.key, nil)
+	if err != nil || pair == nil {
+		m.lock.Unlock()
+		if err == nil {
+			err = election.ErrNotHeld
+		}
+		return err
+	}
+
+	m.access.Lock()
+	defer m.access.Unlock()
+	m.lostCh, m.token = lostCh, int64(pair.ModifyIndex)
+	return nil
+}
+
+// Unlock releases the lock.
+func (m *consulMutex) Unlock() error {
+	m.access.Lock()
+	defer m.access.Unlock()
+
+	m.lostCh = nil
+	if err := m.lock.Unlock(); err != nil {
+		if err == api.ErrLockNotHeld {
+			return election.ErrNotHeld
+		}
+		return err
+	}
+	return nil
+}
+
+// FencingToken returns the ModifyIndex of the lock key after the acquisition.
+func (m *consulMutex) FencingToken() int64 {
+	m.access.Lock()
+	defer m.access.Unlock()
+
+	return m.token
+}
+
+// Close releases the lock (if held) and removes the lock key unless
+// it is used by other holders.
+func (m *consulMutex) Close() error {
+	m.Unlock()
+	if err := m.lock.Destroy(); err != nil && err != api.ErrLockInUse {
+		return err
+	}
+	return nil
+}
+
+// Campaign blocks until the agent acquires the lock of the election
+// or the <ctx> is done.
+func (e *consulElection) Campaign(ctx context.Context, value string) error {
+	lock, err := e.client.LockOpts(&api.LockOptions{Key: e.key, Value: []byte(value), SessionTTL: sessionTTL(e.ttl)})
+	if err != nil {
+		return err
+	}
+	lostCh, err := lock.Lock(ctx.Done())
+	if err != nil {
+		return err
+	} else if lostCh == nil {
+		return ctx.Err()
+	}
+
+	e.access.Lock()
+	defer e.access.Unlock()
+	e.lock, e.lostCh = lock, lostCh
+	return nil
+}
+
+// Resign releases the lock of the election.
+func (e *consulElection) Resign(ctx context.Context) error {
+	e.access.Lock()
+	defer e.access.Unlock()
+
+	if e.lock == nil {
+		return nil
+	}
+	lock := e.lock
+	e.lock, e.lostCh = nil, nil
+	if err := lock.Unlock(); err != nil && err != api.ErrLockNotHeld {
+		return err
+	}
+	return nil
+}
+
+// IsLeader returns true if the agent holds the lock of the election.
+func (e *consulElection) IsLeader() bool {
+	e.access.Lock()
+	defer e.access.Unlock()
+
+	if e.lostCh == nil {
+		return false
+	}
+	select {
+	case <-e.lostCh:
+		return false
+	default:
+		return true
+	}
+}
+
+// Observe watches the lock key of the election by blocking queries.
+// Failed queries (e.g. during the election of the Consul leader) are retried
+// with an increasing delay until the <ctx> is done.
+func (e *consulElection) Observe(ctx context.Context) <-chan string {
+	leaderCh := make(chan string)
+	go func() {
+		defer close(leaderCh)
+		var (
+			index         uint64
+			first         = true
+			leaderSession string
+			retryDelay    = observeRetryMin
+		)
+		for {
+			qOpt := &api.QueryOptions{WaitIndex: index}
+			pair, qm, err := e.client.KV().Get(e.key, qOpt.WithContext(ctx))
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				consulLogger.Warnf("observation of election %s failed (retry in %v): %v", e.key, retryDelay, err)
+				select {
+				case <-time.After(retryDelay):
+				case <-ctx.Done():
+					return
+				}
+				if retryDelay *= 2; retryDelay > observeRetryMax {
+					retryDelay = observeRetryMax
+				}
+				continue
+			}
+			retryDelay = observeRetryMin
+			if qm.LastIndex < index {
+				// the index went backwards (e.g. the Consul data were restored)
+				index = 0
+			} else {
+				index = qm.LastIndex
+			}
+
+			var session, value string
+			if pair != nil && pair.Session != "" {
+				session, value = pair.Session, string(pair.Value)
+			}
+			if !first && session == leaderSession {
+				continue
+			}
+			first, leaderSession = false, session
+			select {
+			case leaderCh <- value:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return leaderCh
+}
+
+// Close resigns.
+func (e *consulElection) Close() error {
+	return e.Resign(context.Background())
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consul
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hashicorp/consul/api"
+	. "github.com/onsi/gomega"
+)
+
+func TestObserveRetry(t *testing.T) {
+	RegisterTestingT(t)
+
+	// the first queries fail (e.g. Consul elects a new leader),
+	// the following blocking queries wait for a change
+	var (
+		access   sync.Mutex
+		requests int
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		access.Lock()
+		requests++
+		n := requests
+		access.Unlock()
+		switch {
+		case n <= 2:
+			http.Error(w, "No cluster leader", http.StatusInternalServerError)
+		case r.URL.Query().Get("index") == "5":
+			<-r.Context().Done()
+		default:
+			w.Header().Set("X-Consul-Index", "5")
+			w.Write([]byte(`[{"Key":"leader","Value":"YWdlbnQx","Session":"s1","ModifyIndex":5}]`))
+		}
+	}))
+	defer srv.Close()
+	client, err := api.NewClient(&api.Config{Address: strings.TrimPrefix(srv.URL, "http://")})
+	Expect(err).ToNot(HaveOccurred())
+
+	e := &consulElection{client: client, key: "leader"}
+	ctx, cancel := context.WithCancel(context.Background())
+	leaderCh := e.Observe(ctx)
+	Eventually(leaderCh).Should(Receive(Equal("agent1")))
+	Consistently(leaderCh).ShouldNot(Receive())
+
+	cancel()
+	Eventually(leaderCh).Should(BeClosed())
+}
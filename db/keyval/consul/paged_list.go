@@ -0,0 +1,164 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consul
+
+import (
+	"github.com/hashicorp/consul/api"
+	"github.com/ligato/cn-infra/db/keyval"
+)
+
+// maxTxnOps is the maximum number of operations in a Consul transaction.
+const maxTxnOps = 64
+
+// pagedList lists the items with a prefix. Without keyval.WithLimit() and
+// keyval.WithPageSize() options all items are read by a single List request.
+// Keys-only listings are read by a single Keys request (Consul lists the keys
+// without their ModifyIndex, the revisions of the items are therefore 0).
+// Otherwise the keys are listed at once and the values are fetched in pages
+// on demand (each page is read by a single transaction). Consul cannot read
+// past states of the data store, items modified after the listing has started
+// are returned with the new values (and their ModifyIndex is greater than
+// the index of the listing).
+type pagedList struct {
+	kv    *api.KV
+	opts  keyval.ListOptions
+	keys  []string
+	next  int // index of the first key of the next page
+	pairs api.KVPairs
+	index int
+	err   error
+}
+
+// listPrefix lists the items with the given <prefix> selected by the list
+// options. <trimPrefix> is the prefix of the broker removed from the keys
+// returned to the caller.
+func listPrefix(kv *api.KV, prefix, trimPrefix string, opts keyval.ListOptions) (*pagedList, error) {
+	return listRange(kv, prefix, "", "", trimPrefix, opts)
+}
+
+// listRange lists the items with the given <prefix> from the range [from, to)
+// selected by the list options. Empty <to> means no upper bound.
+func listRange(kv *api.KV, prefix, from, to, trimPrefix string, opts keyval.ListOptions) (*pagedList, error) {
+	list := &pagedList{kv: kv, opts: opts}
+	if !opts.KeysOnly && opts.Limit == 0 && opts.PageSize == 0 {
+		pairs, _, err := kv.List(prefix, nil)
+		if err != nil {
+			return nil, err
+		}
+		keys := make([]string, 0, len(pairs))
+		byKey := make(map[string]*api.KVPair, len(pairs))
+		for _, pair := range pairs {
+			if inRange(pair.Key, from, to) {
+				keys = append(keys, pair.Key)
+				byKey[pair.Key] = pair
+			}
+		}
+		for _, key := range opts.SelectKeys(keys, trimPrefix) {
+			list.pairs = append(list.pairs, byKey[key])
+		}
+		return list, nil
+	}
+
+	keys, _, err := kv.Keys(prefix, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	var selected []string
+	for _, key := range keys {
+		if inRange(key, from, to) {
+			selected = append(selected, key)
+		}
+	}
+	list.keys = opts.SelectKeys(selected, trimPrefix)
+	if opts.KeysOnly {
+		for _, key := range list.keys {
+			list.pairs = append(list.pairs, &api.KVPair{Key: key})
+		}
+		list.next = len(list.keys)
+	}
+	return list, nil
+}
+
+// inRange returns true if the <key> is from the range [from, to)
+// (empty <to> means no upper bound).
+func inRange(key, from, to string) bool {
+	return key >= from && (to == "" || key < to)
+}
+
+// commonPrefix returns the longest common prefix of the keys (empty if one
+// of them is empty).
+func commonPrefix(a, b string) string {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return a[:i]
+}
+
+// fetchPage reads the values of the next page of the keys.
+func (list *pagedList) fetchPage() error {
+	size := list.opts.PageSize
+	if size == 0 || size > maxTxnOps {
+		size = maxTxnOps
+	}
+	end := list.next + size
+	if end > len(list.keys) {
+		end = len(list.keys)
+	}
+	keys := list.keys[list.next:end]
+
+	var ops api.KVTxnOps
+	for _, key := range keys {
+		ops = append(ops, &api.KVTxnOp{Verb: api.KVGet, Key: key})
+	}
+	ok, resp, _, err := list.kv.Txn(ops, nil)
+	if err != nil {
+		return err
+	}
+	if ok {
+		list.pairs = resp.Results
+	} else {
+		// some of the keys were removed in the meantime
+		list.pairs = nil
+		for _, key := range keys {
+			pair, _, err := list.kv.Get(key, nil)
+			if err != nil {
+				return err
+			}
+			if pair != nil {
+				list.pairs = append(list.pairs, pair)
+			}
+		}
+	}
+	list.next, list.index = end, 0
+	return nil
+}
+
+// nextPair returns the next item of the listing, the next page is fetched
+// if needed. Nil is returned once all items are returned or an error occurs.
+func (list *pagedList) nextPair() *api.KVPair {
+	for list.err == nil && list.index >= len(list.pairs) {
+		if list.next >= len(list.keys) {
+			return nil
+		}
+		list.err = list.fetchPage()
+	}
+	if list.err != nil {
+		return nil
+	}
+	pair := list.pairs[list.index]
+	list.index++
+	return pair
+}
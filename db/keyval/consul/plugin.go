@@ -54,7 +54,7 @@ type Plugin struct {
 // If injected, Consul plugin will use StatusCheck to signal the connection status.
 type Deps struct {
 	local.PluginInfraDeps
-	Resync *resync.Plugin
+	Resync *resync.Plugin `inject:"reverse"` // inject (optional, triggers resync after reconnect)
 }
 
 // Disabled returns *true* if the plugin is not in use due to missing configuration.
@@ -144,3 +144,12 @@ func (plugin *Plugin) NewBroker(keyPrefix string) keyval.ProtoBroker {
 func (plugin *Plugin) NewWatcher(keyPrefix string) keyval.ProtoWatcher {
 	return plugin.protoWrapper.NewWatcher(keyPrefix)
 }
+
+// RawAccess returns access to the data stored in Consul in the form of bytes
+// (nil if the plugin is disabled).
+func (plugin *Plugin) RawAccess() keyval.KvBytesPlugin {
+	if plugin.client == nil {
+		return nil
+	}
+	return plugin.client
+}
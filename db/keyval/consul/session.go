@@ -0,0 +1,165 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consul
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/ligato/cn-infra/datasync"
+	"github.com/ligato/cn-infra/db/keyval"
+)
+
+// sessionLockDelay is the lock-delay of the sessions granted as leases.
+// The default lock-delay (15s) would prevent a restarted agent from putting
+// the ephemeral keys again until it elapses.
+const sessionLockDelay = time.Millisecond
+
+// minSessionTTL is the minimal TTL of a Consul session.
+const minSessionTTL = 10 * time.Second
+
+// maxSessionTTL is the maximal TTL of a Consul session.
+const maxSessionTTL = 24 * time.Hour
+
+// sessionTTL rounds <ttl> to the range accepted by Consul
+// (minSessionTTL - maxSessionTTL) and formats it for the session entry.
+func sessionTTL(ttl time.Duration) string {
+	if ttl < minSessionTTL {
+		ttl = minSessionTTL
+	} else if ttl > maxSessionTTL {
+		ttl = maxSessionTTL
+	}
+	return ttl.String()
+}
+
+// GrantLease creates a new Consul session with the delete behavior,
+// i.e. the keys put with the session are removed once the session
+// is invalidated. Consul accepts TTL between 10s and 24h, <ttl> outside
+// of the range is rounded to the closest limit.
+func (c *Client) GrantLease(ttl time.Duration) (keyval.LeaseID, error) {
+	id, _, err := c.client.Session().Create(&api.SessionEntry{
+		Behavior:  api.SessionBehaviorDelete,
+		TTL:       sessionTTL(ttl),
+		LockDelay: sessionLockDelay,
+	}, nil)
+	if err != nil {
+		return "", err
+	}
+	return keyval.LeaseID(id), nil
+}
+
+// KeepAlive periodically renews the Consul session until it is revoked
+// or the client is closed.
+func (c *Client) KeepAlive(id keyval.LeaseID) error {
+	entry, _, err := c.client.Session().Info(string(id), nil)
+	if err != nil {
+		return err
+	} else if entry == nil {
+		return fmt.Errorf("session %s not found", id)
+	}
+
+	c.access.Lock()
+	defer c.access.Unlock()
+
+	if _, renewed := c.renewals[id]; renewed {
+		return nil
+	}
+	doneCh := make(chan struct{})
+	c.renewals[id] = doneCh
+	go func() {
+		opts := (&api.WriteOptions{}).WithContext(c.closeCtx)
+		if err := c.client.Session().RenewPeriodic(entry.TTL, string(id), opts, doneCh); err != nil && c.closeCtx.Err() == nil {
+			consulLogger.Warnf("renewal of session %s failed: %v", id, err)
+		}
+	}()
+	return nil
+}
+
+// Revoke destroys the Consul session, the keys put with the session are removed.
+func (c *Client) Revoke(id keyval.LeaseID) error {
+	c.access.Lock()
+	if doneCh, renewed := c.renewals[id]; renewed {
+		close(doneCh)
+		delete(c.renewals, id)
+	}
+	c.access.Unlock()
+
+	_, err := c.client.Session().Destroy(string(id), nil)
+	return err
+}
+
+// putWithSession puts the key and binds it to the session by acquiring
+// the key lock. The key locked by another session (e.g. put with another
+// lease or TTL before) is released by that session in the same transaction,
+// i.e. the key is re-bound to the session. With datasync.WithExpectedRevision()
+// or datasync.WithCreateOnly() option the ModifyIndex of the key is checked
+// in the transaction as well.
+func (c *Client) putWithSession(key string, p *api.KVPair, id keyval.LeaseID, opts ...datasync.PutOption) error {
+	p.Session = string(id)
+	var ops api.KVTxnOps
+	rev, expected := keyval.PutExpectedRevision(opts...)
+	if expected {
+		ops = append(ops, revisionCheck(p.Key, rev))
+	}
+	current, _, err := c.client.KV().Get(p.Key, nil)
+	if err != nil {
+		return err
+	}
+	if current != nil && current.Session != "" && current.Session != p.Session {
+		ops = append(ops, &api.KVTxnOp{Verb: api.KVUnlock, Key: p.Key, Value: p.Value, Session: current.Session})
+	}
+	ops = append(ops, &api.KVTxnOp{Verb: api.KVLock, Key: p.Key, Value: p.Value, Session: p.Session})
+
+	acquired, resp, _, err := c.client.KV().Txn(ops, nil)
+	if err != nil {
+		return err
+	} else if !acquired {
+		if expected && len(resp.Errors) > 0 && resp.Errors[0].OpIndex == 0 {
+			return c.revisionMismatch(key, rev)
+		}
+		return fmt.Errorf("key %s is locked by another session (or session %s is invalid)", p.Key, id)
+	}
+	return nil
+}
+
+// putWithTTL puts the key bound to a new session that is not renewed,
+// i.e. the key is removed once the session expires. Consul accepts TTL
+// of at least 10s (shorter <ttl> is rounded up by GrantLease()) and invalidates
+// expired sessions lazily, the key is removed within twice the <ttl>.
+func (c *Client) putWithTTL(key string, p *api.KVPair, ttl time.Duration, opts ...datasync.PutOption) error {
+	id, err := c.GrantLease(ttl)
+	if err != nil {
+		return err
+	}
+	if err := c.putWithSession(key, p, id, opts...); err != nil {
+		if _, destroyErr := c.client.Session().Destroy(string(id), nil); destroyErr != nil {
+			consulLogger.Warnf("failed to destroy session %s: %v", id, destroyErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// putTTL returns the TTL selected by datasync.WithTTL option among the put
+// <opts>. <found> is false if there is no such option (or the TTL is not positive).
+func putTTL(opts ...datasync.PutOption) (ttl time.Duration, found bool) {
+	for _, o := range opts {
+		if withTTL, ok := o.(*datasync.WithTTLOpt); ok && withTTL.TTL > 0 {
+			ttl, found = withTTL.TTL, true
+		}
+	}
+	return ttl, found
+}
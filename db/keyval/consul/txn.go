@@ -15,6 +15,7 @@
 package consul
 
 import (
+	"bytes"
 	"fmt"
 
 	"github.com/hashicorp/consul/api"
@@ -67,3 +68,111 @@ func (tx *txn) Commit() error {
 	}
 	return nil
 }
+
+// condTxn is a conditional transaction mapped to the Consul transaction
+// with check verbs (check-index, check-not-exists).
+// Consul does not support alternative operations of a transaction,
+// the Else operations are therefore applied in a separate transaction
+// (i.e. not atomically with the evaluation of the conditions).
+type condTxn struct {
+	kv         *api.KV
+	prefixKey  func(key string) string
+	conditions []keyval.TxnCondition
+	thenOps    api.KVTxnOps
+	elseOps    api.KVTxnOps
+}
+
+// If adds conditions into the transaction. RevEquals is compared with
+// the ModifyIndex of the key. ValueEquals is evaluated by reading the key,
+// the ModifyIndex of the read value is then checked in the transaction.
+func (tx *condTxn) If(conditions ...keyval.TxnCondition) keyval.BytesCondTxn {
+	tx.conditions = append(tx.conditions, conditions...)
+	return tx
+}
+
+// Then adds operations applied if all the conditions hold.
+func (tx *condTxn) Then(ops ...keyval.TxnOp) keyval.BytesCondTxn {
+	tx.thenOps = tx.appendOps(tx.thenOps, ops)
+	return tx
+}
+
+// Else adds operations applied if any of the conditions does not hold.
+func (tx *condTxn) Else(ops ...keyval.TxnOp) keyval.BytesCondTxn {
+	tx.elseOps = tx.appendOps(tx.elseOps, ops)
+	return tx
+}
+
+// Commit evaluates the conditions and applies the selected operations.
+func (tx *condTxn) Commit() (succeeded bool, err error) {
+	checks, holds, err := tx.checks()
+	if err != nil {
+		return false, err
+	}
+	if holds {
+		ok, resp, _, err := tx.kv.Txn(append(checks, tx.thenOps...), nil)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			return true, nil
+		}
+		for _, txnErr := range resp.Errors {
+			if txnErr.OpIndex >= len(checks) {
+				return false, fmt.Errorf("transaction failed: %s", txnErr.What)
+			}
+		}
+		// a check failed, i.e. a condition does not hold
+	}
+	if len(tx.elseOps) > 0 {
+		ok, resp, _, err := tx.kv.Txn(tx.elseOps, nil)
+		if err != nil {
+			return false, err
+		} else if !ok {
+			return false, fmt.Errorf("transaction failed: %v", resp)
+		}
+	}
+	return false, nil
+}
+
+// checks translates the conditions into check operations. <holds> is false
+// if a condition evaluated before the transaction does not hold.
+func (tx *condTxn) checks() (checks api.KVTxnOps, holds bool, err error) {
+	for _, cond := range tx.conditions {
+		key := tx.key(cond.Key)
+		switch cond.Type {
+		case keyval.CondRevEquals:
+			checks = append(checks, &api.KVTxnOp{Verb: api.KVCheckIndex, Key: key, Index: uint64(cond.Revision)})
+		case keyval.CondMissing:
+			checks = append(checks, &api.KVTxnOp{Verb: api.KVCheckNotExists, Key: key})
+		case keyval.CondValueEquals:
+			pair, _, err := tx.kv.Get(key, nil)
+			if err != nil {
+				return nil, false, err
+			}
+			if pair == nil || !bytes.Equal(pair.Value, cond.Value) {
+				return nil, false, nil
+			}
+			// the value must not change till the transaction is applied
+			checks = append(checks, &api.KVTxnOp{Verb: api.KVCheckIndex, Key: key, Index: pair.ModifyIndex})
+		}
+	}
+	return checks, true, nil
+}
+
+func (tx *condTxn) appendOps(consulOps api.KVTxnOps, ops []keyval.TxnOp) api.KVTxnOps {
+	for _, op := range ops {
+		if op.Delete {
+			consulOps = append(consulOps, &api.KVTxnOp{Verb: api.KVDelete, Key: tx.key(op.Key)})
+		} else {
+			consulOps = append(consulOps, &api.KVTxnOp{Verb: api.KVSet, Key: tx.key(op.Key), Value: op.Value})
+		}
+	}
+	return consulOps
+}
+
+func (tx *condTxn) key(key string) string {
+	if tx.prefixKey != nil {
+		key = tx.prefixKey(key)
+	}
+	return transformKey(key)
+}
@@ -0,0 +1,37 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package election provides distributed locks and leader election for
+// plugins that must run only on one agent in a cluster (e.g. periodic
+// cleanup jobs).
+//
+// The API is implemented by the connections of the key-value data stores
+// (see Provider):
+//   - etcd: etcd concurrency (Mutex and Election over an etcd session),
+//   - Consul: locks acquired by Consul sessions,
+//   - Redis: a lock key set with SET NX and kept alive by the holder,
+//     every acquisition of the lock gets a new fencing token.
+//
+// Example of a plugin that runs its job only while it is the leader:
+//
+//	provider := etcdPlugin.RawAccess().(election.Provider)
+//	e, err := provider.NewElection("/cleanup/election", 10*time.Second)
+//	e = election.WithStatusReport(e, statusCheck, "cleanup-election")
+//	if err = e.Campaign(ctx, agentLabel); err == nil {
+//		// leader until e.Resign() or until the leadership is lost
+//	}
+//
+// The leadership is reported to statuscheck as status.Leadership metadata
+// of the plugin status (see WithStatusReport()).
+package election
@@ -0,0 +1,71 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package election
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNotHeld is returned by Mutex.Unlock() if the lock is not held
+// (e.g. because its session expired in the meantime).
+var ErrNotHeld = errors.New("lock is not held")
+
+// Mutex is a distributed lock.
+type Mutex interface {
+	// Lock blocks until the lock is acquired or the <ctx> is done.
+	Lock(ctx context.Context) error
+	// Unlock releases the lock.
+	Unlock() error
+	// FencingToken returns the token of the current acquisition of the lock.
+	// Tokens increase with every acquisition of the lock, a resource guarded
+	// by the lock can therefore reject requests carrying a stale token.
+	FencingToken() int64
+	// Close releases the lock (if held) and the session of the lock.
+	Close() error
+}
+
+// Election is a leader election.
+type Election interface {
+	// Campaign blocks until the agent is elected as the leader or the <ctx>
+	// is done. The <value> is proclaimed by the agent as the leader
+	// (e.g. the microservice label of the agent).
+	Campaign(ctx context.Context, value string) error
+	// Resign gives up the leadership (if held).
+	Resign(ctx context.Context) error
+	// IsLeader returns true if the agent is the leader.
+	IsLeader() bool
+	// Observe returns a channel that receives the value of the current leader
+	// whenever the leader changes (empty value once the leader is gone,
+	// if the data store reports it).
+	// The channel is closed once the <ctx> is done.
+	Observe(ctx context.Context) <-chan string
+	// Close resigns and releases the session of the election.
+	Close() error
+}
+
+// Provider is implemented by connections of the data stores that support
+// distributed locks and leader election.
+type Provider interface {
+	// NewMutex creates a new distributed lock identified by the <key>.
+	// The lock is released by the data store once the holder does not refresh
+	// its session (lease) for <ttl>.
+	NewMutex(key string, ttl time.Duration) (Mutex, error)
+	// NewElection creates a new participant of the election identified by
+	// the <key>. The leadership is lost once the leader does not refresh its
+	// session (lease) for <ttl>.
+	NewElection(key string, ttl time.Duration) (Election, error)
+}
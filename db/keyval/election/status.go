@@ -0,0 +1,99 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package election
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/ligato/cn-infra/core"
+	"github.com/ligato/cn-infra/health/statuscheck"
+	"github.com/ligato/cn-infra/health/statuscheck/model/status"
+)
+
+// errObserveStopped is reported to statuscheck if the observation
+// of the election stops before the election is closed.
+var errObserveStopped = errors.New("observation of the election stopped")
+
+// reportingElection reports the leadership to statuscheck.
+type reportingElection struct {
+	Election
+	writer statuscheck.PluginStatusWriter
+	name   core.PluginName
+	cancel context.CancelFunc
+
+	access      sync.Mutex
+	leaderValue string
+}
+
+// WithStatusReport returns the election <e> that reports its state to statuscheck
+// under the <name>: the state is OK while the election is observed and
+// the leadership (whether the agent is the leader and the value of the current
+// leader) is reported as status.Leadership metadata of the state.
+func WithStatusReport(e Election, writer statuscheck.PluginStatusWriter, name core.PluginName) Election {
+	ctx, cancel := context.WithCancel(context.Background())
+	re := &reportingElection{Election: e, writer: writer, name: name, cancel: cancel}
+	writer.Register(name, nil)
+	re.report(nil)
+
+	leaderCh := e.Observe(ctx)
+	go func() {
+		for leaderValue := range leaderCh {
+			re.access.Lock()
+			re.leaderValue = leaderValue
+			re.access.Unlock()
+			re.report(nil)
+		}
+		if ctx.Err() == nil {
+			re.report(errObserveStopped)
+		}
+	}()
+	return re
+}
+
+// Campaign calls Campaign of the election and reports the leadership.
+func (re *reportingElection) Campaign(ctx context.Context, value string) error {
+	err := re.Election.Campaign(ctx, value)
+	re.report(nil)
+	return err
+}
+
+// Resign calls Resign of the election and reports the leadership.
+func (re *reportingElection) Resign(ctx context.Context) error {
+	err := re.Election.Resign(ctx)
+	re.report(nil)
+	return err
+}
+
+// Close stops the reporting and closes the election.
+func (re *reportingElection) Close() error {
+	re.cancel()
+	err := re.Election.Close()
+	re.report(nil)
+	return err
+}
+
+func (re *reportingElection) report(err error) {
+	re.access.Lock()
+	leadership := &status.Leadership{Leader: re.Election.IsLeader(), LeaderValue: re.leaderValue}
+	re.access.Unlock()
+
+	state := statuscheck.OK
+	if err != nil {
+		state = statuscheck.Error
+	}
+	re.writer.ReportStateChangeWithMeta(re.name, state, err, leadership)
+}
@@ -0,0 +1,134 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package election_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/ligato/cn-infra/core"
+	"github.com/ligato/cn-infra/db/keyval/election"
+	"github.com/ligato/cn-infra/health/statuscheck"
+	"github.com/ligato/cn-infra/health/statuscheck/model/status"
+	. "github.com/onsi/gomega"
+)
+
+// fakeElection is an election with a single candidate.
+type fakeElection struct {
+	sync.Mutex
+	leader   bool
+	leaderCh chan string
+}
+
+func (e *fakeElection) Campaign(ctx context.Context, value string) error {
+	e.Lock()
+	e.leader = true
+	e.Unlock()
+	e.leaderCh <- value
+	return nil
+}
+
+func (e *fakeElection) Resign(ctx context.Context) error {
+	e.Lock()
+	e.leader = false
+	e.Unlock()
+	e.leaderCh <- ""
+	return nil
+}
+
+func (e *fakeElection) IsLeader() bool {
+	e.Lock()
+	defer e.Unlock()
+	return e.leader
+}
+
+func (e *fakeElection) Observe(ctx context.Context) <-chan string {
+	return e.leaderCh
+}
+
+func (e *fakeElection) Close() error {
+	close(e.leaderCh)
+	return nil
+}
+
+// statusWriter records the reported states.
+type statusWriter struct {
+	sync.Mutex
+	registered  core.PluginName
+	state       statuscheck.PluginState
+	lastErr     error
+	leaderships []status.Leadership
+}
+
+func (w *statusWriter) Register(pluginName core.PluginName, probe statuscheck.PluginStateProbe) {
+	w.registered = pluginName
+}
+
+func (w *statusWriter) ReportStateChange(pluginName core.PluginName, state statuscheck.PluginState, lastError error) {
+	w.ReportStateChangeWithMeta(pluginName, state, lastError, nil)
+}
+
+func (w *statusWriter) ReportStateChangeWithMeta(pluginName core.PluginName, state statuscheck.PluginState,
+	lastError error, meta proto.Message) {
+	w.Lock()
+	defer w.Unlock()
+	w.state, w.lastErr = state, lastError
+	if leadership, ok := meta.(*status.Leadership); ok {
+		if n := len(w.leaderships); n == 0 || w.leaderships[n-1] != *leadership {
+			w.leaderships = append(w.leaderships, *leadership)
+		}
+	}
+}
+
+func (w *statusWriter) lastLeadership() status.Leadership {
+	w.Lock()
+	defer w.Unlock()
+	return w.leaderships[len(w.leaderships)-1]
+}
+
+func TestWithStatusReport(t *testing.T) {
+	RegisterTestingT(t)
+
+	writer := &statusWriter{}
+	e := election.WithStatusReport(&fakeElection{leaderCh: make(chan string)}, writer, "cleanup-election")
+	Expect(writer.registered).Should(BeEquivalentTo("cleanup-election"))
+	Expect(writer.lastLeadership()).Should(Equal(status.Leadership{}))
+
+	Expect(e.Campaign(context.Background(), "agent1")).To(Succeed())
+	Eventually(writer.lastLeadership).Should(Equal(status.Leadership{Leader: true, LeaderValue: "agent1"}))
+	Expect(writer.state).Should(Equal(statuscheck.OK))
+
+	Expect(e.Resign(context.Background())).To(Succeed())
+	Eventually(writer.lastLeadership).Should(Equal(status.Leadership{}))
+	Expect(e.Close()).To(Succeed())
+}
+
+func TestObserveStopped(t *testing.T) {
+	RegisterTestingT(t)
+
+	writer := &statusWriter{}
+	fake := &fakeElection{leaderCh: make(chan string)}
+	election.WithStatusReport(fake, writer, "stopped-election")
+
+	// observation stops before the election is closed
+	close(fake.leaderCh)
+	Eventually(func() statuscheck.PluginState {
+		writer.Lock()
+		defer writer.Unlock()
+		return writer.state
+	}).Should(Equal(statuscheck.Error))
+}
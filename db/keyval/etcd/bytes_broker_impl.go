@@ -33,7 +33,10 @@ type BytesConnectionEtcd struct {
 	logging.Logger
 	etcdClient *clientv3.Client
 	lessor     clientv3.Lease
+	leases     *leaser
 	opTimeout  time.Duration
+	// persists the revisions of the watched prefixes (optional)
+	watchRevisions keyval.WatchRevisionStore
 }
 
 // BytesBrokerWatcherEtcd uses BytesConnectionEtcd to access the datastore.
@@ -43,24 +46,25 @@ type BytesConnectionEtcd struct {
 // to all keys in its methods in order to shorten keys used in arguments.
 type BytesBrokerWatcherEtcd struct {
 	logging.Logger
-	lessor    clientv3.Lease
-	kv        clientv3.KV
-	watcher   clientv3.Watcher
-	opTimeout time.Duration
+	lessor         clientv3.Lease
+	leases         *leaser
+	kv             clientv3.KV
+	watcher        clientv3.Watcher
+	opTimeout      time.Duration
+	clientCtx      context.Context
+	prefix         string
+	watchRevisions keyval.WatchRevisionStore
 }
 
 // bytesKeyValIterator is an iterator returned by ListValues call.
 type bytesKeyValIterator struct {
-	index int
-	len   int
-	resp  *clientv3.GetResponse
+	list      *pagedList
+	prevValue []byte
 }
 
 // bytesKeyIterator is an iterator returned by ListKeys call.
 type bytesKeyIterator struct {
-	index int
-	len   int
-	resp  *clientv3.GetResponse
+	list *pagedList
 }
 
 // bytesKeyVal represents a single key-value pair.
@@ -94,10 +98,12 @@ func NewEtcdConnectionWithBytes(config ClientConfig, log logging.Logger) (*Bytes
 // This constructor is used primarily for testing.
 func NewEtcdConnectionUsingClient(etcdClient *clientv3.Client, log logging.Logger) (*BytesConnectionEtcd, error) {
 	log.Debug("NewEtcdConnectionWithBytes", etcdClient)
+	lessor := clientv3.NewLease(etcdClient)
 	conn := BytesConnectionEtcd{
 		Logger:     log,
 		etcdClient: etcdClient,
-		lessor:     clientv3.NewLease(etcdClient),
+		lessor:     lessor,
+		leases:     newLeaser(lessor),
 		opTimeout:  defaultOpTimeout,
 	}
 	return &conn, nil
@@ -105,12 +111,30 @@ func NewEtcdConnectionUsingClient(etcdClient *clientv3.Client, log logging.Logge
 
 // Close closes the connection to ETCD.
 func (db *BytesConnectionEtcd) Close() error {
+	if db.lessor != nil {
+		// stop keeping the leases alive
+		db.lessor.Close()
+	}
 	if db.etcdClient != nil {
 		return db.etcdClient.Close()
 	}
 	return nil
 }
 
+// SetWatchRevisionStore sets the store of the revisions of the watched
+// prefixes. Watches started afterwards (also by the brokers created afterwards)
+// continue from the stored revisions, e.g. after the restart of the agent.
+func (db *BytesConnectionEtcd) SetWatchRevisionStore(store keyval.WatchRevisionStore) {
+	db.watchRevisions = store
+}
+
+// SetEndpoints updates the endpoints of the etcd cluster used by the connection.
+func (db *BytesConnectionEtcd) SetEndpoints(endpoints ...string) {
+	if db.etcdClient != nil {
+		db.etcdClient.SetEndpoints(endpoints...)
+	}
+}
+
 // NewBroker creates a new instance of a proxy that provides
 // access to etcd. The proxy will reuse the connection from BytesConnectionEtcd.
 // <prefix> will be prepended to the key argument in all calls from the created
@@ -118,11 +142,15 @@ func (db *BytesConnectionEtcd) Close() error {
 // an argument.
 func (db *BytesConnectionEtcd) NewBroker(prefix string) keyval.BytesBroker {
 	return &BytesBrokerWatcherEtcd{
-		Logger:    db.Logger,
-		kv:        namespace.NewKV(db.etcdClient, prefix),
-		lessor:    db.lessor,
-		opTimeout: db.opTimeout,
-		watcher:   namespace.NewWatcher(db.etcdClient, prefix),
+		Logger:         db.Logger,
+		kv:             namespace.NewKV(db.etcdClient, prefix),
+		lessor:         db.lessor,
+		leases:         db.leases,
+		opTimeout:      db.opTimeout,
+		watcher:        namespace.NewWatcher(db.etcdClient, prefix),
+		clientCtx:      db.etcdClient.Ctx(),
+		prefix:         prefix,
+		watchRevisions: db.watchRevisions,
 	}
 }
 
@@ -133,11 +161,15 @@ func (db *BytesConnectionEtcd) NewBroker(prefix string) keyval.BytesBroker {
 // an argument.
 func (db *BytesConnectionEtcd) NewWatcher(prefix string) keyval.BytesWatcher {
 	return &BytesBrokerWatcherEtcd{
-		Logger:    db.Logger,
-		kv:        namespace.NewKV(db.etcdClient, prefix),
-		lessor:    db.lessor,
-		opTimeout: db.opTimeout,
-		watcher:   namespace.NewWatcher(db.etcdClient, prefix),
+		Logger:         db.Logger,
+		kv:             namespace.NewKV(db.etcdClient, prefix),
+		lessor:         db.lessor,
+		leases:         db.leases,
+		opTimeout:      db.opTimeout,
+		watcher:        namespace.NewWatcher(db.etcdClient, prefix),
+		clientCtx:      db.etcdClient.Ctx(),
+		prefix:         prefix,
+		watchRevisions: db.watchRevisions,
 	}
 }
 
@@ -154,6 +186,13 @@ func (pdb *BytesBrokerWatcherEtcd) NewTxn() keyval.BytesTxn {
 	return newTxnInternal(pdb.kv)
 }
 
+// NewCondTxn creates a new conditional transaction.
+// KeyPrefix defined in constructor will be prepended to the keys of all
+// conditions and operations in the transaction.
+func (pdb *BytesBrokerWatcherEtcd) NewCondTxn() keyval.BytesCondTxn {
+	return &bytesCondTxn{kv: pdb.kv}
+}
+
 // GetValue calls 'GetValue' function of the underlying BytesConnectionEtcd.
 // KeyPrefix defined in constructor is prepended to the key argument.
 func (pdb *BytesBrokerWatcherEtcd) GetValue(key string) (data []byte, found bool, revision int64, err error) {
@@ -163,14 +202,14 @@ func (pdb *BytesBrokerWatcherEtcd) GetValue(key string) (data []byte, found bool
 // ListValues calls 'ListValues' function of the underlying BytesConnectionEtcd.
 // KeyPrefix defined in constructor is prepended to the key argument.
 // The prefix is removed from the keys of the returned values.
-func (pdb *BytesBrokerWatcherEtcd) ListValues(key string) (keyval.BytesKeyValIterator, error) {
-	return listValuesInternal(pdb.Logger, pdb.kv, pdb.opTimeout, key)
+func (pdb *BytesBrokerWatcherEtcd) ListValues(key string, opts ...keyval.ListOption) (keyval.BytesKeyValIterator, error) {
+	return listValuesInternal(pdb.Logger, pdb.kv, pdb.opTimeout, key, opts...)
 }
 
 // ListKeys calls 'ListKeys' function of the underlying BytesConnectionEtcd.
 // KeyPrefix defined in constructor is prepended to the argument.
-func (pdb *BytesBrokerWatcherEtcd) ListKeys(prefix string) (keyval.BytesKeyIterator, error) {
-	return listKeysInternal(pdb.Logger, pdb.kv, pdb.opTimeout, prefix)
+func (pdb *BytesBrokerWatcherEtcd) ListKeys(prefix string, opts ...keyval.ListOption) (keyval.BytesKeyIterator, error) {
+	return listKeysInternal(pdb.Logger, pdb.kv, pdb.opTimeout, prefix, opts...)
 }
 
 // Delete calls 'Delete' function of the underlying BytesConnectionEtcd.
@@ -185,7 +224,17 @@ func (pdb *BytesBrokerWatcherEtcd) Delete(key string, opts ...datasync.DelOption
 // Watch events will be delivered to <resp> callback.
 func (pdb *BytesBrokerWatcherEtcd) Watch(resp func(keyval.BytesWatchResp), closeChan chan string, keys ...string) error {
 	for _, k := range keys {
-		err := watchInternal(pdb.Logger, pdb.watcher, closeChan, k, resp)
+		err := watchInternal(&prefixWatch{
+			log:       pdb.Logger,
+			clientCtx: pdb.clientCtx,
+			kv:        pdb.kv,
+			watcher:   pdb.watcher,
+			opTimeout: pdb.opTimeout,
+			store:     pdb.watchRevisions,
+			namespace: pdb.prefix,
+			prefix:    k,
+			resp:      resp,
+		}, closeChan)
 		if err != nil {
 			return err
 		}
@@ -222,6 +271,12 @@ func newTxnInternal(kv clientv3.KV) keyval.BytesTxn {
 	return &tx
 }
 
+// NewCondTxn creates a new conditional transaction (mapped to the etcd
+// transaction with If/Then/Else).
+func (db *BytesConnectionEtcd) NewCondTxn() keyval.BytesCondTxn {
+	return &bytesCondTxn{kv: db.etcdClient}
+}
+
 // Watch starts subscription for changes associated with the selected keys.
 // Watch events will be delivered to <resp> callback.
 // closeCh is a channel closed when Close method is called.It is leveraged
@@ -230,7 +285,16 @@ func newTxnInternal(kv clientv3.KV) keyval.BytesTxn {
 func (db *BytesConnectionEtcd) Watch(resp func(keyval.BytesWatchResp), closeChan chan string, keys ...string) error {
 	var err error
 	for _, k := range keys {
-		err = watchInternal(db.Logger, db.etcdClient, closeChan, k, resp)
+		err = watchInternal(&prefixWatch{
+			log:       db.Logger,
+			clientCtx: db.etcdClient.Ctx(),
+			kv:        db.etcdClient,
+			watcher:   db.etcdClient,
+			opTimeout: db.opTimeout,
+			store:     db.watchRevisions,
+			prefix:    k,
+			resp:      resp,
+		}, closeChan)
 		if err != nil {
 			break
 		}
@@ -238,62 +302,12 @@ func (db *BytesConnectionEtcd) Watch(resp func(keyval.BytesWatchResp), closeChan
 	return err
 }
 
-// watchInternal starts the watch subscription for the key.
-func watchInternal(log logging.Logger, watcher clientv3.Watcher, closeCh chan string, prefix string, resp func(keyval.BytesWatchResp)) error {
-	recvChan := watcher.Watch(context.Background(), prefix, clientv3.WithPrefix(), clientv3.WithPrevKV())
-
-	go func(registeredKey string) {
-		var compactRev int64
-		for {
-			select {
-			case wresp, ok := <-recvChan:
-				if !ok {
-					log.WithField("prefix", prefix).Warn("Watch recv channel was closed")
-					if compactRev != 0 {
-						recvChan = watcher.Watch(context.Background(), prefix,
-							clientv3.WithPrefix(), clientv3.WithPrevKV(), clientv3.WithRev(compactRev))
-						log.WithFields(logging.Fields{
-							"prefix": prefix,
-							"rev":    compactRev,
-						}).Warn("Watch recv channel was re-created")
-						compactRev = 0
-						continue
-					}
-					return
-				}
-				if wresp.Canceled {
-					log.WithField("prefix", prefix).Warn("Watch was canceled")
-				}
-				err := wresp.Err()
-				if err != nil {
-					log.WithFields(logging.Fields{
-						"prefix": prefix,
-						"err":    err,
-					}).Warn("Watch returned error")
-				}
-				compactRev = wresp.CompactRevision
-				if compactRev != 0 {
-					log.WithFields(logging.Fields{
-						"prefix": prefix,
-						"rev":    compactRev,
-					}).Warn("Watched data were compacted ")
-				}
-				for _, ev := range wresp.Events {
-					handleWatchEvent(log, resp, ev)
-				}
-			case closeVal, ok := <-closeCh:
-				if !ok || closeVal == registeredKey {
-					log.WithField("prefix", prefix).Debug("Watch ended")
-					return
-				}
-			}
-		}
-	}(prefix)
-	return nil
-}
-
 // Put writes the provided key-value item into the data store.
 // Returns an error if the item could not be written, nil otherwise.
+// If datasync.WithExpectedRevision() or datasync.WithCreateOnly() option is used,
+// the item is written only if its mod revision matches, otherwise
+// keyval.ErrRevisionMismatch is returned. With keyval.WithLease() option
+// the item is attached to the etcd lease.
 func (db *BytesConnectionEtcd) Put(key string, binData []byte, opts ...datasync.PutOption) error {
 	return putInternal(db.Logger, db.etcdClient, db.lessor, db.opTimeout, key, binData, opts...)
 }
@@ -316,6 +330,18 @@ func putInternal(log logging.Logger, kv clientv3.KV, lessor clientv3.Lease, opTi
 			etcdOpts = append(etcdOpts, clientv3.WithLease(lease.ID))
 		}
 	}
+	if id, found := keyval.PutLease(opts...); found {
+		leaseID, err := parseLeaseID(id)
+		if err != nil {
+			return err
+		}
+		etcdOpts = append(etcdOpts, clientv3.WithLease(leaseID))
+	}
+
+	if rev, expected := keyval.PutExpectedRevision(opts...); expected {
+		_, err := commitIfRevision(ctx, kv, key, rev, clientv3.OpPut(key, string(binData), etcdOpts...))
+		return err
+	}
 
 	if _, err := kv.Put(ctx, key, string(binData), etcdOpts...); err != nil {
 		log.Error("etcd put error: ", err)
@@ -325,6 +351,27 @@ func putInternal(log logging.Logger, kv clientv3.KV, lessor clientv3.Lease, opTi
 	return nil
 }
 
+// commitIfRevision applies <op> only if the item under the <key> was last
+// modified in the revision <rev> (0 = the item does not exist).
+func commitIfRevision(ctx context.Context, kv clientv3.KV, key string, rev int64, op clientv3.Op) (*clientv3.TxnResponse, error) {
+	cmp := clientv3.Compare(clientv3.ModRevision(key), "=", rev)
+	if rev == 0 {
+		cmp = clientv3.Compare(clientv3.CreateRevision(key), "=", 0)
+	}
+	resp, err := kv.Txn(ctx).If(cmp).Then(op).Else(clientv3.OpGet(key)).Commit()
+	if err != nil {
+		return nil, err
+	}
+	if !resp.Succeeded {
+		var current int64
+		if get := resp.Responses[0].GetResponseRange(); get != nil && len(get.Kvs) > 0 {
+			current = get.Kvs[0].ModRevision
+		}
+		return nil, &keyval.ErrRevisionMismatch{Key: key, Expected: rev, Current: current}
+	}
+	return resp, nil
+}
+
 // PutIfNotExists puts given key-value pair into etcd if there is no value set for the key. If the put was successful
 // succeeded is true. If the key already exists succeeded is false and the value for the key is untouched.
 func (db *BytesConnectionEtcd) PutIfNotExists(key string, binData []byte) (succeeded bool, err error) {
@@ -340,6 +387,9 @@ func (db *BytesConnectionEtcd) PutIfNotExists(key string, binData []byte) (succe
 }
 
 // Delete removes data identified by the <key>.
+// If datasync.WithExpectedRevision() option is used, the data are removed
+// only if the mod revision of the <key> matches, otherwise
+// keyval.ErrRevisionMismatch is returned.
 func (db *BytesConnectionEtcd) Delete(key string, opts ...datasync.DelOption) (existed bool, err error) {
 	return deleteInternal(db.Logger, db.etcdClient, db.opTimeout, key, opts...)
 }
@@ -356,6 +406,14 @@ func deleteInternal(log logging.Logger, kv clientv3.KV, opTimeout time.Duration,
 		}
 	}
 
+	if rev, expected := keyval.DelExpectedRevision(opts...); expected {
+		resp, err := commitIfRevision(ctx, kv, key, rev, clientv3.OpDelete(key, etcdOpts...))
+		if err != nil {
+			return false, err
+		}
+		return resp.Responses[0].GetResponseDeleteRange().Deleted > 0, nil
+	}
+
 	// delete data from etcd
 	resp, err := kv.Delete(ctx, key, etcdOpts...)
 	if err != nil {
@@ -421,45 +479,37 @@ func getValueRevInternal(log logging.Logger, kv clientv3.KV, opTimeout time.Dura
 }
 
 // ListValues returns an iterator that enables traversing values stored under
-// the provided <key>.
-func (db *BytesConnectionEtcd) ListValues(key string) (keyval.BytesKeyValIterator, error) {
-	return listValuesInternal(db.Logger, db.etcdClient, db.opTimeout, key)
+// the provided <key>. The values are read by a single Get unless
+// keyval.WithPageSize is given; then they are fetched in pages on demand
+// and all pages are read at the revision of the first page.
+func (db *BytesConnectionEtcd) ListValues(key string, opts ...keyval.ListOption) (keyval.BytesKeyValIterator, error) {
+	return listValuesInternal(db.Logger, db.etcdClient, db.opTimeout, key, opts...)
 }
 
-func listValuesInternal(log logging.Logger, kv clientv3.KV, opTimeout time.Duration, key string) (keyval.BytesKeyValIterator, error) {
-	deadline := time.Now().Add(opTimeout)
-	ctx, cancel := context.WithDeadline(context.Background(), deadline)
-	defer cancel()
-
-	// get data from etcd
-	resp, err := kv.Get(ctx, key, clientv3.WithPrefix())
+func listValuesInternal(log logging.Logger, kv clientv3.KV, opTimeout time.Duration, key string,
+	opts ...keyval.ListOption) (keyval.BytesKeyValIterator, error) {
+	list, err := listPrefix(log, kv, opTimeout, key, 0, keyval.ParseListOptions(opts...))
 	if err != nil {
-		log.Error("etcd error: ", err)
 		return nil, err
 	}
-
-	return &bytesKeyValIterator{len: len(resp.Kvs), resp: resp}, nil
+	return &bytesKeyValIterator{list: list}, nil
 }
 
 // ListKeys returns an iterator that allows traversing all keys from data
-// store that share the given <prefix>.
-func (db *BytesConnectionEtcd) ListKeys(prefix string) (keyval.BytesKeyIterator, error) {
-	return listKeysInternal(db.Logger, db.etcdClient, db.opTimeout, prefix)
+// store that share the given <prefix>. The keys are read by a single Get
+// unless keyval.WithPageSize is given; then they are fetched in pages
+// on demand and all pages are read at the revision of the first page.
+func (db *BytesConnectionEtcd) ListKeys(prefix string, opts ...keyval.ListOption) (keyval.BytesKeyIterator, error) {
+	return listKeysInternal(db.Logger, db.etcdClient, db.opTimeout, prefix, opts...)
 }
 
-func listKeysInternal(log logging.Logger, kv clientv3.KV, opTimeout time.Duration, prefix string) (keyval.BytesKeyIterator, error) {
-	deadline := time.Now().Add(opTimeout)
-	ctx, cancel := context.WithDeadline(context.Background(), deadline)
-	defer cancel()
-
-	// get data from etcd
-	resp, err := kv.Get(ctx, prefix, clientv3.WithPrefix(), clientv3.WithKeysOnly())
+func listKeysInternal(log logging.Logger, kv clientv3.KV, opTimeout time.Duration, prefix string,
+	opts ...keyval.ListOption) (keyval.BytesKeyIterator, error) {
+	list, err := listPrefix(log, kv, opTimeout, prefix, 0, keyval.ParseListOptions(append(opts, keyval.WithKeysOnly())...))
 	if err != nil {
-		log.Error("etcd error: ", err)
 		return nil, err
 	}
-
-	return &bytesKeyIterator{len: len(resp.Kvs), resp: resp}, nil
+	return &bytesKeyIterator{list: list}, nil
 }
 
 // ListValuesRange returns an iterator that enables traversing values stored
@@ -469,18 +519,11 @@ func (db *BytesConnectionEtcd) ListValuesRange(fromPrefix string, toPrefix strin
 }
 
 func listValuesRangeInternal(log logging.Logger, kv clientv3.KV, opTimeout time.Duration, fromPrefix string, toPrefix string) (keyval.BytesKeyValIterator, error) {
-	deadline := time.Now().Add(opTimeout)
-	ctx, cancel := context.WithDeadline(context.Background(), deadline)
-	defer cancel()
-
-	// get data from etcd
-	resp, err := kv.Get(ctx, fromPrefix, clientv3.WithRange(toPrefix))
+	list, err := listRange(log, kv, opTimeout, fromPrefix, toPrefix, 0, keyval.ParseListOptions())
 	if err != nil {
-		log.Error("etcd error: ", err)
 		return nil, err
 	}
-
-	return &bytesKeyValIterator{len: len(resp.Kvs), resp: resp}, nil
+	return &bytesKeyValIterator{list: list}, nil
 }
 
 // Compact compacts the ETCD database to specific revision
@@ -539,43 +582,36 @@ func getRevisionInternal(log logging.Logger, kv clientv3.KV, opTimeout time.Dura
 // When there are no more items to get, <stop> is returned as *true* and <val>
 // is simply *nil*.
 func (ctx *bytesKeyValIterator) GetNext() (val keyval.BytesKeyVal, stop bool) {
-	if ctx.index >= ctx.len {
+	kv := ctx.list.nextKv()
+	if kv == nil {
 		return nil, true
 	}
 
-	key := string(ctx.resp.Kvs[ctx.index].Key)
-	data := ctx.resp.Kvs[ctx.index].Value
-	rev := ctx.resp.Kvs[ctx.index].ModRevision
+	prevValue := ctx.prevValue
+	ctx.prevValue = kv.Value
 
-	var prevValue []byte
-	if len(ctx.resp.Kvs) > 0 && ctx.index > 0 {
-		prevValue = ctx.resp.Kvs[ctx.index-1].Value
-	}
-
-	ctx.index++
+	return &bytesKeyVal{string(kv.Key), kv.Value, prevValue, kv.ModRevision}, false
+}
 
-	return &bytesKeyVal{key, data, prevValue, rev}, false
+// Close returns the error that stopped fetching of the pages (if any).
+func (ctx *bytesKeyValIterator) Close() error {
+	return ctx.list.err
 }
 
 // GetNext returns the following key (+ revision) from the result set.
 // When there are no more keys to get, <stop> is returned as *true*
 // and <key> and <rev> are default values.
 func (ctx *bytesKeyIterator) GetNext() (key string, rev int64, stop bool) {
-	if ctx.index >= ctx.len {
+	kv := ctx.list.nextKv()
+	if kv == nil {
 		return "", 0, true
 	}
-
-	key = string(ctx.resp.Kvs[ctx.index].Key)
-	rev = ctx.resp.Kvs[ctx.index].ModRevision
-	ctx.index++
-
-	return key, rev, false
+	return string(kv.Key), kv.ModRevision, false
 }
 
-// Close does nothing since db cursors are not needed.
-// The method is required by the code since it implements Iterator API.
+// Close returns the error that stopped fetching of the pages (if any).
 func (ctx *bytesKeyIterator) Close() error {
-	return nil
+	return ctx.list.err
 }
 
 // Close does nothing since db cursors are not needed.
@@ -56,3 +56,62 @@ func (tx *bytesTxn) Commit() error {
 	}
 	return nil
 }
+
+// bytesCondTxn is a conditional transaction mapped to the etcd transaction
+// (If/Then/Else).
+type bytesCondTxn struct {
+	cmps    []clientv3.Cmp
+	thenOps []clientv3.Op
+	elseOps []clientv3.Op
+	kv      clientv3.KV
+}
+
+// If adds conditions into the transaction. RevEquals is compared with
+// the mod revision of the key, Missing with its create revision (zero
+// if the key does not exist).
+func (tx *bytesCondTxn) If(conditions ...keyval.TxnCondition) keyval.BytesCondTxn {
+	for _, cond := range conditions {
+		switch cond.Type {
+		case keyval.CondRevEquals:
+			tx.cmps = append(tx.cmps, clientv3.Compare(clientv3.ModRevision(cond.Key), "=", cond.Revision))
+		case keyval.CondMissing:
+			tx.cmps = append(tx.cmps, clientv3.Compare(clientv3.CreateRevision(cond.Key), "=", 0))
+		case keyval.CondValueEquals:
+			tx.cmps = append(tx.cmps, clientv3.Compare(clientv3.Value(cond.Key), "=", string(cond.Value)))
+		}
+	}
+	return tx
+}
+
+// Then adds operations applied if all the conditions hold.
+func (tx *bytesCondTxn) Then(ops ...keyval.TxnOp) keyval.BytesCondTxn {
+	tx.thenOps = appendEtcdOps(tx.thenOps, ops)
+	return tx
+}
+
+// Else adds operations applied if any of the conditions does not hold.
+func (tx *bytesCondTxn) Else(ops ...keyval.TxnOp) keyval.BytesCondTxn {
+	tx.elseOps = appendEtcdOps(tx.elseOps, ops)
+	return tx
+}
+
+// Commit evaluates the conditions and applies the selected operations
+// in a single etcd transaction.
+func (tx *bytesCondTxn) Commit() (succeeded bool, err error) {
+	resp, err := tx.kv.Txn(context.Background()).If(tx.cmps...).Then(tx.thenOps...).Else(tx.elseOps...).Commit()
+	if err != nil {
+		return false, err
+	}
+	return resp.Succeeded, nil
+}
+
+func appendEtcdOps(etcdOps []clientv3.Op, ops []keyval.TxnOp) []clientv3.Op {
+	for _, op := range ops {
+		if op.Delete {
+			etcdOps = append(etcdOps, clientv3.OpDelete(op.Key))
+		} else {
+			etcdOps = append(etcdOps, clientv3.OpPut(op.Key, string(op.Value)))
+		}
+	}
+	return etcdOps
+}
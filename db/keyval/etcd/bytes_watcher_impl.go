@@ -15,7 +15,25 @@
 package etcd
 
 import (
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/etcdserver/api/v3rpc/rpctypes"
+	"github.com/coreos/etcd/mvcc/mvccpb"
 	"github.com/ligato/cn-infra/datasync"
+	"github.com/ligato/cn-infra/db/keyval"
+	"github.com/ligato/cn-infra/logging"
+	"golang.org/x/net/context"
+)
+
+const (
+	// watchRetryPeriod is the delay before a watch that was closed
+	// unexpectedly is re-established.
+	watchRetryPeriod = time.Second
+
+	// watchRevisionStorePeriod is the minimal period between two updates
+	// of the revision of the watched prefix in the keyval.WatchRevisionStore.
+	watchRevisionStorePeriod = time.Second
 )
 
 // BytesWatchPutResp is sent when new key-value pair has been inserted
@@ -93,3 +111,213 @@ func (resp *BytesWatchDelResp) GetPrevValue() []byte {
 func (resp *BytesWatchDelResp) GetRevision() int64 {
 	return resp.rev
 }
+
+// prefixWatch is a subscription for the changes of the keys with the given
+// prefix. It tracks the revision up to which the changes were delivered
+// and the keys that exist under the prefix, so that the watch can be
+// re-established without losing any change. A watch closed unexpectedly
+// is re-created with WithRev(lastRev+1). If the revision was compacted
+// in the meantime, only the watched prefix is resynchronized - the changed
+// items are listed and the keys that no longer exist are reported as deleted.
+type prefixWatch struct {
+	log       logging.Logger
+	clientCtx context.Context // done once the connection is closed
+	kv        clientv3.KV
+	watcher   clientv3.Watcher
+	opTimeout time.Duration
+	store     keyval.WatchRevisionStore
+	namespace string // prefix of the broker (used as a part of the key in the store)
+	prefix    string
+	resp      func(keyval.BytesWatchResp)
+
+	lastRev  int64               // revision up to which the changes were delivered
+	known    map[string]struct{} // keys under the prefix at lastRev (nil = unknown)
+	storedAt time.Time
+}
+
+// watchInternal starts the watch subscription for the key prefix.
+// The watch continues from the revision stored in the keyval.WatchRevisionStore
+// (if any).
+func watchInternal(w *prefixWatch, closeCh chan string) error {
+	var startRev int64
+	if w.store != nil {
+		rev, found, err := w.store.LoadRevision(w.namespace + w.prefix)
+		if err != nil {
+			w.log.WithField("prefix", w.prefix).Warnf("Failed to load the watched revision: %v", err)
+		} else if found {
+			startRev = rev
+		}
+	}
+	if err := w.listKnownKeys(startRev); err != nil {
+		if err != keyval.ErrCompacted {
+			return err
+		}
+		// changes made since the stored revision are lost
+		w.log.WithFields(logging.Fields{
+			"prefix": w.prefix,
+			"rev":    startRev,
+		}).Warn("Stored watch revision was compacted, resynchronizing the prefix")
+		w.lastRev = startRev
+		if err := w.resync(); err != nil {
+			return err
+		}
+	}
+	go w.loop(closeCh)
+	return nil
+}
+
+// listKnownKeys lists the keys under the prefix at the revision <rev>
+// (0 = the current revision) and sets the revision to start the watch from.
+func (w *prefixWatch) listKnownKeys(rev int64) error {
+	list, err := listPrefix(w.log, w.kv, w.opTimeout, w.prefix, rev, keyval.ParseListOptions(keyval.WithKeysOnly()))
+	if err != nil {
+		return translateHistoryErr(err)
+	}
+	known := make(map[string]struct{})
+	for kv := list.nextKv(); kv != nil; kv = list.nextKv() {
+		known[string(kv.Key)] = struct{}{}
+	}
+	if list.err != nil {
+		return translateHistoryErr(list.err)
+	}
+	w.known, w.lastRev = known, list.rev
+	return nil
+}
+
+// loop (re-)establishes the watch until the <closeCh> receives the watched
+// prefix (or is closed) or the connection is closed.
+func (w *prefixWatch) loop(closeCh chan string) {
+	defer w.storeRevision(true)
+	for {
+		compacted, closed := w.receive(closeCh)
+		if closed {
+			return
+		}
+		if compacted {
+			err := w.resync()
+			if err == nil {
+				continue
+			}
+			w.log.WithField("prefix", w.prefix).Errorf("Failed to resynchronize the watched prefix: %v", err)
+		} else {
+			w.log.WithFields(logging.Fields{
+				"prefix": w.prefix,
+				"rev":    w.lastRev + 1,
+			}).Warn("Watch recv channel was closed, re-creating the watch")
+		}
+		select {
+		case <-time.After(watchRetryPeriod):
+		case closeVal, ok := <-closeCh:
+			if !ok || closeVal == w.prefix {
+				return
+			}
+		case <-w.clientCtx.Done():
+			return
+		}
+	}
+}
+
+// receive starts the watch from the revision following the last delivered
+// revision and delivers the changes until the watch is closed.
+func (w *prefixWatch) receive(closeCh chan string) (compacted bool, closed bool) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	recvChan := w.watcher.Watch(ctx, w.prefix, clientv3.WithPrefix(), clientv3.WithPrevKV(),
+		clientv3.WithRev(w.lastRev+1), clientv3.WithProgressNotify())
+
+	for {
+		select {
+		case wresp, ok := <-recvChan:
+			if !ok {
+				return false, false
+			}
+			if wresp.CompactRevision != 0 || wresp.Err() == rpctypes.ErrCompacted {
+				w.log.WithFields(logging.Fields{
+					"prefix": w.prefix,
+					"rev":    wresp.CompactRevision,
+				}).Warn("Watched data were compacted, resynchronizing the prefix")
+				return true, false
+			}
+			if err := wresp.Err(); err != nil {
+				w.log.WithFields(logging.Fields{
+					"prefix": w.prefix,
+					"err":    err,
+				}).Warn("Watch returned error")
+			}
+			for _, ev := range wresp.Events {
+				w.deliver(ev)
+			}
+			if wresp.IsProgressNotify() && wresp.Header.Revision > w.lastRev {
+				// no changes of the prefix up to the revision
+				w.lastRev = wresp.Header.Revision
+			}
+			w.storeRevision(false)
+		case closeVal, ok := <-closeCh:
+			if !ok || closeVal == w.prefix {
+				w.log.WithField("prefix", w.prefix).Debug("Watch ended")
+				return false, true
+			}
+		case <-w.clientCtx.Done():
+			return false, true
+		}
+	}
+}
+
+// deliver delivers the change and updates the tracked revision and keys.
+func (w *prefixWatch) deliver(ev *clientv3.Event) {
+	if w.known != nil {
+		if ev.Type == mvccpb.DELETE {
+			delete(w.known, string(ev.Kv.Key))
+		} else {
+			w.known[string(ev.Kv.Key)] = struct{}{}
+		}
+	}
+	if ev.Kv.ModRevision > w.lastRev {
+		w.lastRev = ev.Kv.ModRevision
+	}
+	handleWatchEvent(w.log, w.resp, ev)
+}
+
+// resync lists the current values under the prefix and delivers the items
+// changed since the last delivered revision and the deletion of the keys
+// that no longer exist (previous values of the changes are not known).
+func (w *prefixWatch) resync() error {
+	list, err := listPrefix(w.log, w.kv, w.opTimeout, w.prefix, 0, keyval.ParseListOptions())
+	if err != nil {
+		return err
+	}
+	current := make(map[string]struct{})
+	for kv := list.nextKv(); kv != nil; kv = list.nextKv() {
+		current[string(kv.Key)] = struct{}{}
+		if kv.ModRevision > w.lastRev {
+			w.resp(NewBytesWatchPutResp(string(kv.Key), kv.Value, nil, kv.ModRevision))
+		}
+	}
+	if list.err != nil {
+		return list.err
+	}
+	if w.known == nil {
+		w.log.WithField("prefix", w.prefix).Warn("Keys deleted before the resync of the watched prefix cannot be detected")
+	}
+	for key := range w.known {
+		if _, exists := current[key]; !exists {
+			w.resp(NewBytesWatchDelResp(key, nil, list.rev))
+		}
+	}
+	w.known, w.lastRev = current, list.rev
+	w.storeRevision(true)
+	return nil
+}
+
+// storeRevision stores the last delivered revision into the keyval.WatchRevisionStore
+// (at most once per watchRevisionStorePeriod unless <force> is true).
+func (w *prefixWatch) storeRevision(force bool) {
+	if w.store == nil || (!force && time.Since(w.storedAt) < watchRevisionStorePeriod) {
+		return
+	}
+	if err := w.store.StoreRevision(w.namespace+w.prefix, w.lastRev); err != nil {
+		w.log.WithField("prefix", w.prefix).Warnf("Failed to store the watched revision: %v", err)
+		return
+	}
+	w.storedAt = time.Now()
+}
@@ -31,15 +31,16 @@ import (
 // package.
 type Config struct {
 	Endpoints             []string      `json:"endpoints"`
-	DialTimeout           time.Duration `json:"dial-timeout"`
-	OpTimeout             time.Duration `json:"operation-timeout"`
+	DialTimeout           time.Duration `json:"dial-timeout" default:"1s" validate:"min=0s"`
+	OpTimeout             time.Duration `json:"operation-timeout" default:"3s" validate:"min=0s"`
 	InsecureTransport     bool          `json:"insecure-transport"`
 	InsecureSkipTLSVerify bool          `json:"insecure-skip-tls-verify"`
 	Certfile              string        `json:"cert-file"`
-	Keyfile               string        `json:"key-file"`
+	Keyfile               string        `json:"key-file" secret:"true"`
 	CAfile                string        `json:"ca-file"`
-	AutoCompact           time.Duration `json:"auto-compact"`
+	AutoCompact           time.Duration `json:"auto-compact" validate:"min=0s"`
 	ReconnectResync       bool          `json:"resync-after-reconnect"`
+	WatchRevisionFile     string        `json:"watch-revision-file"`
 }
 
 // ClientConfig extends clientv3.Config with configuration options introduced
@@ -52,6 +53,8 @@ type ClientConfig struct {
 	OpTimeout time.Duration
 }
 
+// Fallbacks for the timeouts of configurations built without PluginConfig
+// (which applies the default tags of Config).
 const (
 	// defaultDialTimeout defines the default timeout for connecting to etcd.
 	defaultDialTimeout = 1 * time.Second
@@ -67,6 +70,8 @@ const (
 // the function will query the ETCD_ENDPOINTS environment variable
 // for a non-empty value. If neither the config nor the environment specify the
 // endpoint location, a default address "127.0.0.1:2379" is assumed.
+// Zero timeouts (left by configurations built without PluginConfig, which
+// applies the default tags of Config) are replaced with the same defaults.
 // The function may return error only if TLS connection is selected and the
 // CA or client certificate is not accessible/valid.
 func ConfigToClient(yc *Config) (*ClientConfig, error) {
@@ -0,0 +1,41 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd_test
+
+import (
+	"testing"
+
+	"github.com/ligato/cn-infra/config"
+	"github.com/ligato/cn-infra/db/keyval/etcd"
+	"github.com/onsi/gomega"
+)
+
+// TestRedactConfig checks that the private key of the client is not printed
+// with the configuration.
+func TestRedactConfig(t *testing.T) {
+	gomega.RegisterTestingT(t)
+
+	cfg := &etcd.Config{
+		Endpoints: []string{"127.0.0.1:2379"},
+		Certfile:  "client.crt",
+		Keyfile:   "${file:/run/secrets/client.key}",
+	}
+	redacted, err := config.Redact(cfg)
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	doc := redacted.(map[string]interface{})
+	gomega.Expect(doc["key-file"]).Should(gomega.Equal(config.RedactedValue))
+	gomega.Expect(doc["cert-file"]).Should(gomega.Equal("client.crt"))
+	gomega.Expect(cfg.Keyfile).Should(gomega.Equal("${file:/run/secrets/client.key}"))
+}
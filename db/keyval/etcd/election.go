@@ -0,0 +1,188 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"sync"
+	"time"
+
+	"github.com/coreos/etcd/clientv3/concurrency"
+	"github.com/ligato/cn-infra/db/keyval/election"
+	"golang.org/x/net/context"
+)
+
+// etcdMutex implements election.Mutex using the etcd concurrency.Mutex.
+// The create revision of the key of the lock holder is used as the fencing token.
+type etcdMutex struct {
+	session   *concurrency.Session
+	mutex     *concurrency.Mutex
+	opTimeout time.Duration
+
+	access sync.Mutex
+	locked bool
+	token  int64
+}
+
+// etcdElection implements election.Election using the etcd concurrency.Election.
+type etcdElection struct {
+	session   *concurrency.Session
+	election  *concurrency.Election
+	opTimeout time.Duration
+
+	access sync.Mutex
+	leader bool
+}
+
+// NewMutex creates a new distributed lock with its own etcd session.
+// The <ttl> of the session is rounded up to seconds.
+func (db *BytesConnectionEtcd) NewMutex(key string, ttl time.Duration) (election.Mutex, error) {
+	session, err := concurrency.NewSession(db.etcdClient, concurrency.WithTTL(int(ttlSeconds(ttl))))
+	if err != nil {
+		return nil, err
+	}
+	return &etcdMutex{session: session, mutex: concurrency.NewMutex(session, key), opTimeout: db.opTimeout}, nil
+}
+
+// NewElection creates a new participant of the leader election with its own
+// etcd session. The <ttl> of the session is rounded up to seconds.
+func (db *BytesConnectionEtcd) NewElection(key string, ttl time.Duration) (election.Election, error) {
+	session, err := concurrency.NewSession(db.etcdClient, concurrency.WithTTL(int(ttlSeconds(ttl))))
+	if err != nil {
+		return nil, err
+	}
+	return &etcdElection{session: session, election: concurrency.NewElection(session, key), opTimeout: db.opTimeout}, nil
+}
+
+// Lock blocks until the lock is acquired or the <ctx> is done.
+func (m *etcdMutex) Lock(ctx context.Context) error {
+	if err := m.mutex.Lock(ctx); err != nil {
+		return err
+	}
+	resp, err := m.session.Client().Get(ctx, m.mutex.Key())
+	if err != nil {
+		return err
+	}
+	if len(resp.Kvs) == 0 {
+		return election.ErrNotHeld
+	}
+
+	m.access.Lock()
+	defer m.access.Unlock()
+	m.locked, m.token = true, resp.Kvs[0].CreateRevision
+	return nil
+}
+
+// Unlock releases the lock.
+func (m *etcdMutex) Unlock() error {
+	m.access.Lock()
+	defer m.access.Unlock()
+
+	return m.unlock()
+}
+
+func (m *etcdMutex) unlock() error {
+	if !m.locked {
+		return election.ErrNotHeld
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), m.opTimeout)
+	defer cancel()
+	m.locked = false
+	return m.mutex.Unlock(ctx)
+}
+
+// FencingToken returns the create revision of the key of the lock holder.
+func (m *etcdMutex) FencingToken() int64 {
+	m.access.Lock()
+	defer m.access.Unlock()
+
+	return m.token
+}
+
+// Close releases the lock and revokes the session.
+func (m *etcdMutex) Close() error {
+	m.access.Lock()
+	defer m.access.Unlock()
+
+	if m.locked {
+		m.unlock()
+	}
+	return m.session.Close()
+}
+
+// Campaign blocks until the agent is elected as the leader or the <ctx> is done.
+func (e *etcdElection) Campaign(ctx context.Context, value string) error {
+	if err := e.election.Campaign(ctx, value); err != nil {
+		return err
+	}
+	e.access.Lock()
+	e.leader = true
+	e.access.Unlock()
+	return nil
+}
+
+// Resign gives up the leadership.
+func (e *etcdElection) Resign(ctx context.Context) error {
+	e.access.Lock()
+	defer e.access.Unlock()
+
+	if !e.leader {
+		return nil
+	}
+	e.leader = false
+	return e.election.Resign(ctx)
+}
+
+// IsLeader returns true if the agent is the leader and its session
+// has not expired.
+func (e *etcdElection) IsLeader() bool {
+	e.access.Lock()
+	defer e.access.Unlock()
+
+	select {
+	case <-e.session.Done():
+		return false
+	default:
+		return e.leader
+	}
+}
+
+// Observe returns a channel that receives the value of every new leader.
+func (e *etcdElection) Observe(ctx context.Context) <-chan string {
+	leaderCh := make(chan string)
+	respCh := e.election.Observe(ctx)
+	go func() {
+		defer close(leaderCh)
+		for resp := range respCh {
+			var value string
+			if len(resp.Kvs) > 0 {
+				value = string(resp.Kvs[0].Value)
+			}
+			select {
+			case leaderCh <- value:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return leaderCh
+}
+
+// Close resigns and revokes the session.
+func (e *etcdElection) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), e.opTimeout)
+	defer cancel()
+	e.Resign(ctx)
+	return e.session.Close()
+}
@@ -15,6 +15,11 @@
 package etcd
 
 import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"sync"
 	"testing"
 	"time"
@@ -22,10 +27,12 @@ import (
 	"github.com/ligato/cn-infra/datasync"
 	"github.com/ligato/cn-infra/db/keyval"
 	"github.com/ligato/cn-infra/db/keyval/etcd/mocks"
+	"github.com/ligato/cn-infra/logging"
 	"github.com/ligato/cn-infra/logging/logrus"
 
 	"github.com/coreos/etcd/etcdserver/api/v3client"
 	. "github.com/onsi/gomega"
+	"golang.org/x/net/context"
 )
 
 const (
@@ -52,6 +59,8 @@ func TestDataBroker(t *testing.T) {
 	embd.CleanDs()
 	t.Run("listValues", testPrefixedListValues)
 	embd.CleanDs()
+	t.Run("listPages", testListPages)
+	embd.CleanDs()
 	t.Run("txn", testPrefixedTxn)
 	embd.CleanDs()
 	t.Run("testDelWithPrefix", testDelWithPrefix)
@@ -59,6 +68,16 @@ func TestDataBroker(t *testing.T) {
 	t.Run("testPutIfNotExist", testPutIfNotExists)
 	embd.CleanDs()
 	t.Run("compact", testCompact)
+	embd.CleanDs()
+	t.Run("history", testHistory)
+	embd.CleanDs()
+	t.Run("watchResume", testWatchResume)
+	embd.CleanDs()
+	t.Run("lease", testLease)
+	embd.CleanDs()
+	t.Run("mutex", testMutex)
+	embd.CleanDs()
+	t.Run("reload", testReload)
 }
 
 func setupBrokers(t *testing.T) {
@@ -201,6 +220,43 @@ func testPrefixedListValues(t *testing.T) {
 	}
 }
 
+func testListPages(t *testing.T) {
+	setupBrokers(t)
+	defer teardownBrokers()
+
+	for i := 1; i <= 5; i++ {
+		Expect(broker.Put(fmt.Sprintf("%sa/val%d", prefix, i), []byte{byte(i)})).To(Succeed())
+	}
+
+	// pages of 2 items are read at the revision of the first page
+	kvi, err := prefixedBroker.ListValues("a", keyval.WithStartAfter("a/val1"), keyval.WithLimit(3),
+		keyval.WithPageSize(2))
+	Expect(err).To(BeNil())
+	Expect(broker.Put(prefix+"a/val4", []byte{0})).To(Succeed())
+
+	var keys []string
+	for {
+		kv, all := kvi.GetNext()
+		if all {
+			break
+		}
+		if kv.GetKey() == "a/val4" {
+			Expect(kv.GetValue()).To(Equal([]byte{4}))
+		}
+		keys = append(keys, kv.GetKey())
+	}
+	Expect(kvi.(io.Closer).Close()).To(Succeed())
+	Expect(keys).To(Equal([]string{"a/val2", "a/val3", "a/val4"}))
+
+	ki, err := prefixedBroker.ListKeys("a", keyval.WithStartAfter("a/val4"))
+	Expect(err).To(BeNil())
+	key, _, all := ki.GetNext()
+	Expect(all).To(BeFalse())
+	Expect(key).To(Equal("a/val5"))
+	_, _, all = ki.GetNext()
+	Expect(all).To(BeTrue())
+}
+
 func testDelWithPrefix(t *testing.T) {
 	setupBrokers(t)
 	defer teardownBrokers()
@@ -364,3 +420,180 @@ func testCompact(t *testing.T) {
 	Expect(found).NotTo(BeTrue())
 	Expect(err).NotTo(BeNil())
 }
+
+func testHistory(t *testing.T) {
+	setupBrokers(t)
+	defer teardownBrokers()
+
+	Expect(broker.Put(prefix+"h/a", []byte{1})).To(Succeed())
+	_, _, firstRev, err := broker.GetValue(prefix + "h/a")
+	Expect(err).To(BeNil())
+	Expect(broker.Put(prefix+"h/b", []byte{1})).To(Succeed())
+	Expect(broker.Put(prefix+"h/a", []byte{2})).To(Succeed())
+	_, err = broker.Delete(prefix + "h/b")
+	Expect(err).To(BeNil())
+
+	history := prefixedBroker.(keyval.HistoryReader)
+	data, found, rev, err := history.GetValueAtRevision("h/a", firstRev+1)
+	Expect(err).To(BeNil())
+	Expect(found).To(BeTrue())
+	Expect(data).To(Equal([]byte{1}))
+	Expect(rev).To(Equal(firstRev))
+
+	kvi, err := history.ListValuesAtRevision("h/", firstRev+2)
+	Expect(err).To(BeNil())
+	var keys []string
+	for {
+		kv, all := kvi.GetNext()
+		if all {
+			break
+		}
+		keys = append(keys, kv.GetKey())
+	}
+	Expect(keys).To(Equal([]string{"h/a", "h/b"}))
+
+	changes, err := history.KeyHistory("h/b", firstRev)
+	Expect(err).To(BeNil())
+	Expect(changes).To(HaveLen(2))
+	Expect(changes[0].GetKey()).To(Equal("h/b"))
+	Expect(changes[0].GetChangeType()).To(Equal(datasync.Put))
+	Expect(changes[1].GetChangeType()).To(Equal(datasync.Delete))
+	Expect(changes[1].GetPrevValue()).To(Equal([]byte{1}))
+	Expect(changes[1].GetRevision()).To(Equal(firstRev + 3))
+
+	changes, err = history.KeyHistory("h/a", firstRev)
+	Expect(err).To(BeNil())
+	Expect(changes).To(HaveLen(2))
+
+	_, err = broker.Compact()
+	Expect(err).To(BeNil())
+	_, _, _, err = history.GetValueAtRevision("h/a", firstRev)
+	Expect(err).To(Equal(keyval.ErrCompacted))
+	_, err = history.KeyHistory("h/a", firstRev)
+	Expect(err).To(Equal(keyval.ErrCompacted))
+}
+
+func testWatchResume(t *testing.T) {
+	setupBrokers(t)
+	defer teardownBrokers()
+
+	dir, err := ioutil.TempDir("", "etcd")
+	Expect(err).To(BeNil())
+	defer os.RemoveAll(dir)
+	store := keyval.NewFileWatchRevisionStore(filepath.Join(dir, "revisions.json"))
+	broker.SetWatchRevisionStore(store)
+
+	// watch is started, the revision of the delivered change is stored once it ends
+	watchCh := make(chan keyval.BytesWatchResp, 10)
+	closeCh := make(chan string)
+	Expect(broker.NewWatcher(prefix).Watch(keyval.ToChan(watchCh), closeCh, "resume/")).To(Succeed())
+	Expect(broker.Put(prefix+"resume/a", []byte{1})).To(Succeed())
+	var resp keyval.BytesWatchResp
+	Eventually(watchCh).Should(Receive(&resp))
+	Expect(resp.GetKey()).To(Equal("resume/a"))
+	close(closeCh)
+	Eventually(func() int64 {
+		rev, _, _ := store.LoadRevision(prefix + "resume/")
+		return rev
+	}).Should(Equal(resp.GetRevision()))
+
+	// changes made while not watching are delivered once the watch is started again
+	Expect(broker.Put(prefix+"resume/b", []byte{1})).To(Succeed())
+	_, err = broker.Delete(prefix + "resume/a")
+	Expect(err).To(BeNil())
+	closeCh = make(chan string)
+	Expect(broker.NewWatcher(prefix).Watch(keyval.ToChan(watchCh), closeCh, "resume/")).To(Succeed())
+	Eventually(watchCh).Should(Receive(&resp))
+	Expect(resp.GetKey()).To(Equal("resume/b"))
+	Expect(resp.GetChangeType()).To(Equal(datasync.Put))
+	Eventually(watchCh).Should(Receive(&resp))
+	Expect(resp.GetKey()).To(Equal("resume/a"))
+	Expect(resp.GetChangeType()).To(Equal(datasync.Delete))
+	close(closeCh)
+	Eventually(func() int64 {
+		rev, _, _ := store.LoadRevision(prefix + "resume/")
+		return rev
+	}).Should(Equal(resp.GetRevision()))
+
+	// the stored revision is compacted, the changed items are resynchronized
+	Expect(broker.Put(prefix+"resume/c", []byte{1})).To(Succeed())
+	_, err = broker.Compact()
+	Expect(err).To(BeNil())
+	closeCh = make(chan string)
+	defer close(closeCh)
+	Expect(broker.NewWatcher(prefix).Watch(keyval.ToChan(watchCh), closeCh, "resume/")).To(Succeed())
+	Eventually(watchCh).Should(Receive(&resp))
+	Expect(resp.GetKey()).To(Equal("resume/c"))
+	Expect(resp.GetChangeType()).To(Equal(datasync.Put))
+	Consistently(watchCh).ShouldNot(Receive())
+}
+
+func testLease(t *testing.T) {
+	setupBrokers(t)
+	defer teardownBrokers()
+
+	leaser := prefixedBroker.(keyval.Leaser)
+	id, err := leaser.GrantLease(5 * time.Second)
+	Expect(err).To(BeNil())
+	Expect(leaser.KeepAlive(id)).To(Succeed())
+
+	err = prefixedBroker.Put(key, []byte("status"), keyval.WithLease(id))
+	Expect(err).To(BeNil())
+	_, found, _, err := broker.GetValue(prefix + key)
+	Expect(err).To(BeNil())
+	Expect(found).To(BeTrue())
+
+	// revoked lease removes the key
+	Expect(leaser.Revoke(id)).To(Succeed())
+	_, found, _, err = prefixedBroker.GetValue(key)
+	Expect(err).To(BeNil())
+	Expect(found).To(BeFalse())
+}
+
+func testMutex(t *testing.T) {
+	setupBrokers(t)
+	defer teardownBrokers()
+
+	mutex, err := broker.NewMutex("/lock", time.Second)
+	Expect(err).To(BeNil())
+	Expect(mutex.Lock(context.Background())).To(Succeed())
+	Expect(mutex.FencingToken()).To(BeNumerically(">", 0))
+
+	e, err := broker.NewElection("/leader", time.Second)
+	Expect(err).To(BeNil())
+	Expect(e.Campaign(context.Background(), "agent1")).To(Succeed())
+	Expect(e.IsLeader()).To(BeTrue())
+	Expect(e.Close()).To(Succeed())
+
+	Expect(mutex.Unlock()).To(Succeed())
+	Expect(mutex.Close()).To(Succeed())
+}
+
+func testReload(t *testing.T) {
+	endpoint := embd.ETCD.Clients[0].Addr().String()
+	etcdCfg := &Config{Endpoints: []string{endpoint}, DialTimeout: time.Second, OpTimeout: 3 * time.Second}
+	clientCfg, err := ConfigToClient(etcdCfg)
+	Expect(err).To(BeNil())
+	conn, err := NewEtcdConnectionWithBytes(*clientCfg, logrus.DefaultLogger())
+	Expect(err).To(BeNil())
+	defer conn.Close()
+
+	plugin := &Plugin{etcdCfg: etcdCfg, connection: conn}
+	plugin.Log = logging.ForPlugin("etcd", logrus.NewLogRegistry())
+
+	// endpoints are changed on the fly
+	newCfg := *etcdCfg
+	newCfg.Endpoints = []string{endpoint, endpoint}
+	Expect(plugin.Reload(&newCfg)).To(Succeed())
+	Expect(conn.etcdClient.Endpoints()).To(Equal([]string{endpoint, endpoint}))
+	Expect(plugin.CurrentConfig()).To(Equal(&newCfg))
+	Expect(conn.Put(prefix+key, []byte{1})).To(Succeed())
+
+	// other options require restart
+	rejectedCfg := newCfg
+	rejectedCfg.Endpoints = []string{endpoint}
+	rejectedCfg.OpTimeout = time.Second
+	Expect(plugin.Reload(&rejectedCfg)).NotTo(Succeed())
+	Expect(conn.etcdClient.Endpoints()).To(Equal([]string{endpoint, endpoint}))
+	Expect(plugin.CurrentConfig()).To(Equal(&newCfg))
+}
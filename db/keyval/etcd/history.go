@@ -0,0 +1,174 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/etcdserver/api/v3rpc/rpctypes"
+	"github.com/ligato/cn-infra/db/keyval"
+	"github.com/ligato/cn-infra/logging"
+	"golang.org/x/net/context"
+)
+
+// historyQuietPeriod is the time KeyHistory waits for the replayed watch
+// events of a key that does not currently exist (the revision of its last
+// change cannot be learned upfront).
+const historyQuietPeriod = 200 * time.Millisecond
+
+// GetValueAtRevision retrieves the item stored under the <key> at the revision
+// <rev> (zero or negative <rev> means the current revision).
+// keyval.ErrCompacted is returned if etcd was compacted past the revision.
+func (db *BytesConnectionEtcd) GetValueAtRevision(key string, rev int64) (data []byte, found bool, revision int64, err error) {
+	return getValueAtRevisionInternal(db.Logger, db.etcdClient, db.opTimeout, key, rev)
+}
+
+// ListValuesAtRevision returns an iterator that enables traversing values
+// stored under the provided <prefix> at the revision <rev>. The values are
+// read by a single Get unless keyval.WithPageSize is given (then they are
+// fetched in pages on demand).
+func (db *BytesConnectionEtcd) ListValuesAtRevision(prefix string, rev int64, opts ...keyval.ListOption) (keyval.BytesKeyValIterator, error) {
+	return listValuesAtRevisionInternal(db.Logger, db.etcdClient, db.opTimeout, prefix, rev, opts...)
+}
+
+// KeyHistory returns the changes of the item stored under the <key> made
+// in the revision <fromRev> or later (from the oldest to the newest).
+// The changes are replayed by the etcd watch, keyval.ErrCompacted is returned
+// if etcd was compacted past <fromRev>.
+func (db *BytesConnectionEtcd) KeyHistory(key string, fromRev int64) ([]keyval.BytesWatchResp, error) {
+	return keyHistoryInternal(db.Logger, db.etcdClient, db.etcdClient, db.opTimeout, key, fromRev)
+}
+
+// GetValueAtRevision calls 'GetValueAtRevision' function of the underlying
+// BytesConnectionEtcd. KeyPrefix defined in constructor is prepended
+// to the key argument.
+func (pdb *BytesBrokerWatcherEtcd) GetValueAtRevision(key string, rev int64) (data []byte, found bool, revision int64, err error) {
+	return getValueAtRevisionInternal(pdb.Logger, pdb.kv, pdb.opTimeout, key, rev)
+}
+
+// ListValuesAtRevision calls 'ListValuesAtRevision' function of the underlying
+// BytesConnectionEtcd. KeyPrefix defined in constructor is prepended to the
+// argument. The prefix is removed from the keys of the returned values.
+func (pdb *BytesBrokerWatcherEtcd) ListValuesAtRevision(prefix string, rev int64, opts ...keyval.ListOption) (keyval.BytesKeyValIterator, error) {
+	return listValuesAtRevisionInternal(pdb.Logger, pdb.kv, pdb.opTimeout, prefix, rev, opts...)
+}
+
+// KeyHistory calls 'KeyHistory' function of the underlying BytesConnectionEtcd.
+// KeyPrefix defined in constructor is prepended to the key argument
+// and removed from the keys of the returned changes.
+func (pdb *BytesBrokerWatcherEtcd) KeyHistory(key string, fromRev int64) ([]keyval.BytesWatchResp, error) {
+	return keyHistoryInternal(pdb.Logger, pdb.kv, pdb.watcher, pdb.opTimeout, key, fromRev)
+}
+
+func getValueAtRevisionInternal(log logging.Logger, kv clientv3.KV, opTimeout time.Duration,
+	key string, rev int64) (data []byte, found bool, revision int64, err error) {
+	if rev < 0 {
+		rev = 0
+	}
+	data, found, revision, err = getValueRevInternal(log, kv, opTimeout, key, rev)
+	return data, found, revision, translateHistoryErr(err)
+}
+
+func listValuesAtRevisionInternal(log logging.Logger, kv clientv3.KV, opTimeout time.Duration, prefix string,
+	rev int64, opts ...keyval.ListOption) (keyval.BytesKeyValIterator, error) {
+	if rev < 0 {
+		rev = 0
+	}
+	list, err := listPrefix(log, kv, opTimeout, prefix, rev, keyval.ParseListOptions(opts...))
+	if err != nil {
+		return nil, translateHistoryErr(err)
+	}
+	return &bytesKeyValIterator{list: list}, nil
+}
+
+// keyHistoryInternal replays the changes of the key by the watch started
+// at <fromRev>. The replay ends once the watch delivers all changes made
+// until the revision read before the watch was started.
+func keyHistoryInternal(log logging.Logger, kv clientv3.KV, watcher clientv3.Watcher, opTimeout time.Duration,
+	key string, fromRev int64) ([]keyval.BytesWatchResp, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), opTimeout)
+	defer cancel()
+
+	resp, err := kv.Get(ctx, key)
+	if err != nil {
+		log.Error("etcd get error: ", err)
+		return nil, err
+	}
+	currentRev := resp.Header.Revision
+	var lastChange int64 // revision of the last change if the key exists
+	if len(resp.Kvs) > 0 {
+		lastChange = resp.Kvs[0].ModRevision
+	}
+	if fromRev <= 0 {
+		fromRev = 1
+	}
+	if fromRev > currentRev {
+		return nil, nil
+	}
+
+	watchCtx, cancelWatch := context.WithCancel(ctx)
+	defer cancelWatch()
+	recvChan := watcher.Watch(watchCtx, key, clientv3.WithRev(fromRev), clientv3.WithPrevKV())
+
+	var changes []keyval.BytesWatchResp
+	collect := func(change keyval.BytesWatchResp) {
+		changes = append(changes, change)
+	}
+	for {
+		var quiet <-chan time.Time
+		if lastChange == 0 {
+			quiet = time.After(historyQuietPeriod)
+		}
+		select {
+		case wresp, ok := <-recvChan:
+			if !ok {
+				return nil, ctx.Err()
+			}
+			if wresp.CompactRevision != 0 {
+				return nil, keyval.ErrCompacted
+			}
+			if err := wresp.Err(); err != nil {
+				return nil, translateHistoryErr(err)
+			}
+			for _, ev := range wresp.Events {
+				if ev.Kv.ModRevision > currentRev {
+					return changes, nil
+				}
+				handleWatchEvent(log, collect, ev)
+				if lastChange != 0 && ev.Kv.ModRevision >= lastChange {
+					return changes, nil
+				}
+			}
+			if wresp.Header.Revision >= currentRev {
+				return changes, nil
+			}
+		case <-quiet:
+			// the key does not exist and no more changes were replayed
+			return changes, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// translateHistoryErr replaces the etcd error of a compacted revision
+// with keyval.ErrCompacted.
+func translateHistoryErr(err error) error {
+	if err == rpctypes.ErrCompacted {
+		return keyval.ErrCompacted
+	}
+	return err
+}
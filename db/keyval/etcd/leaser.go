@@ -0,0 +1,150 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/ligato/cn-infra/db/keyval"
+	"golang.org/x/net/context"
+)
+
+// leaser implements keyval.Leaser using etcd leases. It is shared by
+// the connection and all its brokers.
+type leaser struct {
+	lessor clientv3.Lease
+
+	access     sync.Mutex
+	keepAlives map[clientv3.LeaseID]context.CancelFunc
+}
+
+func newLeaser(lessor clientv3.Lease) *leaser {
+	return &leaser{lessor: lessor, keepAlives: make(map[clientv3.LeaseID]context.CancelFunc)}
+}
+
+// GrantLease creates a new etcd lease. The <ttl> is rounded up to seconds.
+func (db *BytesConnectionEtcd) GrantLease(ttl time.Duration) (keyval.LeaseID, error) {
+	return db.leases.grant(db.opTimeout, ttl)
+}
+
+// KeepAlive keeps the etcd lease alive until it is revoked or the connection
+// is closed.
+func (db *BytesConnectionEtcd) KeepAlive(id keyval.LeaseID) error {
+	return db.leases.keepAlive(id)
+}
+
+// Revoke revokes the etcd lease, etcd removes all keys attached to the lease.
+func (db *BytesConnectionEtcd) Revoke(id keyval.LeaseID) error {
+	return db.leases.revoke(db.opTimeout, id)
+}
+
+// GrantLease creates a new etcd lease (see BytesConnectionEtcd.GrantLease()).
+func (pdb *BytesBrokerWatcherEtcd) GrantLease(ttl time.Duration) (keyval.LeaseID, error) {
+	return pdb.leases.grant(pdb.opTimeout, ttl)
+}
+
+// KeepAlive keeps the etcd lease alive (see BytesConnectionEtcd.KeepAlive()).
+func (pdb *BytesBrokerWatcherEtcd) KeepAlive(id keyval.LeaseID) error {
+	return pdb.leases.keepAlive(id)
+}
+
+// Revoke revokes the etcd lease (see BytesConnectionEtcd.Revoke()).
+func (pdb *BytesBrokerWatcherEtcd) Revoke(id keyval.LeaseID) error {
+	return pdb.leases.revoke(pdb.opTimeout, id)
+}
+
+func (l *leaser) grant(opTimeout time.Duration, ttl time.Duration) (keyval.LeaseID, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), opTimeout)
+	defer cancel()
+
+	resp, err := l.lessor.Grant(ctx, ttlSeconds(ttl))
+	if err != nil {
+		return "", err
+	}
+	return formatLeaseID(resp.ID), nil
+}
+
+func (l *leaser) keepAlive(id keyval.LeaseID) error {
+	leaseID, err := parseLeaseID(id)
+	if err != nil {
+		return err
+	}
+
+	l.access.Lock()
+	defer l.access.Unlock()
+
+	if _, alive := l.keepAlives[leaseID]; alive {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	respCh, err := l.lessor.KeepAlive(ctx, leaseID)
+	if err != nil {
+		cancel()
+		return err
+	}
+	l.keepAlives[leaseID] = cancel
+	go func() {
+		// the channel is closed once the lease is revoked or expires
+		for range respCh {
+		}
+	}()
+	return nil
+}
+
+func (l *leaser) revoke(opTimeout time.Duration, id keyval.LeaseID) error {
+	leaseID, err := parseLeaseID(id)
+	if err != nil {
+		return err
+	}
+
+	l.access.Lock()
+	if cancel, alive := l.keepAlives[leaseID]; alive {
+		cancel()
+		delete(l.keepAlives, leaseID)
+	}
+	l.access.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), opTimeout)
+	defer cancel()
+	_, err = l.lessor.Revoke(ctx, leaseID)
+	return err
+}
+
+// ttlSeconds rounds the TTL up to seconds (etcd leases have TTL of at least 1s).
+func ttlSeconds(ttl time.Duration) int64 {
+	seconds := int64((ttl + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	return seconds
+}
+
+// formatLeaseID formats the etcd lease ID as a hexadecimal number
+// (as printed by etcdctl).
+func formatLeaseID(id clientv3.LeaseID) keyval.LeaseID {
+	return keyval.LeaseID(strconv.FormatInt(int64(id), 16))
+}
+
+func parseLeaseID(id keyval.LeaseID) (clientv3.LeaseID, error) {
+	leaseID, err := strconv.ParseInt(string(id), 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid etcd lease ID '%s'", id)
+	}
+	return clientv3.LeaseID(leaseID), nil
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package etcd
+
+import (
+	"time"
+
+	"github.com/coreos/etcd/clientv3"
+	"github.com/coreos/etcd/mvcc/mvccpb"
+	"github.com/ligato/cn-infra/db/keyval"
+	"github.com/ligato/cn-infra/logging"
+	"golang.org/x/net/context"
+)
+
+// pagedList fetches the items of a key range from etcd by a single request,
+// or in pages on demand if the page size is set by keyval.WithPageSize().
+// All pages are read at the revision of the first page, the listing is
+// therefore consistent (unless the revision gets compacted in the meantime).
+type pagedList struct {
+	log       logging.Logger
+	kv        clientv3.KV
+	opTimeout time.Duration
+	opts      keyval.ListOptions
+
+	next     string // first key of the next page
+	end      string // end of the range
+	rev      int64  // revision of the listing
+	more     bool   // false once the last page is fetched
+	kvs      []*mvccpb.KeyValue
+	index    int
+	received int
+	err      error
+}
+
+// listPrefix starts listing of the items with the given <prefix>
+// at the revision <rev> (0 = the current revision).
+func listPrefix(log logging.Logger, kv clientv3.KV, opTimeout time.Duration, prefix string, rev int64,
+	opts keyval.ListOptions) (*pagedList, error) {
+	start, end := prefix, clientv3.GetPrefixRangeEnd(prefix)
+	if start == "" {
+		start = "\x00" // all keys
+	}
+	return listRange(log, kv, opTimeout, opts.RangeStart("", start), end, rev, opts)
+}
+
+// listRange starts listing of the items with keys from the range [start, end)
+// at the revision <rev> (0 = the current revision). The first page is fetched
+// immediately.
+func listRange(log logging.Logger, kv clientv3.KV, opTimeout time.Duration, start, end string, rev int64,
+	opts keyval.ListOptions) (*pagedList, error) {
+	list := &pagedList{
+		log:       log,
+		kv:        kv,
+		opTimeout: opTimeout,
+		opts:      opts,
+		next:      start,
+		end:       end,
+		rev:       rev,
+	}
+	if err := list.fetchPage(); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// fetchPage fetches the next page of the items.
+func (list *pagedList) fetchPage() error {
+	ctx, cancel := context.WithTimeout(context.Background(), list.opTimeout)
+	defer cancel()
+
+	ops := []clientv3.OpOption{
+		clientv3.WithRange(list.end),
+		clientv3.WithLimit(int64(list.opts.NextPageSize(list.received))),
+	}
+	if list.rev > 0 {
+		ops = append(ops, clientv3.WithRev(list.rev))
+	}
+	if list.opts.KeysOnly {
+		ops = append(ops, clientv3.WithKeysOnly())
+	}
+	resp, err := list.kv.Get(ctx, list.next, ops...)
+	if err != nil {
+		list.log.Error("etcd error: ", err)
+		return err
+	}
+
+	if list.rev == 0 && resp.Header != nil {
+		list.rev = resp.Header.Revision
+	}
+	list.kvs, list.index = resp.Kvs, 0
+	list.more = resp.More && len(resp.Kvs) > 0
+	if len(resp.Kvs) > 0 {
+		list.next = string(resp.Kvs[len(resp.Kvs)-1].Key) + "\x00"
+	}
+	return nil
+}
+
+// nextKv returns the next item of the listing, the next page is fetched
+// if needed. Nil is returned once all items are returned or an error occurs.
+func (list *pagedList) nextKv() *mvccpb.KeyValue {
+	if list.err != nil || (list.opts.Limit > 0 && list.received >= list.opts.Limit) {
+		return nil
+	}
+	if list.index >= len(list.kvs) {
+		if !list.more {
+			return nil
+		}
+		if list.err = list.fetchPage(); list.err != nil || len(list.kvs) == 0 {
+			return nil
+		}
+	}
+	kv := list.kvs[list.index]
+	list.index++
+	list.received++
+	return kv
+}
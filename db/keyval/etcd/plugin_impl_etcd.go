@@ -16,6 +16,7 @@ package etcd
 
 import (
 	"fmt"
+	"reflect"
 	"time"
 
 	"github.com/ligato/cn-infra/core"
@@ -37,6 +38,8 @@ type Plugin struct {
 	Deps
 	// Plugin is disabled if there is no config file available
 	disabled bool
+	// Currently applied configuration
+	etcdCfg *Config
 	// ETCD connection encapsulation
 	connection *BytesConnectionEtcd
 	// Read/Write proto modelled data
@@ -51,7 +54,7 @@ type Plugin struct {
 // If injected, etcd plugin will use StatusCheck to signal the connection status.
 type Deps struct {
 	local.PluginInfraDeps
-	Resync *resync.Plugin
+	Resync *resync.Plugin `inject:"reverse"` // inject (optional, triggers resync after reconnect)
 }
 
 // Init retrieves ETCD configuration and establishes a new connection
@@ -80,7 +83,12 @@ func (plugin *Plugin) Init() (err error) {
 		plugin.Log.Errorf("Err: %v", err)
 		return err
 	}
+	plugin.etcdCfg = &etcdCfg
 	plugin.reconnectResync = etcdCfg.ReconnectResync
+	if etcdCfg.WatchRevisionFile != "" {
+		// watches continue from the revisions delivered before the restart
+		plugin.connection.SetWatchRevisionStore(keyval.NewFileWatchRevisionStore(etcdCfg.WatchRevisionFile))
+	}
 	if etcdCfg.AutoCompact > 0 {
 		if etcdCfg.AutoCompact < time.Duration(time.Minute*60) {
 			plugin.Log.Warnf("Auto compact option for ETCD is set to less than 60 minutes!")
@@ -121,6 +129,47 @@ func (plugin *Plugin) Close() error {
 	return err
 }
 
+// CurrentConfig returns a copy of the currently applied configuration
+// (used by the agent to reload the configuration).
+func (plugin *Plugin) CurrentConfig() interface{} {
+	cfgCopy := Config{}
+	if plugin.etcdCfg != nil {
+		cfgCopy = *plugin.etcdCfg
+	}
+	return &cfgCopy
+}
+
+// Reload applies the new configuration of the etcd plugin. Only the endpoints
+// of the etcd cluster can be changed without restart of the plugin.
+func (plugin *Plugin) Reload(newCfg interface{}) error {
+	etcdCfg, ok := newCfg.(*Config)
+	if !ok {
+		return fmt.Errorf("unexpected type of ETCD config: %T", newCfg)
+	}
+	if plugin.disabled || plugin.connection == nil {
+		return fmt.Errorf("ETCD plugin was disabled during startup, restart needed to enable it")
+	}
+
+	// all fields except endpoints must remain the same
+	cfgCopy := *etcdCfg
+	cfgCopy.Endpoints = plugin.etcdCfg.Endpoints
+	if !reflect.DeepEqual(&cfgCopy, plugin.etcdCfg) {
+		return fmt.Errorf("only endpoints of ETCD can be changed without restart")
+	}
+
+	// resolve the endpoints the same way as during Init()
+	etcdClientCfg, err := ConfigToClient(etcdCfg)
+	if err != nil {
+		return err
+	}
+	plugin.Log.Infof("Changing ETCD endpoints to %v", etcdClientCfg.Endpoints)
+	plugin.connection.SetEndpoints(etcdClientCfg.Endpoints...)
+
+	cfgCopy = *etcdCfg
+	plugin.etcdCfg = &cfgCopy
+	return nil
+}
+
 // NewBroker creates new instance of prefixed broker that provides API with arguments of type proto.Message.
 func (plugin *Plugin) NewBroker(keyPrefix string) keyval.ProtoBroker {
 	return plugin.protoWrapper.NewBroker(keyPrefix)
@@ -131,6 +180,15 @@ func (plugin *Plugin) NewWatcher(keyPrefix string) keyval.ProtoWatcher {
 	return plugin.protoWrapper.NewWatcher(keyPrefix)
 }
 
+// RawAccess returns access to the data stored in etcd in the form of bytes
+// (nil if the plugin is disabled).
+func (plugin *Plugin) RawAccess() keyval.KvBytesPlugin {
+	if plugin.connection == nil {
+		return nil
+	}
+	return plugin.connection
+}
+
 // Disabled returns *true* if the plugin is not in use due to missing
 // etcd configuration.
 func (plugin *Plugin) Disabled() (disabled bool) {
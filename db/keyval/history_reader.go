@@ -0,0 +1,60 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keyval
+
+import (
+	"errors"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// ErrCompacted is returned by HistoryReader if the requested revision
+// is no longer available (it was compacted or dropped from the bounded
+// history of the data store).
+var ErrCompacted = errors.New("requested revision has been compacted")
+
+// ErrHistoryNotSupported is returned by ProtoHistoryReader if the underlying
+// data store does not keep the history of changes.
+var ErrHistoryNotSupported = errors.New("history of changes is not supported by the data store")
+
+// HistoryReader is implemented by connections and brokers of the data stores
+// that keep the history of changes. It allows to read past states
+// of the data store (e.g. for audit or rollback).
+type HistoryReader interface {
+	// GetValueAtRevision retrieves the item stored under the <key>
+	// at the revision <rev>. <revision> is the revision of the last
+	// modification of the item preceding <rev>.
+	GetValueAtRevision(key string, rev int64) (data []byte, found bool, revision int64, err error)
+	// ListValuesAtRevision returns an iterator that enables to traverse
+	// all items stored under the <prefix> at the revision <rev>.
+	ListValuesAtRevision(prefix string, rev int64, opts ...ListOption) (BytesKeyValIterator, error)
+	// KeyHistory returns all changes of the item stored under the <key>
+	// made in revision <fromRev> or later, from the oldest to the newest.
+	KeyHistory(key string, fromRev int64) ([]BytesWatchResp, error)
+}
+
+// ProtoHistoryReader is HistoryReader for proto-modelled data.
+type ProtoHistoryReader interface {
+	// GetValueAtRevision retrieves the item stored under the <key>
+	// at the revision <rev>. If the item existed, it is unmarshaled
+	// into the <reqObj>.
+	GetValueAtRevision(key string, rev int64, reqObj proto.Message) (found bool, revision int64, err error)
+	// ListValuesAtRevision returns an iterator that enables to traverse
+	// all items stored under the <prefix> at the revision <rev>.
+	ListValuesAtRevision(prefix string, rev int64, opts ...ListOption) (ProtoKeyValIterator, error)
+	// KeyHistory returns all changes of the item stored under the <key>
+	// made in revision <fromRev> or later, from the oldest to the newest.
+	KeyHistory(key string, fromRev int64) ([]ProtoWatchResp, error)
+}
@@ -0,0 +1,175 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvstore
+
+import (
+	"github.com/ligato/cn-infra/datasync"
+	"github.com/ligato/cn-infra/db/keyval"
+)
+
+// Store is the storage of a data store modified by the transactions.
+// The methods are called within a single atomic update of the data store.
+type Store interface {
+	// Get returns the value stored under the key and the revision
+	// of its last modification.
+	Get(key string) (value []byte, found bool, modRev int64, err error)
+
+	// Put stores the value with the revision and returns the change.
+	Put(key string, value []byte, rev int64) (*Change, error)
+
+	// Delete removes the key with the revision and returns the change
+	// (nil if the key does not exist).
+	Delete(key string, rev int64) (*Change, error)
+}
+
+// UpdateFunc applies the changes made by <apply> to the storage of the data
+// store atomically with a new revision <rev>. The revision is used and the
+// changes are delivered to the watches only if <apply> returns any change.
+type UpdateFunc func(apply func(store Store, rev int64) ([]*Change, error)) error
+
+// ApplyOps applies the operations (changes with Op, Key and Value set)
+// with the revision <rev> and returns the changes. Deletes of keys that
+// do not exist are skipped.
+func ApplyOps(store Store, ops []*Change, rev int64) ([]*Change, error) {
+	var changes []*Change
+	for _, op := range ops {
+		var ch *Change
+		var err error
+		if op.Op == datasync.Put {
+			ch, err = store.Put(op.Key, op.Value, rev)
+		} else {
+			ch, err = store.Delete(op.Key, rev)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if ch != nil {
+			changes = append(changes, ch)
+		}
+	}
+	return changes, nil
+}
+
+// Txn allows grouping operations into the transaction. All operations
+// of the transaction are applied atomically with a single revision.
+type Txn struct {
+	update UpdateFunc
+	prefix string
+	ops    []*Change
+}
+
+// NewTxn creates a new transaction applied by <update>. <prefix> is prepended
+// to the keys of all operations.
+func NewTxn(update UpdateFunc, prefix string) *Txn {
+	return &Txn{update: update, prefix: prefix}
+}
+
+// Put adds a new 'put' operation to a previously created transaction.
+// If the <key> does not exist in the data store, a new key-value item
+// will be added to the data store. If <key> exists in the data store,
+// the existing value will be overwritten with the <value> from this
+// operation.
+func (tx *Txn) Put(key string, value []byte) keyval.BytesTxn {
+	tx.ops = append(tx.ops, &Change{Op: datasync.Put, Key: tx.prefix + key, Value: value})
+	return tx
+}
+
+// Delete adds a new 'delete' operation to a previously created
+// transaction. If <key> exists in the data store, the associated value
+// will be removed.
+func (tx *Txn) Delete(key string) keyval.BytesTxn {
+	tx.ops = append(tx.ops, &Change{Op: datasync.Delete, Key: tx.prefix + key})
+	return tx
+}
+
+// Commit commits all operations in a transaction to the data store.
+// Commit is atomic - either all operations in the transaction are
+// committed to the data store, or none of them.
+func (tx *Txn) Commit() error {
+	return tx.update(func(store Store, rev int64) ([]*Change, error) {
+		return ApplyOps(store, tx.ops, rev)
+	})
+}
+
+// CondTxn is a conditional transaction. The conditions are evaluated
+// and the selected operations applied atomically with a single revision.
+type CondTxn struct {
+	update     UpdateFunc
+	prefix     string
+	conditions []keyval.TxnCondition
+	thenOps    []*Change
+	elseOps    []*Change
+}
+
+// NewCondTxn creates a new conditional transaction applied by <update>.
+// <prefix> is prepended to the keys of all conditions and operations.
+func NewCondTxn(update UpdateFunc, prefix string) *CondTxn {
+	return &CondTxn{update: update, prefix: prefix}
+}
+
+// If adds conditions into the transaction.
+func (tx *CondTxn) If(conditions ...keyval.TxnCondition) keyval.BytesCondTxn {
+	tx.conditions = append(tx.conditions, conditions...)
+	return tx
+}
+
+// Then adds operations applied if all the conditions hold.
+func (tx *CondTxn) Then(ops ...keyval.TxnOp) keyval.BytesCondTxn {
+	tx.thenOps = appendOps(tx.thenOps, tx.prefix, ops)
+	return tx
+}
+
+// Else adds operations applied if any of the conditions does not hold.
+func (tx *CondTxn) Else(ops ...keyval.TxnOp) keyval.BytesCondTxn {
+	tx.elseOps = appendOps(tx.elseOps, tx.prefix, ops)
+	return tx
+}
+
+// Commit evaluates the conditions and applies the selected operations
+// atomically with a single revision.
+func (tx *CondTxn) Commit() (succeeded bool, err error) {
+	err = tx.update(func(store Store, rev int64) ([]*Change, error) {
+		succeeded = true
+		for _, cond := range tx.conditions {
+			value, found, modRev, err := store.Get(tx.prefix + cond.Key)
+			if err != nil {
+				return nil, err
+			}
+			if !cond.Holds(value, found, modRev) {
+				succeeded = false
+				break
+			}
+		}
+		if succeeded {
+			return ApplyOps(store, tx.thenOps, rev)
+		}
+		return ApplyOps(store, tx.elseOps, rev)
+	})
+	if err != nil {
+		return false, err
+	}
+	return succeeded, nil
+}
+
+func appendOps(changes []*Change, prefix string, ops []keyval.TxnOp) []*Change {
+	for _, op := range ops {
+		if op.Delete {
+			changes = append(changes, &Change{Op: datasync.Delete, Key: prefix + op.Key})
+		} else {
+			changes = append(changes, &Change{Op: datasync.Put, Key: prefix + op.Key, Value: op.Value})
+		}
+	}
+	return changes
+}
@@ -0,0 +1,117 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvstore
+
+import (
+	"testing"
+
+	"github.com/ligato/cn-infra/datasync"
+	"github.com/ligato/cn-infra/db/keyval"
+	"github.com/onsi/gomega"
+)
+
+type item struct {
+	value  []byte
+	modRev int64
+}
+
+// mapStore is a minimal Store that counts the revision of the updates.
+type mapStore struct {
+	items    map[string]*item
+	revision int64
+}
+
+func newMapStore() *mapStore {
+	return &mapStore{items: make(map[string]*item)}
+}
+
+func (store *mapStore) Get(key string) (value []byte, found bool, modRev int64, err error) {
+	it, found := store.items[key]
+	if !found {
+		return nil, false, 0, nil
+	}
+	return it.value, true, it.modRev, nil
+}
+
+func (store *mapStore) Put(key string, value []byte, rev int64) (*Change, error) {
+	ch := &Change{Op: datasync.Put, Key: key, Value: value, Rev: rev}
+	if prev, found := store.items[key]; found {
+		ch.PrevValue, ch.PrevRev = prev.value, prev.modRev
+	}
+	store.items[key] = &item{value: value, modRev: rev}
+	return ch, nil
+}
+
+func (store *mapStore) Delete(key string, rev int64) (*Change, error) {
+	prev, found := store.items[key]
+	if !found {
+		return nil, nil
+	}
+	delete(store.items, key)
+	return &Change{Op: datasync.Delete, Key: key, PrevValue: prev.value, PrevRev: prev.modRev, Rev: rev}, nil
+}
+
+func (store *mapStore) update(apply func(store Store, rev int64) ([]*Change, error)) error {
+	changes, err := apply(store, store.revision+1)
+	if err == nil && len(changes) > 0 {
+		store.revision++
+	}
+	return err
+}
+
+func TestTxn(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	store := newMapStore()
+
+	gomega.Expect(NewTxn(store.update, "/p/").Put("a", []byte("1")).Put("b", []byte("1")).Commit()).To(gomega.Succeed())
+	gomega.Expect(store.revision).Should(gomega.BeEquivalentTo(1))
+	gomega.Expect(store.items).Should(gomega.HaveKey("/p/a"))
+	gomega.Expect(store.items["/p/b"].modRev).Should(gomega.BeEquivalentTo(1))
+
+	// deletes of missing keys are skipped
+	gomega.Expect(NewTxn(store.update, "/p/").Delete("missing").Commit()).To(gomega.Succeed())
+	gomega.Expect(store.revision).Should(gomega.BeEquivalentTo(1))
+	gomega.Expect(NewTxn(store.update, "/p/").Delete("a").Put("b", []byte("2")).Commit()).To(gomega.Succeed())
+	gomega.Expect(store.revision).Should(gomega.BeEquivalentTo(2))
+	gomega.Expect(store.items).ShouldNot(gomega.HaveKey("/p/a"))
+	gomega.Expect(string(store.items["/p/b"].value)).Should(gomega.Equal("2"))
+}
+
+func TestCondTxn(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	store := newMapStore()
+	gomega.Expect(NewTxn(store.update, "").Put("/p/a", []byte("1")).Commit()).To(gomega.Succeed())
+
+	succeeded, err := NewCondTxn(store.update, "/p/").
+		If(keyval.RevEquals("a", 1), keyval.Missing("b"), keyval.ValueEquals("a", []byte("1"))).
+		Then(keyval.OpPut("b", []byte("1"))).
+		Else(keyval.OpDelete("a")).
+		Commit()
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	gomega.Expect(succeeded).Should(gomega.BeTrue())
+	gomega.Expect(store.items).Should(gomega.HaveKey("/p/a"))
+	gomega.Expect(store.items).Should(gomega.HaveKey("/p/b"))
+
+	succeeded, err = NewCondTxn(store.update, "/p/").
+		If(keyval.Missing("b")).
+		Then(keyval.OpPut("c", []byte("1"))).
+		Else(keyval.OpDelete("a")).
+		Commit()
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	gomega.Expect(succeeded).Should(gomega.BeFalse())
+	gomega.Expect(store.items).ShouldNot(gomega.HaveKey("/p/a"))
+	gomega.Expect(store.items).ShouldNot(gomega.HaveKey("/p/c"))
+	gomega.Expect(store.revision).Should(gomega.BeEquivalentTo(3))
+}
@@ -0,0 +1,249 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvstore
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/ligato/cn-infra/datasync"
+	"github.com/ligato/cn-infra/db/keyval"
+	"github.com/ligato/cn-infra/logging"
+)
+
+// Change is a single change of the data store delivered to the watches.
+type Change struct {
+	Op        datasync.PutDel
+	Key       string
+	Value     []byte
+	PrevValue []byte
+	Rev       int64
+	// PrevRev is the revision of the previous modification (0 if the key did not exist).
+	PrevRev int64
+}
+
+// WatchResp converts the change into the watch event with <trimPrefix>
+// removed from the key. Every call returns its own copy of the values.
+func (ch *Change) WatchResp(trimPrefix string) keyval.BytesWatchResp {
+	key := strings.TrimPrefix(ch.Key, trimPrefix)
+	prevValue := append([]byte(nil), ch.PrevValue...)
+	if ch.Op == datasync.Delete {
+		return NewBytesWatchDelResp(key, prevValue, ch.Rev)
+	}
+	return NewBytesWatchPutResp(key, append([]byte(nil), ch.Value...), prevValue, ch.Rev)
+}
+
+// BytesWatchPutResp is sent when new key-value pair has been inserted
+// or the value has been updated.
+type BytesWatchPutResp struct {
+	key       string
+	value     []byte
+	prevValue []byte
+	rev       int64
+}
+
+// NewBytesWatchPutResp creates an instance of BytesWatchPutResp.
+func NewBytesWatchPutResp(key string, value []byte, prevValue []byte, revision int64) *BytesWatchPutResp {
+	return &BytesWatchPutResp{key: key, value: value, prevValue: prevValue, rev: revision}
+}
+
+// GetChangeType returns "Put" for BytesWatchPutResp.
+func (resp *BytesWatchPutResp) GetChangeType() datasync.PutDel {
+	return datasync.Put
+}
+
+// GetKey returns the key that the value has been inserted under.
+func (resp *BytesWatchPutResp) GetKey() string {
+	return resp.key
+}
+
+// GetValue returns the value that has been inserted.
+func (resp *BytesWatchPutResp) GetValue() []byte {
+	return resp.value
+}
+
+// GetPrevValue returns the previous value that has been inserted.
+func (resp *BytesWatchPutResp) GetPrevValue() []byte {
+	return resp.prevValue
+}
+
+// GetRevision returns the revision associated with the 'put' operation.
+func (resp *BytesWatchPutResp) GetRevision() int64 {
+	return resp.rev
+}
+
+// BytesWatchDelResp is sent when a key-value pair has been removed.
+type BytesWatchDelResp struct {
+	key       string
+	prevValue []byte
+	rev       int64
+}
+
+// NewBytesWatchDelResp creates an instance of BytesWatchDelResp.
+func NewBytesWatchDelResp(key string, prevValue []byte, revision int64) *BytesWatchDelResp {
+	return &BytesWatchDelResp{key: key, prevValue: prevValue, rev: revision}
+}
+
+// GetChangeType returns "Delete" for BytesWatchPutResp.
+func (resp *BytesWatchDelResp) GetChangeType() datasync.PutDel {
+	return datasync.Delete
+}
+
+// GetKey returns the key that a value has been deleted from.
+func (resp *BytesWatchDelResp) GetKey() string {
+	return resp.key
+}
+
+// GetValue returns nil for BytesWatchDelResp.
+func (resp *BytesWatchDelResp) GetValue() []byte {
+	return nil
+}
+
+// GetPrevValue returns previous value for BytesWatchDelResp.
+func (resp *BytesWatchDelResp) GetPrevValue() []byte {
+	return resp.prevValue
+}
+
+// GetRevision returns the revision associated with the 'delete' operation.
+func (resp *BytesWatchDelResp) GetRevision() int64 {
+	return resp.rev
+}
+
+// Watches holds the watches of a data store. The changes are queued
+// by Notify() and delivered to the callback of every watch from a separate
+// goroutine in the order of the changes.
+type Watches struct {
+	log logging.Logger
+
+	access  sync.Mutex
+	watches map[int]*watch
+	lastID  int
+	closeCh chan struct{}
+}
+
+// watch is a subscription for changes of the keys with the given prefix.
+type watch struct {
+	key        string
+	trimPrefix string
+	resp       func(keyval.BytesWatchResp)
+
+	access  sync.Mutex
+	queue   []*Change
+	pending chan struct{}
+}
+
+// NewWatches creates an empty set of watches.
+func NewWatches(log logging.Logger) *Watches {
+	return &Watches{
+		log:     log,
+		watches: make(map[int]*watch),
+		closeCh: make(chan struct{}),
+	}
+}
+
+// Watch registers a new watch for each of the <keys> (prefixes). The watch
+// ends once the key is sent to (or once the) <closeCh> is closed, or once
+// the watches are closed.
+func (ws *Watches) Watch(trimPrefix string, resp func(keyval.BytesWatchResp), closeCh chan string, keys ...string) {
+	ws.access.Lock()
+	defer ws.access.Unlock()
+
+	for _, key := range keys {
+		w := &watch{
+			key:        trimPrefix + key,
+			trimPrefix: trimPrefix,
+			resp:       resp,
+			pending:    make(chan struct{}, 1),
+		}
+		ws.lastID++
+		ws.watches[ws.lastID] = w
+		go ws.watchLoop(ws.lastID, w, closeCh, key)
+	}
+}
+
+// Notify queues the changes for all watches of the changed keys. The data
+// store must serialize the calls so that the watches receive the changes
+// in the order of revisions.
+func (ws *Watches) Notify(changes ...*Change) {
+	ws.access.Lock()
+	defer ws.access.Unlock()
+
+	for _, w := range ws.watches {
+		for _, ch := range changes {
+			if strings.HasPrefix(ch.Key, w.key) {
+				w.enqueue(ch)
+			}
+		}
+	}
+}
+
+// Len returns the number of active watches.
+func (ws *Watches) Len() int {
+	ws.access.Lock()
+	defer ws.access.Unlock()
+
+	return len(ws.watches)
+}
+
+// Close ends all watches.
+func (ws *Watches) Close() {
+	close(ws.closeCh)
+}
+
+// watchLoop delivers the changes of the watched key until the <closeCh>
+// receives the registered key (or is closed) or the watches are closed.
+func (ws *Watches) watchLoop(id int, w *watch, closeCh chan string, registeredKey string) {
+	defer func() {
+		ws.access.Lock()
+		delete(ws.watches, id)
+		ws.access.Unlock()
+	}()
+	for {
+		select {
+		case <-w.pending:
+			for _, ch := range w.takeQueue() {
+				w.resp(ch.WatchResp(w.trimPrefix))
+			}
+		case closeVal, ok := <-closeCh:
+			if !ok || closeVal == registeredKey {
+				ws.log.WithField("prefix", w.key).Debug("Watch ended")
+				return
+			}
+		case <-ws.closeCh:
+			return
+		}
+	}
+}
+
+func (w *watch) enqueue(ch *Change) {
+	w.access.Lock()
+	w.queue = append(w.queue, ch)
+	w.access.Unlock()
+
+	select {
+	case w.pending <- struct{}{}:
+	default:
+		// the goroutine has not consumed the previous signal yet
+	}
+}
+
+func (w *watch) takeQueue() []*Change {
+	w.access.Lock()
+	defer w.access.Unlock()
+
+	queue := w.queue
+	w.queue = nil
+	return queue
+}
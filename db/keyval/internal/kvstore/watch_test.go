@@ -0,0 +1,59 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvstore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ligato/cn-infra/datasync"
+	"github.com/ligato/cn-infra/db/keyval"
+	"github.com/ligato/cn-infra/logging/logrus"
+	"github.com/onsi/gomega"
+)
+
+func TestWatches(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	ws := NewWatches(logrus.DefaultLogger())
+	defer ws.Close()
+
+	received := make(chan keyval.BytesWatchResp, 10)
+	closeCh := make(chan string)
+	ws.Watch("/p/", func(resp keyval.BytesWatchResp) { received <- resp }, closeCh, "a")
+	gomega.Expect(ws.Len()).Should(gomega.Equal(1))
+
+	value := []byte("1")
+	ws.Notify(
+		&Change{Op: datasync.Put, Key: "/p/a1", Value: value, Rev: 1},
+		&Change{Op: datasync.Put, Key: "/p/b", Value: value, Rev: 1},
+		&Change{Op: datasync.Delete, Key: "/p/a2", PrevValue: value, Rev: 2},
+	)
+	var resp keyval.BytesWatchResp
+	gomega.Eventually(received).Should(gomega.Receive(&resp))
+	gomega.Expect(resp.GetKey()).Should(gomega.Equal("a1"))
+	gomega.Expect(resp.GetChangeType()).Should(gomega.Equal(datasync.Put))
+	// the watch receives copies of the values
+	resp.GetValue()[0] = '2'
+	gomega.Expect(string(value)).Should(gomega.Equal("1"))
+	gomega.Eventually(received).Should(gomega.Receive(&resp))
+	gomega.Expect(resp.GetKey()).Should(gomega.Equal("a2"))
+	gomega.Expect(resp.GetChangeType()).Should(gomega.Equal(datasync.Delete))
+	gomega.Expect(resp.GetRevision()).Should(gomega.BeEquivalentTo(2))
+	gomega.Consistently(received, 50*time.Millisecond).ShouldNot(gomega.Receive())
+
+	// the watch ends once its key is sent to the close channel
+	closeCh <- "a"
+	gomega.Eventually(ws.Len).Should(gomega.BeZero())
+}
@@ -15,6 +15,8 @@
 package kvproto
 
 import (
+	"io"
+
 	"github.com/golang/protobuf/proto"
 	"github.com/ligato/cn-infra/datasync"
 	"github.com/ligato/cn-infra/db/keyval"
@@ -99,6 +101,20 @@ func (pdb *protoBroker) NewTxn() keyval.ProtoTxn {
 	return &protoTxn{txn: pdb.broker.NewTxn(), serializer: pdb.serializer}
 }
 
+// NewCondTxn creates a new conditional transaction. Commit of the transaction
+// fails with keyval.ErrCondTxnNotSupported if the underlying data store does
+// not support conditional transactions.
+func (db *ProtoWrapper) NewCondTxn() keyval.ProtoCondTxn {
+	return newProtoCondTxn(db.broker, db.serializer)
+}
+
+// NewCondTxn creates a new conditional transaction. Commit of the transaction
+// fails with keyval.ErrCondTxnNotSupported if the underlying data store does
+// not support conditional transactions.
+func (pdb *protoBroker) NewCondTxn() keyval.ProtoCondTxn {
+	return newProtoCondTxn(pdb.broker, pdb.serializer)
+}
+
 // Put writes the provided key-value item into the data store.
 // It returns an error if the item could not be written, nil otherwise.
 func (db *ProtoWrapper) Put(key string, value proto.Message, opts ...datasync.PutOption) error {
@@ -186,17 +202,18 @@ func getValueProtoInternal(broker keyval.BytesBroker, serializer keyval.Serializ
 }
 
 // ListValues retrieves an iterator for elements stored under the provided <key>.
-func (db *ProtoWrapper) ListValues(key string) (keyval.ProtoKeyValIterator, error) {
-	return listValuesProtoInternal(db.broker, db.serializer, key)
+func (db *ProtoWrapper) ListValues(key string, opts ...keyval.ListOption) (keyval.ProtoKeyValIterator, error) {
+	return listValuesProtoInternal(db.broker, db.serializer, key, opts...)
 }
 
 // ListValues retrieves an iterator for elements stored under the provided <key>.
-func (pdb *protoBroker) ListValues(key string) (keyval.ProtoKeyValIterator, error) {
-	return listValuesProtoInternal(pdb.broker, pdb.serializer, key)
+func (pdb *protoBroker) ListValues(key string, opts ...keyval.ListOption) (keyval.ProtoKeyValIterator, error) {
+	return listValuesProtoInternal(pdb.broker, pdb.serializer, key, opts...)
 }
 
-func listValuesProtoInternal(broker keyval.BytesBroker, serializer keyval.Serializer, key string) (keyval.ProtoKeyValIterator, error) {
-	ctx, err := broker.ListValues(key)
+func listValuesProtoInternal(broker keyval.BytesBroker, serializer keyval.Serializer, key string,
+	opts ...keyval.ListOption) (keyval.ProtoKeyValIterator, error) {
+	ctx, err := broker.ListValues(key, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -205,28 +222,28 @@ func listValuesProtoInternal(broker keyval.BytesBroker, serializer keyval.Serial
 
 // ListKeys returns an iterator that allows to traverse all keys that share the given <prefix>
 // from data store.
-func (db *ProtoWrapper) ListKeys(prefix string) (keyval.ProtoKeyIterator, error) {
-	return listKeysProtoInternal(db.broker, prefix)
+func (db *ProtoWrapper) ListKeys(prefix string, opts ...keyval.ListOption) (keyval.ProtoKeyIterator, error) {
+	return listKeysProtoInternal(db.broker, prefix, opts...)
 }
 
 // ListKeys returns an iterator that allows to traverse all keys that share the given <prefix>
 // from data store.
-func (pdb *protoBroker) ListKeys(prefix string) (keyval.ProtoKeyIterator, error) {
-	return listKeysProtoInternal(pdb.broker, prefix)
+func (pdb *protoBroker) ListKeys(prefix string, opts ...keyval.ListOption) (keyval.ProtoKeyIterator, error) {
+	return listKeysProtoInternal(pdb.broker, prefix, opts...)
 }
 
-func listKeysProtoInternal(broker keyval.BytesBroker, prefix string) (keyval.ProtoKeyIterator, error) {
-	ctx, err := broker.ListKeys(prefix)
+func listKeysProtoInternal(broker keyval.BytesBroker, prefix string, opts ...keyval.ListOption) (keyval.ProtoKeyIterator, error) {
+	ctx, err := broker.ListKeys(prefix, opts...)
 	if err != nil {
 		return nil, err
 	}
 	return &protoKeyIterator{ctx}, nil
 }
 
-// Close does nothing since db cursors are not needed.
-// The method is required by the code since it implements Iterator API.
+// Close returns the error that stopped the underlying iterator (if any)
+// while fetching the items from the data store.
 func (ctx *protoKeyValIterator) Close() error {
-	return nil
+	return closeIterator(ctx.delegate)
 }
 
 // GetNext returns the following item from the result set.
@@ -241,9 +258,17 @@ func (ctx *protoKeyValIterator) GetNext() (kv keyval.ProtoKeyVal, stop bool) {
 	return &protoKeyVal{pair, ctx.serializer}, stop
 }
 
-// Close does nothing since db cursors are not needed.
-// The method is required in the code since it implements Iterator API.
+// Close returns the error that stopped the underlying iterator (if any)
+// while fetching the keys from the data store.
 func (ctx *protoKeyIterator) Close() error {
+	return closeIterator(ctx.delegate)
+}
+
+// closeIterator closes the iterator of the bytes broker if it is an io.Closer.
+func closeIterator(it interface{}) error {
+	if closer, ok := it.(io.Closer); ok {
+		return closer.Close()
+	}
 	return nil
 }
 
@@ -0,0 +1,104 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kvproto
+
+import (
+	"github.com/golang/protobuf/proto"
+	"github.com/ligato/cn-infra/db/keyval"
+)
+
+// GetValueAtRevision retrieves the item stored under the <key> at the revision
+// <rev>. If the item existed, its value is unmarshaled into the <reqObj>.
+// keyval.ErrHistoryNotSupported is returned if the underlying data store
+// does not keep the history of changes.
+func (db *ProtoWrapper) GetValueAtRevision(key string, rev int64, reqObj proto.Message) (found bool, revision int64, err error) {
+	return getValueAtRevisionProtoInternal(db.broker, db.serializer, key, rev, reqObj)
+}
+
+// GetValueAtRevision retrieves the item stored under the <key> at the revision
+// <rev>. If the item existed, its value is unmarshaled into the <reqObj>.
+func (pdb *protoBroker) GetValueAtRevision(key string, rev int64, reqObj proto.Message) (found bool, revision int64, err error) {
+	return getValueAtRevisionProtoInternal(pdb.broker, pdb.serializer, key, rev, reqObj)
+}
+
+func getValueAtRevisionProtoInternal(broker keyval.BytesBroker, serializer keyval.Serializer, key string, rev int64,
+	reqObj proto.Message) (found bool, revision int64, err error) {
+	history, ok := broker.(keyval.HistoryReader)
+	if !ok {
+		return false, 0, keyval.ErrHistoryNotSupported
+	}
+	data, found, revision, err := history.GetValueAtRevision(key, rev)
+	if err != nil || !found {
+		return false, 0, err
+	}
+	if err = serializer.Unmarshal(data, reqObj); err != nil {
+		return false, 0, err
+	}
+	return true, revision, nil
+}
+
+// ListValuesAtRevision retrieves an iterator for elements stored under
+// the provided <prefix> at the revision <rev>.
+func (db *ProtoWrapper) ListValuesAtRevision(prefix string, rev int64, opts ...keyval.ListOption) (keyval.ProtoKeyValIterator, error) {
+	return listValuesAtRevisionProtoInternal(db.broker, db.serializer, prefix, rev, opts...)
+}
+
+// ListValuesAtRevision retrieves an iterator for elements stored under
+// the provided <prefix> at the revision <rev>.
+func (pdb *protoBroker) ListValuesAtRevision(prefix string, rev int64, opts ...keyval.ListOption) (keyval.ProtoKeyValIterator, error) {
+	return listValuesAtRevisionProtoInternal(pdb.broker, pdb.serializer, prefix, rev, opts...)
+}
+
+func listValuesAtRevisionProtoInternal(broker keyval.BytesBroker, serializer keyval.Serializer, prefix string, rev int64,
+	opts ...keyval.ListOption) (keyval.ProtoKeyValIterator, error) {
+	history, ok := broker.(keyval.HistoryReader)
+	if !ok {
+		return nil, keyval.ErrHistoryNotSupported
+	}
+	ctx, err := history.ListValuesAtRevision(prefix, rev, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &protoKeyValIterator{ctx, serializer}, nil
+}
+
+// KeyHistory returns the changes of the item stored under the <key> made
+// in the revision <fromRev> or later (from the oldest to the newest).
+func (db *ProtoWrapper) KeyHistory(key string, fromRev int64) ([]keyval.ProtoWatchResp, error) {
+	return keyHistoryProtoInternal(db.broker, db.serializer, key, fromRev)
+}
+
+// KeyHistory returns the changes of the item stored under the <key> made
+// in the revision <fromRev> or later (from the oldest to the newest).
+func (pdb *protoBroker) KeyHistory(key string, fromRev int64) ([]keyval.ProtoWatchResp, error) {
+	return keyHistoryProtoInternal(pdb.broker, pdb.serializer, key, fromRev)
+}
+
+func keyHistoryProtoInternal(broker keyval.BytesBroker, serializer keyval.Serializer, key string,
+	fromRev int64) ([]keyval.ProtoWatchResp, error) {
+	history, ok := broker.(keyval.HistoryReader)
+	if !ok {
+		return nil, keyval.ErrHistoryNotSupported
+	}
+	changes, err := history.KeyHistory(key, fromRev)
+	if err != nil {
+		return nil, err
+	}
+	protoChanges := make([]keyval.ProtoWatchResp, 0, len(changes))
+	for _, change := range changes {
+		protoChanges = append(protoChanges, NewWatchResp(serializer, change))
+	}
+	return protoChanges, nil
+}
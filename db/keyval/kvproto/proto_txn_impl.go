@@ -66,3 +66,98 @@ func (tx *protoTxn) Commit() error {
 	}
 	return tx.txn.Commit()
 }
+
+// protoCondTxn represents a conditional transaction.
+type protoCondTxn struct {
+	serializer keyval.Serializer
+	err        error
+	txn        keyval.BytesCondTxn
+}
+
+// newProtoCondTxn creates a conditional transaction on top of the broker
+// (fails on Commit() if the broker does not support conditional transactions).
+func newProtoCondTxn(broker keyval.BytesBroker, serializer keyval.Serializer) keyval.ProtoCondTxn {
+	condBroker, ok := broker.(keyval.BytesCondTxnBroker)
+	if !ok {
+		return &protoCondTxn{err: keyval.ErrCondTxnNotSupported}
+	}
+	return &protoCondTxn{txn: condBroker.NewCondTxn(), serializer: serializer}
+}
+
+// If adds conditions into the transaction. The values of the conditions
+// created by keyval.ProtoValueEquals() are serialized.
+func (tx *protoCondTxn) If(conditions ...keyval.TxnCondition) keyval.ProtoCondTxn {
+	if tx.err != nil {
+		return tx
+	}
+
+	// do not modify the conditions of the caller
+	conditions = append([]keyval.TxnCondition(nil), conditions...)
+	for i := range conditions {
+		if conditions[i].ProtoValue == nil {
+			continue
+		}
+		binData, err := tx.serializer.Marshal(conditions[i].ProtoValue)
+		if err != nil {
+			tx.err = err
+			return tx
+		}
+		conditions[i].Value = binData
+	}
+	tx.txn = tx.txn.If(conditions...)
+	return tx
+}
+
+// Then adds operations applied if all the conditions hold.
+func (tx *protoCondTxn) Then(ops ...keyval.ProtoTxnOp) keyval.ProtoCondTxn {
+	if tx.err != nil {
+		return tx
+	}
+
+	bytesOps, err := tx.marshalOps(ops)
+	if err != nil {
+		tx.err = err
+		return tx
+	}
+	tx.txn = tx.txn.Then(bytesOps...)
+	return tx
+}
+
+// Else adds operations applied if any of the conditions does not hold.
+func (tx *protoCondTxn) Else(ops ...keyval.ProtoTxnOp) keyval.ProtoCondTxn {
+	if tx.err != nil {
+		return tx
+	}
+
+	bytesOps, err := tx.marshalOps(ops)
+	if err != nil {
+		tx.err = err
+		return tx
+	}
+	tx.txn = tx.txn.Else(bytesOps...)
+	return tx
+}
+
+// Commit evaluates the conditions and applies the selected operations.
+func (tx *protoCondTxn) Commit() (succeeded bool, err error) {
+	if tx.err != nil {
+		return false, tx.err
+	}
+	return tx.txn.Commit()
+}
+
+func (tx *protoCondTxn) marshalOps(ops []keyval.ProtoTxnOp) ([]keyval.TxnOp, error) {
+	bytesOps := make([]keyval.TxnOp, 0, len(ops))
+	for _, op := range ops {
+		if op.Delete {
+			bytesOps = append(bytesOps, keyval.OpDelete(op.Key))
+			continue
+		}
+		binData, err := tx.serializer.Marshal(op.Value)
+		if err != nil {
+			return nil, err
+		}
+		bytesOps = append(bytesOps, keyval.OpPut(op.Key, binData))
+	}
+	return bytesOps, nil
+}
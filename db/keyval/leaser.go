@@ -0,0 +1,63 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keyval
+
+import (
+	"time"
+
+	"github.com/ligato/cn-infra/datasync"
+)
+
+// LeaseID identifies a lease granted by Leaser.
+type LeaseID string
+
+// Leaser is implemented by connections and brokers of the data stores that
+// support leases. Items put with WithLease() option are bound to the lease:
+// they are removed once the lease expires or is revoked. A lease kept alive
+// by an agent therefore allows to publish items (e.g. the agent status)
+// that disappear when the agent dies.
+type Leaser interface {
+	// GrantLease creates a new lease that expires after <ttl>
+	// unless it is kept alive.
+	GrantLease(ttl time.Duration) (LeaseID, error)
+	// KeepAlive keeps the lease alive in the background until the lease
+	// is revoked or the connection is closed.
+	KeepAlive(id LeaseID) error
+	// Revoke revokes the lease, all items bound to the lease are removed.
+	Revoke(id LeaseID) error
+}
+
+// WithLeaseOpt binds the item written by Put operation to a lease
+// granted by Leaser.
+type WithLeaseOpt struct {
+	datasync.PutOptionMarker
+	LeaseID LeaseID
+}
+
+// WithLease creates a new instance of WithLeaseOpt.
+func WithLease(id LeaseID) *WithLeaseOpt {
+	return &WithLeaseOpt{LeaseID: id}
+}
+
+// PutLease returns the lease selected by WithLease option among the put <opts>.
+// <found> is false if there is no such option.
+func PutLease(opts ...datasync.PutOption) (id LeaseID, found bool) {
+	for _, o := range opts {
+		if opt, ok := o.(*WithLeaseOpt); ok {
+			id, found = opt.LeaseID, true
+		}
+	}
+	return id, found
+}
@@ -0,0 +1,156 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keyval
+
+import (
+	"sort"
+	"strings"
+)
+
+// ListOption defines options for ListValues and ListKeys operations.
+type ListOption interface {
+	// ListOptionMark is used only to mark structures implementing ListOption
+	// interface.
+	ListOptionMark()
+}
+
+// ListOptionMarker is meant for anonymous composition in With*Opt structs.
+type ListOptionMarker struct{}
+
+// ListOptionMark is used only to mark structures implementing ListOption
+// interface.
+func (marker *ListOptionMarker) ListOptionMark() {}
+
+// WithLimitOpt limits the number of items returned by the iterator.
+type WithLimitOpt struct {
+	ListOptionMarker
+	Limit int
+}
+
+// WithLimit creates a new instance of WithLimitOpt.
+// The iterator stops after <limit> items (0 means no limit).
+func WithLimit(limit int) *WithLimitOpt {
+	return &WithLimitOpt{Limit: limit}
+}
+
+// WithStartAfterOpt starts the listing after the given key.
+type WithStartAfterOpt struct {
+	ListOptionMarker
+	Key string
+}
+
+// WithStartAfter creates a new instance of WithStartAfterOpt.
+// Only the items with keys greater than <key> are returned, i.e. passing
+// the last key of the previous page continues with the next page.
+func WithStartAfter(key string) *WithStartAfterOpt {
+	return &WithStartAfterOpt{Key: key}
+}
+
+// WithKeysOnlyOpt lists the keys (and revisions) without the values.
+type WithKeysOnlyOpt struct {
+	ListOptionMarker
+}
+
+// WithKeysOnly creates a new instance of WithKeysOnlyOpt.
+// The items returned by ListValues have nil values.
+func WithKeysOnly() *WithKeysOnlyOpt {
+	return &WithKeysOnlyOpt{}
+}
+
+// WithPageSizeOpt makes the iterator fetch the items from the data store
+// in pages of the given size on demand. Without the option the items are
+// listed by a single request (if the data store supports it).
+type WithPageSizeOpt struct {
+	ListOptionMarker
+	PageSize int
+}
+
+// WithPageSize creates a new instance of WithPageSizeOpt.
+func WithPageSize(pageSize int) *WithPageSizeOpt {
+	return &WithPageSizeOpt{PageSize: pageSize}
+}
+
+// ListOptions groups the values of the options of ListValues and ListKeys.
+type ListOptions struct {
+	// Limit of the number of returned items (0 means no limit).
+	Limit int
+	// StartAfter is the key after which the listing starts ("" lists all keys).
+	StartAfter string
+	// KeysOnly is true if the values are not requested.
+	KeysOnly bool
+	// PageSize is the number of items fetched at once (0 means all items
+	// by a single request).
+	PageSize int
+}
+
+// ParseListOptions returns the values of the list <opts>.
+func ParseListOptions(opts ...ListOption) ListOptions {
+	var options ListOptions
+	for _, o := range opts {
+		switch opt := o.(type) {
+		case *WithLimitOpt:
+			options.Limit = opt.Limit
+		case *WithStartAfterOpt:
+			options.StartAfter = opt.Key
+		case *WithKeysOnlyOpt:
+			options.KeysOnly = true
+		case *WithPageSizeOpt:
+			if opt.PageSize > 0 {
+				options.PageSize = opt.PageSize
+			}
+		}
+	}
+	return options
+}
+
+// RangeStart returns the first key of the listing: <from> or the key
+// following StartAfter (with <keyPrefix> of the broker prepended) if it is
+// greater.
+func (opts ListOptions) RangeStart(keyPrefix, from string) string {
+	if opts.StartAfter == "" {
+		return from
+	}
+	if start := keyPrefix + opts.StartAfter + "\x00"; start > from {
+		return start
+	}
+	return from
+}
+
+// NextPageSize returns the number of items to fetch in the next page
+// once <received> items were returned (0 means all remaining items).
+func (opts ListOptions) NextPageSize(received int) int {
+	if opts.Limit > 0 && (opts.PageSize == 0 || opts.Limit-received < opts.PageSize) {
+		return opts.Limit - received
+	}
+	return opts.PageSize
+}
+
+// SelectKeys sorts the <keys> and returns those that follow StartAfter,
+// at most Limit of them. <trimPrefix> (prefix of the broker) is removed
+// from the keys before they are compared with StartAfter. It is used by
+// the data stores that cannot list the keys in order.
+func (opts ListOptions) SelectKeys(keys []string, trimPrefix string) []string {
+	sort.Strings(keys)
+	var selected []string
+	for _, key := range keys {
+		if opts.Limit > 0 && len(selected) == opts.Limit {
+			break
+		}
+		if opts.StartAfter == "" || strings.TrimPrefix(key, trimPrefix) > opts.StartAfter {
+			selected = append(selected, key)
+		}
+	}
+	return selected
+}
@@ -0,0 +1,528 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mem
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ligato/cn-infra/datasync"
+	"github.com/ligato/cn-infra/db/keyval"
+	"github.com/ligato/cn-infra/db/keyval/internal/kvstore"
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+)
+
+// ErrClosed is returned by the operations of a closed data store.
+var ErrClosed = errors.New("in-memory data store is closed")
+
+// BytesConnectionMem is an in-memory key-value data store.
+// It provides API to read/edit and watch values.
+type BytesConnectionMem struct {
+	logging.Logger
+
+	access   sync.Mutex
+	closed   bool
+	revision int64 // incremented by every change
+	items    map[string]*item
+	watches  *kvstore.Watches
+	history  history // recent changes for HistoryReader
+}
+
+// BytesBrokerWatcherMem uses BytesConnectionMem to access the data store.
+// BytesBrokerWatcherMem allows defining a keyPrefix that is prepended
+// to all keys in its methods in order to shorten keys used in arguments.
+type BytesBrokerWatcherMem struct {
+	db     *BytesConnectionMem
+	prefix string
+}
+
+// item is a value stored under a key.
+type item struct {
+	value     []byte
+	createRev int64
+	modRev    int64
+	// expires the item put with TTL
+	expiration *time.Timer
+}
+
+// bytesKeyValIterator is an iterator returned by ListValues call.
+type bytesKeyValIterator struct {
+	index int
+	kvs   []*bytesKeyVal
+}
+
+// bytesKeyIterator is an iterator returned by ListKeys call.
+type bytesKeyIterator struct {
+	index int
+	kvs   []*bytesKeyVal
+}
+
+// bytesKeyVal represents a single key-value pair.
+type bytesKeyVal struct {
+	key       string
+	value     []byte
+	prevValue []byte
+	revision  int64
+}
+
+// NewBytesConnectionMem creates a new empty in-memory data store.
+func NewBytesConnectionMem(log logging.Logger) *BytesConnectionMem {
+	if log == nil {
+		log = logrus.DefaultLogger()
+	}
+	return &BytesConnectionMem{
+		Logger:  log,
+		items:   make(map[string]*item),
+		watches: kvstore.NewWatches(log),
+		history: history{size: DefaultHistorySize},
+	}
+}
+
+// Close stops all watches. The data store cannot be used anymore.
+func (db *BytesConnectionMem) Close() error {
+	db.access.Lock()
+	defer db.access.Unlock()
+
+	if db.closed {
+		return nil
+	}
+	db.closed = true
+	for _, it := range db.items {
+		it.stopExpiration()
+	}
+	db.watches.Close()
+	return nil
+}
+
+// NewBroker creates a new instance of a proxy that provides access
+// to the data store. <prefix> will be prepended to the key argument in all
+// calls from the created BytesBrokerWatcherMem. To avoid using a prefix,
+// pass keyval.Root constant as an argument.
+func (db *BytesConnectionMem) NewBroker(prefix string) keyval.BytesBroker {
+	return &BytesBrokerWatcherMem{db: db, prefix: prefix}
+}
+
+// NewWatcher creates a new instance of a proxy that provides access
+// to the data store. <prefix> will be prepended to the key argument in all
+// calls on created BytesBrokerWatcherMem and removed from the keys
+// of the watch events. To avoid using a prefix, pass keyval.Root constant
+// as an argument.
+func (db *BytesConnectionMem) NewWatcher(prefix string) keyval.BytesWatcher {
+	return &BytesBrokerWatcherMem{db: db, prefix: prefix}
+}
+
+// Put writes the provided key-value item into the data store.
+// If datasync.WithTTL() option is used, the item is removed once the TTL expires.
+// If datasync.WithExpectedRevision() or datasync.WithCreateOnly() option is used
+// and the item was modified in the meantime, keyval.ErrRevisionMismatch is returned.
+func (db *BytesConnectionMem) Put(key string, data []byte, opts ...datasync.PutOption) error {
+	return db.put(key, data, opts...)
+}
+
+// Delete removes data identified by the <key> (or all keys with the prefix
+// <key> if datasync.WithPrefix() option is used).
+// If datasync.WithExpectedRevision() option is used and the item under
+// the <key> was modified in the meantime, keyval.ErrRevisionMismatch is returned.
+func (db *BytesConnectionMem) Delete(key string, opts ...datasync.DelOption) (existed bool, err error) {
+	return db.delete(key, opts...)
+}
+
+// GetValue retrieves one key-value item from the data store. The item
+// is identified by the provided <key>.
+func (db *BytesConnectionMem) GetValue(key string) (data []byte, found bool, revision int64, err error) {
+	return db.getValue(key)
+}
+
+// ListValues returns an iterator that enables traversing values stored under
+// the provided <key> (prefix) in the lexical order of the keys.
+// The iterator is a snapshot of the items taken when ListValues is called.
+func (db *BytesConnectionMem) ListValues(key string, opts ...keyval.ListOption) (keyval.BytesKeyValIterator, error) {
+	return db.listValues(keyval.Root, key, prefixEnd(key), keyval.ParseListOptions(opts...))
+}
+
+// ListKeys returns an iterator that allows traversing all keys from data
+// store that share the given <prefix>.
+func (db *BytesConnectionMem) ListKeys(prefix string, opts ...keyval.ListOption) (keyval.BytesKeyIterator, error) {
+	return db.listKeys(keyval.Root, prefix, keyval.ParseListOptions(opts...))
+}
+
+// ListValuesRange returns an iterator that enables traversing values stored
+// under the keys from the range [fromPrefix, toPrefix). Empty <toPrefix>
+// means no upper bound.
+func (db *BytesConnectionMem) ListValuesRange(fromPrefix string, toPrefix string) (keyval.BytesKeyValIterator, error) {
+	return db.listValues(keyval.Root, fromPrefix, toPrefix, keyval.ParseListOptions())
+}
+
+// NewTxn creates a new transaction. All operations of the transaction
+// are applied atomically with a single revision.
+func (db *BytesConnectionMem) NewTxn() keyval.BytesTxn {
+	return kvstore.NewTxn(db.update, keyval.Root)
+}
+
+// NewCondTxn creates a new conditional transaction. The conditions are
+// evaluated and the selected operations applied atomically with a single
+// revision.
+func (db *BytesConnectionMem) NewCondTxn() keyval.BytesCondTxn {
+	return kvstore.NewCondTxn(db.update, keyval.Root)
+}
+
+// Watch starts subscription for changes associated with the selected keys
+// (prefixes). Watch events will be delivered to <resp> callback
+// (in the order of the changes, from a separate goroutine).
+// Watching of a key ends once the key is sent to (or once the) <closeChan> is closed.
+func (db *BytesConnectionMem) Watch(resp func(keyval.BytesWatchResp), closeChan chan string, keys ...string) error {
+	return db.watch(keyval.Root, resp, closeChan, keys...)
+}
+
+// GetRevision returns the current revision of the data store.
+func (db *BytesConnectionMem) GetRevision() (revision int64, err error) {
+	db.access.Lock()
+	defer db.access.Unlock()
+
+	return db.revision, nil
+}
+
+// GetRevisions returns the revision that created the item stored under
+// the <key> and the revision of its last modification.
+func (db *BytesConnectionMem) GetRevisions(key string) (createRev int64, modRev int64, found bool, err error) {
+	db.access.Lock()
+	defer db.access.Unlock()
+
+	if db.closed {
+		return 0, 0, false, ErrClosed
+	}
+	it, found := db.items[key]
+	if !found {
+		return 0, 0, false, nil
+	}
+	return it.createRev, it.modRev, true, nil
+}
+
+// Put calls 'Put' function of the underlying BytesConnectionMem.
+// KeyPrefix defined in constructor is prepended to the key argument.
+func (pdb *BytesBrokerWatcherMem) Put(key string, data []byte, opts ...datasync.PutOption) error {
+	return pdb.db.put(pdb.prefix+key, data, opts...)
+}
+
+// NewTxn creates a new transaction.
+// KeyPrefix defined in constructor will be prepended to all key arguments
+// in the transaction.
+func (pdb *BytesBrokerWatcherMem) NewTxn() keyval.BytesTxn {
+	return kvstore.NewTxn(pdb.db.update, pdb.prefix)
+}
+
+// NewCondTxn creates a new conditional transaction.
+// KeyPrefix defined in constructor will be prepended to the keys of all
+// conditions and operations in the transaction.
+func (pdb *BytesBrokerWatcherMem) NewCondTxn() keyval.BytesCondTxn {
+	return kvstore.NewCondTxn(pdb.db.update, pdb.prefix)
+}
+
+// GetValue calls 'GetValue' function of the underlying BytesConnectionMem.
+// KeyPrefix defined in constructor is prepended to the key argument.
+func (pdb *BytesBrokerWatcherMem) GetValue(key string) (data []byte, found bool, revision int64, err error) {
+	return pdb.db.getValue(pdb.prefix + key)
+}
+
+// ListValues calls 'ListValues' function of the underlying BytesConnectionMem.
+// KeyPrefix defined in constructor is prepended to the key argument.
+// The prefix is removed from the keys of the returned values.
+func (pdb *BytesBrokerWatcherMem) ListValues(key string, opts ...keyval.ListOption) (keyval.BytesKeyValIterator, error) {
+	return pdb.db.listValues(pdb.prefix, pdb.prefix+key, prefixEnd(pdb.prefix+key), keyval.ParseListOptions(opts...))
+}
+
+// ListKeys calls 'ListKeys' function of the underlying BytesConnectionMem.
+// KeyPrefix defined in constructor is prepended to the argument.
+// The prefix is removed from the returned keys.
+func (pdb *BytesBrokerWatcherMem) ListKeys(prefix string, opts ...keyval.ListOption) (keyval.BytesKeyIterator, error) {
+	return pdb.db.listKeys(pdb.prefix, pdb.prefix+prefix, keyval.ParseListOptions(opts...))
+}
+
+// ListValuesRange calls 'ListValuesRange' function of the underlying
+// BytesConnectionMem. KeyPrefix defined in constructor is prepended to both
+// bounds of the range.
+func (pdb *BytesBrokerWatcherMem) ListValuesRange(fromPrefix string, toPrefix string) (keyval.BytesKeyValIterator, error) {
+	to := prefixEnd(pdb.prefix)
+	if toPrefix != "" {
+		to = pdb.prefix + toPrefix
+	}
+	return pdb.db.listValues(pdb.prefix, pdb.prefix+fromPrefix, to, keyval.ParseListOptions())
+}
+
+// Delete calls 'Delete' function of the underlying BytesConnectionMem.
+// KeyPrefix defined in constructor is prepended to the key argument.
+func (pdb *BytesBrokerWatcherMem) Delete(key string, opts ...datasync.DelOption) (existed bool, err error) {
+	return pdb.db.delete(pdb.prefix+key, opts...)
+}
+
+// Watch starts subscription for changes associated with the selected <keys>.
+// KeyPrefix defined in constructor is prepended to all <keys> in the argument
+// list. The prefix is removed from the keys returned in watch events.
+func (pdb *BytesBrokerWatcherMem) Watch(resp func(keyval.BytesWatchResp), closeChan chan string, keys ...string) error {
+	return pdb.db.watch(pdb.prefix, resp, closeChan, keys...)
+}
+
+func (db *BytesConnectionMem) put(key string, data []byte, opts ...datasync.PutOption) error {
+	var ttl time.Duration
+	for _, opt := range opts {
+		if withTTL, ok := opt.(*datasync.WithTTLOpt); ok && withTTL.TTL > 0 {
+			ttl = withTTL.TTL
+		}
+	}
+
+	db.access.Lock()
+	defer db.access.Unlock()
+
+	if db.closed {
+		return ErrClosed
+	}
+	if rev, expected := keyval.PutExpectedRevision(opts...); expected {
+		if err := db.checkRevisionLocked(key, rev); err != nil {
+			return err
+		}
+	}
+	db.revision++
+	db.notify(db.putLocked(key, data, ttl, db.revision))
+	return nil
+}
+
+// putLocked stores the value with the given revision and returns the change.
+func (db *BytesConnectionMem) putLocked(key string, data []byte, ttl time.Duration, rev int64) *kvstore.Change {
+	value := append([]byte(nil), data...)
+	ch := &kvstore.Change{Key: key, Value: value, Rev: rev, Op: datasync.Put}
+
+	it, exists := db.items[key]
+	if exists {
+		ch.PrevValue, ch.PrevRev = it.value, it.modRev
+		it.stopExpiration()
+		it.value, it.modRev = value, rev
+	} else {
+		it = &item{value: value, createRev: rev, modRev: rev}
+		db.items[key] = it
+	}
+	if ttl > 0 {
+		it.expiration = time.AfterFunc(ttl, func() { db.expire(key, rev) })
+	}
+	return ch
+}
+
+// expire removes the item put with TTL unless it was changed since.
+func (db *BytesConnectionMem) expire(key string, modRev int64) {
+	db.access.Lock()
+	defer db.access.Unlock()
+
+	if it, exists := db.items[key]; !exists || it.modRev != modRev || db.closed {
+		return
+	}
+	db.Debugf("Key %s expired", key)
+	db.revision++
+	db.notify(db.deleteLocked(key, db.revision))
+}
+
+func (db *BytesConnectionMem) delete(key string, opts ...datasync.DelOption) (existed bool, err error) {
+	withPrefix := false
+	for _, opt := range opts {
+		if _, ok := opt.(*datasync.WithPrefixOpt); ok {
+			withPrefix = true
+		}
+	}
+
+	db.access.Lock()
+	defer db.access.Unlock()
+
+	if db.closed {
+		return false, ErrClosed
+	}
+	if rev, expected := keyval.DelExpectedRevision(opts...); expected {
+		if err := db.checkRevisionLocked(key, rev); err != nil {
+			return false, err
+		}
+	}
+	keys := []string{key}
+	if withPrefix {
+		keys = sortedKeys(db.items, key, prefixEnd(key))
+	}
+	rev := db.revision + 1
+	var changes []*kvstore.Change
+	for _, k := range keys {
+		if _, exists := db.items[k]; exists {
+			changes = append(changes, db.deleteLocked(k, rev))
+		}
+	}
+	if len(changes) == 0 {
+		return false, nil
+	}
+	db.revision = rev
+	db.notify(changes...)
+	return true, nil
+}
+
+// checkRevisionLocked returns keyval.ErrRevisionMismatch if the item
+// was not last modified in the <expected> revision.
+func (db *BytesConnectionMem) checkRevisionLocked(key string, expected int64) error {
+	var current int64
+	it, found := db.items[key]
+	if found {
+		current = it.modRev
+	}
+	return keyval.CheckRevision(key, expected, found, current)
+}
+
+// deleteLocked removes the item (that must exist) and returns the change.
+func (db *BytesConnectionMem) deleteLocked(key string, rev int64) *kvstore.Change {
+	it := db.items[key]
+	it.stopExpiration()
+	delete(db.items, key)
+	return &kvstore.Change{Key: key, PrevValue: it.value, PrevRev: it.modRev, Rev: rev, Op: datasync.Delete}
+}
+
+func (db *BytesConnectionMem) getValue(key string) (data []byte, found bool, revision int64, err error) {
+	db.access.Lock()
+	defer db.access.Unlock()
+
+	if db.closed {
+		return nil, false, 0, ErrClosed
+	}
+	it, found := db.items[key]
+	if !found {
+		return nil, false, 0, nil
+	}
+	// the stored slice must not be modified by the caller
+	return append([]byte(nil), it.value...), true, it.modRev, nil
+}
+
+func (db *BytesConnectionMem) listValues(trimPrefix, from, to string, opts keyval.ListOptions) (keyval.BytesKeyValIterator, error) {
+	db.access.Lock()
+	defer db.access.Unlock()
+
+	if db.closed {
+		return nil, ErrClosed
+	}
+	return &bytesKeyValIterator{kvs: listItems(db.items, trimPrefix, from, to, opts)}, nil
+}
+
+func (db *BytesConnectionMem) listKeys(trimPrefix, prefix string, opts keyval.ListOptions) (keyval.BytesKeyIterator, error) {
+	db.access.Lock()
+	defer db.access.Unlock()
+
+	if db.closed {
+		return nil, ErrClosed
+	}
+	opts.KeysOnly = true
+	return &bytesKeyIterator{kvs: listItems(db.items, trimPrefix, prefix, prefixEnd(prefix), opts)}, nil
+}
+
+// listItems returns the items with keys from the range [from, to)
+// selected by the list options with <trimPrefix> removed from the keys.
+func listItems(items map[string]*item, trimPrefix, from, to string, opts keyval.ListOptions) []*bytesKeyVal {
+	var kvs []*bytesKeyVal
+	for _, key := range sortedKeys(items, opts.RangeStart(trimPrefix, from), to) {
+		if opts.Limit > 0 && len(kvs) == opts.Limit {
+			break
+		}
+		it := items[key]
+		kv := &bytesKeyVal{
+			key:      strings.TrimPrefix(key, trimPrefix),
+			revision: it.modRev,
+		}
+		if !opts.KeysOnly {
+			kv.value = append([]byte(nil), it.value...)
+		}
+		kvs = append(kvs, kv)
+	}
+	return kvs
+}
+
+// sortedKeys returns the sorted keys of the items from the range [from, to),
+// empty <to> means no upper bound.
+func sortedKeys(items map[string]*item, from, to string) []string {
+	var keys []string
+	for key := range items {
+		if key >= from && (to == "" || key < to) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// prefixEnd returns the smallest key greater than all keys with the given
+// prefix (empty string if there is no such key).
+func prefixEnd(prefix string) string {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return string(end[:i+1])
+		}
+	}
+	return ""
+}
+
+// stopExpiration cancels the expiration of the item.
+func (it *item) stopExpiration() {
+	if it.expiration != nil {
+		it.expiration.Stop()
+		it.expiration = nil
+	}
+}
+
+// GetNext returns the following item from the result set.
+// When there are no more items to get, <stop> is returned as *true* and <val>
+// is simply *nil*.
+func (ctx *bytesKeyValIterator) GetNext() (val keyval.BytesKeyVal, stop bool) {
+	if ctx.index >= len(ctx.kvs) {
+		return nil, true
+	}
+	val = ctx.kvs[ctx.index]
+	ctx.index++
+	return val, false
+}
+
+// GetNext returns the following key (+ revision) from the result set.
+// When there are no more keys to get, <stop> is returned as *true*
+// and <key> and <rev> are default values.
+func (ctx *bytesKeyIterator) GetNext() (key string, rev int64, stop bool) {
+	if ctx.index >= len(ctx.kvs) {
+		return "", 0, true
+	}
+	kv := ctx.kvs[ctx.index]
+	ctx.index++
+	return kv.key, kv.revision, false
+}
+
+// GetValue returns the value of the pair.
+func (kv *bytesKeyVal) GetValue() []byte {
+	return kv.value
+}
+
+// GetPrevValue returns the previous value of the pair.
+func (kv *bytesKeyVal) GetPrevValue() []byte {
+	return kv.prevValue
+}
+
+// GetKey returns the key of the pair.
+func (kv *bytesKeyVal) GetKey() string {
+	return kv.key
+}
+
+// GetRevision returns the revision associated with the pair.
+func (kv *bytesKeyVal) GetRevision() int64 {
+	return kv.revision
+}
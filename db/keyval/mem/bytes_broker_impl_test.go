@@ -0,0 +1,460 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mem
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/ligato/cn-infra/datasync"
+	"github.com/ligato/cn-infra/db/keyval"
+	"github.com/ligato/cn-infra/flavors/local"
+	"github.com/ligato/cn-infra/health/statuscheck/model/status"
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+	"github.com/onsi/gomega"
+)
+
+func newConnection() *BytesConnectionMem {
+	return NewBytesConnectionMem(logrus.DefaultLogger())
+}
+
+func listValues(it keyval.BytesKeyValIterator) (kvs map[string]string) {
+	kvs = make(map[string]string)
+	var keys []string
+	for {
+		kv, stop := it.GetNext()
+		if stop {
+			break
+		}
+		keys = append(keys, kv.GetKey())
+		kvs[kv.GetKey()] = string(kv.GetValue())
+	}
+	gomega.Expect(sort.StringsAreSorted(keys)).Should(gomega.BeTrue())
+	return kvs
+}
+
+func TestRevisions(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	db := newConnection()
+	defer db.Close()
+
+	gomega.Expect(db.Put("a", []byte("1"))).To(gomega.Succeed())
+	gomega.Expect(db.Put("b", []byte("1"))).To(gomega.Succeed())
+	gomega.Expect(db.Put("a", []byte("2"))).To(gomega.Succeed())
+
+	data, found, rev, err := db.GetValue("a")
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	gomega.Expect(found).Should(gomega.BeTrue())
+	gomega.Expect(string(data)).Should(gomega.Equal("2"))
+	gomega.Expect(rev).Should(gomega.BeEquivalentTo(3))
+
+	createRev, modRev, found, err := db.GetRevisions("a")
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	gomega.Expect(found).Should(gomega.BeTrue())
+	gomega.Expect(createRev).Should(gomega.BeEquivalentTo(1))
+	gomega.Expect(modRev).Should(gomega.BeEquivalentTo(3))
+
+	existed, err := db.Delete("missing")
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	gomega.Expect(existed).Should(gomega.BeFalse())
+	revision, _ := db.GetRevision()
+	gomega.Expect(revision).Should(gomega.BeEquivalentTo(3))
+
+	existed, err = db.Delete("a")
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	gomega.Expect(existed).Should(gomega.BeTrue())
+	revision, _ = db.GetRevision()
+	gomega.Expect(revision).Should(gomega.BeEquivalentTo(4))
+	_, found, _, _ = db.GetValue("a")
+	gomega.Expect(found).Should(gomega.BeFalse())
+}
+
+func TestExpectedRevision(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	db := newConnection()
+	defer db.Close()
+
+	gomega.Expect(db.Put("a", []byte("1"), datasync.WithCreateOnly())).To(gomega.Succeed())
+	err := db.Put("a", []byte("2"), datasync.WithCreateOnly())
+	gomega.Expect(err).Should(gomega.Equal(&keyval.ErrRevisionMismatch{Key: "a", Expected: 0, Current: 1}))
+
+	gomega.Expect(db.Put("a", []byte("2"), datasync.WithExpectedRevision(1))).To(gomega.Succeed())
+	err = db.Put("a", []byte("3"), datasync.WithExpectedRevision(1))
+	gomega.Expect(err).Should(gomega.Equal(&keyval.ErrRevisionMismatch{Key: "a", Expected: 1, Current: 2}))
+	data, _, _, _ := db.GetValue("a")
+	gomega.Expect(string(data)).Should(gomega.Equal("2"))
+
+	existed, err := db.Delete("a", datasync.WithExpectedRevision(1))
+	gomega.Expect(err).Should(gomega.BeAssignableToTypeOf(&keyval.ErrRevisionMismatch{}))
+	gomega.Expect(existed).Should(gomega.BeFalse())
+	existed, err = db.Delete("a", datasync.WithExpectedRevision(2))
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	gomega.Expect(existed).Should(gomega.BeTrue())
+
+	// failed operations do not change the revision
+	revision, _ := db.GetRevision()
+	gomega.Expect(revision).Should(gomega.BeEquivalentTo(3))
+	err = db.Put("a", []byte("4"), datasync.WithExpectedRevision(2))
+	gomega.Expect(err).Should(gomega.Equal(&keyval.ErrRevisionMismatch{Key: "a", Expected: 2, Current: 0}))
+}
+
+func TestTTL(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	db := newConnection()
+	defer db.Close()
+
+	gomega.Expect(db.Put("expiring", []byte("1"), datasync.WithTTL(50*time.Millisecond))).To(gomega.Succeed())
+	gomega.Expect(db.Put("refreshed", []byte("1"), datasync.WithTTL(50*time.Millisecond))).To(gomega.Succeed())
+	// overwrite without TTL cancels the expiration
+	gomega.Expect(db.Put("refreshed", []byte("2"))).To(gomega.Succeed())
+
+	gomega.Eventually(func() bool {
+		_, found, _, _ := db.GetValue("expiring")
+		return found
+	}).Should(gomega.BeFalse())
+	_, found, _, _ := db.GetValue("refreshed")
+	gomega.Expect(found).Should(gomega.BeTrue())
+}
+
+func TestListValues(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	db := newConnection()
+	defer db.Close()
+
+	for _, key := range []string{"/a/3", "/a/1", "/a/2", "/b/1", "/ab"} {
+		gomega.Expect(db.Put(key, []byte(key))).To(gomega.Succeed())
+	}
+
+	it, err := db.ListValues("/a/")
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	gomega.Expect(listValues(it)).Should(gomega.Equal(map[string]string{"/a/1": "/a/1", "/a/2": "/a/2", "/a/3": "/a/3"}))
+
+	it, err = db.ListValuesRange("/a/2", "/b/")
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	gomega.Expect(listValues(it)).Should(gomega.Equal(map[string]string{"/a/2": "/a/2", "/a/3": "/a/3", "/ab": "/ab"}))
+
+	it, err = db.ListValuesRange("/ab", "")
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	gomega.Expect(listValues(it)).Should(gomega.Equal(map[string]string{"/ab": "/ab", "/b/1": "/b/1"}))
+
+	keys, err := db.ListKeys("/a")
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	var listed []string
+	for {
+		key, _, stop := keys.GetNext()
+		if stop {
+			break
+		}
+		listed = append(listed, key)
+	}
+	gomega.Expect(listed).Should(gomega.Equal([]string{"/a/1", "/a/2", "/a/3", "/ab"}))
+
+	existed, err := db.Delete("/a/", datasync.WithPrefix())
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	gomega.Expect(existed).Should(gomega.BeTrue())
+	it, _ = db.ListValues("/a")
+	gomega.Expect(listValues(it)).Should(gomega.Equal(map[string]string{"/ab": "/ab"}))
+}
+
+func TestReturnedValuesAreCopies(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	db := newConnection()
+	defer db.Close()
+
+	gomega.Expect(db.Put("/a", []byte("value"))).To(gomega.Succeed())
+
+	data, _, _, err := db.GetValue("/a")
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	data[0] = 'X'
+
+	it, err := db.ListValues("/")
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	kv, _ := it.GetNext()
+	kv.GetValue()[0] = 'Y'
+
+	data, _, _, err = db.GetValue("/a")
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	gomega.Expect(string(data)).Should(gomega.Equal("value"))
+}
+
+func TestListOptions(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	db := newConnection()
+	defer db.Close()
+
+	for _, key := range []string{"/a/1", "/a/2", "/a/3", "/a/4", "/b/1"} {
+		gomega.Expect(db.Put(key, []byte(key))).To(gomega.Succeed())
+	}
+
+	it, err := db.ListValues("/a/", keyval.WithLimit(2))
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	gomega.Expect(listValues(it)).Should(gomega.Equal(map[string]string{"/a/1": "/a/1", "/a/2": "/a/2"}))
+
+	it, err = db.ListValues("/a/", keyval.WithStartAfter("/a/2"), keyval.WithKeysOnly())
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	gomega.Expect(listValues(it)).Should(gomega.Equal(map[string]string{"/a/3": "", "/a/4": ""}))
+
+	// the broker lists the keys without its prefix
+	broker := db.NewBroker("/a/")
+	keys, err := broker.ListKeys("", keyval.WithStartAfter("1"), keyval.WithLimit(2))
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	var listed []string
+	for {
+		key, _, stop := keys.GetNext()
+		if stop {
+			break
+		}
+		listed = append(listed, key)
+	}
+	gomega.Expect(listed).Should(gomega.Equal([]string{"2", "3"}))
+}
+
+func TestHistory(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	db := newConnection()
+	defer db.Close()
+
+	gomega.Expect(db.Put("/h/a", []byte("1"))).To(gomega.Succeed()) // rev 1
+	gomega.Expect(db.Put("/h/b", []byte("1"))).To(gomega.Succeed()) // rev 2
+	gomega.Expect(db.Put("/h/a", []byte("2"))).To(gomega.Succeed()) // rev 3
+	_, err := db.Delete("/h/b")                                     // rev 4
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	gomega.Expect(db.Put("/h/c", []byte("1"))).To(gomega.Succeed()) // rev 5
+
+	data, found, rev, err := db.GetValueAtRevision("/h/a", 2)
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	gomega.Expect(found).Should(gomega.BeTrue())
+	gomega.Expect(string(data)).Should(gomega.Equal("1"))
+	gomega.Expect(rev).Should(gomega.BeEquivalentTo(1))
+	_, found, _, err = db.GetValueAtRevision("/h/c", 4)
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	gomega.Expect(found).Should(gomega.BeFalse())
+	_, _, _, err = db.GetValueAtRevision("/h/c", 6)
+	gomega.Expect(err).Should(gomega.HaveOccurred())
+
+	it, err := db.ListValuesAtRevision("/h/", 3)
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	gomega.Expect(listValues(it)).Should(gomega.Equal(map[string]string{"/h/a": "2", "/h/b": "1"}))
+
+	// the broker trims its prefix
+	broker := db.NewBroker("/h/").(*BytesBrokerWatcherMem)
+	changes, err := broker.KeyHistory("b", 2)
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	gomega.Expect(changes).Should(gomega.HaveLen(2))
+	gomega.Expect(changes[0].GetKey()).Should(gomega.Equal("b"))
+	gomega.Expect(changes[0].GetChangeType()).Should(gomega.Equal(datasync.Put))
+	gomega.Expect(changes[0].GetRevision()).Should(gomega.BeEquivalentTo(2))
+	gomega.Expect(changes[1].GetChangeType()).Should(gomega.Equal(datasync.Delete))
+	gomega.Expect(string(changes[1].GetPrevValue())).Should(gomega.Equal("1"))
+	gomega.Expect(changes[1].GetRevision()).Should(gomega.BeEquivalentTo(4))
+
+	// the oldest changes are dropped
+	db.SetHistorySize(2)
+	_, _, _, err = db.GetValueAtRevision("/h/a", 2)
+	gomega.Expect(err).Should(gomega.Equal(keyval.ErrCompacted))
+	_, err = db.KeyHistory("/h/a", 1)
+	gomega.Expect(err).Should(gomega.Equal(keyval.ErrCompacted))
+	data, found, _, err = db.GetValueAtRevision("/h/b", 3)
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	gomega.Expect(found).Should(gomega.BeTrue())
+	gomega.Expect(string(data)).Should(gomega.Equal("1"))
+}
+
+func TestPrefixedBroker(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	db := newConnection()
+	defer db.Close()
+
+	broker := db.NewBroker("/agent/")
+	gomega.Expect(broker.Put("config/x", []byte("x"))).To(gomega.Succeed())
+	gomega.Expect(db.Put("/other/config/y", []byte("y"))).To(gomega.Succeed())
+
+	data, found, _, err := db.GetValue("/agent/config/x")
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	gomega.Expect(found).Should(gomega.BeTrue())
+	gomega.Expect(string(data)).Should(gomega.Equal("x"))
+
+	it, err := broker.ListValues("config/")
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	gomega.Expect(listValues(it)).Should(gomega.Equal(map[string]string{"config/x": "x"}))
+
+	it, err = broker.(*BytesBrokerWatcherMem).ListValuesRange("", "")
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	gomega.Expect(listValues(it)).Should(gomega.Equal(map[string]string{"config/x": "x"}))
+}
+
+func TestTxn(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	db := newConnection()
+	defer db.Close()
+
+	gomega.Expect(db.Put("/txn/removed", []byte("1"))).To(gomega.Succeed())
+
+	respChan := make(chan keyval.BytesWatchResp, 10)
+	gomega.Expect(db.Watch(keyval.ToChan(respChan), nil, "/txn/")).To(gomega.Succeed())
+
+	err := db.NewBroker("/txn/").NewTxn().Put("a", []byte("a")).Put("b", []byte("b")).Delete("removed").Commit()
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	revision, _ := db.GetRevision()
+	gomega.Expect(revision).Should(gomega.BeEquivalentTo(2))
+	for i := 0; i < 3; i++ {
+		var resp keyval.BytesWatchResp
+		gomega.Eventually(respChan).Should(gomega.Receive(&resp))
+		gomega.Expect(resp.GetRevision()).Should(gomega.BeEquivalentTo(2))
+	}
+	_, found, _, _ := db.GetValue("/txn/removed")
+	gomega.Expect(found).Should(gomega.BeFalse())
+}
+
+func TestCondTxn(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	db := newConnection()
+	defer db.Close()
+
+	broker := db.NewBroker("/cond/").(keyval.BytesCondTxnBroker)
+	gomega.Expect(db.Put("/cond/a", []byte("a"))).To(gomega.Succeed())
+	_, _, rev, _ := db.GetValue("/cond/a")
+
+	succeeded, err := broker.NewCondTxn().
+		If(keyval.RevEquals("a", rev), keyval.ValueEquals("a", []byte("a")), keyval.Missing("b")).
+		Then(keyval.OpPut("b", []byte("b")), keyval.OpDelete("a")).
+		Else(keyval.OpPut("else", []byte("else"))).
+		Commit()
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	gomega.Expect(succeeded).Should(gomega.BeTrue())
+	_, found, modRev, _ := db.GetValue("/cond/b")
+	gomega.Expect(found).Should(gomega.BeTrue())
+	gomega.Expect(modRev).Should(gomega.BeEquivalentTo(2))
+	_, found, _, _ = db.GetValue("/cond/a")
+	gomega.Expect(found).Should(gomega.BeFalse())
+
+	// "a" does not exist anymore
+	succeeded, err = broker.NewCondTxn().
+		If(keyval.RevEquals("a", rev)).
+		Then(keyval.OpPut("then", []byte("then"))).
+		Else(keyval.OpPut("else", []byte("else"))).
+		Commit()
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	gomega.Expect(succeeded).Should(gomega.BeFalse())
+	_, found, _, _ = db.GetValue("/cond/then")
+	gomega.Expect(found).Should(gomega.BeFalse())
+	_, found, _, _ = db.GetValue("/cond/else")
+	gomega.Expect(found).Should(gomega.BeTrue())
+
+	// no operations, no revision
+	succeeded, err = db.NewCondTxn().If(keyval.Missing("/cond/b")).Commit()
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	gomega.Expect(succeeded).Should(gomega.BeFalse())
+	revision, _ := db.GetRevision()
+	gomega.Expect(revision).Should(gomega.BeEquivalentTo(3))
+}
+
+func TestWatch(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	db := newConnection()
+	defer db.Close()
+
+	respChan := make(chan keyval.BytesWatchResp, 10)
+	closeChan := make(chan string)
+	gomega.Expect(db.NewWatcher("/agent/").Watch(keyval.ToChan(respChan), closeChan, "config/")).To(gomega.Succeed())
+
+	gomega.Expect(db.Put("/agent/config/x", []byte("1"))).To(gomega.Succeed())
+	gomega.Expect(db.Put("/agent/config/x", []byte("2"))).To(gomega.Succeed())
+	gomega.Expect(db.Put("/agent/status/x", []byte("ignored"))).To(gomega.Succeed())
+	gomega.Expect(db.Put("/agent/config/y", []byte("1"), datasync.WithTTL(10*time.Millisecond))).To(gomega.Succeed())
+
+	var resp keyval.BytesWatchResp
+	gomega.Eventually(respChan).Should(gomega.Receive(&resp))
+	gomega.Expect(resp.GetKey()).Should(gomega.Equal("config/x"))
+	gomega.Expect(resp.GetChangeType()).Should(gomega.Equal(datasync.Put))
+	gomega.Expect(resp.GetPrevValue()).Should(gomega.BeNil())
+	gomega.Expect(resp.GetRevision()).Should(gomega.BeEquivalentTo(1))
+
+	gomega.Eventually(respChan).Should(gomega.Receive(&resp))
+	gomega.Expect(string(resp.GetValue())).Should(gomega.Equal("2"))
+	gomega.Expect(string(resp.GetPrevValue())).Should(gomega.Equal("1"))
+	gomega.Expect(resp.GetRevision()).Should(gomega.BeEquivalentTo(2))
+
+	gomega.Eventually(respChan).Should(gomega.Receive(&resp))
+	gomega.Expect(resp.GetKey()).Should(gomega.Equal("config/y"))
+
+	// expiration of the TTL
+	gomega.Eventually(respChan).Should(gomega.Receive(&resp))
+	gomega.Expect(resp.GetKey()).Should(gomega.Equal("config/y"))
+	gomega.Expect(resp.GetChangeType()).Should(gomega.Equal(datasync.Delete))
+	gomega.Expect(string(resp.GetPrevValue())).Should(gomega.Equal("1"))
+	gomega.Expect(resp.GetRevision()).Should(gomega.BeEquivalentTo(5))
+
+	closeChan <- "config/"
+	gomega.Eventually(db.watches.Len).Should(gomega.BeZero())
+	gomega.Expect(db.Put("/agent/config/x", []byte("3"))).To(gomega.Succeed())
+	gomega.Consistently(respChan, 50*time.Millisecond).ShouldNot(gomega.Receive())
+}
+
+func TestClosed(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	db := newConnection()
+	gomega.Expect(db.Close()).To(gomega.Succeed())
+	gomega.Expect(db.Close()).To(gomega.Succeed())
+
+	gomega.Expect(db.Put("a", nil)).To(gomega.Equal(ErrClosed))
+	_, _, _, err := db.GetValue("a")
+	gomega.Expect(err).To(gomega.Equal(ErrClosed))
+	gomega.Expect(db.Watch(func(keyval.BytesWatchResp) {}, nil, "a")).To(gomega.Equal(ErrClosed))
+}
+
+func TestPlugin(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	plugin := &Plugin{Deps: Deps{PluginLogDeps: local.PluginLogDeps{
+		Log: logging.ForPlugin("mem", logrus.NewLogRegistry()), PluginName: "mem"}}}
+	gomega.Expect(plugin.Init()).To(gomega.Succeed())
+	defer plugin.Close()
+	gomega.Expect(plugin.Disabled()).Should(gomega.BeFalse())
+
+	respChan := make(chan keyval.ProtoWatchResp, 10)
+	gomega.Expect(plugin.NewWatcher("/agent/").Watch(keyval.ToChanProto(respChan), nil, "status/")).To(gomega.Succeed())
+
+	broker := plugin.NewBroker("/agent/")
+	gomega.Expect(broker.Put("status/etcd", &status.PluginStatus{State: status.OperationalState_OK})).To(gomega.Succeed())
+
+	value := &status.PluginStatus{}
+	found, _, err := broker.GetValue("status/etcd", value)
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	gomega.Expect(found).Should(gomega.BeTrue())
+	gomega.Expect(value.State).Should(gomega.Equal(status.OperationalState_OK))
+
+	var resp keyval.ProtoWatchResp
+	gomega.Eventually(respChan).Should(gomega.Receive(&resp))
+	gomega.Expect(resp.GetKey()).Should(gomega.Equal("status/etcd"))
+
+	// conditional transaction with proto-modelled data
+	succeeded, err := broker.(keyval.ProtoCondTxnBroker).NewCondTxn().
+		If(keyval.ProtoValueEquals("status/etcd", &status.PluginStatus{State: status.OperationalState_OK})).
+		Then(keyval.ProtoOpPut("status/etcd", &status.PluginStatus{State: status.OperationalState_ERROR})).
+		Commit()
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	gomega.Expect(succeeded).Should(gomega.BeTrue())
+	_, _, err = broker.GetValue("status/etcd", value)
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	gomega.Expect(value.State).Should(gomega.Equal(status.OperationalState_ERROR))
+
+	data, found, _, err := plugin.RawAccess().NewBroker(keyval.Root).GetValue("/agent/status/etcd")
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	gomega.Expect(found).Should(gomega.BeTrue())
+	gomega.Expect(string(data)).Should(gomega.ContainSubstring("state"))
+}
@@ -0,0 +1,68 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mem
+
+import (
+	"github.com/ligato/cn-infra/db/keyval/internal/kvstore"
+)
+
+// update applies the changes made by <apply> atomically with a new revision
+// (see kvstore.UpdateFunc). It is used to commit the transactions.
+func (db *BytesConnectionMem) update(apply func(store kvstore.Store, rev int64) ([]*kvstore.Change, error)) error {
+	db.access.Lock()
+	defer db.access.Unlock()
+
+	if db.closed {
+		return ErrClosed
+	}
+	rev := db.revision + 1
+	changes, err := apply(lockedStore{db}, rev)
+	if err != nil {
+		return err
+	}
+	if len(changes) > 0 {
+		db.revision = rev
+		db.notify(changes...)
+	}
+	return nil
+}
+
+// lockedStore provides the items of the data store to the transactions
+// (kvstore.Store). Must be used with the lock of the data store held.
+type lockedStore struct {
+	db *BytesConnectionMem
+}
+
+// Get returns the value of the item and the revision of its last modification.
+func (store lockedStore) Get(key string) (value []byte, found bool, modRev int64, err error) {
+	it, found := store.db.items[key]
+	if !found {
+		return nil, false, 0, nil
+	}
+	return it.value, true, it.modRev, nil
+}
+
+// Put stores the value with the revision and returns the change.
+func (store lockedStore) Put(key string, value []byte, rev int64) (*kvstore.Change, error) {
+	return store.db.putLocked(key, value, 0, rev), nil
+}
+
+// Delete removes the item and returns the change (nil if the item does not exist).
+func (store lockedStore) Delete(key string, rev int64) (*kvstore.Change, error) {
+	if _, exists := store.db.items[key]; !exists {
+		return nil, nil
+	}
+	return store.db.deleteLocked(key, rev), nil
+}
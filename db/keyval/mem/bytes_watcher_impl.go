@@ -0,0 +1,56 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mem
+
+import (
+	"github.com/ligato/cn-infra/db/keyval"
+	"github.com/ligato/cn-infra/db/keyval/internal/kvstore"
+)
+
+// BytesWatchPutResp is sent when new key-value pair has been inserted
+// or the value has been updated.
+type BytesWatchPutResp = kvstore.BytesWatchPutResp
+
+// NewBytesWatchPutResp creates an instance of BytesWatchPutResp.
+func NewBytesWatchPutResp(key string, value []byte, prevValue []byte, revision int64) *BytesWatchPutResp {
+	return kvstore.NewBytesWatchPutResp(key, value, prevValue, revision)
+}
+
+// BytesWatchDelResp is sent when a key-value pair has been removed.
+type BytesWatchDelResp = kvstore.BytesWatchDelResp
+
+// NewBytesWatchDelResp creates an instance of BytesWatchDelResp.
+func NewBytesWatchDelResp(key string, prevValue []byte, revision int64) *BytesWatchDelResp {
+	return kvstore.NewBytesWatchDelResp(key, prevValue, revision)
+}
+
+// watch registers a new watch for each of the <keys>.
+func (db *BytesConnectionMem) watch(trimPrefix string, resp func(keyval.BytesWatchResp), closeCh chan string, keys ...string) error {
+	db.access.Lock()
+	defer db.access.Unlock()
+
+	if db.closed {
+		return ErrClosed
+	}
+	db.watches.Watch(trimPrefix, resp, closeCh, keys...)
+	return nil
+}
+
+// notify records the changes in the history and queues them for all watches
+// of the changed keys. Must be called with the lock of the data store held.
+func (db *BytesConnectionMem) notify(changes ...*kvstore.Change) {
+	db.history.add(changes...)
+	db.watches.Notify(changes...)
+}
@@ -0,0 +1,38 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package mem implements the key-value Data Broker client API with an
+// in-memory data store. See cn-infra/db/keyval for the definition
+// of the key-value Data Broker client API.
+//
+// The data store does not need any external process, it is meant for unit
+// tests and for agents that run hermetically (e.g. kvdbsync with mem.Plugin
+// injected as the KvPlugin). It mimics the behavior of etcd:
+//   - every change increments the global revision of the data store,
+//     every key keeps its create and modification revision,
+//   - keys put with datasync.WithTTL() are removed once the TTL expires,
+//   - keys are listed (by prefix or by range) in the lexical order,
+//   - watch events carry the revision of the change and the previous value,
+//   - all operations of a transaction are applied atomically with a single
+//     revision.
+//
+// The entity that provides access to the data store is called BytesConnectionMem:
+//
+//	db := mem.NewBytesConnectionMem(logger)
+//	broker := db.NewBroker("/vnf-agent/")
+//	broker.Put("config/x", []byte("value"))
+//
+// The data store can be used as a plugin of an agent (see Plugin),
+// the proto-modelled data are serialized to JSON as with the etcd plugin.
+package mem
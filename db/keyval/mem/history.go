@@ -0,0 +1,192 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mem
+
+import (
+	"fmt"
+
+	"github.com/ligato/cn-infra/db/keyval"
+	"github.com/ligato/cn-infra/db/keyval/internal/kvstore"
+)
+
+// DefaultHistorySize is the default number of the most recent changes kept
+// by the data store for keyval.HistoryReader (see SetHistorySize()).
+const DefaultHistorySize = 1000
+
+// history keeps a bounded number of the most recent changes of the data store.
+type history struct {
+	size    int
+	changes []*kvstore.Change // from the oldest to the newest
+	// revision of the newest change dropped from the history
+	compacted int64
+}
+
+// add appends the changes and drops the oldest changes above the size limit.
+func (h *history) add(changes ...*kvstore.Change) {
+	h.changes = append(h.changes, changes...)
+	h.trim()
+}
+
+// trim drops the oldest changes above the size limit.
+func (h *history) trim() {
+	size := h.size
+	if size < 0 {
+		size = 0
+	}
+	if drop := len(h.changes) - size; drop > 0 {
+		h.compacted = h.changes[drop-1].Rev
+		h.changes = h.changes[drop:]
+	}
+}
+
+// SetHistorySize changes the number of the most recent changes kept by the data
+// store for keyval.HistoryReader (DefaultHistorySize by default). Revisions
+// older than the oldest kept change can no longer be read (keyval.ErrCompacted
+// is returned). Zero or negative <size> disables the history.
+func (db *BytesConnectionMem) SetHistorySize(size int) {
+	db.access.Lock()
+	defer db.access.Unlock()
+
+	db.history.size = size
+	db.history.trim()
+}
+
+// GetValueAtRevision retrieves the item stored under the <key> at the revision
+// <rev> (zero or negative <rev> means the current revision).
+// keyval.ErrCompacted is returned if the revision is older than the history
+// kept by the data store.
+func (db *BytesConnectionMem) GetValueAtRevision(key string, rev int64) (data []byte, found bool, revision int64, err error) {
+	return db.getValueAtRevision(key, rev)
+}
+
+// ListValuesAtRevision returns an iterator that enables traversing values
+// stored under the provided <prefix> at the revision <rev> in the lexical
+// order of the keys.
+func (db *BytesConnectionMem) ListValuesAtRevision(prefix string, rev int64, opts ...keyval.ListOption) (keyval.BytesKeyValIterator, error) {
+	return db.listValuesAtRevision(keyval.Root, prefix, prefixEnd(prefix), rev, keyval.ParseListOptions(opts...))
+}
+
+// KeyHistory returns the changes of the item stored under the <key> made
+// in the revision <fromRev> or later (from the oldest to the newest).
+// keyval.ErrCompacted is returned if some of the changes were already dropped
+// from the history.
+func (db *BytesConnectionMem) KeyHistory(key string, fromRev int64) ([]keyval.BytesWatchResp, error) {
+	return db.keyHistory(keyval.Root, key, fromRev)
+}
+
+// GetValueAtRevision calls 'GetValueAtRevision' function of the underlying
+// BytesConnectionMem. KeyPrefix defined in constructor is prepended
+// to the key argument.
+func (pdb *BytesBrokerWatcherMem) GetValueAtRevision(key string, rev int64) (data []byte, found bool, revision int64, err error) {
+	return pdb.db.getValueAtRevision(pdb.prefix+key, rev)
+}
+
+// ListValuesAtRevision calls 'ListValuesAtRevision' function of the underlying
+// BytesConnectionMem. KeyPrefix defined in constructor is prepended to the
+// argument. The prefix is removed from the keys of the returned values.
+func (pdb *BytesBrokerWatcherMem) ListValuesAtRevision(prefix string, rev int64, opts ...keyval.ListOption) (keyval.BytesKeyValIterator, error) {
+	return pdb.db.listValuesAtRevision(pdb.prefix, pdb.prefix+prefix, prefixEnd(pdb.prefix+prefix), rev, keyval.ParseListOptions(opts...))
+}
+
+// KeyHistory calls 'KeyHistory' function of the underlying BytesConnectionMem.
+// KeyPrefix defined in constructor is prepended to the key argument
+// and removed from the keys of the returned changes.
+func (pdb *BytesBrokerWatcherMem) KeyHistory(key string, fromRev int64) ([]keyval.BytesWatchResp, error) {
+	return pdb.db.keyHistory(pdb.prefix, pdb.prefix+key, fromRev)
+}
+
+func (db *BytesConnectionMem) getValueAtRevision(key string, rev int64) (data []byte, found bool, revision int64, err error) {
+	db.access.Lock()
+	defer db.access.Unlock()
+
+	if rev, err = db.historyRevisionLocked(rev); err != nil {
+		return nil, false, 0, err
+	}
+	if it, exists := db.items[key]; exists {
+		data, found, revision = it.value, true, it.modRev
+	}
+	// revert the changes made after the revision
+	for i := len(db.history.changes) - 1; i >= 0 && db.history.changes[i].Rev > rev; i-- {
+		if ch := db.history.changes[i]; ch.Key == key {
+			data, found, revision = ch.PrevValue, ch.PrevRev != 0, ch.PrevRev
+		}
+	}
+	return append([]byte(nil), data...), found, revision, nil
+}
+
+func (db *BytesConnectionMem) listValuesAtRevision(trimPrefix, from, to string, rev int64, opts keyval.ListOptions) (keyval.BytesKeyValIterator, error) {
+	db.access.Lock()
+	defer db.access.Unlock()
+
+	rev, err := db.historyRevisionLocked(rev)
+	if err != nil {
+		return nil, err
+	}
+	items := make(map[string]*item)
+	for _, key := range sortedKeys(db.items, from, to) {
+		it := db.items[key]
+		items[key] = &item{value: it.value, createRev: it.createRev, modRev: it.modRev}
+	}
+	// revert the changes made after the revision
+	for i := len(db.history.changes) - 1; i >= 0 && db.history.changes[i].Rev > rev; i-- {
+		ch := db.history.changes[i]
+		if ch.Key < from || (to != "" && ch.Key >= to) {
+			continue
+		}
+		if ch.PrevRev == 0 {
+			delete(items, ch.Key)
+		} else {
+			items[ch.Key] = &item{value: ch.PrevValue, modRev: ch.PrevRev}
+		}
+	}
+	return &bytesKeyValIterator{kvs: listItems(items, trimPrefix, from, to, opts)}, nil
+}
+
+func (db *BytesConnectionMem) keyHistory(trimPrefix, key string, fromRev int64) ([]keyval.BytesWatchResp, error) {
+	db.access.Lock()
+	defer db.access.Unlock()
+
+	if db.closed {
+		return nil, ErrClosed
+	}
+	if db.history.compacted > 0 && fromRev <= db.history.compacted {
+		return nil, keyval.ErrCompacted
+	}
+	var changes []keyval.BytesWatchResp
+	for _, ch := range db.history.changes {
+		if ch.Key == key && ch.Rev >= fromRev {
+			changes = append(changes, ch.WatchResp(trimPrefix))
+		}
+	}
+	return changes, nil
+}
+
+// historyRevisionLocked validates the revision requested from the history
+// (zero or negative revision is replaced with the current revision).
+func (db *BytesConnectionMem) historyRevisionLocked(rev int64) (int64, error) {
+	if db.closed {
+		return 0, ErrClosed
+	}
+	if rev <= 0 {
+		return db.revision, nil
+	}
+	if rev > db.revision {
+		return 0, fmt.Errorf("revision %d is newer than the current revision %d", rev, db.revision)
+	}
+	if rev < db.history.compacted {
+		return 0, keyval.ErrCompacted
+	}
+	return rev, nil
+}
@@ -0,0 +1,76 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mem
+
+import (
+	"github.com/ligato/cn-infra/db/keyval"
+	"github.com/ligato/cn-infra/db/keyval/kvproto"
+	"github.com/ligato/cn-infra/flavors/local"
+	"github.com/ligato/cn-infra/utils/safeclose"
+)
+
+// Plugin implements the in-memory key-value data store as a plugin.
+// The plugin does not need any configuration and it is never disabled.
+type Plugin struct {
+	Deps
+	// in-memory data store
+	connection *BytesConnectionMem
+	// Read/Write proto modelled data
+	protoWrapper *kvproto.ProtoWrapper
+}
+
+// Deps lists dependencies of the in-memory data store plugin.
+type Deps struct {
+	local.PluginLogDeps // inject
+}
+
+// Init creates an empty data store.
+func (plugin *Plugin) Init() error {
+	plugin.connection = NewBytesConnectionMem(plugin.Log)
+	plugin.protoWrapper = kvproto.NewProtoWrapperWithSerializer(plugin.connection, &keyval.SerializerJSON{})
+	return nil
+}
+
+// Close stops all watches of the data store.
+func (plugin *Plugin) Close() error {
+	if plugin.connection == nil {
+		return nil
+	}
+	return safeclose.Close(plugin.connection)
+}
+
+// NewBroker creates new instance of prefixed broker that provides API with arguments of type proto.Message.
+func (plugin *Plugin) NewBroker(keyPrefix string) keyval.ProtoBroker {
+	return plugin.protoWrapper.NewBroker(keyPrefix)
+}
+
+// NewWatcher creates new instance of prefixed broker that provides API with arguments of type proto.Message.
+func (plugin *Plugin) NewWatcher(keyPrefix string) keyval.ProtoWatcher {
+	return plugin.protoWrapper.NewWatcher(keyPrefix)
+}
+
+// RawAccess returns access to the data stored in the form of bytes
+// (nil if the plugin has not been initialized yet).
+func (plugin *Plugin) RawAccess() keyval.KvBytesPlugin {
+	if plugin.connection == nil {
+		return nil
+	}
+	return plugin.connection
+}
+
+// Disabled always returns *false*, the in-memory data store is always available.
+func (plugin *Plugin) Disabled() (disabled bool) {
+	return false
+}
@@ -47,3 +47,13 @@ type KvBytesPlugin interface {
 	// To avoid using a prefix, pass keyval.Root constant as argument.
 	NewWatcher(keyPrefix string) BytesWatcher
 }
+
+// KvRawAccess is implemented by key-value datastore plugins that besides
+// the proto-modelled data also provide access to the data in the form of bytes
+// (e.g. for documents that are not proto messages).
+type KvRawAccess interface {
+	// RawAccess returns access to the data store without (de)serialization
+	// of the values. Nil is returned if the plugin is disabled or not
+	// initialized yet.
+	RawAccess() KvBytesPlugin
+}
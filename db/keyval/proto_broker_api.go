@@ -33,11 +33,15 @@ type ProtoBroker interface {
 	// it is unmarshaled into the <reqObj>.
 	GetValue(key string, reqObj proto.Message) (found bool, revision int64, err error)
 	// ListValues returns an iterator that enables to traverse all items stored
-	// under the provided <key>.
-	ListValues(key string) (ProtoKeyValIterator, error)
+	// under the provided <key>. The items are listed by a single request
+	// unless WithPageSize is given (then they are fetched in pages on demand),
+	// the listing can be adjusted using ListOptions.
+	ListValues(key string, opts ...ListOption) (ProtoKeyValIterator, error)
 	// ListKeys returns an iterator that allows to traverse all keys from data
-	// store that share the given <prefix>.
-	ListKeys(prefix string) (ProtoKeyIterator, error)
+	// store that share the given <prefix>. The keys are listed by a single
+	// request unless WithPageSize is given (then they are fetched in pages
+	// on demand), the listing can be adjusted using ListOptions.
+	ListKeys(prefix string, opts ...ListOption) (ProtoKeyIterator, error)
 	// Delete removes data stored under the <key>.
 	Delete(key string, opts ...datasync.DelOption) (existed bool, err error)
 }
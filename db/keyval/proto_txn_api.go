@@ -32,3 +32,49 @@ type ProtoTxn interface {
 	// of them and an error is returned.
 	Commit() error
 }
+
+// ProtoCondTxn is a conditional transaction. It is like BytesCondTxn, except
+// that data are protobuf/JSON formatted.
+type ProtoCondTxn interface {
+	// If adds conditions (see RevEquals(), Missing(), ProtoValueEquals())
+	// into the transaction.
+	If(conditions ...TxnCondition) ProtoCondTxn
+	// Then adds operations (see ProtoOpPut(), ProtoOpDelete()) applied if all
+	// the conditions hold.
+	Then(ops ...ProtoTxnOp) ProtoCondTxn
+	// Else adds operations (see ProtoOpPut(), ProtoOpDelete()) applied if any
+	// of the conditions does not hold.
+	Else(ops ...ProtoTxnOp) ProtoCondTxn
+	// Commit evaluates the conditions and applies the selected operations.
+	// <succeeded> is true if all the conditions held (i.e. the Then operations
+	// were applied).
+	Commit() (succeeded bool, err error)
+}
+
+// ProtoCondTxnBroker is implemented by the proto brokers that support
+// conditional transactions.
+type ProtoCondTxnBroker interface {
+	// NewCondTxn creates a conditional transaction.
+	NewCondTxn() ProtoCondTxn
+}
+
+// ProtoTxnOp is an operation of a conditional transaction with
+// protobuf/JSON formatted data.
+type ProtoTxnOp struct {
+	// Key of the item that is written or removed.
+	Key string
+	// Value written under the key (if not Delete).
+	Value proto.Message
+	// Delete is true if the item is removed.
+	Delete bool
+}
+
+// ProtoOpPut returns an operation that writes <value> under the <key>.
+func ProtoOpPut(key string, value proto.Message) ProtoTxnOp {
+	return ProtoTxnOp{Key: key, Value: value}
+}
+
+// ProtoOpDelete returns an operation that removes the item under the <key>.
+func ProtoOpDelete(key string) ProtoTxnOp {
+	return ProtoTxnOp{Key: key, Delete: true}
+}
@@ -17,6 +17,7 @@ package redis
 import (
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/ligato/cn-infra/datasync"
@@ -33,25 +34,47 @@ type BytesConnectionRedis struct {
 	// closeCh will be closed when this connection is closed, i.e. by the Close() method.
 	// It is used to give go routines a signal to stop.
 	closeCh chan string
+	// stopCh is closed by Close() to stop the refreshes of the leases
+	// and of the locks held by this connection.
+	stopCh chan struct{}
 
 	// Flag to indicate whether this connection is closed.
 	closed bool
+
+	// leases granted by GrantLease()
+	leaseAccess sync.Mutex
+	leases      map[keyval.LeaseID]*lease
+	lastLeaseID int64
+
+	// changes are appended to the streams if the change feed is enabled
+	changeFeed *changeFeed
+	// store of the revisions delivered by the watchers reading the change feed
+	watchRevisions keyval.WatchRevisionStore
+
+	// how transactions with keys of several hash slots are committed
+	crossSlotTxn CrossSlotTxnMode
 }
 
 // bytesKeyIterator is an iterator returned by ListKeys call.
 type bytesKeyIterator struct {
-	index      int
-	keys       []string
-	db         *BytesConnectionRedis
-	pattern    string
-	cursor     uint64
-	trimPrefix func(key string) string
-	err        error
+	index   int
+	keys    []string
+	db      *BytesConnectionRedis
+	pattern string
+	cursor  uint64
+	prefix  string // removed from the returned keys
+	opts    keyval.ListOptions
+	// ordered is true if the keys were selected by WithLimit or WithStartAfter
+	// option, <selected> then holds the keys of the following pages.
+	ordered  bool
+	selected []string
+	err      error
 }
 
 // bytesKeyValIterator is an iterator returned by ListValues call.
 type bytesKeyValIterator struct {
-	values [][]byte
+	values    [][]byte
+	prevValue []byte
 	bytesKeyIterator
 }
 
@@ -65,7 +88,32 @@ type bytesKeyVal struct {
 // NewBytesConnection creates a new instance of BytesConnectionRedis using the provided
 // Client (be it node, or cluster, or sentinel client).
 func NewBytesConnection(client Client, log logging.Logger) (*BytesConnectionRedis, error) {
-	return &BytesConnectionRedis{log, client, make(chan string), false}, nil
+	return &BytesConnectionRedis{
+		Logger:  log,
+		client:  client,
+		closeCh: make(chan string),
+		stopCh:  make(chan struct{}),
+		leases:  make(map[keyval.LeaseID]*lease),
+	}, nil
+}
+
+// EnableChangeFeed enables the change feed based on Redis Streams
+// (see ChangeFeedConfig). It should be called before the connection is used.
+func (db *BytesConnectionRedis) EnableChangeFeed(cfg ChangeFeedConfig) {
+	db.changeFeed = newChangeFeed(cfg)
+}
+
+// SetWatchRevisionStore sets the store of the revisions up to which
+// the watchers reading the change feed delivered the changes. The watches
+// continue from the stored revisions (see keyval.WatchRevisionStore).
+func (db *BytesConnectionRedis) SetWatchRevisionStore(store keyval.WatchRevisionStore) {
+	db.watchRevisions = store
+}
+
+// recordsChanges returns true if the changes made by the operations are
+// appended to the change feed.
+func (db *BytesConnectionRedis) recordsChanges(ops ...op) bool {
+	return db.changeFeed != nil && db.changeFeed.records(ops)
 }
 
 // Close closes the connection to redis.
@@ -77,6 +125,7 @@ func (db *BytesConnectionRedis) Close() error {
 	db.Debug("Close()")
 	db.closed = true
 	safeclose.Close(db.closeCh)
+	close(db.stopCh)
 	if db.client != nil {
 		err := safeclose.Close(db.client)
 		if err != nil {
@@ -97,7 +146,19 @@ func (db *BytesConnectionRedis) NewTxn() keyval.BytesTxn {
 	return &Txn{db: db, ops: []op{}, addPrefix: nil}
 }
 
+// NewCondTxn creates a new conditional transaction (see CondTxn).
+func (db *BytesConnectionRedis) NewCondTxn() keyval.BytesCondTxn {
+	db.Debug("NewCondTxn()")
+
+	return &CondTxn{db: db}
+}
+
 // Put sets the key/value in Redis data store. Replaces value if the key already exists.
+// With datasync.WithCreateOnly() option the key is set only if it does not exist yet
+// (keyval.ErrRevisionMismatch is returned otherwise). Redis does not keep revisions
+// of the keys, datasync.WithExpectedRevision() with a non-zero revision is therefore
+// not supported. With keyval.WithLease() option the key expires together with
+// the lease (see GrantLease()), the option can be combined with WithCreateOnly().
 func (db *BytesConnectionRedis) Put(key string, data []byte, opts ...datasync.PutOption) error {
 	if db.closed {
 		return fmt.Errorf("Put(%s) called on a closed connection", key)
@@ -110,6 +171,42 @@ func (db *BytesConnectionRedis) Put(key string, data []byte, opts ...datasync.Pu
 			ttl = withTTL.TTL
 		}
 	}
+	rev, createOnly := keyval.PutExpectedRevision(opts...)
+	if createOnly && rev != 0 {
+		return fmt.Errorf("Put(%s) failed: revisions are not supported by Redis", key)
+	}
+	if id, found := keyval.PutLease(opts...); found {
+		return db.putWithLease(key, data, id, createOnly)
+	}
+	if err := db.put(key, data, ttl, createOnly); err != nil {
+		return err
+	}
+	// the key is released only once it was written (a failed create-only
+	// put must not detach an existing key from its lease)
+	db.releaseKeys(key)
+	return nil
+}
+
+// put writes the key without a lease.
+func (db *BytesConnectionRedis) put(key string, data []byte, ttl time.Duration, createOnly bool) error {
+	if db.recordsChanges(op{key: key}) {
+		created, _, err := db.changeFeed.apply(db.client, []op{{key: key, value: data}}, ttl, createOnly)
+		if err != nil {
+			return fmt.Errorf("Put(%s) failed: %s", key, err)
+		} else if !created {
+			return &keyval.ErrRevisionMismatch{Key: key}
+		}
+		return nil
+	}
+	if createOnly {
+		created, err := db.client.SetNX(key, data, ttl).Result()
+		if err != nil {
+			return fmt.Errorf("SetNX(%s) failed: %s", key, err)
+		} else if !created {
+			return &keyval.ErrRevisionMismatch{Key: key}
+		}
+		return nil
+	}
 	err := db.client.Set(key, data, ttl).Err()
 	if err != nil {
 		return fmt.Errorf("Set(%s) failed: %s", key, err)
@@ -137,29 +234,44 @@ func (db *BytesConnectionRedis) GetValue(key string) (data []byte, found bool, r
 
 // ListKeys returns an iterator used to traverse keys that start with the given match string.
 // When done traversing, you must close the iterator by calling its Close() method.
-func (db *BytesConnectionRedis) ListKeys(match string) (keyval.BytesKeyIterator, error) {
+func (db *BytesConnectionRedis) ListKeys(match string, opts ...keyval.ListOption) (keyval.BytesKeyIterator, error) {
 	if db.closed {
 		return nil, fmt.Errorf("ListKeys(%s) called on a closed connection", match)
 	}
-	return listKeys(db, match, nil, nil)
+	return listKeys(db, match, "", keyval.ParseListOptions(opts...))
 }
 
 // ListValues returns an iterator used to traverse key value pairs for all the keys that start with the given match string.
 // When done traversing, you must close the iterator by calling its Close() method.
-func (db *BytesConnectionRedis) ListValues(match string) (keyval.BytesKeyValIterator, error) {
+func (db *BytesConnectionRedis) ListValues(match string, opts ...keyval.ListOption) (keyval.BytesKeyValIterator, error) {
 	if db.closed {
 		return nil, fmt.Errorf("ListValues(%s) called on a closed connection", match)
 	}
-	return listValues(db, match, nil, nil)
+	return listValues(db, match, "", keyval.ParseListOptions(opts...))
 }
 
 // Delete deletes all the keys that start with the given match string.
+// Redis does not keep revisions of the keys, datasync.WithExpectedRevision()
+// is supported only with revision 0 (i.e. the key must not exist).
 func (db *BytesConnectionRedis) Delete(key string, opts ...datasync.DelOption) (found bool, err error) {
 	if db.closed {
 		return false, fmt.Errorf("Delete(%s) called on a closed connection", key)
 	}
 	db.Debugf("Delete(%s)", key)
 
+	if rev, expected := keyval.DelExpectedRevision(opts...); expected {
+		if rev != 0 {
+			return false, fmt.Errorf("Delete(%s) failed: revisions are not supported by Redis", key)
+		}
+		exists, err := db.client.Exists(key).Result()
+		if err != nil {
+			return false, fmt.Errorf("Exists(%s) failed: %s", key, err)
+		} else if exists != 0 {
+			return false, &keyval.ErrRevisionMismatch{Key: key}
+		}
+		return false, nil
+	}
+
 	keysToDelete := []string{}
 
 	var keyIsPrefix bool
@@ -187,6 +299,15 @@ func (db *BytesConnectionRedis) Delete(key string, opts ...datasync.DelOption) (
 	} else {
 		keysToDelete = append(keysToDelete, key)
 	}
+	db.releaseKeys(keysToDelete...)
+
+	if db.recordsChanges(delOps(keysToDelete)...) {
+		_, deleted, err := db.changeFeed.apply(db.client, delOps(keysToDelete), 0, false)
+		if err != nil {
+			return false, fmt.Errorf("Delete(%s) failed: %s", key, err)
+		}
+		return deleted != 0, nil
+	}
 
 	intCmd := db.client.Del(keysToDelete...)
 	if intCmd.Err() != nil {
@@ -203,33 +324,45 @@ func (it *bytesKeyIterator) Close() error {
 // GetNext returns the next item from the iterator.
 // If the iterator encounters an error or has reached the last item previously, lastReceived is set to true.
 func (it *bytesKeyIterator) GetNext() (key string, rev int64, lastReceived bool) {
-	if it.err != nil {
+	if it.err != nil || (it.index >= len(it.keys) && !it.fetchKeys()) {
 		return "", 0, true
 	}
-	if it.index >= len(it.keys) {
+
+	key = strings.TrimPrefix(it.keys[it.index], it.prefix)
+	it.index++
+
+	return key, 0, false
+}
+
+// fetchKeys fetches the keys of the next page. It returns false if there are
+// no more keys or an error occurred.
+func (it *bytesKeyIterator) fetchKeys() bool {
+	if it.err != nil {
+		return false
+	}
+	if it.ordered {
+		if len(it.selected) == 0 {
+			return false
+		}
+		size := it.opts.PageSize
+		if size == 0 || size > len(it.selected) {
+			size = len(it.selected)
+		}
+		it.keys, it.selected = it.selected[:size], it.selected[size:]
+	} else {
 		if it.cursor == 0 {
-			return "", 0, true
+			return false
 		}
 		var err error
-		it.keys, it.cursor, err = scanKeys(it.db, it.pattern, it.cursor)
+		it.keys, it.cursor, err = scanKeys(it.db, it.pattern, it.cursor, it.opts.PageSize)
 		if err != nil {
 			it.err = err
 			it.db.Errorf("GetNext() failed: %s (pattern %s)", err.Error(), it.pattern)
-			return "", 0, true
+			return false
 		}
-		if len(it.keys) == 0 {
-			return "", 0, it.cursor == 0
-		}
-		it.index = 0
-	}
-
-	key = it.keys[it.index]
-	if it.trimPrefix != nil {
-		key = it.trimPrefix(key)
 	}
-	it.index++
-
-	return key, 0, false
+	it.index = 0
+	return len(it.keys) > 0
 }
 
 // Close closes the iterator. It returns either an error (if it occurs), or nil.
@@ -243,46 +376,38 @@ func (it *bytesKeyValIterator) GetNext() (kv keyval.BytesKeyVal, lastReceived bo
 	if it.err != nil {
 		return nil, true
 	}
-	if it.index >= len(it.values) {
-		if it.cursor == 0 {
-			return nil, true
-		}
-		var err error
-		it.keys, it.cursor, err = scanKeys(it.db, it.pattern, it.cursor)
-		if err != nil {
-			it.err = err
-			it.db.Errorf("GetNext() failed: %s (pattern %s)", err.Error(), it.pattern)
-			return nil, true
-		}
-		if len(it.keys) == 0 {
-			return nil, it.cursor == 0
-		}
-		it.values, err = getValues(it.db, it.keys)
-		if err != nil {
-			it.err = err
-			it.db.Errorf("GetNext() failed: %s (pattern %s)", err.Error(), it.pattern)
+	if it.index >= len(it.keys) {
+		if !it.fetchKeys() || !it.fetchValues() {
 			return nil, true
 		}
-		it.index = 0
-	}
-
-	key := it.keys[it.index]
-	if it.trimPrefix != nil {
-		key = it.trimPrefix(key)
 	}
 
+	key := strings.TrimPrefix(it.keys[it.index], it.prefix)
 	value := it.values[it.index]
-	var prevValue []byte
-	if it.index > 0 {
-		prevValue = it.values[it.index-1]
-	}
-
-	kv = &bytesKeyVal{key, value, prevValue}
+	kv = &bytesKeyVal{key, value, it.prevValue}
+	it.prevValue = value
 	it.index++
 
 	return kv, false
 }
 
+// fetchValues fetches the values of the keys of the current page
+// (unless WithKeysOnly option is used).
+func (it *bytesKeyValIterator) fetchValues() bool {
+	if it.opts.KeysOnly {
+		it.values = make([][]byte, len(it.keys))
+		return true
+	}
+	var err error
+	it.values, err = getValues(it.db, it.keys)
+	if err != nil {
+		it.err = err
+		it.db.Errorf("GetNext() failed: %s (pattern %s)", err.Error(), it.pattern)
+		return false
+	}
+	return true
+}
+
 // GetValue returns the value of the pair.
 func (kv *bytesKeyVal) GetValue() []byte {
 	return kv.value
@@ -303,48 +428,70 @@ func (kv *bytesKeyVal) GetRevision() int64 {
 	return 0
 }
 
-func listKeys(db *BytesConnectionRedis, match string,
-	addPrefix func(key string) string, trimPrefix func(key string) string) (keyval.BytesKeyIterator, error) {
-	pattern := match
-	if addPrefix != nil {
-		pattern = addPrefix(pattern)
+func listKeys(db *BytesConnectionRedis, match string, prefix string, opts keyval.ListOptions) (keyval.BytesKeyIterator, error) {
+	it, err := newKeyIterator(db, match, prefix, opts)
+	if err != nil {
+		return nil, err
 	}
-	pattern = wildcard(pattern)
+	return it, nil
+}
+
+// newKeyIterator starts listing of the keys matching <match> (with <prefix>
+// prepended). Without WithLimit and WithStartAfter options the keys are
+// scanned in pages on demand (in no particular order), otherwise all matching
+// keys are scanned at once and sorted to select the requested part.
+func newKeyIterator(db *BytesConnectionRedis, match string, prefix string, opts keyval.ListOptions) (*bytesKeyIterator, error) {
+	pattern := wildcard(prefix + match)
 	db.Debugf("listKeys(%s): pattern %s", match, pattern)
 
-	keys, cursor, err := scanKeys(db, pattern, 0)
-	if err != nil {
-		return nil, err
+	it := &bytesKeyIterator{
+		db:      db,
+		pattern: pattern,
+		prefix:  prefix,
+		opts:    opts,
+		ordered: opts.Limit > 0 || opts.StartAfter != "",
+	}
+	if !it.ordered {
+		keys, cursor, err := scanKeys(db, pattern, 0, opts.PageSize)
+		if err != nil {
+			return nil, err
+		}
+		it.keys, it.cursor = keys, cursor
+		return it, nil
+	}
+
+	var all []string
+	for cursor := uint64(0); ; {
+		keys, next, err := scanKeys(db, pattern, cursor, opts.PageSize)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, keys...)
+		if next == 0 {
+			break
+		}
+		cursor = next
 	}
-	return &bytesKeyIterator{
-		index:      0,
-		keys:       keys,
-		db:         db,
-		pattern:    pattern,
-		cursor:     cursor,
-		trimPrefix: trimPrefix}, nil
+	it.selected = opts.SelectKeys(all, prefix)
+	it.fetchKeys()
+	return it, nil
 }
 
-func listValues(db *BytesConnectionRedis, match string,
-	addPrefix func(key string) string, trimPrefix func(key string) string) (keyval.BytesKeyValIterator, error) {
-	keyIterator, err := listKeys(db, match, addPrefix, trimPrefix)
+func listValues(db *BytesConnectionRedis, match string, prefix string, opts keyval.ListOptions) (keyval.BytesKeyValIterator, error) {
+	keyIterator, err := newKeyIterator(db, match, prefix, opts)
 	if err != nil {
 		return nil, err
 	}
-	bkIterator := keyIterator.(*bytesKeyIterator)
-	values, err := getValues(db, bkIterator.keys)
-	if err != nil {
-		return nil, err
+	it := &bytesKeyValIterator{bytesKeyIterator: *keyIterator}
+	if !it.fetchValues() {
+		return nil, it.err
 	}
-	return &bytesKeyValIterator{
-		values:           values,
-		bytesKeyIterator: *bkIterator}, nil
+	return it, nil
 }
 
-func scanKeys(db *BytesConnectionRedis, pattern string, cursor uint64) (keys []string, next uint64, err error) {
+func scanKeys(db *BytesConnectionRedis, pattern string, cursor uint64, count int) (keys []string, next uint64, err error) {
 	for {
-		// count == 0 defaults to Redis default. See https://redis.io/commands/scan.
-		keys, next, err = db.client.Scan(cursor, pattern, 0).Result()
+		keys, next, err = db.client.Scan(cursor, pattern, int64(count)).Result()
 		if err != nil {
 			db.Errorf("Scan(%s) failed: %s", pattern, err)
 			return keys, next, err
@@ -352,9 +499,9 @@ func scanKeys(db *BytesConnectionRedis, pattern string, cursor uint64) (keys []s
 		if keys == nil {
 			keys = []string{}
 		}
-		count := len(keys)
-		if count > 0 || next == 0 {
-			db.Debugf("scanKeys(%s): got %d keys @ cursor %d (next cursor %d)", pattern, count, cursor, next)
+		n := len(keys)
+		if n > 0 || next == 0 {
+			db.Debugf("scanKeys(%s): got %d keys @ cursor %d (next cursor %d)", pattern, n, cursor, next)
 			return keys, next, nil
 		}
 		cursor = next
@@ -457,6 +604,15 @@ func (pdb *BytesBrokerWatcherRedis) NewTxn() keyval.BytesTxn {
 	return &Txn{db: pdb.delegate, ops: []op{}, addPrefix: pdb.addPrefix}
 }
 
+// NewCondTxn creates a new conditional transaction (see CondTxn).
+// Prefix will be prepended to the keys of all conditions and operations
+// in the transaction.
+func (pdb *BytesBrokerWatcherRedis) NewCondTxn() keyval.BytesCondTxn {
+	pdb.Debug("NewCondTxn()")
+
+	return &CondTxn{db: pdb.delegate, addPrefix: pdb.addPrefix}
+}
+
 // Put calls Put function of BytesConnectionRedis. Prefix will be prepended to the key argument.
 func (pdb *BytesBrokerWatcherRedis) Put(key string, data []byte, opts ...datasync.PutOption) error {
 	if pdb.delegate.closed {
@@ -482,22 +638,22 @@ func (pdb *BytesBrokerWatcherRedis) GetValue(key string) (data []byte, found boo
 // Prefix will be prepended to key argument when searching.
 // The returned keys, however, will have the prefix trimmed.
 // When done traversing, you must close the iterator by calling its Close() method.
-func (pdb *BytesBrokerWatcherRedis) ListKeys(match string) (keyval.BytesKeyIterator, error) {
+func (pdb *BytesBrokerWatcherRedis) ListKeys(match string, opts ...keyval.ListOption) (keyval.BytesKeyIterator, error) {
 	if pdb.delegate.closed {
 		return nil, fmt.Errorf("ListKeys(%s) called on a closed connection", match)
 	}
-	return listKeys(pdb.delegate, match, pdb.addPrefix, pdb.trimPrefix)
+	return listKeys(pdb.delegate, match, pdb.prefix, keyval.ParseListOptions(opts...))
 }
 
 // ListValues calls ListValues function of BytesConnectionRedis.
 // Prefix will be prepended to key argument when searching.
 // The returned keys, however, will have the prefix trimmed.
 // When done traversing, you must close the iterator by calling its Close() method.
-func (pdb *BytesBrokerWatcherRedis) ListValues(match string) (keyval.BytesKeyValIterator, error) {
+func (pdb *BytesBrokerWatcherRedis) ListValues(match string, opts ...keyval.ListOption) (keyval.BytesKeyValIterator, error) {
 	if pdb.delegate.closed {
 		return nil, fmt.Errorf("ListValues(%s) called on a closed connection", match)
 	}
-	return listValues(pdb.delegate, match, pdb.addPrefix, pdb.trimPrefix)
+	return listValues(pdb.delegate, match, pdb.prefix, keyval.ParseListOptions(opts...))
 }
 
 // Delete calls Delete function of BytesConnectionRedis.
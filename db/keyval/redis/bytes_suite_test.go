@@ -27,6 +27,8 @@ import (
 	"strings"
 
 	"errors"
+	"io"
+	"sort"
 
 	"github.com/alicebob/miniredis"
 	goredis "github.com/go-redis/redis"
@@ -396,6 +398,67 @@ func TestKeyValIterator(t *testing.T) {
 	_, _ = it.GetNext()
 }
 
+func TestListOptions(t *testing.T) {
+	gomega.RegisterTestingT(t)
+
+	prefix := "ListOptions-"
+	for i := 1; i <= 20; i++ {
+		key := fmt.Sprintf("%s%02d", prefix, i)
+		bytesBrokerWatcher.Put(key, []byte(key))
+	}
+
+	// pages of the keys in order
+	var listed []string
+	startAfter := ""
+	for {
+		it, err := bytesBrokerWatcher.ListValues(prefix, keyval.WithLimit(8), keyval.WithStartAfter(startAfter),
+			keyval.WithPageSize(3))
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		count := 0
+		for {
+			kv, last := it.GetNext()
+			if last {
+				break
+			}
+			gomega.Expect(kv.GetValue()).Should(gomega.BeEquivalentTo(kv.GetKey()))
+			listed = append(listed, kv.GetKey())
+			startAfter = kv.GetKey()
+			count++
+		}
+		gomega.Expect(it.(io.Closer).Close()).To(gomega.Succeed())
+		if count < 8 {
+			break
+		}
+	}
+	gomega.Expect(listed).Should(gomega.HaveLen(20))
+	gomega.Expect(sort.StringsAreSorted(listed)).Should(gomega.BeTrue())
+
+	it, err := bytesBrokerWatcher.ListValues(prefix, keyval.WithKeysOnly(), keyval.WithPageSize(5))
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	count := 0
+	for {
+		kv, last := it.GetNext()
+		if last {
+			break
+		}
+		gomega.Expect(kv.GetValue()).Should(gomega.BeNil())
+		count++
+	}
+	gomega.Expect(count).Should(gomega.Equal(20))
+
+	keys, err := bytesBrokerWatcher.ListKeys(prefix, keyval.WithStartAfter(prefix+"18"))
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	listed = nil
+	for {
+		key, _, last := keys.GetNext()
+		if last {
+			break
+		}
+		listed = append(listed, key)
+	}
+	gomega.Expect(listed).Should(gomega.Equal([]string{prefix + "19", prefix + "20"}))
+}
+
 func TestDel(t *testing.T) {
 	gomega.RegisterTestingT(t)
 
@@ -433,7 +496,175 @@ func TestTxn(t *testing.T) {
 
 	txn = bytesBrokerWatcher.NewTxn()
 	txn.Put("{hashTag}key", []byte{}).Delete("key")
-	checkCrossSlot(txn.(*Txn))
+	gomega.Expect(groupBySlot(txn.(*Txn).ops)).Should(gomega.HaveLen(2))
+}
+
+func TestCondTxn(t *testing.T) {
+	gomega.RegisterTestingT(t)
+
+	gomega.Expect(bytesBrokerWatcher.Put("condKey", []byte("val"))).To(gomega.Succeed())
+
+	succeeded, err := bytesBrokerWatcher.NewCondTxn().
+		If(keyval.ValueEquals("condKey", []byte("val")), keyval.Missing("condOther")).
+		Then(keyval.OpPut("condKey", []byte("new")), keyval.OpPut("condOther", []byte("other"))).
+		Commit()
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	gomega.Expect(succeeded).Should(gomega.BeTrue())
+	val, _, _, err := bytesBrokerWatcher.GetValue("condKey")
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	gomega.Expect(val).Should(gomega.Equal([]byte("new")))
+
+	succeeded, err = bytesBrokerWatcher.NewCondTxn().
+		If(keyval.Missing("condOther")).
+		Then(keyval.OpDelete("condKey")).
+		Else(keyval.OpDelete("condOther")).
+		Commit()
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	gomega.Expect(succeeded).Should(gomega.BeFalse())
+	_, found, _, err := bytesBrokerWatcher.GetValue("condKey")
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	gomega.Expect(found).Should(gomega.BeTrue())
+	_, found, _, err = bytesBrokerWatcher.GetValue("condOther")
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	gomega.Expect(found).Should(gomega.BeFalse())
+
+	// revisions are not supported
+	_, err = bytesBrokerWatcher.NewCondTxn().If(keyval.RevEquals("condKey", 1)).Commit()
+	gomega.Expect(err).Should(gomega.HaveOccurred())
+}
+
+func TestPutCreateOnly(t *testing.T) {
+	gomega.RegisterTestingT(t)
+
+	err := bytesBrokerWatcher.Put("createOnly", []byte("val"), datasync.WithCreateOnly())
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	err = bytesBrokerWatcher.Put("createOnly", []byte("other"), datasync.WithCreateOnly())
+	gomega.Expect(err).Should(gomega.BeAssignableToTypeOf(&keyval.ErrRevisionMismatch{}))
+	val, _, _, err := bytesBrokerWatcher.GetValue("createOnly")
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	gomega.Expect(val).Should(gomega.Equal([]byte("val")))
+
+	// revisions are not supported
+	err = bytesBrokerWatcher.Put("createOnly", []byte("other"), datasync.WithExpectedRevision(1))
+	gomega.Expect(err).Should(gomega.HaveOccurred())
+	_, err = bytesBrokerWatcher.Delete("createOnly", datasync.WithExpectedRevision(1))
+	gomega.Expect(err).Should(gomega.HaveOccurred())
+	found, err := bytesBrokerWatcher.Delete("createOnly")
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	gomega.Expect(found).Should(gomega.BeTrue())
+}
+
+func TestLease(t *testing.T) {
+	gomega.RegisterTestingT(t)
+
+	id, err := bytesConn.GrantLease(300 * time.Millisecond)
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	err = bytesConn.Put("leased", []byte("val"), keyval.WithLease(id))
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	gomega.Expect(miniRedis.TTL("leased")).Should(gomega.Equal(300 * time.Millisecond))
+
+	// the expiration is refreshed while the lease is kept alive
+	gomega.Expect(bytesConn.KeepAlive(id)).To(gomega.Succeed())
+	miniRedis.FastForward(200 * time.Millisecond)
+	gomega.Eventually(func() time.Duration {
+		return miniRedis.TTL("leased")
+	}).Should(gomega.Equal(300 * time.Millisecond))
+
+	gomega.Expect(bytesConn.Revoke(id)).To(gomega.Succeed())
+	gomega.Expect(miniRedis.Exists("leased")).Should(gomega.BeFalse())
+
+	err = bytesConn.Put("leased", []byte("val"), keyval.WithLease(id))
+	gomega.Expect(err).Should(gomega.HaveOccurred())
+}
+
+func TestLeaseCreateOnly(t *testing.T) {
+	gomega.RegisterTestingT(t)
+
+	id, err := bytesConn.GrantLease(time.Minute)
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	err = bytesConn.Put("leasedCreateOnly", []byte("val"), keyval.WithLease(id), datasync.WithCreateOnly())
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	gomega.Expect(miniRedis.TTL("leasedCreateOnly")).Should(gomega.Equal(time.Minute))
+
+	// the existing key is neither overwritten nor bound to the other lease
+	otherID, err := bytesConn.GrantLease(time.Hour)
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	err = bytesConn.Put("leasedCreateOnly", []byte("other"), keyval.WithLease(otherID), datasync.WithCreateOnly())
+	gomega.Expect(err).Should(gomega.BeAssignableToTypeOf(&keyval.ErrRevisionMismatch{}))
+	val, _, _, err := bytesConn.GetValue("leasedCreateOnly")
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	gomega.Expect(val).Should(gomega.Equal([]byte("val")))
+	gomega.Expect(miniRedis.TTL("leasedCreateOnly")).Should(gomega.Equal(time.Minute))
+
+	gomega.Expect(bytesConn.Revoke(otherID)).To(gomega.Succeed())
+	gomega.Expect(miniRedis.Exists("leasedCreateOnly")).Should(gomega.BeTrue())
+	gomega.Expect(bytesConn.Revoke(id)).To(gomega.Succeed())
+	gomega.Expect(miniRedis.Exists("leasedCreateOnly")).Should(gomega.BeFalse())
+}
+
+func TestLeaseKeptByFailedPut(t *testing.T) {
+	gomega.RegisterTestingT(t)
+
+	id, err := bytesConn.GrantLease(300 * time.Millisecond)
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	err = bytesConn.Put("leasedFailedPut", []byte("val"), keyval.WithLease(id))
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	gomega.Expect(bytesConn.KeepAlive(id)).To(gomega.Succeed())
+
+	// the key is not overwritten and stays bound to the lease
+	err = bytesConn.Put("leasedFailedPut", []byte("other"), datasync.WithCreateOnly())
+	gomega.Expect(err).Should(gomega.BeAssignableToTypeOf(&keyval.ErrRevisionMismatch{}))
+
+	// its expiration is still refreshed past the TTL
+	for i := 0; i < 3; i++ {
+		miniRedis.FastForward(200 * time.Millisecond)
+		gomega.Eventually(func() time.Duration {
+			return miniRedis.TTL("leasedFailedPut")
+		}).Should(gomega.Equal(300 * time.Millisecond))
+	}
+	val, _, _, err := bytesConn.GetValue("leasedFailedPut")
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	gomega.Expect(val).Should(gomega.Equal([]byte("val")))
+
+	gomega.Expect(bytesConn.Revoke(id)).To(gomega.Succeed())
+	gomega.Expect(miniRedis.Exists("leasedFailedPut")).Should(gomega.BeFalse())
+}
+
+func TestLeaseReleasedKeys(t *testing.T) {
+	gomega.RegisterTestingT(t)
+
+	id, err := bytesConn.GrantLease(300 * time.Millisecond)
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	otherID, err := bytesConn.GrantLease(time.Minute)
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	for _, key := range []string{"released/put", "released/other", "released/deleted", "released/txn"} {
+		gomega.Expect(bytesConn.Put(key, []byte("val"), keyval.WithLease(id))).To(gomega.Succeed())
+	}
+	gomega.Expect(bytesConn.KeepAlive(id)).To(gomega.Succeed())
+
+	// the keys overwritten or deleted later no longer belong to the lease
+	gomega.Expect(bytesConn.Put("released/put", []byte("new"))).To(gomega.Succeed())
+	gomega.Expect(bytesConn.Put("released/other", []byte("new"), keyval.WithLease(otherID))).To(gomega.Succeed())
+	_, err = bytesConn.Delete("released/deleted")
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	gomega.Expect(bytesConn.NewTxn().Put("released/txn", []byte("new")).Commit()).To(gomega.Succeed())
+
+	// their expiration is not refreshed by the lease
+	gomega.Consistently(func() time.Duration {
+		return miniRedis.TTL("released/put")
+	}, 250*time.Millisecond).Should(gomega.BeZero())
+	gomega.Expect(miniRedis.TTL("released/other")).Should(gomega.Equal(time.Minute))
+
+	// and they are not deleted by Revoke()
+	gomega.Expect(bytesConn.Revoke(id)).To(gomega.Succeed())
+	for _, key := range []string{"released/put", "released/other", "released/txn"} {
+		gomega.Expect(miniRedis.Exists(key)).Should(gomega.BeTrue(), key)
+	}
+	gomega.Expect(bytesConn.Revoke(otherID)).To(gomega.Succeed())
+	gomega.Expect(miniRedis.Exists("released/other")).Should(gomega.BeFalse())
+	_, err = bytesConn.Delete("released/", datasync.WithPrefix())
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
 }
 
 /* miniRedis does not support PSUBSCRIBE yet.
@@ -17,6 +17,7 @@ package redis
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	goredis "github.com/go-redis/redis"
 	"github.com/howeyc/crc16"
@@ -27,6 +28,7 @@ type op struct {
 	key   string
 	value []byte
 	del   bool
+	ttl   time.Duration // expiration of the put value (0 = no expiration)
 }
 
 // Txn allows to group operations into the transaction. Transaction executes multiple operations
@@ -46,7 +48,7 @@ func (tx *Txn) Put(key string, value []byte) keyval.BytesTxn {
 	if tx.addPrefix != nil {
 		key = tx.addPrefix(key)
 	}
-	tx.ops = append(tx.ops, op{key, value, false})
+	tx.ops = append(tx.ops, op{key: key, value: value})
 	return tx
 }
 
@@ -56,13 +58,15 @@ func (tx *Txn) Delete(key string) keyval.BytesTxn {
 	if tx.addPrefix != nil {
 		key = tx.addPrefix(key)
 	}
-	tx.ops = append(tx.ops, op{key, nil, true})
+	tx.ops = append(tx.ops, op{key: key, del: true})
 	return tx
 }
 
 // Commit commits all operations in a transaction to the data store.
 // Commit is atomic - either all operations in the transaction are
-// committed to the data store, or none of them.
+// committed to the data store, or none of them. In Redis Cluster,
+// transactions with keys of several hash slots are committed according
+// to the CrossSlotTxnMode of the connection (rejected by default).
 func (tx *Txn) Commit() (err error) {
 	if tx.db.closed {
 		return fmt.Errorf("Commit() called on a closed connection")
@@ -73,67 +77,166 @@ func (tx *Txn) Commit() (err error) {
 		return nil
 	}
 
+	if _, isCluster := tx.db.client.(*goredis.ClusterClient); isCluster {
+		if groups := groupBySlot(tx.ops); len(groups) > 1 {
+			return tx.db.commitCrossSlot(groups)
+		}
+	}
+	if err := tx.db.commitOps(tx.ops); err != nil {
+		return err
+	}
+	tx.db.releaseOps(tx.ops)
+	return nil
+}
+
+// commitOps applies the operations in MULTI/EXEC (or by the script
+// of the change feed).
+func (db *BytesConnectionRedis) commitOps(ops []op) error {
+	if db.recordsChanges(ops...) {
+		if _, _, err := db.changeFeed.apply(db.client, ops, 0, false); err != nil {
+			return fmt.Errorf("Commit() failed: %s", err)
+		}
+		return nil
+	}
+
 	// go-redis
 
-	pipeline := tx.db.client.TxPipeline()
-	for _, op := range tx.ops {
+	pipeline := db.client.TxPipeline()
+	for _, op := range ops {
 		if op.del {
 			pipeline.Del(op.key)
 		} else {
-			pipeline.Set(op.key, op.value, 0)
+			pipeline.Set(op.key, op.value, op.ttl)
 		}
 	}
-	_, err = pipeline.Exec()
-	if err != nil {
-		// Redis cluster won't let you run multi-key commands in case of cross slot.
-		// - Cross slot check may be useful indicator in case of failure.
-		if _, yes := tx.db.client.(*goredis.ClusterClient); yes {
-			checkCrossSlot(tx)
-		}
+	if _, err := pipeline.Exec(); err != nil {
 		return fmt.Errorf("%T.Exec() failed: %s", pipeline, err)
 	}
 	return nil
 }
 
-// CROSSSLOT Keys in request don't hash to the same slot
-// https://stackoverflow.com/questions/38042629/redis-cross-slot-error
-// https://redis.io/topics/cluster-spec#keys-hash-tags
-// https://redis.io/topics/cluster-tutorial
-// "Redis Cluster supports multiple key operations as long as all the keys involved into a single
-// command execution (or whole transaction, or Lua script execution) all belong to the same hash
-// slot. The user can force multiple keys to be part of the same hash slot by using a concept
-// called hash tags."
-func checkCrossSlot(tx *Txn) bool {
-	var hashSlot uint16
-	var key string
-
-	for _, op := range tx.ops {
-		if hashSlot == 0 {
-			hashSlot = getHashSlot(op.key)
-			key = op.key
-		} else {
-			slot := getHashSlot(op.key)
-			if slot != hashSlot {
-				tx.db.Warnf("%T: Found CROSS SLOT keys (%s, %d) and (%s, %d)",
-					*tx, key, hashSlot, op.key, slot)
-				return true
+// CondTxn is a conditional transaction. The keys of the conditions are
+// watched (WATCH) while the conditions are evaluated and the selected
+// operations are applied in MULTI/EXEC. If any of the watched keys is modified
+// in the meantime, the transaction is aborted and Commit returns an error.
+// Redis does not keep revisions of the keys, keyval.RevEquals() conditions
+// are therefore not supported.
+type CondTxn struct {
+	db         *BytesConnectionRedis
+	conditions []keyval.TxnCondition
+	thenOps    []op
+	elseOps    []op
+	addPrefix  func(key string) string
+}
+
+// If adds conditions into the transaction.
+func (tx *CondTxn) If(conditions ...keyval.TxnCondition) keyval.BytesCondTxn {
+	for _, cond := range conditions {
+		if tx.addPrefix != nil {
+			cond.Key = tx.addPrefix(cond.Key)
+		}
+		tx.conditions = append(tx.conditions, cond)
+	}
+	return tx
+}
+
+// Then adds operations applied if all the conditions hold.
+func (tx *CondTxn) Then(ops ...keyval.TxnOp) keyval.BytesCondTxn {
+	tx.thenOps = tx.appendOps(tx.thenOps, ops)
+	return tx
+}
+
+// Else adds operations applied if any of the conditions does not hold.
+func (tx *CondTxn) Else(ops ...keyval.TxnOp) keyval.BytesCondTxn {
+	tx.elseOps = tx.appendOps(tx.elseOps, ops)
+	return tx
+}
+
+// Commit evaluates the conditions and applies the selected operations.
+func (tx *CondTxn) Commit() (succeeded bool, err error) {
+	if tx.db.closed {
+		return false, fmt.Errorf("Commit() called on a closed connection")
+	}
+	tx.db.Debug("Commit()")
+
+	var keys []string
+	for _, cond := range tx.conditions {
+		if cond.Type == keyval.CondRevEquals {
+			return false, fmt.Errorf("revisions are not supported by Redis (condition on %s)", cond.Key)
+		}
+		keys = append(keys, cond.Key)
+	}
+
+	var applied []op
+	err = tx.db.client.Watch(func(rtx *goredis.Tx) error {
+		applied = nil
+		succeeded = true
+		for _, cond := range tx.conditions {
+			value, err := rtx.Get(cond.Key).Bytes()
+			if err != nil && err != GoRedisNil {
+				return fmt.Errorf("Get(%s) failed: %s", cond.Key, err)
 			}
+			if !cond.Holds(value, err == nil, 0) {
+				succeeded = false
+				break
+			}
+		}
+		ops := tx.thenOps
+		if !succeeded {
+			ops = tx.elseOps
+		}
+		if len(ops) == 0 {
+			return nil
+		}
+		_, err := rtx.Pipelined(func(pipeline goredis.Pipeliner) error {
+			if tx.db.recordsChanges(ops...) {
+				scriptKeys, args := tx.db.changeFeed.scriptArgs(ops, 0, false)
+				changeScript.Eval(pipeline, scriptKeys, args...)
+				return nil
+			}
+			for _, op := range ops {
+				if op.del {
+					pipeline.Del(op.key)
+				} else {
+					pipeline.Set(op.key, op.value, op.ttl)
+				}
+			}
+			return nil
+		})
+		if err == nil {
+			applied = ops
+		}
+		return err
+	}, keys...)
+	if err == goredis.TxFailedErr {
+		return false, fmt.Errorf("transaction aborted, watched keys %v were modified: %s", keys, err)
+	} else if err != nil {
+		return false, err
+	}
+	tx.db.releaseOps(applied)
+	return succeeded, nil
+}
+
+func (tx *CondTxn) appendOps(redisOps []op, ops []keyval.TxnOp) []op {
+	for _, txnOp := range ops {
+		key := txnOp.Key
+		if tx.addPrefix != nil {
+			key = tx.addPrefix(key)
 		}
+		redisOps = append(redisOps, op{key: key, value: txnOp.Value, del: txnOp.Delete})
 	}
-	return false
+	return redisOps
 }
 
+// getHashSlot returns the hash slot of the key - CRC16 (XMODEM) of the key
+// or of its hash tag (non-empty part between the first { and the following }).
 func getHashSlot(key string) uint16 {
-	var tag string
-	start := strings.Index(key, "{")
-	if start != -1 {
-		start++
-		tagSlice := key[start:]
-		end := strings.Index(tagSlice, "}")
-		if end != -1 {
-			tag = tagSlice[:end]
+	tag := key
+	if start := strings.Index(key, "{"); start != -1 {
+		if end := strings.Index(key[start+1:], "}"); end > 0 {
+			tag = key[start+1 : start+1+end]
 		}
 	}
 	const redisHashSlotCount = 16384
-	return crc16.ChecksumCCITT([]byte(tag)) % redisHashSlotCount
+	return crc16.Update(0, crc16.CCITTFalseTable, []byte(tag)) % redisHashSlotCount
 }
@@ -17,15 +17,33 @@ package redis
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	goredis "github.com/go-redis/redis"
 	"github.com/ligato/cn-infra/datasync"
 	"github.com/ligato/cn-infra/db/keyval"
+	"github.com/ligato/cn-infra/logging"
 	"github.com/ligato/cn-infra/utils/safeclose"
 )
 
 const keySpaceEventPrefix = "__keyspace@*__:"
 
+const (
+	// streamReadBlock is the time XREAD waits for new records of the change
+	// feed. It must be shorter than the read timeout of the client.
+	streamReadBlock = 500 * time.Millisecond
+
+	// streamReadCount is the maximum number of records returned by one XREAD.
+	streamReadCount = 100
+
+	// watchRetryPeriod is the delay before a failed XREAD is retried.
+	watchRetryPeriod = time.Second
+
+	// watchRevisionStorePeriod is the minimal period between two updates
+	// of the revisions of the watched prefix in the keyval.WatchRevisionStore.
+	watchRevisionStorePeriod = time.Second
+)
+
 // BytesWatchPutResp is sent when new key-value pair has been inserted or the value is updated.
 type BytesWatchPutResp struct {
 	key       string
@@ -66,8 +84,9 @@ func (resp *BytesWatchPutResp) GetRevision() int64 {
 
 // BytesWatchDelResp is sent when a key-value pair has been removed.
 type BytesWatchDelResp struct {
-	key string
-	rev int64 // TODO Does Redis data have revision?
+	key       string
+	prevValue []byte // known only with the change feed
+	rev       int64  // known only with the change feed
 }
 
 // NewBytesWatchDelResp creates an instance of BytesWatchDelResp.
@@ -90,9 +109,10 @@ func (resp *BytesWatchDelResp) GetValue() []byte {
 	return nil
 }
 
-// GetPrevValue returns nil for BytesWatchDelResp
+// GetPrevValue returns the value that has been deleted (nil unless
+// the change feed is enabled).
 func (resp *BytesWatchDelResp) GetPrevValue() []byte {
-	return nil
+	return resp.prevValue
 }
 
 // GetRevision returns the revision associated with the delete operation.
@@ -106,13 +126,48 @@ func (db *BytesConnectionRedis) Watch(resp func(keyval.BytesWatchResp), closeCha
 	if db.closed {
 		return fmt.Errorf("watch(%v) called on a closed connection", keys)
 	}
-	db.closeCh = closeChan
-
-	return watch(db, resp, db.closeCh, nil, nil, keys...)
+	return watch(db, resp, closeChan, nil, nil, keys...)
 }
 
 func watch(db *BytesConnectionRedis, resp func(keyval.BytesWatchResp), closeChan <-chan string,
 	addPrefix func(key string) string, trimPrefix func(key string) string, keys ...string) error {
+	if db.changeFeed != nil {
+		var unrecorded []string
+		for _, key := range keys {
+			prefix := key
+			if addPrefix != nil {
+				prefix = addPrefix(key)
+			}
+			streams := db.changeFeed.streamKeys(prefix)
+			if streams == nil {
+				unrecorded = append(unrecorded, key)
+				continue
+			}
+			// streams are read separately, they may be stored by different
+			// nodes of Redis Cluster
+			for _, stream := range streams {
+				w := &streamWatch{
+					db:         db,
+					key:        key,
+					prefix:     prefix,
+					stream:     stream,
+					trimPrefix: trimPrefix,
+					resp:       resp,
+				}
+				if err := w.start(); err != nil {
+					return err
+				}
+				go w.loop(closeChan)
+			}
+		}
+		if len(unrecorded) == 0 {
+			return nil
+		}
+		// changes of the keys not covered by the change feed are watched
+		// by keyspace notifications
+		db.Warnf("Changes of %v are not recorded in the change feed, using keyspace notifications", unrecorded)
+		keys = unrecorded
+	}
 	patterns := make([]string, len(keys))
 	for i, k := range keys {
 		if addPrefix != nil {
@@ -120,6 +175,10 @@ func watch(db *BytesConnectionRedis, resp func(keyval.BytesWatchResp), closeChan
 		}
 		patterns[i] = keySpaceEventPrefix + wildcard(k)
 	}
+	if cluster, isCluster := db.client.(*goredis.ClusterClient); isCluster {
+		// keyspace notifications are local to the nodes of the cluster
+		return watchCluster(db, cluster, resp, closeChan, trimPrefix, patterns...)
+	}
 	pubSub := db.client.PSubscribe(patterns...)
 	startWatch(db, pubSub, resp, trimPrefix, patterns...)
 	go func() {
@@ -189,6 +248,254 @@ func startWatch(db *BytesConnectionRedis, pubSub *goredis.PubSub,
 	}()
 }
 
+// streamWatch reads the changes of the keys with the given prefix from
+// a stream of the change feed (see ChangeFeedConfig). The ID of the last
+// read record is kept, so that XREAD continues exactly where it stopped,
+// even after a failure. The ID is stored (as a revision) in the
+// keyval.WatchRevisionStore of the connection, so that the watch
+// of a restarted agent continues from the stored ID. If the records
+// following the last read record were trimmed from the stream in the meantime,
+// the watched prefix is resynchronized (see resync).
+type streamWatch struct {
+	db         *BytesConnectionRedis
+	key        string // watched key as given to Watch
+	prefix     string // watched key with the prefix of the broker
+	stream     string
+	trimPrefix func(key string) string
+	resp       func(keyval.BytesWatchResp)
+
+	lastID   string // ID of the last read record
+	storedAt time.Time
+}
+
+// start sets the ID to start reading the stream from: the stored ID
+// (if any) or the ID of the last record in the stream.
+func (w *streamWatch) start() error {
+	if w.db.watchRevisions != nil {
+		rev, found, err := w.db.watchRevisions.LoadRevision(w.storeKey())
+		if err != nil {
+			w.db.WithField("prefix", w.prefix).Warnf("Failed to load the watched revision: %v", err)
+		} else if found {
+			w.lastID = revisionToStreamID(rev)
+			return w.checkGap()
+		}
+	}
+	last, err := w.edgeRecord("XREVRANGE", "+", "-")
+	if err != nil {
+		return err
+	}
+	w.lastID = "0-0"
+	if last != nil {
+		w.lastID = last.id
+	}
+	return nil
+}
+
+// edgeRecord returns the first record of the stream read by <cmdName>
+// (XRANGE for the oldest record, XREVRANGE for the newest one), nil if
+// the stream is empty.
+func (w *streamWatch) edgeRecord(cmdName, start, end string) (*streamRecord, error) {
+	cmd := goredis.NewSliceCmd(cmdName, w.stream, start, end, "COUNT", 1)
+	if err := w.db.client.Process(cmd); err != nil {
+		return nil, fmt.Errorf("%s(%s) failed: %s", cmdName, w.stream, err)
+	}
+	records, err := parseStreamEntries(cmd.Val())
+	if err != nil {
+		return nil, fmt.Errorf("%s(%s) failed: %s", cmdName, w.stream, err)
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+	return &records[0], nil
+}
+
+// checkGap resynchronizes the watched prefix if the records following
+// the last read record are no longer in the stream.
+func (w *streamWatch) checkGap() error {
+	first, err := w.edgeRecord("XRANGE", "-", "+")
+	if err != nil {
+		return err
+	}
+	firstID := ""
+	if first != nil {
+		firstID = first.id
+	}
+	if !recordsTrimmed(w.lastID, firstID) {
+		return nil
+	}
+	w.db.WithFields(logging.Fields{
+		"prefix": w.prefix,
+		"id":     w.lastID,
+		"first":  firstID,
+	}).Warn("Records of the change feed following the last read record were trimmed, resynchronizing the prefix")
+	return w.resync()
+}
+
+// recordsTrimmed returns true if records following the record <lastID> may
+// have been removed from the stream, i.e. the record <lastID> itself is no
+// longer in the stream starting with the record <firstID> (empty if the stream
+// is empty). Streams are trimmed from the oldest records (MAXLEN ~).
+func recordsTrimmed(lastID, firstID string) bool {
+	last, err := streamIDToRevision(lastID)
+	if err != nil {
+		return true
+	}
+	if firstID == "" {
+		// the stream was removed (records are never trimmed completely)
+		return last > 0
+	}
+	first, err := streamIDToRevision(firstID)
+	return err != nil || first > last
+}
+
+// resync delivers the current values of the keys recorded in the stream
+// as put events and continues reading the stream after its newest record.
+// Redis does not keep the deleted keys, the keys deleted by the trimmed
+// records therefore cannot be reported (nor the previous values).
+func (w *streamWatch) resync() error {
+	last, err := w.edgeRecord("XREVRANGE", "+", "-")
+	if err != nil {
+		return err
+	}
+	lastID := "0-0"
+	if last != nil {
+		lastID = last.id
+	}
+	rev, err := streamIDToRevision(lastID)
+	if err != nil {
+		return err
+	}
+	it, err := newKeyIterator(w.db, w.prefix, "", keyval.ListOptions{})
+	if err != nil {
+		return err
+	}
+	values := &bytesKeyValIterator{bytesKeyIterator: *it}
+	if !values.fetchValues() {
+		return values.err
+	}
+	w.db.WithField("prefix", w.prefix).Warn("Keys deleted in the trimmed records of the change feed cannot be detected")
+	for {
+		kv, stop := values.GetNext()
+		if stop {
+			break
+		}
+		key := kv.GetKey()
+		if w.db.changeFeed.streamKey(key) != w.stream || kv.GetValue() == nil {
+			continue // recorded by another stream or deleted in the meantime
+		}
+		if w.trimPrefix != nil {
+			key = w.trimPrefix(key)
+		}
+		w.resp(NewBytesWatchPutResp(key, kv.GetValue(), nil, rev))
+	}
+	if err := values.Close(); err != nil {
+		return err
+	}
+	w.lastID = lastID
+	w.storeRevision(true)
+	return nil
+}
+
+// loop reads the stream until the <closeCh> receives the watched key
+// (or is closed) or the connection is closed.
+func (w *streamWatch) loop(closeCh <-chan string) {
+	defer w.storeRevision(true)
+	w.db.Debugf("start Watch(%s) of stream %s", w.prefix, w.stream)
+
+	for {
+		if w.closed(closeCh) {
+			return
+		}
+		cmd := goredis.NewCmd("XREAD", "COUNT", streamReadCount, "BLOCK", int64(streamReadBlock/time.Millisecond),
+			"STREAMS", w.stream, w.lastID)
+		err := w.db.client.Process(cmd)
+		if w.closed(closeCh) {
+			return
+		}
+		if err == GoRedisNil {
+			continue // no new records
+		}
+		var records map[string][]streamRecord
+		if err == nil {
+			records, err = parseXReadReply(cmd.Val())
+		}
+		if err != nil {
+			w.db.WithField("prefix", w.prefix).Warnf("XREAD of the change feed failed: %v", err)
+			time.Sleep(watchRetryPeriod)
+			// the stream may have been trimmed while it could not be read
+			if err := w.checkGap(); err != nil {
+				w.db.WithField("prefix", w.prefix).Warnf("Check of the change feed failed: %v", err)
+			}
+			continue
+		}
+		for _, record := range records[w.stream] {
+			w.deliver(record)
+			w.lastID = record.id
+		}
+		w.storeRevision(false)
+	}
+}
+
+// closed returns true if the watch should end.
+func (w *streamWatch) closed(closeCh <-chan string) bool {
+	if w.db.closed {
+		return true
+	}
+	select {
+	case closeVal, ok := <-closeCh:
+		if !ok || closeVal == w.key {
+			w.db.WithField("prefix", w.prefix).Debug("Watch ended")
+			return true
+		}
+	default:
+	}
+	return false
+}
+
+// deliver delivers the change of a key with the watched prefix.
+func (w *streamWatch) deliver(record streamRecord) {
+	if !strings.HasPrefix(record.key, w.prefix) {
+		return
+	}
+	rev, err := streamIDToRevision(record.id)
+	if err != nil {
+		w.db.WithFields(logging.Fields{"prefix": w.prefix, "id": record.id}).Warn(err)
+	}
+	key := record.key
+	if w.trimPrefix != nil {
+		key = w.trimPrefix(key)
+	}
+	if record.del {
+		w.resp(&BytesWatchDelResp{key: key, prevValue: record.prevValue, rev: rev})
+	} else {
+		w.resp(NewBytesWatchPutResp(key, record.value, record.prevValue, rev))
+	}
+}
+
+// storeRevision stores the ID of the last read record into
+// the keyval.WatchRevisionStore (at most once per watchRevisionStorePeriod
+// unless <force> is true).
+func (w *streamWatch) storeRevision(force bool) {
+	store := w.db.watchRevisions
+	if store == nil || (!force && time.Since(w.storedAt) < watchRevisionStorePeriod) {
+		return
+	}
+	rev, err := streamIDToRevision(w.lastID)
+	if err == nil {
+		err = store.StoreRevision(w.storeKey(), rev)
+	}
+	if err != nil {
+		w.db.WithField("prefix", w.prefix).Warnf("Failed to store the watched revision: %v", err)
+		return
+	}
+	w.storedAt = time.Now()
+}
+
+// storeKey returns the key of the revision in the keyval.WatchRevisionStore.
+func (w *streamWatch) storeKey() string {
+	return w.stream + "|" + w.prefix
+}
+
 // Watch starts subscription for changes associated with the selected key. Watch events will be delivered to respChan.
 func (pdb *BytesBrokerWatcherRedis) Watch(resp func(keyval.BytesWatchResp), closeChan chan string, keys ...string) error {
 	if pdb.delegate.closed {
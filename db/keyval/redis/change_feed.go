@@ -0,0 +1,331 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	goredis "github.com/go-redis/redis"
+)
+
+const (
+	// DefaultChangeStreamKeyPrefix is prepended to the prefixes of the keys
+	// to form the keys of the change streams.
+	DefaultChangeStreamKeyPrefix = "__changes:"
+
+	// DefaultChangeStreamMaxLen is the default (approximate) maximum number
+	// of change records kept in a stream.
+	DefaultChangeStreamMaxLen = 100000
+
+	// seqBits is the number of bits of the revision holding the sequence
+	// number of the stream ID (the rest holds the milliseconds).
+	seqBits = 20
+)
+
+// ChangeFeedConfig configures the change feed based on Redis Streams.
+// With the change feed enabled, Put, Delete and transactions append records
+// of the changes (with previous values) to the stream of the prefix of
+// the changed key, and watchers read the streams (XREAD) instead of
+// subscribing to keyspace notifications.
+type ChangeFeedConfig struct {
+	// Enabled enables the change feed.
+	Enabled bool `json:"enabled"`
+
+	// Prefixes of the keys whose changes are recorded, each prefix has its own
+	// stream (the longest matching prefix is used). If empty, changes of all
+	// keys are recorded in a single stream.
+	Prefixes []string `json:"prefixes"`
+
+	// StreamKeyPrefix is prepended to the prefix to form the key of the stream.
+	// Default is DefaultChangeStreamKeyPrefix.
+	StreamKeyPrefix string `json:"stream-key-prefix"`
+
+	// MaxLen is the approximate maximum number of records kept in each stream.
+	// Default is DefaultChangeStreamMaxLen, negative value disables trimming.
+	MaxLen int64 `json:"max-len"`
+
+	// RevisionFile is the file where watchers store the revisions (IDs of the stream
+	// records) up to which the changes were delivered. If set, watches of a restarted
+	// agent continue from the stored revisions.
+	RevisionFile string `json:"revision-file"`
+}
+
+// changeFeed appends the changes of the keys to the streams.
+type changeFeed struct {
+	prefixes        []string
+	streamKeyPrefix string
+	maxLen          int64
+}
+
+// changeScript applies puts and deletes of the keys and appends the changes
+// to the streams atomically.
+// KEYS: pairs of (key, stream) - empty stream for keys that are not recorded,
+// ARGV: max length of the streams, create-only flag, then triples of
+// (operation, value, TTL in milliseconds) for the keys.
+// It returns false if the key of a create-only put exists, otherwise the number
+// of deleted keys.
+var changeScript = goredis.NewScript(`
+local maxLen, createOnly = tonumber(ARGV[1]), ARGV[2] == '1'
+if createOnly and redis.call('EXISTS', KEYS[1]) == 1 then
+	return false
+end
+local deleted = 0
+local arg = 3
+for i = 1, #KEYS, 2 do
+	local key, stream = KEYS[i], KEYS[i+1]
+	local op, value, ttl = ARGV[arg], ARGV[arg+1], tonumber(ARGV[arg+2])
+	arg = arg + 3
+	local prev = redis.call('GET', key)
+	if op == 'put' then
+		if ttl > 0 then
+			redis.call('SET', key, value, 'PX', ttl)
+		else
+			redis.call('SET', key, value)
+		end
+	elseif prev then
+		redis.call('DEL', key)
+		deleted = deleted + 1
+	end
+	if stream ~= '' and (op == 'put' or prev) then
+		local record = {'op', op, 'key', key}
+		if op == 'put' then
+			table.insert(record, 'value')
+			table.insert(record, value)
+		end
+		if prev then
+			table.insert(record, 'prev')
+			table.insert(record, prev)
+		end
+		if maxLen > 0 then
+			redis.call('XADD', stream, 'MAXLEN', '~', maxLen, '*', unpack(record))
+		else
+			redis.call('XADD', stream, '*', unpack(record))
+		end
+	end
+end
+return deleted
+`)
+
+// newChangeFeed creates the change feed from the configuration.
+func newChangeFeed(cfg ChangeFeedConfig) *changeFeed {
+	feed := &changeFeed{
+		prefixes:        cfg.Prefixes,
+		streamKeyPrefix: cfg.StreamKeyPrefix,
+		maxLen:          cfg.MaxLen,
+	}
+	if len(feed.prefixes) == 0 {
+		feed.prefixes = []string{""}
+	}
+	if feed.streamKeyPrefix == "" {
+		feed.streamKeyPrefix = DefaultChangeStreamKeyPrefix
+	}
+	if feed.maxLen == 0 {
+		feed.maxLen = DefaultChangeStreamMaxLen
+	}
+	return feed
+}
+
+// streamKey returns the key of the stream recording the changes of the <key>
+// (empty if the changes of the key are not recorded).
+func (feed *changeFeed) streamKey(key string) string {
+	prefix, found := feed.prefixOf(key)
+	if !found {
+		return ""
+	}
+	return feed.streamKeyPrefix + prefix
+}
+
+// prefixOf returns the longest prefix of the feed matching the <key>.
+func (feed *changeFeed) prefixOf(key string) (prefix string, found bool) {
+	for _, p := range feed.prefixes {
+		if strings.HasPrefix(key, p) && (!found || len(p) > len(prefix)) {
+			prefix, found = p, true
+		}
+	}
+	return prefix, found
+}
+
+// streamKeys returns the keys of the streams recording the changes of the keys
+// with the <prefix> - the stream of the longest feed prefix matching the <prefix>
+// and the streams of the longer feed prefixes starting with the <prefix>.
+// It returns nil if the changes of the keys with the <prefix> are not recorded.
+func (feed *changeFeed) streamKeys(prefix string) []string {
+	covering, found := feed.prefixOf(prefix)
+	if !found {
+		return nil
+	}
+	streams := []string{feed.streamKeyPrefix + covering}
+	for _, p := range feed.prefixes {
+		if len(p) > len(prefix) && strings.HasPrefix(p, prefix) {
+			streams = append(streams, feed.streamKeyPrefix+p)
+		}
+	}
+	return streams
+}
+
+// records returns true if the change of any of the keys is recorded.
+func (feed *changeFeed) records(ops []op) bool {
+	for _, op := range ops {
+		if _, found := feed.prefixOf(op.key); found {
+			return true
+		}
+	}
+	return false
+}
+
+// delOps returns the operations deleting the keys.
+func delOps(keys []string) []op {
+	ops := make([]op, len(keys))
+	for i, key := range keys {
+		ops[i] = op{key: key, del: true}
+	}
+	return ops
+}
+
+// scriptArgs returns the keys and arguments of the changeScript applying
+// the operations. The put values expire after <ttl> unless the operation
+// defines its own TTL.
+func (feed *changeFeed) scriptArgs(ops []op, ttl time.Duration, createOnly bool) (keys []string, args []interface{}) {
+	var createFlag string
+	if createOnly {
+		createFlag = "1"
+	}
+	args = []interface{}{feed.maxLen, createFlag}
+	for _, op := range ops {
+		keys = append(keys, op.key, feed.streamKey(op.key))
+		if op.del {
+			args = append(args, "del", "", int64(0))
+			continue
+		}
+		opTTL := ttl
+		if op.ttl > 0 {
+			opTTL = op.ttl
+		}
+		args = append(args, "put", op.value, int64(opTTL/time.Millisecond))
+	}
+	return keys, args
+}
+
+// apply applies the operations and appends the changes to the streams.
+// It returns false if the key of a create-only put exists, and the number
+// of deleted keys.
+func (feed *changeFeed) apply(client Client, ops []op, ttl time.Duration, createOnly bool) (applied bool, deleted int64, err error) {
+	keys, args := feed.scriptArgs(ops, ttl, createOnly)
+	result, err := changeScript.Run(client, keys, args...).Result()
+	if err == GoRedisNil {
+		return false, 0, nil
+	} else if err != nil {
+		return false, 0, err
+	}
+	deleted, _ = result.(int64)
+	return true, deleted, nil
+}
+
+// streamRecord is a change read from the stream.
+type streamRecord struct {
+	id        string
+	del       bool
+	key       string
+	value     []byte
+	prevValue []byte
+}
+
+// parseXReadReply parses the reply of XREAD into the records of the streams.
+func parseXReadReply(reply interface{}) (map[string][]streamRecord, error) {
+	streams, ok := reply.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected reply %T", reply)
+	}
+	records := make(map[string][]streamRecord)
+	for _, item := range streams {
+		// [stream, [entries...]]
+		stream, ok := item.([]interface{})
+		if !ok || len(stream) != 2 {
+			return nil, fmt.Errorf("unexpected stream reply %v", item)
+		}
+		name, _ := stream[0].(string)
+		entries, err := parseStreamEntries(stream[1])
+		if err != nil {
+			return nil, err
+		}
+		records[name] = entries
+	}
+	return records, nil
+}
+
+// parseStreamEntries parses the entries of the stream (reply of XRANGE
+// or a part of the reply of XREAD) into the records.
+func parseStreamEntries(reply interface{}) ([]streamRecord, error) {
+	entries, ok := reply.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected reply %T", reply)
+	}
+	records := make([]streamRecord, 0, len(entries))
+	for _, entry := range entries {
+		// [id, [field, value, ...]]
+		fields, ok := entry.([]interface{})
+		if !ok || len(fields) != 2 {
+			return nil, fmt.Errorf("unexpected stream entry %v", entry)
+		}
+		id, _ := fields[0].(string)
+		values, _ := fields[1].([]interface{})
+		record := streamRecord{id: id}
+		for i := 0; i+1 < len(values); i += 2 {
+			name, _ := values[i].(string)
+			value, _ := values[i+1].(string)
+			switch name {
+			case "op":
+				record.del = value == "del"
+			case "key":
+				record.key = value
+			case "value":
+				record.value = []byte(value)
+			case "prev":
+				record.prevValue = []byte(value)
+			}
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// streamIDToRevision converts the ID of the stream record (<milliseconds>-<sequence>)
+// to the revision. The milliseconds are stored in the upper bits of the revision
+// and the sequence number in the lower seqBits bits.
+func streamIDToRevision(id string) (int64, error) {
+	parts := strings.SplitN(id, "-", 2)
+	ms, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid stream ID %s", id)
+	}
+	var seq int64
+	if len(parts) == 2 {
+		if seq, err = strconv.ParseInt(parts[1], 10, 64); err != nil {
+			return 0, fmt.Errorf("invalid stream ID %s", id)
+		}
+	}
+	if seq >= 1<<seqBits {
+		return 0, fmt.Errorf("sequence number of stream ID %s out of range", id)
+	}
+	return ms<<seqBits | seq, nil
+}
+
+// revisionToStreamID converts the revision back to the ID of the stream record.
+func revisionToStreamID(rev int64) string {
+	return fmt.Sprintf("%d-%d", rev>>seqBits, rev&(1<<seqBits-1))
+}
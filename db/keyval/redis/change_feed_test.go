@@ -0,0 +1,80 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"testing"
+	"time"
+
+	"github.com/onsi/gomega"
+)
+
+// miniRedis does not support streams, only the parts of the change feed
+// not depending on the server are tested.
+func TestChangeFeed(t *testing.T) {
+	gomega.RegisterTestingT(t)
+
+	feed := newChangeFeed(ChangeFeedConfig{Enabled: true, Prefixes: []string{"/a/", "/a/b/", "/c/"}})
+	gomega.Expect(feed.streamKey("/a/x")).Should(gomega.Equal("__changes:/a/"))
+	gomega.Expect(feed.streamKey("/a/b/x")).Should(gomega.Equal("__changes:/a/b/"))
+	gomega.Expect(feed.streamKey("/d/x")).Should(gomega.BeEmpty())
+	gomega.Expect(feed.streamKeys("/a/")).Should(gomega.Equal([]string{"__changes:/a/", "__changes:/a/b/"}))
+	gomega.Expect(feed.streamKeys("/a/b/c")).Should(gomega.Equal([]string{"__changes:/a/b/"}))
+	gomega.Expect(feed.streamKeys("/")).Should(gomega.BeNil())
+	gomega.Expect(feed.records([]op{{key: "/d/x"}})).Should(gomega.BeFalse())
+	gomega.Expect(feed.records([]op{{key: "/d/x"}, {key: "/c/x"}})).Should(gomega.BeTrue())
+
+	keys, args := feed.scriptArgs([]op{{key: "/a/x", value: []byte("val")}, {key: "/d/x", del: true},
+		{key: "/c/x", value: []byte("ttl"), ttl: time.Minute}}, 2*time.Second, false)
+	gomega.Expect(keys).Should(gomega.Equal([]string{"/a/x", "__changes:/a/", "/d/x", "", "/c/x", "__changes:/c/"}))
+	gomega.Expect(args).Should(gomega.Equal([]interface{}{int64(DefaultChangeStreamMaxLen), "",
+		"put", []byte("val"), int64(2000), "del", "", int64(0), "put", []byte("ttl"), int64(60000)}))
+
+	// all keys are recorded in a single stream by default
+	feed = newChangeFeed(ChangeFeedConfig{Enabled: true})
+	gomega.Expect(feed.streamKeys("/any/")).Should(gomega.Equal([]string{DefaultChangeStreamKeyPrefix}))
+
+	rev, err := streamIDToRevision("1526000000000-5")
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	next, err := streamIDToRevision("1526000000001-0")
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	gomega.Expect(next).Should(gomega.BeNumerically(">", rev))
+	gomega.Expect(revisionToStreamID(rev)).Should(gomega.Equal("1526000000000-5"))
+	_, err = streamIDToRevision("invalid")
+	gomega.Expect(err).Should(gomega.HaveOccurred())
+
+	// records following the last read record were trimmed unless the record
+	// is still in the stream
+	gomega.Expect(recordsTrimmed("5-0", "4-0")).Should(gomega.BeFalse())
+	gomega.Expect(recordsTrimmed("5-0", "5-0")).Should(gomega.BeFalse())
+	gomega.Expect(recordsTrimmed("5-0", "5-1")).Should(gomega.BeTrue())
+	gomega.Expect(recordsTrimmed("5-0", "")).Should(gomega.BeTrue())
+	gomega.Expect(recordsTrimmed("0-0", "")).Should(gomega.BeFalse())
+
+	reply := []interface{}{
+		[]interface{}{"__changes:/a/", []interface{}{
+			[]interface{}{"1-0", []interface{}{"op", "put", "key", "/a/x", "value", "v2", "prev", "v1"}},
+			[]interface{}{"1-1", []interface{}{"op", "del", "key", "/a/x", "prev", "v2"}},
+		}},
+	}
+	records, err := parseXReadReply(reply)
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	gomega.Expect(records).Should(gomega.Equal(map[string][]streamRecord{"__changes:/a/": {
+		{id: "1-0", key: "/a/x", value: []byte("v2"), prevValue: []byte("v1")},
+		{id: "1-1", del: true, key: "/a/x", prevValue: []byte("v2")},
+	}}))
+	_, err = parseXReadReply([]interface{}{"unexpected"})
+	gomega.Expect(err).Should(gomega.HaveOccurred())
+}
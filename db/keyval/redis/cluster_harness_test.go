@@ -0,0 +1,606 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const testSlotCount = 16384
+
+// testCluster emulates Redis Cluster by several in-process Redis nodes
+// (miniRedis supports neither cluster commands nor PSUBSCRIBE).
+// Each node serves the keys of its hash slots and redirects the commands
+// for other keys by MOVED, answers CLUSTER SLOTS with the common slot map
+// and publishes keyspace notifications of the changes of its keys
+// to the clients subscribed on the node. Only the commands used by
+// the tests are supported. Scripts (EVAL, EVALSHA) are emulated by the Go
+// functions registered by registerScript.
+type testCluster struct {
+	sync.Mutex
+	nodes   []*testNode
+	owners  [testSlotCount]*testNode
+	scripts map[string]testScript // by SHA1 of the script
+}
+
+// testScript emulates a Lua script on the node (cluster is locked). It returns
+// int64, string or nil.
+type testScript func(node *testNode, keys []string, args []string) interface{}
+
+// testNode is a single node of the testCluster.
+type testNode struct {
+	cluster     *testCluster
+	listener    net.Listener
+	addr        string
+	data        map[string]string
+	ttls        map[string]int64       // TTLs of the keys in milliseconds (expiration is not emulated)
+	subscribers map[*testConn][]string // patterns of the subscribed clients
+	conns       map[*testConn]struct{}
+	failExec    bool // EXEC fails (to test failures of transactions)
+}
+
+// testConn is a client connection to a testNode.
+type testConn struct {
+	sync.Mutex // serializes replies and published messages
+	conn       net.Conn
+	w          *bufio.Writer
+	multi      bool       // MULTI was received
+	queued     [][]string // commands queued until EXEC
+}
+
+// newTestCluster starts a cluster of <size> master nodes with the slots
+// distributed evenly.
+func newTestCluster(size int) *testCluster {
+	cluster := &testCluster{}
+	for i := 0; i < size; i++ {
+		cluster.addNode()
+	}
+	for slot := 0; slot < testSlotCount; slot++ {
+		cluster.owners[slot] = cluster.nodes[slot*size/testSlotCount]
+	}
+	return cluster
+}
+
+// registerScript registers the emulation of the script with the given SHA1.
+func (cluster *testCluster) registerScript(sha string, script testScript) {
+	cluster.Lock()
+	defer cluster.Unlock()
+	if cluster.scripts == nil {
+		cluster.scripts = make(map[string]testScript)
+	}
+	cluster.scripts[sha] = script
+}
+
+func scriptSHA(body string) string {
+	sum := sha1.Sum([]byte(body))
+	return hex.EncodeToString(sum[:])
+}
+
+// addNode starts a new node without any slots.
+func (cluster *testCluster) addNode() *testNode {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	node := &testNode{
+		cluster:     cluster,
+		listener:    listener,
+		addr:        listener.Addr().String(),
+		data:        make(map[string]string),
+		ttls:        make(map[string]int64),
+		subscribers: make(map[*testConn][]string),
+		conns:       make(map[*testConn]struct{}),
+	}
+	cluster.Lock()
+	cluster.nodes = append(cluster.nodes, node)
+	cluster.Unlock()
+	go node.accept()
+	return node
+}
+
+// addrs returns the addresses of the nodes.
+func (cluster *testCluster) addrs() []string {
+	cluster.Lock()
+	defer cluster.Unlock()
+	var addrs []string
+	for _, node := range cluster.nodes {
+		addrs = append(addrs, node.addr)
+	}
+	return addrs
+}
+
+// nodeOf returns the node owning the slot of the key.
+func (cluster *testCluster) nodeOf(key string) *testNode {
+	cluster.Lock()
+	defer cluster.Unlock()
+	return cluster.owners[getHashSlot(key)]
+}
+
+// failover replaces the node with a new node (promoted replica) that takes
+// over the data and the slots of the node. The old node is stopped.
+func (cluster *testCluster) failover(node *testNode) *testNode {
+	replica := cluster.addNode()
+	cluster.Lock()
+	for key, value := range node.data {
+		replica.data[key] = value
+	}
+	for slot := range cluster.owners {
+		if cluster.owners[slot] == node {
+			cluster.owners[slot] = replica
+		}
+	}
+	cluster.removeNode(node)
+	cluster.Unlock()
+	node.close()
+	return replica
+}
+
+// migrateSlot moves the slot of the key together with its keys to the node
+// <target> the way MIGRATE does (the source node notifies the deletion,
+// the target node the restore of the keys).
+func (cluster *testCluster) migrateSlot(key string, target *testNode) {
+	cluster.Lock()
+	defer cluster.Unlock()
+	slot := getHashSlot(key)
+	source := cluster.owners[slot]
+	cluster.owners[slot] = target
+	for k, v := range source.data {
+		if getHashSlot(k) == slot {
+			delete(source.data, k)
+			source.publish(k, "del")
+			target.data[k] = v
+			target.publish(k, "restore")
+		}
+	}
+}
+
+// notify publishes the keyspace notification on the node (e.g. the node
+// is a replica or an old master notifying the same change).
+func (cluster *testCluster) notify(node *testNode, key string, event string) {
+	cluster.Lock()
+	defer cluster.Unlock()
+	node.publish(key, event)
+}
+
+// failExec makes EXEC of the node fail.
+func (cluster *testCluster) failExec(node *testNode, fail bool) {
+	cluster.Lock()
+	defer cluster.Unlock()
+	node.failExec = fail
+}
+
+// ttl returns the TTL of the key in milliseconds (0 if the key does not expire).
+func (cluster *testCluster) ttl(key string) int64 {
+	cluster.Lock()
+	defer cluster.Unlock()
+	return cluster.owners[getHashSlot(key)].ttls[key]
+}
+
+// get returns the value of the key stored by the cluster.
+func (cluster *testCluster) get(key string) (value string, found bool) {
+	cluster.Lock()
+	defer cluster.Unlock()
+	value, found = cluster.owners[getHashSlot(key)].data[key]
+	return value, found
+}
+
+// subscribed returns true if any client is subscribed on the node.
+func (cluster *testCluster) subscribed(node *testNode) bool {
+	cluster.Lock()
+	defer cluster.Unlock()
+	return len(node.subscribers) > 0
+}
+
+// removeNode removes the node from the list of the nodes (cluster is locked).
+func (cluster *testCluster) removeNode(node *testNode) {
+	for i, n := range cluster.nodes {
+		if n == node {
+			cluster.nodes = append(cluster.nodes[:i], cluster.nodes[i+1:]...)
+			return
+		}
+	}
+}
+
+// close stops all nodes.
+func (cluster *testCluster) close() {
+	cluster.Lock()
+	nodes := cluster.nodes
+	cluster.nodes = nil
+	cluster.Unlock()
+	for _, node := range nodes {
+		node.close()
+	}
+}
+
+func (node *testNode) accept() {
+	for {
+		conn, err := node.listener.Accept()
+		if err != nil {
+			return
+		}
+		c := &testConn{conn: conn, w: bufio.NewWriter(conn)}
+		node.cluster.Lock()
+		node.conns[c] = struct{}{}
+		node.cluster.Unlock()
+		go node.serve(c)
+	}
+}
+
+// close stops the node and closes all client connections.
+func (node *testNode) close() {
+	node.listener.Close()
+	node.cluster.Lock()
+	defer node.cluster.Unlock()
+	for c := range node.conns {
+		c.conn.Close()
+	}
+}
+
+func (node *testNode) serve(c *testConn) {
+	defer func() {
+		node.cluster.Lock()
+		delete(node.conns, c)
+		delete(node.subscribers, c)
+		node.cluster.Unlock()
+		c.conn.Close()
+	}()
+	r := bufio.NewReader(c.conn)
+	for {
+		args, err := readTestCommand(r)
+		if err != nil {
+			return
+		}
+		node.cluster.Lock()
+		node.dispatch(c, args)
+		node.cluster.Unlock()
+	}
+}
+
+// dispatch executes the command (cluster is locked).
+func (node *testNode) dispatch(c *testConn, args []string) {
+	c.Lock()
+	defer c.Unlock()
+	defer c.w.Flush()
+
+	cmd := strings.ToUpper(args[0])
+	switch cmd {
+	case "PING":
+		if _, subscribed := node.subscribers[c]; subscribed {
+			c.writeArray("pong", "")
+		} else {
+			fmt.Fprint(c.w, "+PONG\r\n")
+		}
+		return
+	case "COMMAND":
+		c.writeCommandInfo()
+		return
+	case "CLUSTER":
+		switch {
+		case len(args) > 1 && strings.ToUpper(args[1]) == "SLOTS":
+			node.cluster.writeSlots(c)
+			return
+		case len(args) > 1 && strings.ToUpper(args[1]) == "INFO":
+			c.writeBulk("cluster_state:ok\r\n")
+			return
+		}
+	case "PSUBSCRIBE":
+		for _, pattern := range args[1:] {
+			node.subscribers[c] = append(node.subscribers[c], pattern)
+			fmt.Fprintf(c.w, "*3\r\n$10\r\npsubscribe\r\n")
+			c.writeBulk(pattern)
+			fmt.Fprintf(c.w, ":%d\r\n", len(node.subscribers[c]))
+		}
+		return
+	case "PUNSUBSCRIBE":
+		patterns := args[1:]
+		if len(patterns) == 0 {
+			patterns = node.subscribers[c]
+		}
+		for _, pattern := range patterns {
+			var rest []string
+			for _, p := range node.subscribers[c] {
+				if p != pattern {
+					rest = append(rest, p)
+				}
+			}
+			node.subscribers[c] = rest
+			fmt.Fprintf(c.w, "*3\r\n$12\r\npunsubscribe\r\n")
+			c.writeBulk(pattern)
+			fmt.Fprintf(c.w, ":%d\r\n", len(rest))
+		}
+		return
+	case "MULTI":
+		c.multi, c.queued = true, nil
+		fmt.Fprint(c.w, "+OK\r\n")
+		return
+	case "EXEC":
+		if !c.multi {
+			break
+		}
+		c.multi = false
+		if node.failExec {
+			fmt.Fprint(c.w, "-ERR injected EXEC failure\r\n")
+			return
+		}
+		fmt.Fprintf(c.w, "*%d\r\n", len(c.queued))
+		for _, queued := range c.queued {
+			node.execute(c, strings.ToUpper(queued[0]), queued[1:])
+		}
+		return
+	case "EVAL", "EVALSHA":
+		node.eval(c, cmd, args[1:])
+		return
+	case "GET", "SET", "DEL", "EXISTS", "MGET", "PTTL":
+		if len(args) < 2 {
+			break
+		}
+		slot := getHashSlot(args[1])
+		if owner := node.cluster.owners[slot]; owner != node {
+			fmt.Fprintf(c.w, "-MOVED %d %s\r\n", slot, owner.addr)
+			return
+		}
+		if c.multi {
+			c.queued = append(c.queued, args)
+			fmt.Fprint(c.w, "+QUEUED\r\n")
+			return
+		}
+		node.execute(c, cmd, args[1:])
+		return
+	}
+	fmt.Fprintf(c.w, "-ERR unknown command '%s'\r\n", args[0])
+}
+
+// execute executes the data command (cluster is locked).
+func (node *testNode) execute(c *testConn, cmd string, args []string) {
+	switch cmd {
+	case "GET":
+		if value, found := node.data[args[0]]; found {
+			c.writeBulk(value)
+		} else {
+			fmt.Fprint(c.w, "$-1\r\n")
+		}
+	case "MGET":
+		fmt.Fprintf(c.w, "*%d\r\n", len(args))
+		for _, key := range args {
+			if value, found := node.data[key]; found {
+				c.writeBulk(value)
+			} else {
+				fmt.Fprint(c.w, "$-1\r\n")
+			}
+		}
+	case "SET":
+		node.data[args[0]] = args[1]
+		delete(node.ttls, args[0])
+		if len(args) == 4 {
+			ttl, _ := strconv.ParseInt(args[3], 10, 64)
+			if strings.ToUpper(args[2]) == "EX" {
+				ttl *= 1000
+			}
+			node.ttls[args[0]] = ttl
+		}
+		node.publish(args[0], "set")
+		fmt.Fprint(c.w, "+OK\r\n")
+	case "DEL", "EXISTS":
+		count := 0
+		for _, key := range args {
+			if _, found := node.data[key]; found {
+				count++
+				if cmd == "DEL" {
+					delete(node.data, key)
+					delete(node.ttls, key)
+					node.publish(key, "del")
+				}
+			}
+		}
+		fmt.Fprintf(c.w, ":%d\r\n", count)
+	case "PTTL":
+		ttl, found := node.ttls[args[0]]
+		if _, exists := node.data[args[0]]; !exists {
+			ttl = -2
+		} else if !found {
+			ttl = -1
+		}
+		fmt.Fprintf(c.w, ":%d\r\n", ttl)
+	}
+}
+
+// eval runs the emulation of the script (cluster is locked). All keys
+// of the script must hash to the slot of the node.
+func (node *testNode) eval(c *testConn, cmd string, args []string) {
+	if len(args) < 2 {
+		fmt.Fprintf(c.w, "-ERR wrong number of arguments for '%s' command\r\n", cmd)
+		return
+	}
+	sha := args[0]
+	if cmd == "EVAL" {
+		sha = scriptSHA(args[0])
+	}
+	numKeys, err := strconv.Atoi(args[1])
+	if err != nil || numKeys > len(args)-2 {
+		fmt.Fprint(c.w, "-ERR invalid number of keys\r\n")
+		return
+	}
+	keys, scriptArgs := args[2:2+numKeys], args[2+numKeys:]
+	for _, key := range keys {
+		if getHashSlot(key) != getHashSlot(keys[0]) {
+			fmt.Fprint(c.w, "-CROSSSLOT Keys in request don't hash to the same slot\r\n")
+			return
+		}
+	}
+	if len(keys) > 0 {
+		slot := getHashSlot(keys[0])
+		if owner := node.cluster.owners[slot]; owner != node {
+			fmt.Fprintf(c.w, "-MOVED %d %s\r\n", slot, owner.addr)
+			return
+		}
+	}
+	script, found := node.cluster.scripts[sha]
+	if !found {
+		fmt.Fprint(c.w, "-NOSCRIPT No matching script. Please use EVAL.\r\n")
+		return
+	}
+	switch reply := script(node, keys, scriptArgs).(type) {
+	case int64:
+		fmt.Fprintf(c.w, ":%d\r\n", reply)
+	case string:
+		c.writeBulk(reply)
+	default:
+		fmt.Fprint(c.w, "$-1\r\n")
+	}
+}
+
+// publish sends the keyspace notification to the subscribed clients
+// (cluster is locked).
+func (node *testNode) publish(key string, event string) {
+	channel := "__keyspace@0__:" + key
+	for c, patterns := range node.subscribers {
+		for _, pattern := range patterns {
+			if matchTestPattern(pattern, channel) {
+				c.Lock()
+				c.writeArray("pmessage", pattern, channel, event)
+				c.w.Flush()
+				c.Unlock()
+			}
+		}
+	}
+}
+
+// writeSlots writes the reply of CLUSTER SLOTS (cluster is locked).
+func (cluster *testCluster) writeSlots(c *testConn) {
+	type slotRange struct {
+		start, end int
+		node       *testNode
+	}
+	var ranges []slotRange
+	for slot, node := range cluster.owners {
+		if len(ranges) > 0 && ranges[len(ranges)-1].node == node {
+			ranges[len(ranges)-1].end = slot
+			continue
+		}
+		ranges = append(ranges, slotRange{slot, slot, node})
+	}
+	fmt.Fprintf(c.w, "*%d\r\n", len(ranges))
+	for _, r := range ranges {
+		host, port, _ := net.SplitHostPort(r.node.addr)
+		fmt.Fprintf(c.w, "*3\r\n:%d\r\n:%d\r\n*2\r\n", r.start, r.end)
+		c.writeBulk(host)
+		fmt.Fprintf(c.w, ":%s\r\n", port)
+	}
+}
+
+// writeCommandInfo writes the reply of COMMAND for the supported commands.
+func (c *testConn) writeCommandInfo() {
+	commands := []struct {
+		name     string
+		arity    int
+		readOnly bool
+		firstKey int
+	}{
+		{"get", 2, true, 1}, {"mget", -2, true, 1}, {"set", -3, false, 1}, {"del", -2, false, 1}, {"exists", -2, true, 1},
+		{"cluster", -2, false, 0}, {"ping", -1, false, 0}, {"psubscribe", -2, false, 0},
+	}
+	fmt.Fprintf(c.w, "*%d\r\n", len(commands))
+	for _, cmd := range commands {
+		fmt.Fprintf(c.w, "*6\r\n")
+		c.writeBulk(cmd.name)
+		fmt.Fprintf(c.w, ":%d\r\n", cmd.arity)
+		if cmd.readOnly {
+			fmt.Fprintf(c.w, "*1\r\n+readonly\r\n")
+		} else {
+			fmt.Fprintf(c.w, "*0\r\n")
+		}
+		lastKey := cmd.firstKey
+		if cmd.name == "del" || cmd.name == "exists" || cmd.name == "mget" {
+			lastKey = -1
+		}
+		fmt.Fprintf(c.w, ":%d\r\n:%d\r\n:%d\r\n", cmd.firstKey, lastKey, 1)
+	}
+}
+
+func (c *testConn) writeBulk(s string) {
+	fmt.Fprintf(c.w, "$%d\r\n%s\r\n", len(s), s)
+}
+
+func (c *testConn) writeArray(items ...string) {
+	fmt.Fprintf(c.w, "*%d\r\n", len(items))
+	for _, item := range items {
+		c.writeBulk(item)
+	}
+}
+
+// readTestCommand reads a command sent as an array of bulk strings.
+func readTestCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return nil, fmt.Errorf("unexpected command %q", line)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		if line, err = r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+// matchTestPattern matches the channel against the glob pattern
+// (only * and ? wildcards are supported).
+func matchTestPattern(pattern, channel string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := len(channel); i >= 0; i-- {
+				if matchTestPattern(pattern[1:], channel[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(channel) == 0 {
+				return false
+			}
+		default:
+			if len(channel) == 0 || channel[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern, channel = pattern[1:], channel[1:]
+	}
+	return len(channel) == 0
+}
@@ -0,0 +1,289 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"time"
+
+	goredis "github.com/go-redis/redis"
+	"github.com/ligato/cn-infra/db/keyval"
+	"github.com/ligato/cn-infra/logging"
+)
+
+const (
+	// clusterTopologyCheckPeriod is the period of checks of the master nodes
+	// of the cluster watched for keyspace notifications.
+	clusterTopologyCheckPeriod = time.Second
+
+	// clusterDedupWindow is the period during which an event equal to
+	// the previous event of the same key is considered a duplicate.
+	clusterDedupWindow = time.Second
+)
+
+// clusterWatch subscribes to keyspace notifications on every master node
+// of Redis Cluster (keyspace notifications are local to the node that
+// changed the key). The masters are re-read (CLUSTER SLOTS) periodically,
+// so that the subscriptions follow failovers and resharding. The same
+// change may be notified by several nodes (e.g. by the old and the new
+// master during failover), such events are delivered only once.
+type clusterWatch struct {
+	db         *BytesConnectionRedis
+	cluster    *goredis.ClusterClient
+	patterns   []string
+	resp       func(keyval.BytesWatchResp)
+	trimPrefix func(key string) string
+
+	nodesLock sync.Mutex
+	nodes     map[string]*nodeSubscription // by the address of the master
+
+	// events are delivered under the lock, one at a time
+	recentLock sync.Mutex
+	recent     map[string]recentEvent // recently delivered events by key
+}
+
+// nodeSubscription is the subscription to keyspace notifications
+// of one master node.
+type nodeSubscription struct {
+	addr   string
+	client *goredis.Client
+	pubSub *goredis.PubSub
+	stop   chan struct{}
+}
+
+// recentEvent is a recently delivered event (used to detect duplicates).
+type recentEvent struct {
+	del   bool
+	value []byte
+	at    time.Time
+}
+
+// watchCluster subscribes to the <patterns> on all master nodes of the cluster
+// until the <closeCh> is closed or the connection is closed.
+func watchCluster(db *BytesConnectionRedis, cluster *goredis.ClusterClient, resp func(keyval.BytesWatchResp),
+	closeCh <-chan string, trimPrefix func(key string) string, patterns ...string) error {
+	w := &clusterWatch{
+		db:         db,
+		cluster:    cluster,
+		patterns:   patterns,
+		resp:       resp,
+		trimPrefix: trimPrefix,
+		nodes:      make(map[string]*nodeSubscription),
+		recent:     make(map[string]recentEvent),
+	}
+	if err := w.updateNodes(); err != nil {
+		return err
+	}
+	go w.loop(closeCh)
+	return nil
+}
+
+// loop follows the topology of the cluster until the watch is closed.
+func (w *clusterWatch) loop(closeCh <-chan string) {
+	defer w.unsubscribeAll()
+	ticker := time.NewTicker(clusterTopologyCheckPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if w.db.closed {
+				return
+			}
+			if err := w.updateNodes(); err != nil {
+				w.db.Warnf("Failed to update the masters watched for %v: %v", w.patterns, err)
+			}
+			w.purgeRecent()
+		case _, active := <-closeCh:
+			if !active {
+				w.db.Debugf("Received signal to close Watch(%v)", w.patterns)
+				return
+			}
+		}
+	}
+}
+
+// updateNodes subscribes to the masters of the cluster that are not
+// subscribed yet and unsubscribes from the nodes that are no longer masters.
+func (w *clusterWatch) updateNodes() error {
+	slots, err := w.cluster.ClusterSlots().Result()
+	if err != nil {
+		return err
+	}
+	masters := make(map[string]struct{})
+	for _, slot := range slots {
+		if len(slot.Nodes) > 0 {
+			masters[slot.Nodes[0].Addr] = struct{}{}
+		}
+	}
+
+	w.nodesLock.Lock()
+	defer w.nodesLock.Unlock()
+	for addr, sub := range w.nodes {
+		if _, isMaster := masters[addr]; !isMaster {
+			w.db.Debugf("Node %s is no longer a master, unsubscribing %v", addr, w.patterns)
+			w.unsubscribe(sub)
+			delete(w.nodes, addr)
+		}
+	}
+	for addr := range masters {
+		if _, subscribed := w.nodes[addr]; subscribed {
+			continue
+		}
+		sub, err := w.subscribe(addr)
+		if err != nil {
+			// retried with the next update
+			w.db.Warnf("Failed to subscribe %v on node %s: %v", w.patterns, addr, err)
+			continue
+		}
+		w.nodes[addr] = sub
+		go w.receive(sub)
+	}
+	return nil
+}
+
+// subscribe subscribes to the patterns on the node and waits until
+// the subscription is confirmed.
+func (w *clusterWatch) subscribe(addr string) (*nodeSubscription, error) {
+	opts := w.cluster.Options()
+	client := goredis.NewClient(&goredis.Options{
+		Addr:         addr,
+		Password:     opts.Password,
+		DialTimeout:  opts.DialTimeout,
+		ReadTimeout:  opts.ReadTimeout,
+		WriteTimeout: opts.WriteTimeout,
+		PoolSize:     1,
+	})
+	pubSub := client.PSubscribe(w.patterns...)
+	for range w.patterns {
+		if _, err := pubSub.ReceiveTimeout(opts.DialTimeout + opts.ReadTimeout); err != nil {
+			pubSub.Close()
+			client.Close()
+			return nil, err
+		}
+	}
+	w.db.Debugf("Subscribed %v on node %s", w.patterns, addr)
+	return &nodeSubscription{addr: addr, client: client, pubSub: pubSub, stop: make(chan struct{})}, nil
+}
+
+// receive handles the notifications received from the node until
+// the subscription is closed.
+func (w *clusterWatch) receive(sub *nodeSubscription) {
+	for {
+		msg, err := sub.pubSub.ReceiveMessage()
+		select {
+		case <-sub.stop:
+			return
+		default:
+		}
+		if w.db.closed {
+			return
+		}
+		if err != nil {
+			w.db.Warnf("Watch(%v) on node %s encountered error: %s", w.patterns, sub.addr, err)
+			time.Sleep(watchRetryPeriod)
+			continue
+		}
+		w.handle(msg)
+	}
+}
+
+// handle delivers the change notified by the message.
+func (w *clusterWatch) handle(msg *goredis.Message) {
+	key := msg.Channel[strings.Index(msg.Channel, ":")+1:]
+	switch msg.Payload {
+	case "set":
+		// keyspace event does not carry value, it is read from the cluster
+		value, found, _, err := w.db.GetValue(key)
+		if err != nil {
+			w.db.Errorf("GetValue(%s) failed with error %s", key, err)
+			return
+		}
+		if !found {
+			return // deleted in the meantime, deletion is notified as well
+		}
+		w.deliver(key, value, false)
+	case "del", "expired":
+		// the key deleted from the source node of a migration (resharding)
+		// still exists in the cluster
+		_, found, _, err := w.db.GetValue(key)
+		if err != nil {
+			w.db.Errorf("GetValue(%s) failed with error %s", key, err)
+			return
+		}
+		if found {
+			return
+		}
+		w.deliver(key, nil, true)
+	default:
+		w.db.Debugf("%T: %s %s %s -- not handled", msg, msg.Pattern, msg.Channel, msg.Payload)
+	}
+}
+
+// deliver delivers the change unless the same change of the key was
+// delivered within the clusterDedupWindow.
+func (w *clusterWatch) deliver(key string, value []byte, del bool) {
+	w.recentLock.Lock()
+	defer w.recentLock.Unlock()
+
+	if last, found := w.recent[key]; found && last.del == del && bytes.Equal(last.value, value) &&
+		time.Since(last.at) < clusterDedupWindow {
+		w.db.WithFields(logging.Fields{"key": key, "del": del}).Debug("Duplicate keyspace event ignored")
+		return
+	}
+	w.recent[key] = recentEvent{del: del, value: value, at: time.Now()}
+
+	if w.trimPrefix != nil {
+		key = w.trimPrefix(key)
+	}
+	if del {
+		w.resp(NewBytesWatchDelResp(key, 0))
+	} else {
+		w.resp(NewBytesWatchPutResp(key, value, nil, 0))
+	}
+}
+
+// purgeRecent removes the events delivered before the clusterDedupWindow.
+func (w *clusterWatch) purgeRecent() {
+	w.recentLock.Lock()
+	defer w.recentLock.Unlock()
+	for key, event := range w.recent {
+		if time.Since(event.at) >= clusterDedupWindow {
+			delete(w.recent, key)
+		}
+	}
+}
+
+// unsubscribeAll closes the subscriptions on all nodes.
+func (w *clusterWatch) unsubscribeAll() {
+	w.nodesLock.Lock()
+	defer w.nodesLock.Unlock()
+	for addr, sub := range w.nodes {
+		w.unsubscribe(sub)
+		delete(w.nodes, addr)
+	}
+}
+
+// unsubscribe closes the subscription on the node.
+func (w *clusterWatch) unsubscribe(sub *nodeSubscription) {
+	close(sub.stop)
+	if err := sub.pubSub.Close(); err != nil {
+		// the connection may already be broken
+		w.db.Debugf("Closing subscription on node %s failed: %v", sub.addr, err)
+	}
+	sub.client.Close()
+}
@@ -0,0 +1,102 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ligato/cn-infra/datasync"
+	"github.com/ligato/cn-infra/db/keyval"
+	"github.com/onsi/gomega"
+)
+
+func TestHashSlot(t *testing.T) {
+	gomega.RegisterTestingT(t)
+
+	gomega.Expect(getHashSlot("123456789")).Should(gomega.Equal(uint16(0x31C3)))
+	gomega.Expect(getHashSlot("{user1000}.following")).Should(gomega.Equal(getHashSlot("user1000")))
+	gomega.Expect(getHashSlot("foo{}{bar}")).ShouldNot(gomega.Equal(getHashSlot("bar")))
+}
+
+func TestClusterWatch(t *testing.T) {
+	gomega.RegisterTestingT(t)
+
+	cluster := newTestCluster(3)
+	defer cluster.close()
+	client, err := CreateClusterClient(ClusterConfig{Endpoints: cluster.addrs()})
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	conn, err := NewBytesConnection(client, log)
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	defer conn.Close()
+
+	events := make(chan keyval.BytesWatchResp, 100)
+	closeCh := make(chan string)
+	defer close(closeCh)
+	err = conn.NewWatcher("/cluster/").Watch(keyval.ToChan(events), closeCh, "key")
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	expectEvent := func(key string, changeType datasync.PutDel, value string) {
+		var event keyval.BytesWatchResp
+		gomega.Eventually(events, 5*time.Second).Should(gomega.Receive(&event))
+		gomega.Expect(event.GetKey()).Should(gomega.Equal(key))
+		gomega.Expect(event.GetChangeType()).Should(gomega.Equal(changeType))
+		gomega.Expect(string(event.GetValue())).Should(gomega.Equal(value))
+	}
+
+	// keys stored by every node are watched
+	keys := make(map[*testNode]string)
+	for i := 0; len(keys) < 3; i++ {
+		key := fmt.Sprintf("key%d", i)
+		node := cluster.nodeOf("/cluster/" + key)
+		if _, found := keys[node]; !found {
+			keys[node] = key
+			gomega.Expect(conn.Put("/cluster/"+key, []byte("val"))).To(gomega.Succeed())
+			expectEvent(key, datasync.Put, "val")
+		}
+	}
+
+	// the same change notified by another node is delivered once
+	var node, other *testNode
+	for n := range keys {
+		if node == nil {
+			node = n
+		} else if other == nil {
+			other = n
+		}
+	}
+	cluster.notify(other, "/cluster/"+keys[node], "set")
+	gomega.Consistently(events, 300*time.Millisecond).ShouldNot(gomega.Receive())
+
+	// resharding - the keys deleted from the source node are not reported
+	target := cluster.addNode()
+	cluster.migrateSlot("/cluster/"+keys[node], target)
+	gomega.Eventually(func() bool { return cluster.subscribed(target) }, 5*time.Second).Should(gomega.BeTrue())
+	gomega.Consistently(events, 300*time.Millisecond).ShouldNot(gomega.Receive())
+	gomega.Expect(conn.Put("/cluster/"+keys[node], []byte("moved"))).To(gomega.Succeed())
+	expectEvent(keys[node], datasync.Put, "moved")
+
+	// failover - the promoted replica is subscribed
+	replica := cluster.failover(other)
+	gomega.Eventually(func() bool { return cluster.subscribed(replica) }, 5*time.Second).Should(gomega.BeTrue())
+	_, err = conn.Delete("/cluster/" + keys[other])
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	expectEvent(keys[other], datasync.Delete, "")
+
+	// keys that are not watched
+	gomega.Expect(conn.Put("/other/key", []byte("val"))).To(gomega.Succeed())
+	gomega.Consistently(events, 300*time.Millisecond).ShouldNot(gomega.Receive())
+}
@@ -25,6 +25,7 @@ import (
 	"github.com/coreos/etcd/pkg/tlsutil"
 	"github.com/ghodss/yaml"
 	goredis "github.com/go-redis/redis"
+	"github.com/ligato/cn-infra/config"
 )
 
 // TLS configures Transport layer security properties.
@@ -96,32 +97,39 @@ type Client interface {
 	// interface.
 	Close() error
 	PSubscribe(channels ...string) *goredis.PubSub
+	Process(cmd goredis.Cmder) error
+	Watch(fn func(*goredis.Tx) error, keys ...string) error
 }
 
 // ClientConfig is a configuration common to all types of Redis clients.
 type ClientConfig struct {
 	// Password for authentication, if required.
-	Password string `json:"password"`
+	// Can refer to a secret, e.g. ${env:REDIS_PASSWORD} (see config.ResolveSecretRefs()).
+	Password string `json:"password" secret:"true"`
 
 	// Dial timeout for establishing new connections. Default is 5 seconds.
-	DialTimeout time.Duration `json:"dial-timeout"`
+	DialTimeout time.Duration `json:"dial-timeout" default:"5s" validate:"min=0s"`
 
 	// Timeout for socket reads. If reached, commands will fail with a timeout
 	// instead of blocking. Default is 3 seconds.
-	ReadTimeout time.Duration `json:"read-timeout"`
+	ReadTimeout time.Duration `json:"read-timeout" default:"3s" validate:"min=0s"`
 
 	// Timeout for socket writes. If reached, commands will fail with a timeout
 	// instead of blocking. Default is ReadTimeout.
-	WriteTimeout time.Duration `json:"write-timeout"`
+	WriteTimeout time.Duration `json:"write-timeout" validate:"min=0s"`
 
 	// Connection pool configuration.
 	Pool PoolConfig `json:"pool"`
+
+	// Change feed based on Redis Streams, used by watchers instead of
+	// keyspace notifications when enabled.
+	ChangeFeed ChangeFeedConfig `json:"change-feed"`
 }
 
 // NodeConfig Node client configuration
 type NodeConfig struct {
 	// host:port address of a Redis node
-	Endpoint string `json:"endpoint"`
+	Endpoint string `json:"endpoint" validate:"hostport"`
 
 	// Database to be selected after connecting to the server.
 	DB int `json:"db"`
@@ -139,7 +147,7 @@ type NodeConfig struct {
 // ClusterConfig Cluster client configuration
 type ClusterConfig struct {
 	// A seed list of host:port addresses of cluster nodes.
-	Endpoints []string `json:"endpoints"`
+	Endpoints []string `json:"endpoints" validate:"required,hostport"`
 
 	// Enables read-only queries on slave nodes.
 	EnableReadQueryOnSlave bool `json:"enable-query-on-slave"`
@@ -150,13 +158,17 @@ type ClusterConfig struct {
 	// Allows routing read-only commands to the closest master or slave node.
 	RouteByLatency bool `json:"route-by-latency"`
 
+	// How transactions with keys of several hash slots are committed:
+	// reject (default), split or rollback (see CrossSlotTxnMode).
+	CrossSlotTxn CrossSlotTxnMode `json:"cross-slot-txn" default:"reject" validate:"oneof=reject split rollback"`
+
 	ClientConfig
 }
 
 // SentinelConfig Sentinel client configuration
 type SentinelConfig struct {
 	// A seed list of host:port addresses sentinel nodes.
-	Endpoints []string `json:"endpoints"`
+	Endpoints []string `json:"endpoints" validate:"required,hostport"`
 
 	// The sentinel master name.
 	MasterName string `json:"master-name"`
@@ -171,7 +183,7 @@ type SentinelConfig struct {
 type PoolConfig struct {
 	// Maximum number of socket connections.
 	// Default is 10 connections per every CPU as reported by runtime.NumCPU.
-	PoolSize int `json:"max-connections"`
+	PoolSize int `json:"max-connections" validate:"min=0"`
 	// Amount of time, in seconds, a client waits for connection if all connections
 	// are busy before returning an error.
 	// Default is ReadTimeout + 1 second.
@@ -179,7 +191,7 @@ type PoolConfig struct {
 	// Amount of time, in seconds, after which a client closes idle connections.
 	// Should be less than server's timeout.
 	// Default is 5 minutes.
-	IdleTimeout time.Duration `json:"idle-timeout"`
+	IdleTimeout time.Duration `json:"idle-timeout" default:"5m" validate:"min=0s"`
 	// Frequency of idle checks.
 	// Default is 1 minute.
 	// When negative value is set, then idle check is disabled.
@@ -337,7 +349,26 @@ func CreateSentinelClient(config SentinelConfig) (Client, error) {
 	}), nil
 }
 
+// getClientConfig returns the configuration common to all types of clients
+// from the node, cluster or sentinel configuration.
+func getClientConfig(config interface{}) ClientConfig {
+	switch cfg := config.(type) {
+	case NodeConfig:
+		return cfg.ClientConfig
+	case ClusterConfig:
+		return cfg.ClientConfig
+	case SentinelConfig:
+		return cfg.ClientConfig
+	}
+	return ClientConfig{}
+}
+
 // LoadConfig Loads the given configFile and returns appropriate config instance.
+// The type of the configuration is selected by the fields that are set
+// (master-name for sentinel, endpoint for a single node, cluster otherwise).
+// Empty fields are set to their default values (see config.SetDefaults()),
+// references to secrets are resolved (see config.ResolveSecretRefs()) and
+// the configuration is validated (see config.Validate()).
 func LoadConfig(configFile string) (cfg interface{}, err error) {
 	b, err := ioutil.ReadFile(configFile)
 	if err != nil {
@@ -350,7 +381,8 @@ func LoadConfig(configFile string) (cfg interface{}, err error) {
 		return nil, err
 	}
 	if s.MasterName != "" {
-		return s, nil
+		err = completeConfig(&s)
+		return s, err
 	}
 
 	n := NodeConfig{}
@@ -359,7 +391,8 @@ func LoadConfig(configFile string) (cfg interface{}, err error) {
 		return nil, err
 	}
 	if n.Endpoint != "" {
-		return n, nil
+		err = completeConfig(&n)
+		return n, err
 	}
 
 	c := ClusterConfig{}
@@ -367,5 +400,18 @@ func LoadConfig(configFile string) (cfg interface{}, err error) {
 	if err != nil {
 		return nil, err
 	}
-	return c, nil
+	err = completeConfig(&c)
+	return c, err
+}
+
+// completeConfig applies the defaults, secrets and validation rules
+// to the loaded configuration (pointer to the selected config type).
+func completeConfig(cfg interface{}) error {
+	if err := config.SetDefaults(cfg); err != nil {
+		return err
+	}
+	if err := config.ResolveSecretRefs(cfg); err != nil {
+		return err
+	}
+	return config.Validate(cfg)
 }
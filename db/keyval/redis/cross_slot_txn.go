@@ -0,0 +1,205 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"fmt"
+	"time"
+
+	goredis "github.com/go-redis/redis"
+)
+
+// CrossSlotTxnMode defines how transactions with keys of several hash slots
+// are committed in Redis Cluster. Redis Cluster supports MULTI/EXEC only
+// for keys of the same hash slot (https://redis.io/topics/cluster-spec#keys-hash-tags).
+type CrossSlotTxnMode string
+
+const (
+	// CrossSlotTxnReject rejects transactions with keys of several hash slots
+	// (default).
+	CrossSlotTxnReject CrossSlotTxnMode = "reject"
+
+	// CrossSlotTxnSplit groups the operations by hash slots and commits each
+	// group by a separate MULTI/EXEC (in the order of the first operation of
+	// the group). Each group is atomic, the transaction as a whole is not:
+	// if a group fails, the previous groups remain committed and
+	// *CrossSlotTxnError describes which keys were changed.
+	CrossSlotTxnSplit CrossSlotTxnMode = "split"
+
+	// CrossSlotTxnRollback is CrossSlotTxnSplit with a compensating rollback:
+	// the values and the remaining TTLs of the keys are read before the commit
+	// and if a group fails, the values of the keys of the committed groups are
+	// restored together with their expiration (the TTL read before the commit,
+	// i.e. the keys expire no sooner than they would have without the
+	// transaction). Changes of the keys made by others in the meantime are
+	// overwritten by the rollback.
+	CrossSlotTxnRollback CrossSlotTxnMode = "rollback"
+)
+
+// CrossSlotTxnError is returned by Commit of a transaction split by hash slots
+// (see CrossSlotTxnSplit) if a group of operations failed.
+type CrossSlotTxnError struct {
+	// Committed are the keys of the committed groups (not rolled back).
+	Committed []string
+	// Failed are the keys of the group that failed.
+	Failed []string
+	// NotApplied are the keys of the groups that were not committed
+	// because of the failure.
+	NotApplied []string
+	// RolledBack are the keys of the committed groups restored
+	// by the compensating rollback (see CrossSlotTxnRollback).
+	RolledBack []string
+	// Err is the error of the failed group.
+	Err error
+	// RollbackErr is the error of the rollback (if any).
+	RollbackErr error
+}
+
+// Error returns the description of the partial failure.
+func (e *CrossSlotTxnError) Error() string {
+	msg := fmt.Sprintf("cross-slot transaction failed for keys %v: %v (committed %v, not applied %v",
+		e.Failed, e.Err, e.Committed, e.NotApplied)
+	if len(e.RolledBack) > 0 {
+		msg += fmt.Sprintf(", rolled back %v", e.RolledBack)
+	}
+	if e.RollbackErr != nil {
+		msg += fmt.Sprintf(", rollback failed: %v", e.RollbackErr)
+	}
+	return msg + ")"
+}
+
+// SetCrossSlotTxnMode sets how transactions with keys of several hash slots
+// are committed in Redis Cluster (see CrossSlotTxnMode).
+func (db *BytesConnectionRedis) SetCrossSlotTxnMode(mode CrossSlotTxnMode) {
+	db.crossSlotTxn = mode
+}
+
+// groupBySlot groups the operations by the hash slots of their keys
+// (in the order of the first operation of each group).
+func groupBySlot(ops []op) [][]op {
+	var groups [][]op
+	index := make(map[uint16]int)
+	for _, op := range ops {
+		slot := getHashSlot(op.key)
+		i, found := index[slot]
+		if !found {
+			i = len(groups)
+			index[slot] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], op)
+	}
+	return groups
+}
+
+// commitCrossSlot commits the groups of operations according to the mode
+// of the connection. Only the keys of the groups that remain committed
+// are released from their leases.
+func (db *BytesConnectionRedis) commitCrossSlot(groups [][]op) error {
+	switch db.crossSlotTxn {
+	case CrossSlotTxnSplit, CrossSlotTxnRollback:
+	case CrossSlotTxnReject, "":
+		return fmt.Errorf("Commit() failed: keys of the transaction hash to %d slots, "+
+			"use hash tags or SetCrossSlotTxnMode()", len(groups))
+	default:
+		return fmt.Errorf("Commit() failed: unknown cross-slot transaction mode %q", db.crossSlotTxn)
+	}
+
+	var rollback [][]op
+	if db.crossSlotTxn == CrossSlotTxnRollback {
+		var err error
+		if rollback, err = db.compensatingOps(groups); err != nil {
+			return fmt.Errorf("Commit() failed: %s", err)
+		}
+	}
+
+	for i, group := range groups {
+		err := db.commitOps(group)
+		if err == nil {
+			continue
+		}
+		txnErr := &CrossSlotTxnError{Failed: opKeys(group), Err: err}
+		for _, notApplied := range groups[i+1:] {
+			txnErr.NotApplied = append(txnErr.NotApplied, opKeys(notApplied)...)
+		}
+		for j, committed := range groups[:i] {
+			if rollback == nil {
+				txnErr.Committed = append(txnErr.Committed, opKeys(committed)...)
+			} else if rollbackErr := db.commitOps(rollback[j]); rollbackErr != nil {
+				txnErr.Committed = append(txnErr.Committed, opKeys(committed)...)
+				txnErr.RollbackErr = rollbackErr
+			} else {
+				txnErr.RolledBack = append(txnErr.RolledBack, opKeys(committed)...)
+			}
+		}
+		db.releaseKeys(txnErr.Committed...)
+		db.Warn(txnErr)
+		return txnErr
+	}
+	for _, group := range groups {
+		db.releaseOps(group)
+	}
+	return nil
+}
+
+// compensatingOps reads the current values and TTLs of the keys and returns
+// the operations restoring them for each group.
+func (db *BytesConnectionRedis) compensatingOps(groups [][]op) ([][]op, error) {
+	rollback := make([][]op, len(groups))
+	for i, group := range groups {
+		// keys of a group are in the same slot, MGET is allowed
+		keys := opKeys(group)
+		var mget *goredis.SliceCmd
+		pttls := make([]*goredis.DurationCmd, len(keys))
+		_, err := db.client.Pipelined(func(pipeline goredis.Pipeliner) error {
+			mget = pipeline.MGet(keys...)
+			for j, key := range keys {
+				pttls[j] = pipeline.PTTL(key)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("MGet(%v) failed: %s", keys, err)
+		}
+		values := mget.Val()
+		restored := make(map[string]struct{})
+		for j, key := range keys {
+			if _, duplicate := restored[key]; duplicate {
+				continue
+			}
+			restored[key] = struct{}{}
+			if value, found := values[j].(string); found {
+				// PTTL is negative for keys without expiration
+				var ttl time.Duration
+				if pttl := pttls[j].Val(); pttl > 0 {
+					ttl = pttl
+				}
+				rollback[i] = append(rollback[i], op{key: key, value: []byte(value), ttl: ttl})
+			} else {
+				rollback[i] = append(rollback[i], op{key: key, del: true})
+			}
+		}
+	}
+	return rollback, nil
+}
+
+// opKeys returns the keys of the operations.
+func opKeys(ops []op) []string {
+	keys := make([]string, len(ops))
+	for i, op := range ops {
+		keys[i] = op.key
+	}
+	return keys
+}
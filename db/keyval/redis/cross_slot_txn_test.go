@@ -0,0 +1,166 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ligato/cn-infra/datasync"
+	"github.com/ligato/cn-infra/db/keyval"
+	"github.com/onsi/gomega"
+)
+
+// keyPerNode returns a key stored by every node of the 3-node cluster.
+func keyPerNode(cluster *testCluster) (keys []string, nodes []*testNode) {
+	for i := 0; len(keys) < 3; i++ {
+		key := fmt.Sprintf("txn%d", i)
+		node := cluster.nodeOf(key)
+		if len(nodes) == 0 || (node != nodes[0] && (len(nodes) == 1 || node != nodes[1])) {
+			keys = append(keys, key)
+			nodes = append(nodes, node)
+		}
+	}
+	return keys, nodes
+}
+
+func TestCrossSlotTxn(t *testing.T) {
+	gomega.RegisterTestingT(t)
+
+	cluster := newTestCluster(3)
+	defer cluster.close()
+	client, err := CreateClusterClient(ClusterConfig{Endpoints: cluster.addrs()})
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	conn, err := NewBytesConnection(client, log)
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	defer conn.Close()
+
+	keys, nodes := keyPerNode(cluster)
+	expectValues := func(values ...string) {
+		for i, key := range keys {
+			value, found := cluster.get(key)
+			if values[i] == "" {
+				gomega.Expect(found).Should(gomega.BeFalse(), key)
+			} else {
+				gomega.Expect(value).Should(gomega.Equal(values[i]), key)
+			}
+		}
+	}
+	newTxn := func(value string) *Txn {
+		txn := conn.NewTxn()
+		for _, key := range keys {
+			txn.Put(key, []byte(value))
+		}
+		return txn.(*Txn)
+	}
+
+	// rejected by default
+	gomega.Expect(newTxn("a").Commit()).ShouldNot(gomega.Succeed())
+	expectValues("", "", "")
+
+	conn.SetCrossSlotTxnMode(CrossSlotTxnSplit)
+	gomega.Expect(newTxn("a").Commit()).To(gomega.Succeed())
+	expectValues("a", "a", "a")
+
+	// partial failure
+	cluster.failExec(nodes[1], true)
+	err = newTxn("b").Commit()
+	txnErr, ok := err.(*CrossSlotTxnError)
+	gomega.Expect(ok).Should(gomega.BeTrue())
+	gomega.Expect(txnErr.Committed).Should(gomega.Equal([]string{keys[0]}))
+	gomega.Expect(txnErr.Failed).Should(gomega.Equal([]string{keys[1]}))
+	gomega.Expect(txnErr.NotApplied).Should(gomega.Equal([]string{keys[2]}))
+	gomega.Expect(txnErr.RolledBack).Should(gomega.BeEmpty())
+	expectValues("b", "a", "a")
+
+	// compensating rollback
+	conn.SetCrossSlotTxnMode(CrossSlotTxnRollback)
+	_, err = conn.Delete(keys[0])
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	err = newTxn("c").Commit()
+	txnErr, ok = err.(*CrossSlotTxnError)
+	gomega.Expect(ok).Should(gomega.BeTrue())
+	gomega.Expect(txnErr.Committed).Should(gomega.BeEmpty())
+	gomega.Expect(txnErr.RolledBack).Should(gomega.Equal([]string{keys[0]}))
+	gomega.Expect(txnErr.RollbackErr).ShouldNot(gomega.HaveOccurred())
+	expectValues("", "a", "a")
+
+	// the expiration of the restored keys is kept
+	gomega.Expect(conn.Put(keys[0], []byte("t"), datasync.WithTTL(time.Minute))).To(gomega.Succeed())
+	err = newTxn("d").Commit()
+	txnErr, ok = err.(*CrossSlotTxnError)
+	gomega.Expect(ok).Should(gomega.BeTrue())
+	gomega.Expect(txnErr.RolledBack).Should(gomega.Equal([]string{keys[0]}))
+	expectValues("t", "a", "a")
+	gomega.Expect(cluster.ttl(keys[0])).Should(gomega.BeEquivalentTo(time.Minute / time.Millisecond))
+
+	cluster.failExec(nodes[1], false)
+	gomega.Expect(newTxn("c").Commit()).To(gomega.Succeed())
+	expectValues("c", "c", "c")
+}
+
+func TestCrossSlotTxnLeases(t *testing.T) {
+	gomega.RegisterTestingT(t)
+
+	cluster := newTestCluster(3)
+	defer cluster.close()
+	client, err := CreateClusterClient(ClusterConfig{Endpoints: cluster.addrs()})
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	conn, err := NewBytesConnection(client, log)
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	defer conn.Close()
+
+	keys, nodes := keyPerNode(cluster)
+	id, err := conn.GrantLease(time.Minute)
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	for _, key := range keys {
+		gomega.Expect(conn.Put(key, []byte("leased"), keyval.WithLease(id))).To(gomega.Succeed())
+	}
+	expectLeased := func(leased ...bool) {
+		conn.leaseAccess.Lock()
+		defer conn.leaseAccess.Unlock()
+		for i, key := range keys {
+			_, found := conn.leases[id].keys[key]
+			gomega.Expect(found).Should(gomega.Equal(leased[i]), key)
+		}
+	}
+	newTxn := func(value string) keyval.BytesTxn {
+		txn := conn.NewTxn()
+		for _, key := range keys {
+			txn.Put(key, []byte(value))
+		}
+		return txn
+	}
+
+	// the keys of a rejected transaction keep their lease
+	gomega.Expect(newTxn("a").Commit()).ShouldNot(gomega.Succeed())
+	expectLeased(true, true, true)
+
+	// as well as the keys rolled back or not committed
+	cluster.failExec(nodes[1], true)
+	conn.SetCrossSlotTxnMode(CrossSlotTxnRollback)
+	gomega.Expect(newTxn("a").Commit()).ShouldNot(gomega.Succeed())
+	expectLeased(true, true, true)
+
+	// only the keys of the committed groups are released
+	conn.SetCrossSlotTxnMode(CrossSlotTxnSplit)
+	gomega.Expect(newTxn("a").Commit()).ShouldNot(gomega.Succeed())
+	expectLeased(false, true, true)
+
+	cluster.failExec(nodes[1], false)
+	gomega.Expect(newTxn("b").Commit()).To(gomega.Succeed())
+	expectLeased(false, false, false)
+}
@@ -0,0 +1,345 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	goredis "github.com/go-redis/redis"
+	"github.com/ligato/cn-infra/db/keyval/election"
+)
+
+// fencingTokenSuffix is appended to the lock key to get the key of the counter
+// of the lock acquisitions (fencing tokens), see fencingTokenKey().
+const fencingTokenSuffix = ".fencing-token"
+
+var (
+	// acquireScript sets the lock key if it does not exist and returns
+	// the next fencing token (0 if the lock is held by someone else).
+	acquireScript = goredis.NewScript(`
+if redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[2]) then
+	return redis.call('INCR', KEYS[2])
+end
+return 0`)
+
+	// refreshScript prolongs the expiration of the lock key if it is still
+	// held by the caller.
+	refreshScript = goredis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0`)
+
+	// releaseScript removes the lock key if it is still held by the caller.
+	releaseScript = goredis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0`)
+)
+
+// redisLock is a lock key set with SET NX and a TTL. The holder keeps
+// refreshing the TTL, the lock is therefore released by Redis once the holder
+// dies. Every acquisition of the lock increments the fencing token.
+type redisLock struct {
+	db  *BytesConnectionRedis
+	key string
+	ttl time.Duration
+
+	access sync.Mutex
+	value  string        // value of the lock key while the lock is held
+	token  int64         // fencing token of the last acquisition
+	stopCh chan struct{} // closed by release()
+	lostCh chan struct{} // closed once the lock is lost or released
+}
+
+// redisMutex implements election.Mutex using redisLock.
+type redisMutex struct {
+	*redisLock
+	owner string
+}
+
+// redisElection implements election.Election using redisLock whose value
+// carries the value of the leader.
+type redisElection struct {
+	*redisLock
+	owner string
+}
+
+// NewMutex creates a new distributed lock. The lock key expires after <ttl>
+// unless it is refreshed by the holder.
+func (db *BytesConnectionRedis) NewMutex(key string, ttl time.Duration) (election.Mutex, error) {
+	owner, err := newOwnerID()
+	if err != nil {
+		return nil, err
+	}
+	return &redisMutex{redisLock: newRedisLock(db, key, ttl), owner: owner}, nil
+}
+
+// NewElection creates a new participant of the leader election. The lock key
+// of the election expires after <ttl> unless it is refreshed by the leader.
+func (db *BytesConnectionRedis) NewElection(key string, ttl time.Duration) (election.Election, error) {
+	owner, err := newOwnerID()
+	if err != nil {
+		return nil, err
+	}
+	return &redisElection{redisLock: newRedisLock(db, key, ttl), owner: owner}, nil
+}
+
+func newRedisLock(db *BytesConnectionRedis, key string, ttl time.Duration) *redisLock {
+	return &redisLock{db: db, key: key, ttl: ttl}
+}
+
+// newOwnerID returns a random ID that identifies the holder of the lock.
+func newOwnerID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// Lock blocks until the lock is acquired or the <ctx> is done.
+func (m *redisMutex) Lock(ctx context.Context) error {
+	return m.acquire(ctx, m.owner)
+}
+
+// Unlock releases the lock.
+func (m *redisMutex) Unlock() error {
+	held, err := m.release()
+	if err == nil && !held {
+		return election.ErrNotHeld
+	}
+	return err
+}
+
+// FencingToken returns the token of the last acquisition of the lock.
+func (m *redisMutex) FencingToken() int64 {
+	m.access.Lock()
+	defer m.access.Unlock()
+
+	return m.token
+}
+
+// Close releases the lock (if held).
+func (m *redisMutex) Close() error {
+	_, err := m.release()
+	return err
+}
+
+// Campaign blocks until the agent acquires the lock of the election
+// or the <ctx> is done.
+func (e *redisElection) Campaign(ctx context.Context, value string) error {
+	return e.acquire(ctx, e.owner+":"+value)
+}
+
+// Resign releases the lock of the election.
+func (e *redisElection) Resign(ctx context.Context) error {
+	_, err := e.release()
+	return err
+}
+
+// IsLeader returns true if the agent holds the lock of the election.
+func (e *redisElection) IsLeader() bool {
+	e.access.Lock()
+	defer e.access.Unlock()
+
+	if e.lostCh == nil {
+		return false
+	}
+	select {
+	case <-e.lostCh:
+		return false
+	default:
+		return true
+	}
+}
+
+// Observe polls the lock key of the election.
+func (e *redisElection) Observe(ctx context.Context) <-chan string {
+	leaderCh := make(chan string)
+	go func() {
+		defer close(leaderCh)
+		ticker := time.NewTicker(e.retryInterval())
+		defer ticker.Stop()
+
+		var leader string
+		first := true
+		for {
+			current, err := e.db.client.Get(e.key).Result()
+			if err != nil && err != GoRedisNil {
+				e.db.Warnf("observation of election %s failed: %v", e.key, err)
+			} else if first || current != leader {
+				first, leader = false, current
+				var value string
+				if parts := strings.SplitN(current, ":", 2); len(parts) == 2 {
+					value = parts[1]
+				}
+				select {
+				case leaderCh <- value:
+				case <-ctx.Done():
+					return
+				}
+			}
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			case <-e.db.stopCh:
+				return
+			}
+		}
+	}()
+	return leaderCh
+}
+
+// Close resigns.
+func (e *redisElection) Close() error {
+	_, err := e.release()
+	return err
+}
+
+// retryInterval is the interval of attempts to acquire the lock.
+func (l *redisLock) retryInterval() time.Duration {
+	interval := l.ttl / 10
+	if interval < 10*time.Millisecond {
+		interval = 10 * time.Millisecond
+	}
+	return interval
+}
+
+func (l *redisLock) acquire(ctx context.Context, value string) error {
+	if l.db.closed {
+		return fmt.Errorf("acquisition of lock %s called on a closed connection", l.key)
+	}
+	for {
+		sent := time.Now()
+		res, err := acquireScript.Run(l.db.client, []string{l.key, fencingTokenKey(l.key)},
+			value, int64(l.ttl/time.Millisecond)).Result()
+		if err != nil {
+			return fmt.Errorf("acquisition of lock %s failed: %s", l.key, err)
+		}
+		if token, ok := res.(int64); ok && token > 0 {
+			l.access.Lock()
+			l.value, l.token = value, token
+			l.stopCh, l.lostCh = make(chan struct{}), make(chan struct{})
+			go l.keepAlive(value, sent, l.stopCh, l.lostCh)
+			l.access.Unlock()
+			return nil
+		}
+		select {
+		case <-time.After(l.retryInterval()):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// fencingTokenKey returns the key of the counter of the acquisitions of the lock
+// <key>. The counter hashes to the same slot of Redis Cluster as the lock key,
+// so that both keys can be used by a single script: the lock key with a hash tag
+// keeps the tag, other lock keys are used as the hash tag of the counter.
+func fencingTokenKey(key string) string {
+	if tokenKey := key + fencingTokenSuffix; getHashSlot(tokenKey) == getHashSlot(key) {
+		return tokenKey
+	}
+	return "{" + key + "}" + fencingTokenSuffix
+}
+
+// keepAlive refreshes the TTL of the lock key three times per TTL until
+// the lock is released or lost. The lock is considered lost also once the TTL
+// passes since the last successful refresh (the lock key may have already
+// expired in Redis and be acquired by someone else), <refreshed> is the time
+// the acquisition of the lock was sent.
+func (l *redisLock) keepAlive(value string, refreshed time.Time, stopCh, lostCh chan struct{}) {
+	defer close(lostCh)
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+	expiration := time.NewTimer(l.ttl - time.Since(refreshed))
+	defer expiration.Stop()
+
+	// refreshes run in the background so that a stuck request does not delay
+	// the expiration
+	type refreshResult struct {
+		sent time.Time
+		res  interface{}
+		err  error
+	}
+	resultCh := make(chan refreshResult, 1)
+	refreshing := false
+
+	for {
+		select {
+		case <-ticker.C:
+			if refreshing {
+				continue
+			}
+			refreshing = true
+			go func(sent time.Time) {
+				res, err := refreshScript.Run(l.db.client, []string{l.key}, value, int64(l.ttl/time.Millisecond)).Result()
+				resultCh <- refreshResult{sent, res, err}
+			}(time.Now())
+		case result := <-resultCh:
+			refreshing = false
+			if result.err != nil {
+				l.db.Warnf("refresh of lock %s failed: %v", l.key, result.err)
+			} else if ok, _ := result.res.(int64); ok == 0 {
+				l.db.Warnf("lock %s was lost", l.key)
+				return
+			} else {
+				if !expiration.Stop() {
+					select {
+					case <-expiration.C:
+					default:
+					}
+				}
+				expiration.Reset(l.ttl - time.Since(result.sent))
+			}
+		case <-expiration.C:
+			l.db.Warnf("lock %s was lost (not refreshed within %v)", l.key, l.ttl)
+			return
+		case <-stopCh:
+			return
+		case <-l.db.stopCh:
+			return
+		}
+	}
+}
+
+// release removes the lock key if the lock is held.
+func (l *redisLock) release() (held bool, err error) {
+	l.access.Lock()
+	defer l.access.Unlock()
+
+	if l.value == "" {
+		return false, nil
+	}
+	value := l.value
+	l.value = ""
+	close(l.stopCh)
+
+	res, err := releaseScript.Run(l.db.client, []string{l.key}, value).Result()
+	if err != nil {
+		return true, fmt.Errorf("release of lock %s failed: %s", l.key, err)
+	}
+	deleted, _ := res.(int64)
+	return deleted != 0, nil
+}
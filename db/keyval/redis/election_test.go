@@ -0,0 +1,186 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis"
+	goredis "github.com/go-redis/redis"
+	"github.com/ligato/cn-infra/db/keyval/election"
+	"github.com/onsi/gomega"
+)
+
+// newElectionConnection returns a new connection to miniRedis
+// (bytesConn is closed by TestBrokerClosed).
+func newElectionConnection() *BytesConnectionRedis {
+	conn, err := NewBytesConnection(goredis.NewClient(&goredis.Options{Addr: miniRedis.Addr()}), log)
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	return conn
+}
+
+func TestMutex(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	conn := newElectionConnection()
+	defer conn.Close()
+
+	mutex1, err := conn.NewMutex("mutex", time.Second)
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	mutex2, err := conn.NewMutex("mutex", time.Second)
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	gomega.Expect(mutex1.Lock(context.Background())).To(gomega.Succeed())
+	token := mutex1.FencingToken()
+	gomega.Expect(token).Should(gomega.BeNumerically(">", 0))
+
+	// the lock is held by mutex1
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	gomega.Expect(mutex2.Lock(ctx)).Should(gomega.Equal(context.DeadlineExceeded))
+	gomega.Expect(mutex2.Unlock()).Should(gomega.Equal(election.ErrNotHeld))
+
+	gomega.Expect(mutex1.Unlock()).To(gomega.Succeed())
+	gomega.Expect(mutex2.Lock(context.Background())).To(gomega.Succeed())
+	gomega.Expect(mutex2.FencingToken()).Should(gomega.BeNumerically(">", token))
+
+	// the lock expired and was taken over by someone else
+	miniRedis.Set("mutex", "other")
+	gomega.Expect(mutex2.Unlock()).Should(gomega.Equal(election.ErrNotHeld))
+	gomega.Expect(mutex1.Close()).To(gomega.Succeed())
+	gomega.Expect(mutex2.Close()).To(gomega.Succeed())
+	miniRedis.Del("mutex")
+}
+
+func TestElection(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	conn := newElectionConnection()
+	defer conn.Close()
+
+	candidate1, err := conn.NewElection("election", time.Second)
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	candidate2, err := conn.NewElection("election", time.Second)
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	leaderCh := candidate2.Observe(ctx)
+	gomega.Eventually(leaderCh).Should(gomega.Receive(gomega.Equal("")))
+
+	gomega.Expect(candidate1.Campaign(context.Background(), "agent1")).To(gomega.Succeed())
+	gomega.Expect(candidate1.IsLeader()).Should(gomega.BeTrue())
+	gomega.Eventually(leaderCh).Should(gomega.Receive(gomega.Equal("agent1")))
+
+	campaignDone := make(chan error, 1)
+	go func() {
+		campaignDone <- candidate2.Campaign(context.Background(), "agent2")
+	}()
+	gomega.Consistently(campaignDone, 100*time.Millisecond).ShouldNot(gomega.Receive())
+	gomega.Expect(candidate2.IsLeader()).Should(gomega.BeFalse())
+
+	gomega.Expect(candidate1.Resign(context.Background())).To(gomega.Succeed())
+	gomega.Expect(candidate1.IsLeader()).Should(gomega.BeFalse())
+	gomega.Eventually(campaignDone).Should(gomega.Receive(gomega.BeNil()))
+	gomega.Expect(candidate2.IsLeader()).Should(gomega.BeTrue())
+	gomega.Eventually(leaderCh).Should(gomega.Receive(gomega.Equal("agent2")))
+
+	gomega.Expect(candidate2.Close()).To(gomega.Succeed())
+	gomega.Expect(candidate1.Close()).To(gomega.Succeed())
+}
+
+func TestElectionLostWhenNotRefreshed(t *testing.T) {
+	gomega.RegisterTestingT(t)
+	server, err := miniredis.Run()
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	defer server.Close()
+	conn, err := NewBytesConnection(goredis.NewClient(&goredis.Options{Addr: server.Addr()}), log)
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	defer conn.Close()
+
+	candidate, err := conn.NewElection("election", 300*time.Millisecond)
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	gomega.Expect(candidate.Campaign(context.Background(), "agent1")).To(gomega.Succeed())
+	gomega.Consistently(candidate.IsLeader, 400*time.Millisecond).Should(gomega.BeTrue())
+
+	// the lock cannot be refreshed, leadership is lost once the TTL passes
+	server.Close()
+	gomega.Eventually(candidate.IsLeader, 400*time.Millisecond, 10*time.Millisecond).Should(gomega.BeFalse())
+}
+
+// registerLockScripts registers the emulations of the scripts of redisLock
+// (expiration of the lock key is not emulated).
+func registerLockScripts(cluster *testCluster) {
+	cluster.registerScript(acquireScript.Hash(), func(node *testNode, keys []string, args []string) interface{} {
+		if _, held := node.data[keys[0]]; held {
+			return int64(0)
+		}
+		node.data[keys[0]] = args[0]
+		token, _ := strconv.ParseInt(node.data[keys[1]], 10, 64)
+		token++
+		node.data[keys[1]] = strconv.FormatInt(token, 10)
+		return token
+	})
+	cluster.registerScript(refreshScript.Hash(), func(node *testNode, keys []string, args []string) interface{} {
+		if node.data[keys[0]] == args[0] {
+			return int64(1)
+		}
+		return int64(0)
+	})
+	cluster.registerScript(releaseScript.Hash(), func(node *testNode, keys []string, args []string) interface{} {
+		if node.data[keys[0]] == args[0] {
+			delete(node.data, keys[0])
+			return int64(1)
+		}
+		return int64(0)
+	})
+}
+
+func TestClusterMutex(t *testing.T) {
+	gomega.RegisterTestingT(t)
+
+	cluster := newTestCluster(3)
+	defer cluster.close()
+	registerLockScripts(cluster)
+	client, err := CreateClusterClient(ClusterConfig{Endpoints: cluster.addrs()})
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	conn, err := NewBytesConnection(client, log)
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	defer conn.Close()
+
+	// the counter of the fencing tokens is stored in the slot of the lock key
+	for _, key := range []string{"/cluster/mutex", "/{agent1}/mutex"} {
+		gomega.Expect(getHashSlot(fencingTokenKey(key))).Should(gomega.Equal(getHashSlot(key)), key)
+
+		mutex1, err := conn.NewMutex(key, time.Second)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+		mutex2, err := conn.NewMutex(key, time.Second)
+		gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+
+		gomega.Expect(mutex1.Lock(context.Background())).To(gomega.Succeed())
+		gomega.Expect(mutex1.FencingToken()).Should(gomega.BeEquivalentTo(1))
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		gomega.Expect(mutex2.Lock(ctx)).Should(gomega.Equal(context.DeadlineExceeded))
+		cancel()
+
+		gomega.Expect(mutex1.Unlock()).To(gomega.Succeed())
+		gomega.Expect(mutex2.Lock(context.Background())).To(gomega.Succeed())
+		gomega.Expect(mutex2.FencingToken()).Should(gomega.BeEquivalentTo(2))
+		gomega.Expect(mutex2.Close()).To(gomega.Succeed())
+		_, held := cluster.get(key)
+		gomega.Expect(held).Should(gomega.BeFalse())
+	}
+}
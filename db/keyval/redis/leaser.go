@@ -0,0 +1,228 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/ligato/cn-infra/db/keyval"
+)
+
+// lease is emulated by expiration of the keys put with the lease. The expiration
+// is refreshed by PEXPIRE while the lease is kept alive.
+type lease struct {
+	ttl  time.Duration
+	keys map[string]struct{}
+	// stop is closed by Revoke() (nil until the lease is kept alive)
+	stop chan struct{}
+}
+
+// GrantLease creates a new lease. Redis does not support leases, the lease
+// is therefore local to the connection: the keys put with the lease expire
+// after <ttl> unless the lease is kept alive by the (running) agent.
+func (db *BytesConnectionRedis) GrantLease(ttl time.Duration) (keyval.LeaseID, error) {
+	if db.closed {
+		return "", fmt.Errorf("GrantLease() called on a closed connection")
+	}
+	if ttl <= 0 {
+		return "", fmt.Errorf("GrantLease() failed: invalid TTL %v", ttl)
+	}
+
+	db.leaseAccess.Lock()
+	defer db.leaseAccess.Unlock()
+
+	db.lastLeaseID++
+	id := keyval.LeaseID(strconv.FormatInt(db.lastLeaseID, 10))
+	db.leases[id] = &lease{ttl: ttl, keys: make(map[string]struct{})}
+	return id, nil
+}
+
+// KeepAlive periodically refreshes the expiration of the keys put with
+// the lease until the lease is revoked or the connection is closed.
+func (db *BytesConnectionRedis) KeepAlive(id keyval.LeaseID) error {
+	if db.closed {
+		return fmt.Errorf("KeepAlive(%s) called on a closed connection", id)
+	}
+
+	db.leaseAccess.Lock()
+	defer db.leaseAccess.Unlock()
+
+	l, found := db.leases[id]
+	if !found {
+		return fmt.Errorf("KeepAlive(%s) failed: lease not found", id)
+	}
+	if l.stop == nil {
+		l.stop = make(chan struct{})
+		go db.refreshLease(l)
+	}
+	return nil
+}
+
+// Revoke removes the lease together with all keys put with the lease.
+func (db *BytesConnectionRedis) Revoke(id keyval.LeaseID) error {
+	if db.closed {
+		return fmt.Errorf("Revoke(%s) called on a closed connection", id)
+	}
+
+	db.leaseAccess.Lock()
+	l, found := db.leases[id]
+	if !found {
+		db.leaseAccess.Unlock()
+		return fmt.Errorf("Revoke(%s) failed: lease not found", id)
+	}
+	delete(db.leases, id)
+	if l.stop != nil {
+		close(l.stop)
+	}
+	keys := l.keyList()
+	db.leaseAccess.Unlock()
+
+	if len(keys) == 0 {
+		return nil
+	}
+	var err error
+	if db.recordsChanges(delOps(keys)...) {
+		_, _, err = db.changeFeed.apply(db.client, delOps(keys), 0, false)
+	} else {
+		err = db.client.Del(keys...).Err()
+	}
+	if err != nil {
+		return fmt.Errorf("Revoke(%s) failed: %s", id, err)
+	}
+	return nil
+}
+
+// putWithLease sets the key with the expiration of the lease.
+// The key is removed from the lease it was put with before (if any).
+// With <createOnly> the key is set (SET NX PX) and bound to the lease only
+// if it does not exist yet (keyval.ErrRevisionMismatch is returned otherwise).
+func (db *BytesConnectionRedis) putWithLease(key string, data []byte, id keyval.LeaseID, createOnly bool) error {
+	db.leaseAccess.Lock()
+	l, found := db.leases[id]
+	if found && !createOnly {
+		db.releaseKeysLocked(key)
+		l.keys[key] = struct{}{}
+	}
+	db.leaseAccess.Unlock()
+
+	if !found {
+		return fmt.Errorf("Put(%s) failed: lease %s not found", key, id)
+	}
+	created := true
+	if db.recordsChanges(op{key: key}) {
+		var err error
+		if created, _, err = db.changeFeed.apply(db.client, []op{{key: key, value: data}}, l.ttl, createOnly); err != nil {
+			return fmt.Errorf("Put(%s) failed: %s", key, err)
+		}
+	} else if createOnly {
+		var err error
+		if created, err = db.client.SetNX(key, data, l.ttl).Result(); err != nil {
+			return fmt.Errorf("SetNX(%s) failed: %s", key, err)
+		}
+	} else if err := db.client.Set(key, data, l.ttl).Err(); err != nil {
+		return fmt.Errorf("Set(%s) failed: %s", key, err)
+	}
+	if !created {
+		return &keyval.ErrRevisionMismatch{Key: key}
+	}
+
+	if createOnly {
+		// the existing key (possibly bound to another lease) must not be released
+		// before it is known that it did not exist
+		db.leaseAccess.Lock()
+		db.releaseKeysLocked(key)
+		l.keys[key] = struct{}{}
+		db.leaseAccess.Unlock()
+	}
+	return nil
+}
+
+// refreshLease refreshes the expiration of the keys put with the lease
+// three times per TTL.
+func (db *BytesConnectionRedis) refreshLease(l *lease) {
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			db.leaseAccess.Lock()
+			keys := l.keyList()
+			db.leaseAccess.Unlock()
+			for _, key := range keys {
+				if err := db.client.PExpire(key, l.ttl).Err(); err != nil {
+					db.Warnf("PExpire(%s) failed: %s", key, err)
+				}
+			}
+		case <-l.stop:
+			return
+		case <-db.stopCh:
+			return
+		}
+	}
+}
+
+// releaseKeys removes the keys from the leases they were put with. It is called
+// once the keys were overwritten (or before they are deleted), so that their
+// expiration is no longer refreshed and Revoke() does not delete them.
+func (db *BytesConnectionRedis) releaseKeys(keys ...string) {
+	db.leaseAccess.Lock()
+	defer db.leaseAccess.Unlock()
+
+	db.releaseKeysLocked(keys...)
+}
+
+func (db *BytesConnectionRedis) releaseKeysLocked(keys ...string) {
+	for _, l := range db.leases {
+		for _, key := range keys {
+			delete(l.keys, key)
+		}
+	}
+}
+
+// releaseOps removes the keys of the operations from the leases.
+func (db *BytesConnectionRedis) releaseOps(ops []op) {
+	keys := make([]string, len(ops))
+	for i, op := range ops {
+		keys[i] = op.key
+	}
+	db.releaseKeys(keys...)
+}
+
+// keyList returns the keys put with the lease.
+func (l *lease) keyList() []string {
+	keys := make([]string, 0, len(l.keys))
+	for key := range l.keys {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// GrantLease calls GrantLease function of BytesConnectionRedis.
+func (pdb *BytesBrokerWatcherRedis) GrantLease(ttl time.Duration) (keyval.LeaseID, error) {
+	return pdb.delegate.GrantLease(ttl)
+}
+
+// KeepAlive calls KeepAlive function of BytesConnectionRedis.
+func (pdb *BytesBrokerWatcherRedis) KeepAlive(id keyval.LeaseID) error {
+	return pdb.delegate.KeepAlive(id)
+}
+
+// Revoke calls Revoke function of BytesConnectionRedis.
+func (pdb *BytesBrokerWatcherRedis) Revoke(id keyval.LeaseID) error {
+	return pdb.delegate.Revoke(id)
+}
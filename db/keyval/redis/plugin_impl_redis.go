@@ -15,6 +15,9 @@
 package redis
 
 import (
+	"time"
+
+	"github.com/ligato/cn-infra/config"
 	"github.com/ligato/cn-infra/db/keyval"
 	"github.com/ligato/cn-infra/db/keyval/kvproto"
 	"github.com/ligato/cn-infra/flavors/local"
@@ -62,6 +65,15 @@ func (plugin *Plugin) Init() (err error) {
 	if err != nil {
 		return err
 	}
+	if feedCfg := getClientConfig(redisCfg).ChangeFeed; feedCfg.Enabled {
+		plugin.connection.EnableChangeFeed(feedCfg)
+		if feedCfg.RevisionFile != "" {
+			plugin.connection.SetWatchRevisionStore(keyval.NewFileWatchRevisionStore(feedCfg.RevisionFile))
+		}
+	}
+	if clusterCfg, isCluster := redisCfg.(ClusterConfig); isCluster {
+		plugin.connection.SetCrossSlotTxnMode(clusterCfg.CrossSlotTxn)
+	}
 	plugin.protoWrapper = kvproto.NewProtoWrapperWithSerializer(plugin.connection, &keyval.SerializerJSON{})
 
 	// Register for providing status reports (polling mode)
@@ -95,6 +107,15 @@ func (plugin *Plugin) NewWatcher(keyPrefix string) keyval.ProtoWatcher {
 	return plugin.protoWrapper.NewWatcher(keyPrefix)
 }
 
+// RawAccess returns access to the data stored in redis in the form of bytes
+// (nil if the plugin is disabled).
+func (plugin *Plugin) RawAccess() keyval.KvBytesPlugin {
+	if plugin.connection == nil {
+		return nil
+	}
+	return plugin.connection
+}
+
 // Disabled returns *true* if the plugin is not in use due to missing
 // redis configuration.
 func (plugin *Plugin) Disabled() (disabled bool) {
@@ -111,9 +132,29 @@ func (plugin *Plugin) getRedisConfig() (cfg interface{}, err error) {
 	configFile := plugin.PluginConfig.GetConfigName()
 	if configFile != "" {
 		cfg, err = LoadConfig(configFile)
+		plugin.reportLoadStatus(configFile, cfg, err)
 		if err != nil {
 			return
 		}
 	}
 	return
 }
+
+// reportLoadStatus records the configuration loaded by LoadConfig() (the type
+// of the configuration is not known in advance, so GetValue() above only
+// checks that the config file exists).
+func (plugin *Plugin) reportLoadStatus(configFile string, cfg interface{}, err error) {
+	status, found := config.GetLoadStatus(string(plugin.PluginName))
+	if !found {
+		status = config.LoadStatus{PluginName: string(plugin.PluginName), File: configFile}
+	}
+	status.Found = true
+	status.Config = nil
+	status.LoadedAt = time.Time{}
+	if err != nil {
+		status.Error = err.Error()
+	} else {
+		status.Config, _ = config.Redact(cfg)
+	}
+	config.ReportLoadStatus(status)
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ligato/cn-infra/config"
+	"github.com/ligato/cn-infra/flavors/local"
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+	"github.com/namsral/flag"
+	"github.com/onsi/gomega"
+)
+
+func TestConfigLoadStatus(t *testing.T) {
+	gomega.RegisterTestingT(t)
+
+	dir, err := ioutil.TempDir("", "redis-config")
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	defer os.RemoveAll(dir)
+	cfgFile := filepath.Join(dir, "redis.conf")
+
+	const pluginName = "redis-status"
+	plugin := &Plugin{}
+	plugin.PluginInfraDeps = local.PluginInfraDeps{
+		PluginLogDeps: local.PluginLogDeps{Log: logging.ForPlugin(pluginName, logrus.NewLogRegistry()), PluginName: pluginName},
+		PluginConfig:  config.ForPlugin(pluginName, cfgFile),
+	}
+	gomega.Expect(flag.Set(pluginName+config.FlagSuffix, cfgFile)).To(gomega.Succeed()) // declared by a previous run
+
+	// the loaded configuration is reported with the password redacted
+	gomega.Expect(ioutil.WriteFile(cfgFile, []byte("endpoint: localhost:6379\npassword: secret\n"), 0644)).To(gomega.Succeed())
+	cfg, err := plugin.getRedisConfig()
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	gomega.Expect(cfg).Should(gomega.BeAssignableToTypeOf(NodeConfig{}))
+
+	status, found := config.GetLoadStatus(pluginName)
+	gomega.Expect(found).Should(gomega.BeTrue())
+	gomega.Expect(status.Found).Should(gomega.BeTrue())
+	gomega.Expect(status.File).Should(gomega.Equal(cfgFile))
+	gomega.Expect(status.Error).Should(gomega.BeEmpty())
+	gomega.Expect(status.Config).Should(gomega.HaveKeyWithValue("endpoint", "localhost:6379"))
+	gomega.Expect(status.Config).Should(gomega.HaveKeyWithValue("password", config.RedactedValue))
+
+	// errors of LoadConfig are reported as well
+	os.Unsetenv("REDIS_STATUS_TEST_PASSWORD")
+	gomega.Expect(ioutil.WriteFile(cfgFile, []byte("endpoint: localhost:6379\npassword: ${env:REDIS_STATUS_TEST_PASSWORD}\n"), 0644)).To(gomega.Succeed())
+	_, err = plugin.getRedisConfig()
+	gomega.Expect(err).Should(gomega.HaveOccurred())
+
+	status, found = config.GetLoadStatus(pluginName)
+	gomega.Expect(found).Should(gomega.BeTrue())
+	gomega.Expect(status.Error).Should(gomega.Equal(err.Error()))
+	gomega.Expect(status.Config).Should(gomega.BeNil())
+}
+
+func TestLoadConfigDefaults(t *testing.T) {
+	gomega.RegisterTestingT(t)
+
+	dir, err := ioutil.TempDir("", "redis-config")
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	defer os.RemoveAll(dir)
+	cfgFile := filepath.Join(dir, "redis.conf")
+
+	// the defaults of the selected config type are applied
+	gomega.Expect(ioutil.WriteFile(cfgFile, []byte("endpoints: [\"localhost:7000\"]\nread-timeout: 1000000000\n"), 0644)).To(gomega.Succeed())
+	cfg, err := LoadConfig(cfgFile)
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	gomega.Expect(cfg).Should(gomega.BeAssignableToTypeOf(ClusterConfig{}))
+	clusterCfg := cfg.(ClusterConfig)
+	gomega.Expect(clusterCfg.CrossSlotTxn).Should(gomega.Equal(CrossSlotTxnReject))
+	gomega.Expect(clusterCfg.DialTimeout).Should(gomega.Equal(5 * time.Second))
+	gomega.Expect(clusterCfg.ReadTimeout).Should(gomega.Equal(time.Second))
+
+	// and the configuration is validated
+	gomega.Expect(ioutil.WriteFile(cfgFile, []byte("endpoints: [\"localhost\"]\ncross-slot-txn: all\n"), 0644)).To(gomega.Succeed())
+	_, err = LoadConfig(cfgFile)
+	gomega.Expect(err).Should(gomega.BeAssignableToTypeOf(config.ValidationErrors{}))
+	gomega.Expect(err.(config.ValidationErrors)).Should(gomega.HaveLen(2))
+}
@@ -0,0 +1,80 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keyval
+
+import (
+	"fmt"
+
+	"github.com/ligato/cn-infra/datasync"
+)
+
+// ErrRevisionMismatch is returned by Put and Delete with
+// datasync.WithExpectedRevision() or datasync.WithCreateOnly() option
+// if the item was modified in the meantime (or it already exists).
+type ErrRevisionMismatch struct {
+	// Key of the item.
+	Key string
+	// Expected revision of the item (0 if the item was expected to not exist).
+	Expected int64
+	// Current revision of the item (0 if the item does not exist
+	// or the data store does not keep revisions).
+	Current int64
+}
+
+// Error returns a description of the mismatch.
+func (err *ErrRevisionMismatch) Error() string {
+	if err.Expected == 0 {
+		return fmt.Sprintf("item %s already exists (revision %d)", err.Key, err.Current)
+	}
+	return fmt.Sprintf("revision of item %s is %d, expected %d", err.Key, err.Current, err.Expected)
+}
+
+// PutExpectedRevision returns the revision required by WithExpectedRevision
+// or WithCreateOnly (revision 0) option among the put <opts>.
+// <expected> is false if there is no such option.
+func PutExpectedRevision(opts ...datasync.PutOption) (rev int64, expected bool) {
+	for _, o := range opts {
+		switch opt := o.(type) {
+		case *datasync.WithExpectedRevisionOpt:
+			rev, expected = opt.Revision, true
+		case *datasync.WithCreateOnlyOpt:
+			rev, expected = 0, true
+		}
+	}
+	return rev, expected
+}
+
+// DelExpectedRevision returns the revision required by WithExpectedRevision
+// option among the delete <opts>. <expected> is false if there is no such option.
+func DelExpectedRevision(opts ...datasync.DelOption) (rev int64, expected bool) {
+	for _, o := range opts {
+		if opt, ok := o.(*datasync.WithExpectedRevisionOpt); ok {
+			rev, expected = opt.Revision, true
+		}
+	}
+	return rev, expected
+}
+
+// CheckRevision returns ErrRevisionMismatch if the item under the <key>
+// (<found> with revision <current>) does not match the <expected> revision.
+func CheckRevision(key string, expected int64, found bool, current int64) error {
+	if !found {
+		current = 0
+	}
+	if current != expected {
+		return &ErrRevisionMismatch{Key: key, Expected: expected, Current: current}
+	}
+	return nil
+}
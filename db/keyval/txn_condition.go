@@ -0,0 +1,94 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keyval
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// ErrCondTxnNotSupported is returned by Commit() of conditional transactions
+// of the data stores that do not support them.
+var ErrCondTxnNotSupported = errors.New("conditional transactions are not supported by the data store")
+
+// TxnConditionType selects how the item is compared in a condition
+// of a conditional transaction.
+type TxnConditionType int
+
+const (
+	// CondRevEquals holds if the item exists and its revision (of the last
+	// modification) equals TxnCondition.Revision.
+	CondRevEquals TxnConditionType = iota
+	// CondMissing holds if the item does not exist.
+	CondMissing
+	// CondValueEquals holds if the item exists and its value equals
+	// TxnCondition.Value.
+	CondValueEquals
+)
+
+// TxnCondition is a condition of a conditional transaction.
+type TxnCondition struct {
+	// Type of the comparison.
+	Type TxnConditionType
+	// Key of the compared item.
+	Key string
+	// Revision compared by CondRevEquals.
+	Revision int64
+	// Value compared by CondValueEquals.
+	Value []byte
+	// ProtoValue compared by CondValueEquals in ProtoCondTxn (serialized
+	// into Value by the serializer of the transaction).
+	ProtoValue proto.Message
+}
+
+// RevEquals returns a condition that holds if the item under the <key>
+// exists and it was last modified in the revision <rev>.
+func RevEquals(key string, rev int64) TxnCondition {
+	return TxnCondition{Type: CondRevEquals, Key: key, Revision: rev}
+}
+
+// Missing returns a condition that holds if there is no item under the <key>.
+func Missing(key string) TxnCondition {
+	return TxnCondition{Type: CondMissing, Key: key}
+}
+
+// ValueEquals returns a condition that holds if the item under the <key>
+// exists and its value equals <value>.
+func ValueEquals(key string, value []byte) TxnCondition {
+	return TxnCondition{Type: CondValueEquals, Key: key, Value: value}
+}
+
+// ProtoValueEquals returns a condition (for ProtoCondTxn) that holds
+// if the item under the <key> exists and its value equals the serialized
+// <value>.
+func ProtoValueEquals(key string, value proto.Message) TxnCondition {
+	return TxnCondition{Type: CondValueEquals, Key: key, ProtoValue: value}
+}
+
+// Holds evaluates the condition for the current state of the item
+// (<found> is false if the item does not exist).
+func (cond *TxnCondition) Holds(value []byte, found bool, rev int64) bool {
+	switch cond.Type {
+	case CondRevEquals:
+		return found && rev == cond.Revision
+	case CondMissing:
+		return !found
+	case CondValueEquals:
+		return found && bytes.Equal(value, cond.Value)
+	}
+	return false
+}
@@ -0,0 +1,114 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keyval
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// WatchRevisionStore persists the revisions up to which the changes
+// of the watched prefixes were delivered, so that the watches of a restarted
+// agent continue from the stored revisions instead of the current revision
+// (the changes made while the agent was down are delivered as well).
+type WatchRevisionStore interface {
+	// LoadRevision returns the stored revision of the watched <prefix>.
+	LoadRevision(prefix string) (rev int64, found bool, err error)
+
+	// StoreRevision stores the revision up to which the changes
+	// of the watched <prefix> were delivered.
+	StoreRevision(prefix string, rev int64) error
+}
+
+// FileWatchRevisionStore is WatchRevisionStore that keeps the revisions
+// in a JSON file.
+type FileWatchRevisionStore struct {
+	sync.Mutex
+	path      string
+	revisions map[string]int64
+}
+
+// NewFileWatchRevisionStore creates a new WatchRevisionStore that keeps
+// the revisions in the file <path> (created once the first revision
+// is stored).
+func NewFileWatchRevisionStore(path string) *FileWatchRevisionStore {
+	return &FileWatchRevisionStore{path: path}
+}
+
+// LoadRevision returns the stored revision of the watched <prefix>.
+func (store *FileWatchRevisionStore) LoadRevision(prefix string) (rev int64, found bool, err error) {
+	store.Lock()
+	defer store.Unlock()
+
+	if err := store.load(); err != nil {
+		return 0, false, err
+	}
+	rev, found = store.revisions[prefix]
+	return rev, found, nil
+}
+
+// StoreRevision stores the revision of the watched <prefix> and rewrites
+// the file.
+func (store *FileWatchRevisionStore) StoreRevision(prefix string, rev int64) error {
+	store.Lock()
+	defer store.Unlock()
+
+	if err := store.load(); err != nil {
+		return err
+	}
+	store.revisions[prefix] = rev
+	data, err := json.Marshal(store.revisions)
+	if err != nil {
+		return err
+	}
+	// replace the file atomically
+	tmpFile, err := ioutil.TempFile(filepath.Dir(store.path), filepath.Base(store.path))
+	if err != nil {
+		return err
+	}
+	_, err = tmpFile.Write(data)
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpFile.Name(), store.path)
+	}
+	if err != nil {
+		os.Remove(tmpFile.Name())
+	}
+	return err
+}
+
+// load reads the file once.
+func (store *FileWatchRevisionStore) load() error {
+	if store.revisions != nil {
+		return nil
+	}
+	revisions := make(map[string]int64)
+	data, err := ioutil.ReadFile(store.path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &revisions); err != nil {
+			return err
+		}
+	}
+	store.revisions = revisions
+	return nil
+}
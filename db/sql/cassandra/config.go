@@ -26,7 +26,7 @@ import (
 //TLS used to configure TLS
 type TLS struct {
 	Certfile               string `json:"cert_path"`                // client certificate
-	Keyfile                string `json:"key_path"`                 // client private key
+	Keyfile                string `json:"key_path" secret:"true"`   // client private key
 	CAfile                 string `json:"ca_path"`                  // certificate authority
 	EnableHostVerification bool   `json:"enable_host_verification"` // whether to skip verification of server name & certificate
 	Enabled                bool   `json:"enabled"`                  // enable/disable TLS
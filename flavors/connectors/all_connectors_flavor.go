@@ -19,6 +19,7 @@ import (
 	"github.com/ligato/cn-infra/datasync"
 	"github.com/ligato/cn-infra/datasync/kvdbsync"
 	"github.com/ligato/cn-infra/datasync/resync"
+	"github.com/ligato/cn-infra/db/keyval/bolt"
 	"github.com/ligato/cn-infra/db/keyval/consul"
 	"github.com/ligato/cn-infra/db/keyval/etcd"
 	"github.com/ligato/cn-infra/db/keyval/redis"
@@ -49,7 +50,7 @@ func WithPlugins(listPlugins func(local *AllConnectorsFlavor) []*core.NamedPlugi
 // AllConnectorsFlavor is a combination of all plugins that allow
 // connectivity to external database/messaging...
 // Effectively it is combination of ETCD, Kafka, Redis, Cassandra
-// plugins.
+// plugins and the embedded Bolt data store.
 //
 // User/admin can enable those plugins/connectors by providing
 // configs (at least endpoints) for them.
@@ -69,7 +70,10 @@ type AllConnectorsFlavor struct {
 
 	Cassandra cassandra.Plugin
 
-	ResyncOrch resync.Plugin // the order is important because of AfterInit()
+	Bolt         bolt.Plugin
+	BoltDataSync kvdbsync.Plugin
+
+	ResyncOrch resync.Plugin
 
 	injected bool
 }
@@ -94,9 +98,13 @@ func (f *AllConnectorsFlavor) Inject() bool {
 	f.ETCD.Deps.Resync = &f.ResyncOrch
 	InjectKVDBSync(&f.ETCDDataSync, &f.ETCD, f.ETCD.PluginName, f.FlavorLocal, &f.ResyncOrch)
 
+	f.Bolt.Deps.PluginInfraDeps = *f.InfraDeps("bolt", local.WithConf())
+	InjectKVDBSync(&f.BoltDataSync, &f.Bolt, f.Bolt.PluginName, f.FlavorLocal, &f.ResyncOrch)
+
 	f.FlavorLocal.StatusCheck.Transport = &datasync.CompositeKVProtoWriter{Adapters: []datasync.KeyProtoValWriter{
 		&f.ETCDDataSync,
 		&f.ConsulDataSync,
+		&f.BoltDataSync,
 	}}
 
 	f.Redis.Deps.PluginInfraDeps = *f.InfraDeps("redis", local.WithConf())
@@ -89,6 +89,7 @@ func (f *FlavorLocal) Inject() bool {
 
 	f.StatusCheck.Deps.Log = f.LoggerFor("status-check")
 	f.StatusCheck.Deps.PluginName = core.PluginName("status-check")
+	f.StatusCheck.Deps.PluginConfig = config.ForPlugin("status-check")
 
 	return true
 }
@@ -187,6 +188,15 @@ func declareFlags() {
 	if flag.Lookup(config.DirFlag) == nil {
 		flag.String(config.DirFlag, config.DirDefault, config.DirUsage)
 	}
+	if flag.Lookup(config.AgentConfigFlag) == nil {
+		flag.String(config.AgentConfigFlag, config.AgentConfigDefault, config.AgentConfigUsage)
+	}
+	if flag.Lookup(config.PrintAgentConfigFlag) == nil {
+		flag.Bool(config.PrintAgentConfigFlag, false, config.PrintAgentConfigUsage)
+	}
+	if flag.Lookup(config.PrintConfigReferenceFlag) == nil {
+		flag.Bool(config.PrintConfigReferenceFlag, false, config.PrintConfigReferenceUsage)
+	}
 }
 
 // withPluginsOpt is return value of local.WithPlugins() utility
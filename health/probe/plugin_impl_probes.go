@@ -25,6 +25,7 @@ import (
 const (
 	livenessProbePath  string = "/liveness"  // liveness probe URL
 	readinessProbePath string = "/readiness" // readiness probe URL
+	lifecyclePath      string = "/lifecycle" // lifecycle state of plugins URL
 )
 
 // Plugin struct holds all plugin-related data.
@@ -44,6 +45,7 @@ func (p *Plugin) AfterInit() error {
 			p.Log.Infof("Starting health http-probe on port %v", p.HTTP.GetPort())
 			p.HTTP.RegisterHTTPHandler(livenessProbePath, p.livenessProbeHandler, "GET")
 			p.HTTP.RegisterHTTPHandler(readinessProbePath, p.readinessProbeHandler, "GET")
+			p.HTTP.RegisterHTTPHandler(lifecyclePath, p.lifecycleHandler, "GET")
 
 		} else {
 			p.Log.Info("Unable to register http-probe handler, StatusCheck is nil")
@@ -89,6 +91,14 @@ func (p *Plugin) livenessProbeHandler(formatter *render.Render) http.HandlerFunc
 	}
 }
 
+// lifecycleHandler returns the lifecycle state of all plugins of the agent.
+func (p *Plugin) lifecycleHandler(formatter *render.Render) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, req *http.Request) {
+		formatter.JSON(w, http.StatusOK, p.StatusCheck.GetPluginLifecycle())
+	}
+}
+
 // String returns plugin name if it was injected, "HEALTH_RPC_PROBES" otherwise.
 func (p *Plugin) String() string {
 	if len(string(p.PluginName)) > 0 {
@@ -13,6 +13,7 @@ It is generated from these files:
 It has these top-level messages:
 	AgentStatus
 	PluginStatus
+	Leadership
 	InterfaceStats
 */
 package status
@@ -72,12 +73,29 @@ type PluginStatus struct {
 	LastChange int64            `protobuf:"varint,4,opt,name=last_change,proto3" json:"last_change,omitempty"`
 	LastUpdate int64            `protobuf:"varint,5,opt,name=last_update,proto3" json:"last_update,omitempty"`
 	Error      string           `protobuf:"bytes,6,opt,name=error,proto3" json:"error,omitempty"`
+	Leadership *Leadership      `protobuf:"bytes,7,opt,name=leadership" json:"leadership,omitempty"`
 }
 
 func (m *PluginStatus) Reset()         { *m = PluginStatus{} }
 func (m *PluginStatus) String() string { return proto.CompactTextString(m) }
 func (*PluginStatus) ProtoMessage()    {}
 
+func (m *PluginStatus) GetLeadership() *Leadership {
+	if m != nil {
+		return m.Leadership
+	}
+	return nil
+}
+
+type Leadership struct {
+	Leader      bool   `protobuf:"varint,1,opt,name=leader,proto3" json:"leader,omitempty"`
+	LeaderValue string `protobuf:"bytes,2,opt,name=leader_value,proto3" json:"leader_value,omitempty"`
+}
+
+func (m *Leadership) Reset()         { *m = Leadership{} }
+func (m *Leadership) String() string { return proto.CompactTextString(m) }
+func (*Leadership) ProtoMessage()    {}
+
 type InterfaceStats struct {
 	Interfaces []*InterfaceStats_Interface `protobuf:"bytes,1,rep,name=interfaces" json:"interfaces,omitempty"`
 }
@@ -62,9 +62,17 @@ type InterfaceStatusReader interface {
 	GetInterfaceStats() status.InterfaceStats
 }
 
+// LifecycleReader looks up the lifecycle state of plugins as tracked by the agent.
+type LifecycleReader interface {
+	// GetPluginLifecycle returns a map containing the lifecycle state (see core.LifecycleState)
+	// of all plugins of the agent. The map is empty if the lifecycle is not available.
+	GetPluginLifecycle() map[string]core.LifecycleState
+}
+
 // StatusReader allows to lookup agent status and retrieve a map containing status of all plugins.
 type StatusReader interface {
 	AgentStatusReader
 	InterfaceStatusReader
+	LifecycleReader
 	GetAllPluginStatus() map[string]*status.PluginStatus
 }
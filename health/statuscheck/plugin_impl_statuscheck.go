@@ -16,10 +16,12 @@ package statuscheck
 
 import (
 	"context"
+	"fmt"
 	"sync"
 	"time"
 
 	"github.com/gogo/protobuf/proto"
+	"github.com/ligato/cn-infra/config"
 	"github.com/ligato/cn-infra/core"
 	"github.com/ligato/cn-infra/datasync"
 	"github.com/ligato/cn-infra/health/statuscheck/model/status"
@@ -34,24 +36,39 @@ const (
 	// Error state means that some error has occurred in the plugin.
 	Error PluginState = "error"
 
-	// frequency of periodic writes of state data into ETCD
+	// default frequency of periodic writes of state data into ETCD
 	periodicWriteTimeout time.Duration = time.Second * 10
 
-	// frequency of periodic plugin state probing
+	// default frequency of periodic plugin state probing
 	periodicProbingTimeout time.Duration = time.Second * 5
+
+	// size of the buffer for lifecycle events
+	lifecycleEventsBuffer = 100
 )
 
+// Config holds the configuration of the statuscheck plugin.
+type Config struct {
+	// PublishingInterval is the frequency of periodic writes of state data
+	// via the transport (10s if not set).
+	PublishingInterval time.Duration `json:"publishing-interval" default:"10s" validate:"min=0s"`
+	// ProbingInterval is the frequency of periodic probing of plugins' state (5s if not set).
+	ProbingInterval time.Duration `json:"probing-interval" default:"5s" validate:"min=0s"`
+}
+
 // Plugin struct holds all plugin-related data.
 type Plugin struct {
 	Deps
 
 	access sync.Mutex // lock for the Plugin data
+	config *Config    // current configuration
 
 	agentStat     *status.AgentStatus             // overall agent status
 	interfaceStat *status.InterfaceStats          // interfaces' overall status
 	pluginStat    map[string]*status.PluginStatus // plugin's status
 	pluginProbe   map[string]PluginStateProbe     // registered status probes
 
+	lifecycle core.LifecycleWatcher // lifecycle of plugins (set by the agent)
+
 	ctx    context.Context
 	cancel context.CancelFunc // cancel can be used to cancel all goroutines and their jobs inside of the plugin
 	wg     sync.WaitGroup     // wait group that allows to wait until all goroutines of the plugin have finished
@@ -59,13 +76,23 @@ type Plugin struct {
 
 // Deps lists the dependencies of statuscheck plugin.
 type Deps struct {
-	Log        logging.PluginLogger       // inject
-	PluginName core.PluginName            // inject
-	Transport  datasync.KeyProtoValWriter // inject (optional)
+	Log                 logging.PluginLogger       // inject
+	PluginName          core.PluginName            // inject
+	Transport           datasync.KeyProtoValWriter // inject (optional)
+	config.PluginConfig                            // inject (optional)
 }
 
 // Init prepares the initial status data.
 func (p *Plugin) Init() error {
+	// read the configuration (if there is any)
+	cfg := &Config{}
+	if p.PluginConfig != nil {
+		if _, err := p.PluginConfig.GetValue(cfg); err != nil {
+			return err
+		}
+	}
+	p.config = cfg
+
 	// write initial status data into ETCD
 	p.agentStat = &status.AgentStatus{
 		BuildVersion: core.BuildVersion,
@@ -88,9 +115,21 @@ func (p *Plugin) Init() error {
 	// prepare context for all go routines
 	p.ctx, p.cancel = context.WithCancel(context.Background())
 
+	// watch lifecycle transitions of the plugins
+	if p.lifecycle != nil {
+		events := make(chan core.LifecycleEvent, lifecycleEventsBuffer)
+		unregister := p.lifecycle.WatchLifecycle(events)
+		go p.watchLifecycle(p.ctx, events, unregister)
+	}
+
 	return nil
 }
 
+// SetLifecycleWatcher is called by the agent to give access to the lifecycle of all plugins.
+func (p *Plugin) SetLifecycleWatcher(watcher core.LifecycleWatcher) {
+	p.lifecycle = watcher
+}
+
 // AfterInit starts go routines for periodic probing and periodic updates.
 // Initial state data are published via the injected transport.
 func (p *Plugin) AfterInit() error {
@@ -123,6 +162,58 @@ func (p *Plugin) Close() error {
 	return nil
 }
 
+// CurrentConfig returns a copy of the currently applied configuration
+// (used by the agent to reload the configuration).
+func (p *Plugin) CurrentConfig() interface{} {
+	p.access.Lock()
+	defer p.access.Unlock()
+
+	cfgCopy := *p.config
+	return &cfgCopy
+}
+
+// Reload applies the new probing and publishing intervals. The intervals
+// take effect after the currently running period elapses.
+func (p *Plugin) Reload(newCfg interface{}) error {
+	cfg, ok := newCfg.(*Config)
+	if !ok {
+		return fmt.Errorf("unexpected type of status check config: %T", newCfg)
+	}
+	if err := config.Validate(cfg); err != nil {
+		return err
+	}
+
+	p.access.Lock()
+	defer p.access.Unlock()
+
+	cfgCopy := *cfg
+	p.config = &cfgCopy
+	p.Log.Infof("Status check config reloaded: %+v", cfgCopy)
+	return nil
+}
+
+// probingInterval returns the configured frequency of probing.
+func (p *Plugin) probingInterval() time.Duration {
+	p.access.Lock()
+	defer p.access.Unlock()
+
+	if p.config == nil || p.config.ProbingInterval == 0 {
+		return periodicProbingTimeout
+	}
+	return p.config.ProbingInterval
+}
+
+// publishingInterval returns the configured frequency of publishing.
+func (p *Plugin) publishingInterval() time.Duration {
+	p.access.Lock()
+	defer p.access.Unlock()
+
+	if p.config == nil || p.config.PublishingInterval == 0 {
+		return periodicWriteTimeout
+	}
+	return p.config.PublishingInterval
+}
+
 // Register a plugin for status change reporting.
 func (p *Plugin) Register(pluginName core.PluginName, probe PluginStateProbe) {
 	p.access.Lock()
@@ -157,6 +248,8 @@ func (p *Plugin) ReportStateChangeWithMeta(pluginName core.PluginName, state Plu
 	switch data := meta.(type) {
 	case *status.InterfaceStats_Interface:
 		p.reportInterfaceStateChange(data)
+	case *status.Leadership:
+		p.reportLeadershipChange(pluginName, data)
 	default:
 		p.Log.Debug("Unknown type of status metadata")
 	}
@@ -217,6 +310,29 @@ func (p *Plugin) reportStateChange(pluginName core.PluginName, state PluginState
 	}
 }
 
+func (p *Plugin) reportLeadershipChange(pluginName core.PluginName, data *status.Leadership) {
+	p.access.Lock()
+	defer p.access.Unlock()
+
+	stat, ok := p.pluginStat[string(pluginName)]
+	if !ok {
+		p.Log.Errorf("Unregistered plugin %s is reporting the leadership, ignoring.", pluginName)
+		return
+	}
+
+	// update only if the leadership has really changed
+	if stat.Leadership != nil && *stat.Leadership == *data {
+		return
+	}
+	p.Log.WithFields(map[string]interface{}{"plugin": pluginName, "leader": data.Leader,
+		"leaderValue": data.LeaderValue}).Info("Agent plugin leadership update.")
+
+	leadership := *data
+	stat.Leadership = &leadership
+	stat.LastChange = time.Now().Unix()
+	p.publishPluginData(pluginName, stat)
+}
+
 func (p *Plugin) reportInterfaceStateChange(data *status.InterfaceStats_Interface) {
 	p.access.Lock()
 	defer p.access.Unlock()
@@ -287,7 +403,7 @@ func (p *Plugin) periodicProbing(ctx context.Context) {
 
 	for {
 		select {
-		case <-time.After(periodicProbingTimeout):
+		case <-time.After(p.probingInterval()):
 			for pluginName, probe := range p.pluginProbe {
 				state, lastErr := probe()
 				p.ReportStateChange(core.PluginName(pluginName), state, lastErr)
@@ -313,7 +429,7 @@ func (p *Plugin) periodicUpdates(ctx context.Context) {
 
 	for {
 		select {
-		case <-time.After(periodicWriteTimeout):
+		case <-time.After(p.publishingInterval()):
 			p.publishAllData()
 
 		case <-ctx.Done():
@@ -322,6 +438,35 @@ func (p *Plugin) periodicUpdates(ctx context.Context) {
 	}
 }
 
+// watchLifecycle reports failures of the registered plugins detected
+// by the agent (lifecycle transitions to the Failed state).
+func (p *Plugin) watchLifecycle(ctx context.Context, events chan core.LifecycleEvent, unregister func()) {
+	p.wg.Add(1)
+	defer p.wg.Done()
+	defer unregister()
+
+	for {
+		select {
+		case event := <-events:
+			p.access.Lock()
+			_, registered := p.pluginStat[string(event.PluginName)]
+			p.access.Unlock()
+			if !registered {
+				continue
+			}
+			switch event.To {
+			case core.Failed:
+				p.reportStateChange(event.PluginName, Error, event.Err)
+			case core.Initializing:
+				p.reportStateChange(event.PluginName, Init, nil)
+			}
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
 // getAgentState return current global operational state of the agent.
 func (p *Plugin) getAgentState() status.OperationalState {
 	p.access.Lock()
@@ -364,3 +509,15 @@ func (p *Plugin) GetInterfaceStats() status.InterfaceStats {
 
 	return *p.interfaceStat
 }
+
+// GetPluginLifecycle returns a map containing the lifecycle state of all plugins
+// of the agent.
+func (p *Plugin) GetPluginLifecycle() map[string]core.LifecycleState {
+	states := make(map[string]core.LifecycleState)
+	if p.lifecycle != nil {
+		for pluginName, state := range p.lifecycle.PluginStates() {
+			states[string(pluginName)] = state
+		}
+	}
+	return states
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statuscheck
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ligato/cn-infra/config"
+	"github.com/ligato/cn-infra/core"
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+	"github.com/namsral/flag"
+	. "github.com/onsi/gomega"
+)
+
+// probedPlugin registers a probe counting its calls.
+type probedPlugin struct {
+	StatusCheck *Plugin
+	probes      int32
+}
+
+func (p *probedPlugin) Init() error {
+	p.StatusCheck.Register("probed", func() (PluginState, error) {
+		atomic.AddInt32(&p.probes, 1)
+		return OK, nil
+	})
+	return nil
+}
+
+func (p *probedPlugin) Close() error {
+	return nil
+}
+
+func TestReload(t *testing.T) {
+	RegisterTestingT(t)
+
+	dir, err := ioutil.TempDir("", "statuscheck")
+	Expect(err).ShouldNot(HaveOccurred())
+	defer os.RemoveAll(dir)
+	cfgFile := filepath.Join(dir, "statuscheck.conf")
+	writeConfig := func(cfg string) {
+		Expect(ioutil.WriteFile(cfgFile, []byte(cfg), 0644)).To(Succeed())
+	}
+	writeConfig("probing-interval: 200000000\n") // 200ms
+
+	pluginCfg := config.ForPlugin("status-check", cfgFile)
+	Expect(flag.Set("status-check"+config.FlagSuffix, cfgFile)).To(Succeed()) // declared by a previous run
+	plugin := &Plugin{Deps: Deps{
+		Log:          logging.ForPlugin("status-check", logrus.NewLogRegistry()),
+		PluginName:   "status-check",
+		PluginConfig: pluginCfg,
+	}}
+	probed := &probedPlugin{StatusCheck: plugin}
+	agent := core.NewAgentDeprecated(logrus.DefaultLogger(), time.Second,
+		&core.NamedPlugin{PluginName: "status-check", Plugin: plugin}, &core.NamedPlugin{PluginName: "probed", Plugin: probed})
+	Expect(agent.Start()).To(Succeed())
+	defer agent.Stop()
+	Expect(plugin.probingInterval()).Should(Equal(200 * time.Millisecond))
+	Expect(plugin.publishingInterval()).Should(Equal(10 * time.Second)) // default
+	Eventually(func() int32 { return atomic.LoadInt32(&probed.probes) }).Should(BeNumerically(">=", 1))
+
+	// shorter probing interval takes effect after the current period
+	writeConfig("probing-interval: 10000000\n") // 10ms
+	Expect(agent.Reload()).To(Succeed())
+	Expect(plugin.probingInterval()).Should(Equal(10 * time.Millisecond))
+	probes := atomic.LoadInt32(&probed.probes)
+	Eventually(func() int32 { return atomic.LoadInt32(&probed.probes) }).Should(BeNumerically(">=", probes+5))
+
+	// negative interval is rejected
+	writeConfig("probing-interval: -1\n")
+	Expect(agent.Reload()).ShouldNot(Succeed())
+	Expect(plugin.probingInterval()).Should(Equal(10 * time.Millisecond))
+}
@@ -17,6 +17,7 @@ package logmanager
 import (
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/gorilla/mux"
 	"github.com/unrolled/render"
@@ -91,27 +92,87 @@ func (lm *Plugin) Init() error {
 		}
 		lm.Log.Debugf("logs config: %+v", lm.Conf)
 
-		if lm.Conf.DefaultLevel != "" {
-			if err := lm.LogRegistry.SetLevel("default", lm.Conf.DefaultLevel); err != nil {
-				lm.Log.Warn("setting default log level failed:", err)
-			} else {
-				lm.Log.Debugf("default log level to %q", lm.Conf.DefaultLevel)
-			}
-		}
+		// intentionally just log warn & not propagate the error (it is minor thing to interrupt startup)
+		lm.setLevels(lm.Conf)
+	}
+
+	return nil
+}
+
+// CurrentConfig returns a copy of the currently applied configuration
+// (used by the agent to reload the configuration).
+func (lm *Plugin) CurrentConfig() interface{} {
+	conf := &Conf{}
+	if lm.Conf != nil {
+		conf.DefaultLevel = lm.Conf.DefaultLevel
+		conf.Loggers = append(conf.Loggers, lm.Conf.Loggers...)
+	}
+	return conf
+}
 
-		// try to set log levels (note, not all of them might exist yet)
-		for _, cfgLogger := range lm.Conf.Loggers {
-			if err := lm.LogRegistry.SetLevel(cfgLogger.Name, cfgLogger.Level); err != nil {
-				//intentionally just log warn & not propagate the error (it is minor thing to interrupt startup)
-				lm.Log.Warn("setting level failed:", err)
-			}
+// Reload applies log levels from the new configuration. Loggers that are
+// no longer listed in the configuration keep their current log level.
+// As in Init(), levels that cannot be set (e.g. for loggers that do not
+// exist yet) are only logged. The configuration is rejected if it contains
+// an unknown log level.
+func (lm *Plugin) Reload(newCfg interface{}) error {
+	conf, ok := newCfg.(*Conf)
+	if !ok {
+		return fmt.Errorf("unexpected type of logs config: %T", newCfg)
+	}
+	if err := checkLevels(conf); err != nil {
+		return err
+	}
+	lm.setLevels(conf)
+	lm.Conf = conf
+	lm.Log.Debugf("logs config reloaded: %+v", lm.Conf)
+	return nil
+}
+
+// setLevels sets log levels defined in the configuration.
+// Errors are intentionally just logged (not all loggers might exist yet).
+func (lm *Plugin) setLevels(conf *Conf) {
+	if conf.DefaultLevel != "" {
+		if err := lm.LogRegistry.SetLevel("default", conf.DefaultLevel); err != nil {
+			lm.Log.Warn("setting default log level failed:", err)
+		} else {
+			lm.Log.Debugf("default log level to %q", conf.DefaultLevel)
 		}
+	}
 
+	// try to set log levels (note, not all of them might exist yet)
+	for _, cfgLogger := range conf.Loggers {
+		if err := lm.LogRegistry.SetLevel(cfgLogger.Name, cfgLogger.Level); err != nil {
+			lm.Log.Warn("setting level failed:", err)
+		}
 	}
+}
 
+// checkLevels returns an error if the configuration contains an unknown log level.
+func checkLevels(conf *Conf) error {
+	if conf.DefaultLevel != "" && !knownLevel(conf.DefaultLevel) {
+		return fmt.Errorf("unknown default log level %q", conf.DefaultLevel)
+	}
+	for _, cfgLogger := range conf.Loggers {
+		if !knownLevel(cfgLogger.Level) {
+			return fmt.Errorf("unknown log level %q of logger %s", cfgLogger.Level, cfgLogger.Name)
+		}
+	}
 	return nil
 }
 
+// knownLevel returns true if the level is the name of one of logging.LogLevel
+// ("warn" is accepted as well).
+func knownLevel(level string) bool {
+	level = strings.ToLower(level)
+	for lvl := logging.PanicLevel; lvl <= logging.DebugLevel; lvl++ {
+		if level == lvl.String() || level == "warn" {
+			return true
+		}
+	}
+	return false
+}
+
 // AfterInit is called at plugin initialization. It register the following handlers:
 // - List all registered loggers:
 //   > curl -X GET http://localhost:<port>/log/list
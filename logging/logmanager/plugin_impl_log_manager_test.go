@@ -0,0 +1,83 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logmanager
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ligato/cn-infra/config"
+	"github.com/ligato/cn-infra/core"
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+	"github.com/namsral/flag"
+	. "github.com/onsi/gomega"
+)
+
+// strictRegistry fails to set the level of the loggers that do not exist.
+type strictRegistry struct {
+	logging.Registry
+}
+
+func (registry *strictRegistry) SetLevel(logger, level string) error {
+	if _, found := registry.Lookup(logger); !found && logger != "default" {
+		return fmt.Errorf("logger %s not found", logger)
+	}
+	return registry.Registry.SetLevel(logger, level)
+}
+
+func TestReload(t *testing.T) {
+	RegisterTestingT(t)
+
+	dir, err := ioutil.TempDir("", "logs")
+	Expect(err).ShouldNot(HaveOccurred())
+	defer os.RemoveAll(dir)
+	cfgFile := filepath.Join(dir, "logs.conf")
+	writeConfig := func(cfg string) {
+		Expect(ioutil.WriteFile(cfgFile, []byte(cfg), 0644)).To(Succeed())
+	}
+	writeConfig("loggers:\n  - name: existing\n    level: info\n")
+
+	registry := &strictRegistry{logrus.NewLogRegistry()}
+	registry.NewLogger("existing")
+	pluginCfg := config.ForPlugin("logs", cfgFile)
+	Expect(flag.Set("logs"+config.FlagSuffix, cfgFile)).To(Succeed()) // declared by a previous run
+	plugin := &Plugin{Deps: Deps{
+		Log:          logging.ForPlugin("logs", registry),
+		PluginName:   "logs",
+		PluginConfig: pluginCfg,
+		LogRegistry:  registry,
+	}}
+	agent := core.NewAgentDeprecated(logrus.DefaultLogger(), time.Second, &core.NamedPlugin{PluginName: "logs", Plugin: plugin})
+	Expect(agent.Start()).To(Succeed())
+	defer agent.Stop()
+	Expect(registry.GetLevel("existing")).Should(Equal("info"))
+
+	// loggers that do not exist yet do not prevent the reload
+	writeConfig("loggers:\n  - name: existing\n    level: debug\n  - name: future\n    level: error\n")
+	Expect(agent.Reload()).To(Succeed())
+	Expect(registry.GetLevel("existing")).Should(Equal("debug"))
+	Expect(plugin.CurrentConfig().(*Conf).Loggers).Should(HaveLen(2))
+
+	// unknown log level is rejected
+	writeConfig("loggers:\n  - name: existing\n    level: verbose\n")
+	Expect(agent.Reload()).ShouldNot(Succeed())
+	Expect(registry.GetLevel("existing")).Should(Equal("debug"))
+	Expect(plugin.CurrentConfig().(*Conf).Loggers).Should(HaveLen(2))
+}
@@ -25,14 +25,12 @@ import (
 )
 
 // PluginConfig tries :
-// - to load flag <plugin-name>-port and then FixConfig() just in case
-// - alternatively <plugin-name>-config and then FixConfig() just in case
-// - alternatively DefaultConfig()
+// - to load flag <plugin-name>-port
+// - alternatively <plugin-name>-config
+// and then sets the empty fields to their defaults (see config.SetDefaults())
+// also if there is no config file.
 func PluginConfig(pluginCfg config.PluginConfig, cfg *Config, pluginName core.PluginName) error {
-	portFlag := flag.Lookup(httpPortFlag(pluginName))
-	if portFlag != nil && portFlag.Value != nil && portFlag.Value.String() != "" && cfg != nil {
-		cfg.Endpoint = DefaultIP + ":" + portFlag.Value.String()
-	}
+	applyPortFlag(cfg, pluginName)
 
 	if pluginCfg != nil {
 		_, err := pluginCfg.GetValue(cfg)
@@ -41,9 +39,16 @@ func PluginConfig(pluginCfg config.PluginConfig, cfg *Config, pluginName core.Pl
 		}
 	}
 
-	FixConfig(cfg)
+	return config.SetDefaults(cfg)
+}
 
-	return nil
+// applyPortFlag sets the endpoint of the configuration to the port given
+// by the <plugin-name>-port flag (if set).
+func applyPortFlag(cfg *Config, pluginName core.PluginName) {
+	portFlag := flag.Lookup(httpPortFlag(pluginName))
+	if portFlag != nil && portFlag.Value != nil && portFlag.Value.String() != "" && cfg != nil {
+		cfg.Endpoint = DefaultIP + ":" + portFlag.Value.String()
+	}
 }
 
 // DefaultConfig returns new instance of config with default endpoint
@@ -51,18 +56,12 @@ func DefaultConfig() *Config {
 	return &Config{Endpoint: DefaultEndpoint}
 }
 
-// FixConfig fill default values for empty fields
-func FixConfig(cfg *Config) {
-	if cfg != nil && cfg.Endpoint == "" {
-		cfg.Endpoint = DefaultEndpoint
-	}
-}
-
 // Config is a configuration for HTTP server
 // It is meant to be extended with security (TLS...)
 type Config struct {
 	// Endpoint is an address of HTTP server
-	Endpoint string
+	// (DefaultEndpoint or the port given by the <plugin-name>-port flag if not set)
+	Endpoint string `default:"0.0.0.0:9191" validate:"hostport"`
 
 	// ReadTimeout is the maximum duration for reading the entire
 	// request, including the body.
@@ -71,32 +70,32 @@ type Config struct {
 	// decisions on each request body's acceptable deadline or
 	// upload rate, most users will prefer to use
 	// ReadHeaderTimeout. It is valid to use them both.
-	ReadTimeout time.Duration
+	ReadTimeout time.Duration `validate:"min=0s"`
 
 	// ReadHeaderTimeout is the amount of time allowed to read
 	// request headers. The connection's read deadline is reset
 	// after reading the headers and the Handler can decide what
 	// is considered too slow for the body.
-	ReadHeaderTimeout time.Duration
+	ReadHeaderTimeout time.Duration `validate:"min=0s"`
 
 	// WriteTimeout is the maximum duration before timing out
 	// writes of the response. It is reset whenever a new
 	// request's header is read. Like ReadTimeout, it does not
 	// let Handlers make decisions on a per-request basis.
-	WriteTimeout time.Duration
+	WriteTimeout time.Duration `validate:"min=0s"`
 
 	// IdleTimeout is the maximum amount of time to wait for the
 	// next request when keep-alives are enabled. If IdleTimeout
 	// is zero, the value of ReadTimeout is used. If both are
 	// zero, there is no timeout.
-	IdleTimeout time.Duration
+	IdleTimeout time.Duration `validate:"min=0s"`
 
 	// MaxHeaderBytes controls the maximum number of bytes the
 	// server will read parsing the request header's keys and
 	// values, including the request line. It does not limit the
 	// size of the request body.
 	// If zero, DefaultMaxHeaderBytes is used.
-	MaxHeaderBytes int
+	MaxHeaderBytes int `validate:"min=0"`
 
 	// ServerCertfile is path to the server certificate. If the certificate and corresponding
 	// key (see config item below) is defined server uses HTTPS instead of HTTP.
@@ -107,8 +106,9 @@ type Config struct {
 
 	// ClientBasicAuth is a slice of credentials in form "username:password"
 	// used for basic HTTP authentication. If defined only authenticated users are allowed
-	// to access the server.
-	ClientBasicAuth []string `json:"client-basic-auth"`
+	// to access the server. Passwords can refer to secrets,
+	// e.g. "admin:${file:/run/secrets/admin}" (see config.ResolveSecretRefs()).
+	ClientBasicAuth []string `json:"client-basic-auth" secret:"true"`
 
 	// ClientCerts is a slice of the root certificate authorities
 	// that servers uses to verify a client certificate
@@ -0,0 +1,60 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/unrolled/render"
+
+	"github.com/ligato/cn-infra/config"
+)
+
+const (
+	// configPath exposes the effective configuration of all plugins
+	configPath = "/config"
+	// pluginConfigPath exposes the effective configuration of a single plugin
+	pluginConfigPath = "/config/{" + pluginVarName + "}"
+	pluginVarName    = "plugin"
+)
+
+// registerConfigHandlers registers handlers exposing the configuration
+// of plugins (see config.LoadStatus). Values of secret fields are redacted.
+func (plugin *Plugin) registerConfigHandlers() {
+	plugin.RegisterHTTPHandler(configPath, plugin.configHandler, "GET")
+	plugin.RegisterHTTPHandler(pluginConfigPath, plugin.pluginConfigHandler, "GET")
+}
+
+// configHandler returns the configuration of all plugins.
+func (plugin *Plugin) configHandler(formatter *render.Render) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		formatter.JSON(w, http.StatusOK, config.LoadStatuses())
+	}
+}
+
+// pluginConfigHandler returns the configuration of the plugin given by the path.
+func (plugin *Plugin) pluginConfigHandler(formatter *render.Render) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		pluginName := mux.Vars(req)[pluginVarName]
+		status, found := config.GetLoadStatus(pluginName)
+		if !found {
+			formatter.JSON(w, http.StatusNotFound,
+				struct{ Error string }{"configuration of plugin " + pluginName + " not loaded"})
+			return
+		}
+		formatter.JSON(w, http.StatusOK, status)
+	}
+}
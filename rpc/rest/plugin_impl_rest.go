@@ -18,7 +18,9 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"reflect"
 	"strings"
+	"sync"
 
 	"github.com/gorilla/mux"
 	"github.com/unrolled/render"
@@ -52,6 +54,8 @@ type Plugin struct {
 	// Used mainly for testing purposes
 	listenAndServe ListenAndServe
 
+	access    sync.Mutex // protects the configuration, authenticator and server during reload
+	defaults  Config     // configuration before the config file was applied (see DefaultConfig())
 	server    io.Closer
 	mx        *mux.Router
 	formatter *render.Render
@@ -71,18 +75,20 @@ type Deps struct {
 
 // Init is the plugin entry point called by Agent Core
 // - It prepares Gorilla MUX HTTP Router
+// - It registers handlers exposing the configuration of plugins
 func (plugin *Plugin) Init() (err error) {
 	if plugin.Config == nil {
 		plugin.Config = DefaultConfig()
 	}
+	plugin.defaults = *plugin.Config
 	if err := PluginConfig(plugin.Deps.PluginConfig, plugin.Config, plugin.Deps.PluginName); err != nil {
 		return err
 	}
 
 	// if there is no injected authenticator and there are credentials defined in the config file
 	// instantiate staticAuthenticator otherwise do not use basic Auth
-	if plugin.Authenticator == nil && len(plugin.Config.ClientBasicAuth) > 0 {
-		plugin.Authenticator, err = newStaticAuthenticator(plugin.Config.ClientBasicAuth)
+	if !plugin.authInjected() {
+		plugin.Authenticator, err = configAuthenticator(plugin.Config)
 		if err != nil {
 			return err
 		}
@@ -92,6 +98,7 @@ func (plugin *Plugin) Init() (err error) {
 	plugin.formatter = render.New(render.Options{
 		IndentJSON: true,
 	})
+	plugin.registerConfigHandlers()
 
 	return err
 }
@@ -102,15 +109,14 @@ func (plugin *Plugin) RegisterHTTPHandler(path string,
 	methods ...string) *mux.Route {
 	plugin.Log.Debug("Register handler ", path)
 
-	if plugin.Authenticator != nil {
-		return plugin.mx.HandleFunc(path, auth(handler(plugin.formatter), plugin.Authenticator)).Methods(methods...)
-	}
-	return plugin.mx.HandleFunc(path, handler(plugin.formatter)).Methods(methods...)
-
+	return plugin.mx.HandleFunc(path, plugin.auth(handler(plugin.formatter))).Methods(methods...)
 }
 
 // GetPort returns plugin configuration port
 func (plugin *Plugin) GetPort() int {
+	plugin.access.Lock()
+	defer plugin.access.Unlock()
+
 	if plugin.Config != nil {
 		return plugin.Config.GetPort()
 	}
@@ -119,21 +125,107 @@ func (plugin *Plugin) GetPort() int {
 
 // AfterInit starts the HTTP server.
 func (plugin *Plugin) AfterInit() (err error) {
+	plugin.access.Lock()
+	defer plugin.access.Unlock()
+
+	plugin.server, err = plugin.startServer(*plugin.Config)
+	return err
+}
+
+// CurrentConfig returns a copy of the currently applied configuration
+// (used by the agent to reload the configuration).
+func (plugin *Plugin) CurrentConfig() interface{} {
+	plugin.access.Lock()
+	defer plugin.access.Unlock()
+
 	cfgCopy := *plugin.Config
+	return &cfgCopy
+}
 
-	if plugin.listenAndServe != nil {
-		plugin.server, err = plugin.listenAndServe(cfgCopy, plugin.mx)
-	} else {
-		if cfgCopy.UseHTTPS() {
-			plugin.Log.Info("Listening on https://", cfgCopy.Endpoint)
-		} else {
-			plugin.Log.Info("Listening on http://", cfgCopy.Endpoint)
+// DefaultConfig returns a copy of the configuration the plugin started with
+// (DefaultConfig() or the configuration set by the flavor) with the port flag
+// applied, i.e. the configuration the config file is applied to during Init()
+// (used by the agent to reload the configuration).
+func (plugin *Plugin) DefaultConfig() interface{} {
+	plugin.access.Lock()
+	defer plugin.access.Unlock()
+
+	cfgCopy := plugin.defaults
+	applyPortFlag(&cfgCopy, plugin.Deps.PluginName)
+	return &cfgCopy
+}
+
+// Reload applies the new configuration of the HTTP server. Timeouts and
+// the maximum size of request headers are applied by restarting the server,
+// users allowed to access the server (ClientBasicAuth) are replaced without
+// restart (unless an authenticator was injected). Endpoint and TLS settings
+// cannot be changed without restart of the agent.
+func (plugin *Plugin) Reload(newCfg interface{}) (err error) {
+	cfg, ok := newCfg.(*Config)
+	if !ok {
+		return fmt.Errorf("unexpected type of HTTP config: %T", newCfg)
+	}
+
+	plugin.access.Lock()
+	defer plugin.access.Unlock()
+
+	cfgCopy := *cfg
+	if cfgCopy.Endpoint == "" {
+		cfgCopy.Endpoint = plugin.Config.Endpoint
+	}
+	if cfgCopy.Endpoint != plugin.Config.Endpoint ||
+		cfgCopy.ServerCertfile != plugin.Config.ServerCertfile ||
+		cfgCopy.ServerKeyfile != plugin.Config.ServerKeyfile ||
+		!reflect.DeepEqual(cfgCopy.ClientCerts, plugin.Config.ClientCerts) {
+		return fmt.Errorf("endpoint and TLS settings of %v cannot be changed without restart", plugin)
+	}
+
+	authenticator := plugin.Authenticator
+	if !plugin.authInjected() {
+		if authenticator, err = configAuthenticator(&cfgCopy); err != nil {
+			return err
+		}
+	}
+
+	if plugin.server != nil && serverSettingsChanged(plugin.Config, &cfgCopy) {
+		plugin.Log.Info("Restarting HTTP server to apply new configuration")
+		if err = safeclose.Close(plugin.server); err != nil {
+			return err
+		}
+		if plugin.server, err = plugin.startServer(cfgCopy); err != nil {
+			// try to get back to the previous configuration
+			plugin.server, _ = plugin.startServer(*plugin.Config)
+			return err
 		}
+	}
+
+	plugin.Authenticator = authenticator
+	plugin.Config = &cfgCopy
+	return nil
+}
 
-		plugin.server, err = ListenAndServeHTTP(cfgCopy, plugin.mx)
+// startServer starts the HTTP server with the given configuration.
+func (plugin *Plugin) startServer(cfg Config) (io.Closer, error) {
+	if plugin.listenAndServe != nil {
+		return plugin.listenAndServe(cfg, plugin.mx)
 	}
 
-	return err
+	if cfg.UseHTTPS() {
+		plugin.Log.Info("Listening on https://", cfg.Endpoint)
+	} else {
+		plugin.Log.Info("Listening on http://", cfg.Endpoint)
+	}
+	return ListenAndServeHTTP(cfg, plugin.mx)
+}
+
+// serverSettingsChanged returns true if the settings of http.Server differ
+// between the given configurations.
+func serverSettingsChanged(oldCfg, newCfg *Config) bool {
+	return oldCfg.ReadTimeout != newCfg.ReadTimeout ||
+		oldCfg.ReadHeaderTimeout != newCfg.ReadHeaderTimeout ||
+		oldCfg.WriteTimeout != newCfg.WriteTimeout ||
+		oldCfg.IdleTimeout != newCfg.IdleTimeout ||
+		oldCfg.MaxHeaderBytes != newCfg.MaxHeaderBytes
 }
 
 // Close stops the HTTP server.
@@ -149,8 +241,18 @@ func (plugin *Plugin) String() string {
 	return "HTTP"
 }
 
-func auth(fn http.HandlerFunc, auth BasicHTTPAuthenticator) http.HandlerFunc {
+// auth wraps the handler with basic HTTP authentication
+// (if an authenticator is in use when the request is received).
+func (plugin *Plugin) auth(fn http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		plugin.access.Lock()
+		auth := plugin.Authenticator
+		plugin.access.Unlock()
+
+		if auth == nil {
+			fn(w, r)
+			return
+		}
 		user, pass, _ := r.BasicAuth()
 		if !auth.Authenticate(user, pass) {
 			w.Header().Set("WWW-Authenticate", "Provide valid username and password")
@@ -161,6 +263,26 @@ func auth(fn http.HandlerFunc, auth BasicHTTPAuthenticator) http.HandlerFunc {
 	}
 }
 
+// authInjected returns true if the authenticator was injected
+// (i.e. it was not created from the credentials in the config file).
+func (plugin *Plugin) authInjected() bool {
+	_, static := plugin.Authenticator.(*staticAuthenticator)
+	return plugin.Authenticator != nil && !static
+}
+
+// configAuthenticator returns staticAuthenticator for the credentials defined
+// in the config, nil if there are none.
+func configAuthenticator(cfg *Config) (BasicHTTPAuthenticator, error) {
+	if len(cfg.ClientBasicAuth) == 0 {
+		return nil, nil
+	}
+	sa, err := newStaticAuthenticator(cfg.ClientBasicAuth)
+	if err != nil {
+		return nil, err
+	}
+	return sa, nil
+}
+
 // staticAuthenticator is default implementation of BasicHTTPAuthenticator
 type staticAuthenticator struct {
 	credentials map[string]string
@@ -0,0 +1,102 @@
+// Copyright (c) 2017 Cisco and/or its affiliates.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at:
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rest
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ligato/cn-infra/config"
+	"github.com/ligato/cn-infra/core"
+	"github.com/ligato/cn-infra/logging"
+	"github.com/ligato/cn-infra/logging/logrus"
+	"github.com/namsral/flag"
+	. "github.com/onsi/gomega"
+)
+
+type nopServer struct{}
+
+func (nopServer) Close() error { return nil }
+
+func TestReload(t *testing.T) {
+	RegisterTestingT(t)
+
+	dir, err := ioutil.TempDir("", "rest")
+	Expect(err).ShouldNot(HaveOccurred())
+	defer os.RemoveAll(dir)
+	cfgFile := filepath.Join(dir, "reloadhttp.conf")
+	writeConfig := func(cfg string) {
+		Expect(ioutil.WriteFile(cfgFile, []byte(cfg), 0644)).To(Succeed())
+	}
+	writeConfig("ReadTimeout: 10\nclient-basic-auth: [\"admin:pass\"]\n")
+
+	if flag.Lookup(httpPortFlag("reloadhttp")) == nil {
+		DeclareHTTPPortFlag("reloadhttp")
+	}
+	Expect(flag.Set("reloadhttp-port", "9292")).To(Succeed())
+
+	var servers []Config
+	pluginCfg := config.ForPlugin("reloadhttp", cfgFile)
+	Expect(flag.Set("reloadhttp"+config.FlagSuffix, cfgFile)).To(Succeed()) // declared by a previous run
+	plugin := &Plugin{
+		Config: &Config{IdleTimeout: 5}, // set by the flavor
+		Deps: Deps{
+			Log:          logging.ForPlugin("reloadhttp", logrus.NewLogRegistry()),
+			PluginName:   "reloadhttp",
+			PluginConfig: pluginCfg,
+		},
+		listenAndServe: func(cfg Config, handler http.Handler) (io.Closer, error) {
+			servers = append(servers, cfg)
+			return nopServer{}, nil
+		},
+	}
+	agent := core.NewAgentDeprecated(logrus.DefaultLogger(), time.Second, &core.NamedPlugin{PluginName: "reloadhttp", Plugin: plugin})
+	Expect(agent.Start()).To(Succeed())
+	defer agent.Stop()
+	Expect(servers).Should(HaveLen(1))
+	Expect(servers[0].Endpoint).Should(Equal("0.0.0.0:9292"))
+	Expect(plugin.Authenticator).ShouldNot(BeNil())
+
+	// partial config file - the defaults of the flavor and the flag are kept,
+	// the server is restarted with the new timeout and the users are removed
+	writeConfig("ReadTimeout: 20\n")
+	Expect(agent.Reload()).To(Succeed())
+	Expect(servers).Should(HaveLen(2))
+	Expect(servers[1].Endpoint).Should(Equal("0.0.0.0:9292"))
+	Expect(servers[1].ReadTimeout).Should(Equal(time.Duration(20)))
+	Expect(servers[1].IdleTimeout).Should(Equal(time.Duration(5)))
+	Expect(plugin.Authenticator).Should(BeNil())
+
+	// the endpoint cannot be changed without restart
+	writeConfig("endpoint: 0.0.0.0:9393\nReadTimeout: 30\n")
+	Expect(agent.Reload()).ShouldNot(Succeed())
+	Expect(servers).Should(HaveLen(2))
+	Expect(plugin.GetPort()).Should(Equal(9292))
+	Expect(plugin.CurrentConfig().(*Config).ReadTimeout).Should(Equal(time.Duration(20)))
+}
+
+func TestPluginConfigDefaults(t *testing.T) {
+	RegisterTestingT(t)
+
+	// the default endpoint is set also without a config file
+	cfg := &Config{}
+	Expect(PluginConfig(nil, cfg, "defaulthttp")).To(Succeed())
+	Expect(cfg.Endpoint).Should(Equal(DefaultEndpoint))
+}
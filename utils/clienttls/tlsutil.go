@@ -24,11 +24,11 @@ import (
 
 // TLS stores the client side TLS settings
 type TLS struct {
-	Enabled    bool   `json:"enabled"`     // enable/disable TLS
-	SkipVerify bool   `json:"skip-verify"` // whether to skip verification of server name & certificate
-	Certfile   string `json:"cert-file"`   // client certificate
-	Keyfile    string `json:"key-file"`    // client private key
-	CAfile     string `json:"ca-file"`     // certificate authority
+	Enabled    bool   `json:"enabled"`                // enable/disable TLS
+	SkipVerify bool   `json:"skip-verify"`            // whether to skip verification of server name & certificate
+	Certfile   string `json:"cert-file"`              // client certificate
+	Keyfile    string `json:"key-file" secret:"true"` // client private key
+	CAfile     string `json:"ca-file"`                // certificate authority
 }
 
 // CreateTLSConfig used to generate the crypto/tls Config